@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/git"
+	"github.com/Jieay/git-watcher/internal/history"
+	"github.com/Jieay/git-watcher/internal/logging"
+	"github.com/Jieay/git-watcher/internal/webhook"
+)
+
+// planCheck plans one branch check or submodule update of a dry run
+type planCheck func(ctx context.Context) (*git.BranchResult, error)
+
+// handleDryRunTrigger answers a dry-run trigger with the plans of the branches or submodules
+// it selects. The checks run synchronously and are recorded as runs, but nothing is committed,
+// pushed or merged and no notification is sent.
+func handleDryRunTrigger(w http.ResponseWriter, r *http.Request, gitManager *git.Manager, historyStore *history.Store, payload *webhook.WebhookTriggerRequest) {
+	ctx := git.WithDryRun(r.Context())
+	if payload.Branch == "" && payload.Tag != "" {
+		http.Error(w, "Dry runs plan branch checks and submodule updates, tag checks cannot be planned", http.StatusBadRequest)
+		return
+	}
+
+	checks := make(map[*config.Repository][]planCheck)
+	repos := make([]*config.Repository, 0)
+	addCheck := func(repo *config.Repository, check planCheck) {
+		if _, ok := checks[repo]; !ok {
+			repos = append(repos, repo)
+		}
+		checks[repo] = append(checks[repo], check)
+	}
+
+	var urlRepos []*config.Repository
+	if payload.URL != "" && payload.Repository == "" {
+		if urlRepos = gitManager.RepositoriesForURL(payload.URL); len(urlRepos) == 0 {
+			targets := gitManager.SubmodulesForURL(payload.Branch, payload.Tag, payload.URL)
+			if len(targets) == 0 {
+				http.Error(w, fmt.Sprintf("No watched repository or submodule uses %s", payload.URL), http.StatusNotFound)
+				return
+			}
+			for _, target := range targets {
+				repo, err := gitManager.Repository(target.Repository)
+				if err != nil {
+					continue
+				}
+				target := target
+				addCheck(repo, func(ctx context.Context) (*git.BranchResult, error) {
+					ctx = logging.With(ctx, logging.KeyBranch, target.Branch, logging.KeySubmodule, target.Path)
+					return gitManager.UpdateSubmodule(ctx, target.Repository, target.Branch, target.Path)
+				})
+			}
+		}
+	}
+
+	if len(repos) == 0 {
+		var matched []*config.Repository
+		switch {
+		case len(urlRepos) > 0:
+			matched = urlRepos
+		case payload.Branch != "":
+			var err error
+			if matched, err = resolveTriggerRepositories(gitManager, payload.Repository, payload.Branch); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+		case payload.Repository != "":
+			repo, err := gitManager.Repository(payload.Repository)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			matched = []*config.Repository{repo}
+		default:
+			matched = gitManager.Repositories()
+		}
+		for _, repo := range matched {
+			branches := gitManager.GetConfig().BranchesFor(repo)
+			if payload.Branch != "" {
+				branches = []string{payload.Branch}
+			}
+			for _, branch := range branches {
+				repoName, branch := repo.GetName(), branch
+				addCheck(repo, func(ctx context.Context) (*git.BranchResult, error) {
+					return gitManager.CheckAndUpdateRepoBranch(logging.With(ctx, logging.KeyBranch, branch), repoName, branch)
+				})
+			}
+		}
+	}
+
+	runIDs := make([]uint64, 0, len(repos))
+	results := make([]*git.BranchResult, 0)
+	failed := false
+	for _, repo := range repos {
+		extendDeadlines(ctx, w, gitManager)
+		run := history.NewRun(history.TriggerWebhook, repo.GetName())
+		run.DryRun = true
+		if err := historyStore.Begin(run); err != nil {
+			logging.FromContext(ctx).Warn("failed to record run", logging.KeyRepository, repo.GetName(), "error", err)
+		}
+		runCtx := logging.With(ctx, logging.KeyRunID, run.ID, logging.KeyRepository, repo.GetName())
+		logger := logging.FromContext(runCtx)
+		logger.Info("dry run started", "trigger", run.Trigger)
+		for _, check := range checks[repo] {
+			result, err := check(runCtx)
+			run.AddBranch(result)
+			results = append(results, result)
+			if err != nil {
+				logger.Error("failed to plan branch", logging.KeyBranch, result.Branch, "error", err)
+				failed = true
+			}
+		}
+		run.Finish(nil)
+		if err := historyStore.Save(run); err != nil {
+			logger.Warn("failed to save run", "error", err)
+		}
+		logger.Info("dry run finished", "status", run.Status)
+		runIDs = append(runIDs, run.ID)
+	}
+
+	status, code := "planned", http.StatusOK
+	if failed {
+		status, code = "failed", http.StatusInternalServerError
+	}
+	writeJSON(w, code, map[string]interface{}{
+		"status":   status,
+		"dryRun":   true,
+		"runIds":   runIDs,
+		"branches": results,
+	})
+}
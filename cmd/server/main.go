@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,6 +17,9 @@ import (
 
 	config "github.com/Jieay/git-watcher/configs"
 	"github.com/Jieay/git-watcher/internal/git"
+	"github.com/Jieay/git-watcher/internal/history"
+	"github.com/Jieay/git-watcher/internal/logging"
+	"github.com/Jieay/git-watcher/internal/metrics"
 	"github.com/Jieay/git-watcher/internal/scheduler"
 	"github.com/Jieay/git-watcher/internal/webhook"
 )
@@ -24,7 +29,7 @@ var (
 )
 
 // handleArtifactsWebhook handles the artifacts webhook
-func handleArtifactsWebhook(gitManager *git.Manager) http.HandlerFunc {
+func handleArtifactsWebhook(webhookClient *webhook.Client, gitManager *git.Manager, historyStore *history.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -33,22 +38,11 @@ func handleArtifactsWebhook(gitManager *git.Manager) http.HandlerFunc {
 
 		// Read and parse the request body
 		var payload struct {
-			Artifact struct {
-				UserId              int64   `json:"userId"`
-				UserName            string  `json:"userName"`
-				ProjectId           int64   `json:"projectId"`
-				ProjectName         string  `json:"projectName"`
-				TeamId              int64   `json:"teamId"`
-				Action              string  `json:"action"`
-				ArtifactType        string  `json:"artifactType"`
-				ArtifactRepoId      int64   `json:"artifactRepoId"`
-				ArtifactRepoName    string  `json:"artifactRepoName"`
-				ArtifactPkgId       int64   `json:"artifactPkgId"`
-				ArtifactPkgName     string  `json:"artifactPkgName"`
-				ArtifactVersionId   int64   `json:"artifactVersionId"`
-				ArtifactVersionName string  `json:"artifactVersionName"`
-				Size                float64 `json:"size"`
-			} `json:"artifact"`
+			Artifact git.Artifact `json:"artifact"`
+			DryRun   bool         `json:"dryRun"` // Only plan the update
+			Force    bool         `json:"force"`  // Write the version even when it is older than the recorded one
+			// Environment written to, the first configured environment by default
+			Environment string `json:"environment"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
@@ -61,14 +55,54 @@ func handleArtifactsWebhook(gitManager *git.Manager) http.HandlerFunc {
 			http.Error(w, "Missing required fields", http.StatusBadRequest)
 			return
 		}
+		if payload.Environment != "" {
+			artifactsRepo := gitManager.GetConfig().ArtifactsRepo
+			if artifactsRepo == nil {
+				http.Error(w, "No artifacts repository is configured", http.StatusBadRequest)
+				return
+			}
+			if _, err := artifactsRepo.EnvironmentFor(payload.Environment); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
 
-		// Update the artifacts repository
-		if err := gitManager.UpdateArtifactsRepo(
-			payload.Artifact.ArtifactRepoName,
-			payload.Artifact.ArtifactPkgName,
-			payload.Artifact.ArtifactVersionName,
-		); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to update artifacts: %v", err), http.StatusInternalServerError)
+		// Update the artifacts repository and record the run
+		extendDeadlines(r.Context(), w, gitManager)
+		run := history.NewRun(history.TriggerArtifacts, "")
+		run.DryRun = payload.DryRun || r.URL.Query().Get("dryRun") == "true" || gitManager.IsDryRun(r.Context())
+		if err := historyStore.Begin(run); err != nil {
+			logging.FromContext(r.Context()).Warn("failed to record artifacts run", "error", err)
+		}
+		ctx := logging.With(r.Context(), logging.KeyRunID, run.ID, logging.KeyRepository, payload.Artifact.ArtifactRepoName)
+		if run.DryRun {
+			ctx = git.WithDryRun(ctx)
+		}
+		logger := logging.FromContext(ctx)
+		logger.Info("artifacts update received",
+			"package", payload.Artifact.ArtifactPkgName,
+			"version", payload.Artifact.ArtifactVersionName,
+			"user", payload.Artifact.UserName)
+		force := payload.Force || r.URL.Query().Get("force") == "true"
+		result, err := gitManager.UpdateArtifactsRepo(ctx, payload.Artifact, git.ArtifactsOptions{
+			Force:       force,
+			Environment: payload.Environment,
+		})
+		run.Artifacts = result
+		run.Finish(err)
+		if saveErr := historyStore.Save(run); saveErr != nil {
+			logger.Warn("failed to save run", "error", saveErr)
+		}
+		if result.Conflict != nil {
+			notifyArtifactsConflict(ctx, webhookClient, result)
+		}
+		if err != nil {
+			logger.Error("failed to update artifacts", "error", err)
+			status := http.StatusInternalServerError
+			if errors.Is(err, git.ErrArtifactsConflict) || errors.Is(err, git.ErrArtifactsDowngrade) {
+				status = http.StatusConflict
+			}
+			http.Error(w, fmt.Sprintf("Failed to update artifacts: %v", err), status)
 			return
 		}
 
@@ -76,6 +110,7 @@ func handleArtifactsWebhook(gitManager *git.Manager) http.HandlerFunc {
 		response := map[string]interface{}{
 			"status":  "success",
 			"message": fmt.Sprintf("Successfully updated artifacts for %s", payload.Artifact.ArtifactRepoName),
+			"runId":   run.ID,
 			"details": map[string]interface{}{
 				"userId":              payload.Artifact.UserId,
 				"userName":            payload.Artifact.UserName,
@@ -93,6 +128,20 @@ func handleArtifactsWebhook(gitManager *git.Manager) http.HandlerFunc {
 				"size":                payload.Artifact.Size,
 			},
 		}
+		if result.Push != nil && result.Push.PullRequest != nil {
+			response["pullRequest"] = result.Push.PullRequest
+		}
+		if result.Conflict != nil {
+			response["conflict"] = result.Conflict
+			if result.Conflict.PullRequest != nil {
+				response["message"] = fmt.Sprintf("Opened pull request %s to resolve the conflict of %s", result.Conflict.PullRequest.URL, payload.Artifact.ArtifactRepoName)
+			}
+		}
+		if run.DryRun {
+			response["message"] = fmt.Sprintf("Planned artifacts update for %s", payload.Artifact.ArtifactRepoName)
+			response["dryRun"] = true
+			response["plan"] = result.Plan
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -100,13 +149,133 @@ func handleArtifactsWebhook(gitManager *git.Manager) http.HandlerFunc {
 	}
 }
 
+// notifyArtifactsConflict sends an artifacts_conflict notification for an artifacts update whose
+// feature branch conflicted with the target branch
+func notifyArtifactsConflict(ctx context.Context, webhookClient *webhook.Client, result *git.ArtifactsResult) {
+	conflict := &webhook.ArtifactsConflict{
+		Package:       result.Package,
+		Version:       result.Version,
+		FeatureBranch: result.FeatureBranch,
+		TargetBranch:  result.TargetBranch,
+		Strategy:      result.Conflict.Strategy,
+		Files:         result.Conflict.Files,
+		Resolved:      result.Conflict.Resolved,
+		Error:         result.Error,
+	}
+	if result.Conflict.PullRequest != nil {
+		conflict.PullRequest = result.Conflict.PullRequest.URL
+	}
+	message := fmt.Sprintf("Artifacts update of %s %s conflicts with %s, resolved with %s", result.Package, result.Version, result.TargetBranch, conflict.Strategy)
+	if !conflict.Resolved {
+		message = fmt.Sprintf("Artifacts update of %s %s conflicts with %s and was not merged", result.Package, result.Version, result.TargetBranch)
+	}
+	payload := webhook.WebhookPayload{
+		Event:      "artifacts_conflict",
+		Timestamp:  time.Now(),
+		Repository: result.Repository,
+		Branch:     result.TargetBranch,
+		Message:    message,
+		Conflict:   conflict,
+	}
+	webhookClient.Notify(ctx, payload)
+}
+
+// resolveTriggerRepositories returns the watched repositories a trigger for the given branch applies to.
+// With no repository name, every repository tracking the branch is selected; a single
+// watched repository accepts any branch as before.
+func resolveTriggerRepositories(gitManager *git.Manager, repoName, branch string) ([]*config.Repository, error) {
+	if repoName != "" {
+		repo, err := gitManager.Repository(repoName)
+		if err != nil {
+			return nil, err
+		}
+		return []*config.Repository{repo}, nil
+	}
+
+	repos := gitManager.Repositories()
+	if len(repos) == 1 {
+		return repos, nil
+	}
+
+	matched := make([]*config.Repository, 0, len(repos))
+	for _, repo := range repos {
+		for _, b := range gitManager.GetConfig().BranchesFor(repo) {
+			if b == branch {
+				matched = append(matched, repo)
+				break
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no watched repository tracks branch %s", branch)
+	}
+	return matched, nil
+}
+
+// resolveTagRepositories returns the repositories whose tags a trigger checks: the named
+// repository, or every watched repository with tag patterns when repoName is empty
+func resolveTagRepositories(gitManager *git.Manager, repoName string) ([]*config.Repository, error) {
+	repos := gitManager.Repositories()
+	if repoName != "" {
+		repo, err := gitManager.Repository(repoName)
+		if err != nil {
+			return nil, err
+		}
+		repos = []*config.Repository{repo}
+	}
+
+	matched := make([]*config.Repository, 0, len(repos))
+	for _, repo := range repos {
+		if len(repo.Tags) > 0 {
+			matched = append(matched, repo)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no watched repository has tag patterns configured")
+	}
+	return matched, nil
+}
+
+// extendDeadlines lets a handler running git operations respond after the server read and
+// write timeouts, which would otherwise cancel the request and drop the response. The
+// deadline leaves room for a clone, a fetch and two pushes.
+func extendDeadlines(ctx context.Context, w http.ResponseWriter, gitManager *git.Manager) {
+	timeouts := gitManager.GetConfig().Timeouts
+	deadline := time.Now().Add(timeouts.CloneTimeout() + timeouts.FetchTimeout() + 2*timeouts.PushTimeout())
+	controller := http.NewResponseController(w)
+	if err := errors.Join(controller.SetReadDeadline(deadline), controller.SetWriteDeadline(deadline)); err != nil {
+		logging.FromContext(ctx).Warn("failed to extend request deadlines", "error", err)
+	}
+}
+
+// resolveURLRepositories resolves each repository using a pushed remote URL with resolve,
+// keeping every repository it accepts; it fails with the first error when it accepts none
+func resolveURLRepositories(urlRepos []*config.Repository, resolve func(repoName string) ([]*config.Repository, error)) ([]*config.Repository, error) {
+	var firstErr error
+	matched := make([]*config.Repository, 0, len(urlRepos))
+	for _, repo := range urlRepos {
+		repos, err := resolve(repo.GetName())
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		matched = append(matched, repos...)
+	}
+	if len(matched) == 0 {
+		return nil, firstErr
+	}
+	return matched, nil
+}
+
 func main() {
 	flag.Parse()
 
 	// Load configuration
 	cfg, err := config.LoadConfig(*configFile)
 	if err != nil {
-		log.Printf("Warning: Failed to load configuration file: %v", err)
+		slog.Warn("failed to load configuration file", "error", err)
 		// 如果配置文件加载失败，使用默认配置
 		cfg = &config.Config{
 			Server: config.ServerConfig{
@@ -129,27 +298,65 @@ func main() {
 	// 确保环境变量覆盖配置文件
 	config.OverrideWithEnv(cfg)
 
+	// Initialize the logger; every package logs through the default logger or the one carried by a context
+	logger, err := logging.New(cfg.Log)
+	if err != nil {
+		slog.Error("failed to initialize logger", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
 	// Initialize Git manager
 	gitManager, err := git.NewManager(&cfg.Git)
 	if err != nil {
-		log.Fatalf("Failed to initialize Git manager: %v", err)
+		slog.Error("failed to initialize Git manager", "error", err)
+		os.Exit(1)
 	}
 
-	// Initialize webhook client
-	webhookClient := webhook.NewClient(&cfg.Webhook)
+	// Open the run history
+	historyStore, err := history.Open(cfg.HistoryPath(), cfg.History.MaxRuns)
+	if err != nil {
+		slog.Error("failed to open run history", "error", err)
+		os.Exit(1)
+	}
+	defer historyStore.Close()
+
+	// Keep the submodule holds of rollbacks in the run history
+	if err := gitManager.UseHoldStore(historyStore); err != nil {
+		slog.Error("failed to load submodule holds", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize webhook client with the outbox of failed notifications
+	outbox, err := webhook.OpenOutbox(cfg.OutboxPath())
+	if err != nil {
+		slog.Error("failed to open webhook outbox", "error", err)
+		os.Exit(1)
+	}
+	defer outbox.Close()
+	webhookClient := webhook.NewClient(&cfg.Webhook, outbox)
 
 	// Initialize scheduler
-	sched := scheduler.NewScheduler(&cfg.Schedule, gitManager, webhookClient)
+	sched := scheduler.NewScheduler(&cfg.Schedule, gitManager, webhookClient, historyStore)
 
-	// Create a context that we can cancel
+	// Create a context that we can cancel; it aborts scheduled checks and
+	// in-flight request handlers, including their git operations, on shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Start the scheduler
 	if err := sched.Start(ctx); err != nil {
-		log.Fatalf("Failed to start scheduler: %v", err)
+		slog.Error("failed to start scheduler", "error", err)
+		os.Exit(1)
 	}
 
+	// Redeliver failed notifications in the background
+	outboxDone := make(chan struct{})
+	go func() {
+		defer close(outboxDone)
+		webhookClient.RunOutbox(ctx)
+	}()
+
 	// Set up HTTP server
 	mux := http.NewServeMux()
 
@@ -172,58 +379,137 @@ func main() {
 			return
 		}
 
-		// 打印接收到的所有字段信息
-		log.Printf("=== Webhook Trigger Received ===")
-		log.Printf("Event: %s", payload.Event)
-		log.Printf("Branch: %s", payload.Branch)
-		log.Printf("Reference: %s", payload.Reference)
-		log.Printf("Ref: %s", payload.Ref)
-		log.Printf("===============================")
-
-		logMsg := "Received webhook trigger -"
-		logMsg += fmt.Sprintf(" Event: %s,", payload.Event)
-
-		if payload.Branch != "" {
-			logMsg += fmt.Sprintf(" Branch: %s,", payload.Branch)
+		// 记录接收到的所有字段信息
+		slog.Info("webhook trigger received",
+			"event", payload.Event,
+			logging.KeyRepository, payload.Repository,
+			logging.KeyBranch, payload.Branch,
+			"tag", payload.Tag,
+			"url", payload.URL,
+			"reference", payload.Reference,
+			"ref", payload.Ref)
+
+		// A dry run returns the plan of the checks instead of running them in the background
+		if payload.DryRun || gitManager.IsDryRun(r.Context()) {
+			handleDryRunTrigger(w, r, gitManager, historyStore, &payload)
+			return
 		}
-		if payload.Reference != "" {
-			logMsg += fmt.Sprintf(" Reference: %s,", payload.Reference)
+
+		// A remote URL selects the watched repositories using it or, failing that, the submodules using it
+		var urlRepos []*config.Repository
+		if payload.URL != "" && payload.Repository == "" {
+			if urlRepos = gitManager.RepositoriesForURL(payload.URL); len(urlRepos) == 0 {
+				targets := gitManager.SubmodulesForURL(payload.Branch, payload.Tag, payload.URL)
+				if len(targets) == 0 {
+					http.Error(w, fmt.Sprintf("No watched repository or submodule uses %s", payload.URL), http.StatusNotFound)
+					return
+				}
+				if err := sched.TriggerSubmoduleUpdate(targets, history.TriggerWebhook); err != nil {
+					http.Error(w, fmt.Sprintf("Failed to trigger submodule update: %v", err), http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintf(w, "Update of %d submodules using %s triggered", len(targets), payload.URL)
+				return
+			}
 		}
-		if payload.Ref != "" {
-			logMsg += fmt.Sprintf(" Ref: %s,", payload.Ref)
+
+		// A tag reference checks the tags of the repository instead of its branches
+		if payload.Branch == "" && payload.Tag != "" {
+			repos, err := resolveTagRepositories(gitManager, payload.Repository)
+			if len(urlRepos) > 0 {
+				repos, err = resolveURLRepositories(urlRepos, func(name string) ([]*config.Repository, error) {
+					return resolveTagRepositories(gitManager, name)
+				})
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			names := make([]string, 0, len(repos))
+			for _, repo := range repos {
+				if err := sched.TriggerTagCheck(repo.GetName()); err != nil {
+					http.Error(w, fmt.Sprintf("Failed to trigger tag check: %v", err), http.StatusInternalServerError)
+					return
+				}
+				names = append(names, repo.GetName())
+			}
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, "Tag check of %v triggered", names)
+			return
 		}
-		// Trim trailing comma if exists
-		logMsg = strings.TrimSuffix(logMsg, ",")
-		log.Print(logMsg)
 
 		// If a specific branch is provided, check only that branch
 		if payload.Branch != "" {
-			if err := gitManager.CheckAndUpdateRepoBranch(payload.Branch); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to update branch %s: %v", payload.Branch, err), http.StatusInternalServerError)
-				return
+			repos, err := resolveTriggerRepositories(gitManager, payload.Repository, payload.Branch)
+			if len(urlRepos) > 0 {
+				repos, err = resolveURLRepositories(urlRepos, func(name string) ([]*config.Repository, error) {
+					return resolveTriggerRepositories(gitManager, name, payload.Branch)
+				})
 			}
-
-			// Create webhook payload for notification
-			mainRepoHash, _ := gitManager.GetLastCommitHash(gitManager.GetConfig().MainRepo)
-			repoUpdates := make(map[string]webhook.RepoUpdate)
-			repoUpdates["main"] = webhook.RepoUpdate{
-				Repository: gitManager.GetConfig().MainRepo.GetURL(),
-				Branch:     payload.Branch,
-				Timestamp:  time.Now(),
-				CommitHash: mainRepoHash,
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
 			}
 
-			notifyPayload := webhook.WebhookPayload{
-				Event:       "repository_update",
-				Timestamp:   time.Now(),
-				Branch:      payload.Branch,
-				Message:     fmt.Sprintf("Repository branch %s and submodules update completed", payload.Branch),
-				RepoUpdates: repoUpdates,
+			// Every repository is checked, a failure is reported after the others ran
+			var failures []string
+			for _, repo := range repos {
+				extendDeadlines(r.Context(), w, gitManager)
+				run := history.NewRun(history.TriggerWebhook, repo.GetName())
+				if err := historyStore.Begin(run); err != nil {
+					slog.Warn("failed to record run", logging.KeyRepository, repo.GetName(), "error", err)
+				}
+				ctx := logging.With(r.Context(),
+					logging.KeyRunID, run.ID,
+					logging.KeyRepository, repo.GetName(),
+					logging.KeyBranch, payload.Branch)
+				logger := logging.FromContext(ctx)
+				logger.Info("run started", "trigger", run.Trigger)
+				result, err := gitManager.CheckAndUpdateRepoBranch(ctx, repo.GetName(), payload.Branch)
+				run.AddBranch(result)
+				run.Finish(nil)
+				if saveErr := historyStore.Save(run); saveErr != nil {
+					logger.Warn("failed to save run", "error", saveErr)
+				}
+				logger.Info("run finished", "status", run.Status)
+				if err != nil {
+					logger.Error("failed to check/update branch", "error", err)
+					failures = append(failures, fmt.Sprintf("repository %s branch %s: %v", repo.GetName(), payload.Branch, err))
+					continue
+				}
+
+				// Create webhook payload for notification
+				mainRepoHash, _ := gitManager.GetBranchCommitHash(ctx, repo, payload.Branch)
+				repoUpdates := make(map[string]webhook.RepoUpdate)
+				repoUpdates[repo.GetName()] = webhook.RepoUpdate{
+					Repository: repo.GetURL(),
+					Branch:     payload.Branch,
+					Timestamp:  time.Now(),
+					CommitHash: mainRepoHash,
+				}
+
+				notifyPayload := webhook.WebhookPayload{
+					Event:       "repository_update",
+					Timestamp:   time.Now(),
+					Repository:  repo.GetName(),
+					Branch:      payload.Branch,
+					Message:     fmt.Sprintf("Repository %s branch %s and submodules update completed", repo.GetName(), payload.Branch),
+					RepoUpdates: repoUpdates,
+				}
+
+				// Send webhook notification
+				webhookClient.Notify(ctx, notifyPayload)
 			}
 
-			// Send webhook notification
-			if err := webhookClient.SendNotification(notifyPayload); err != nil {
-				log.Printf("Error sending webhook notification: %v", err)
+			// Some repositories were updated when only part of them failed
+			if len(failures) > 0 {
+				status := http.StatusInternalServerError
+				if len(failures) < len(repos) {
+					status = http.StatusMultiStatus
+				}
+				http.Error(w, fmt.Sprintf("Failed to update %d of %d repositories: %s", len(failures), len(repos), strings.Join(failures, "; ")), status)
+				return
 			}
 
 			w.WriteHeader(http.StatusOK)
@@ -232,29 +518,63 @@ func main() {
 		}
 
 		// If no branch specified, trigger check for all branches
-		if err := sched.TriggerManualCheck(); err != nil {
+		if len(urlRepos) > 0 {
+			names := make([]string, 0, len(urlRepos))
+			for _, repo := range urlRepos {
+				if err := sched.TriggerManualCheck(repo.GetName()); err != nil {
+					http.Error(w, fmt.Sprintf("Failed to trigger check: %v", err), http.StatusInternalServerError)
+					return
+				}
+				names = append(names, repo.GetName())
+			}
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, "Manual check for all branches of %v triggered", names)
+			return
+		}
+		if err := sched.TriggerManualCheck(payload.Repository); err != nil {
 			http.Error(w, fmt.Sprintf("Failed to trigger check: %v", err), http.StatusInternalServerError)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
+		if payload.Repository != "" {
+			fmt.Fprintf(w, "Manual check for all branches of %s triggered", payload.Repository)
+			return
+		}
 		fmt.Fprintf(w, "Manual check for all branches triggered")
 	})
 
-	// Status endpoint
-	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
-		isRunning := sched.IsRunning()
-		status := "running"
-		if !isRunning {
-			status = "stopped"
-		}
+	// Hosting service webhook endpoints
+	mux.HandleFunc("/webhook/github", handleGitHubWebhook(webhookClient, gitManager, sched))
+	mux.HandleFunc("/webhook/gitlab", handleGitLabWebhook(webhookClient, gitManager, sched))
+	mux.HandleFunc("/webhook/gitea", handleGiteaWebhook(webhookClient, gitManager, sched))
 
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "Scheduler status: %s", status)
-	})
+	// Status endpoint
+	mux.HandleFunc("/status", handleStatus(sched, gitManager, webhookClient))
 
 	// Add the new artifacts webhook route
-	mux.HandleFunc("/webhook/artifacts", handleArtifactsWebhook(gitManager))
+	mux.HandleFunc("/webhook/artifacts", handleArtifactsWebhook(webhookClient, gitManager, historyStore))
+
+	// Run history endpoints
+	mux.HandleFunc("/runs", handleListRuns(historyStore))
+	mux.HandleFunc("/runs/", handleGetRun(historyStore))
+
+	// Environment promotion endpoints
+	mux.HandleFunc("/promote", handlePromote(webhookClient, gitManager, historyStore))
+	mux.HandleFunc("/promotions", handleListPromotions(historyStore))
+	mux.HandleFunc("/promotions/", handlePromotion(webhookClient, gitManager, historyStore))
+
+	// Rollback endpoints
+	mux.HandleFunc("/rollback/artifacts", handleArtifactsRollback(webhookClient, gitManager, historyStore))
+	mux.HandleFunc("/rollback/submodules", handleSubmodulesRollback(webhookClient, gitManager, historyStore))
+	mux.HandleFunc("/rollback/submodules/release", handleSubmodulesRelease(gitManager))
+
+	// Webhook outbox endpoints
+	mux.HandleFunc("/webhook/outbox", handleListOutbox(webhookClient))
+	mux.HandleFunc("/webhook/outbox/", handleRedeliver(webhookClient))
+
+	// Prometheus metrics endpoint
+	mux.Handle("/metrics", metrics.Handler())
 
 	// Create HTTP server
 	server := &http.Server{
@@ -263,13 +583,17 @@ func main() {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
 	}
 
 	// Start HTTP server in a goroutine
 	go func() {
-		log.Printf("Starting server on port %d", cfg.Server.Port)
+		slog.Info("starting server", "port", cfg.Server.Port)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+			slog.Error("failed to start server", "error", err)
+			os.Exit(1)
 		}
 	}()
 
@@ -279,19 +603,30 @@ func main() {
 
 	// Wait for termination signal
 	<-sigChan
-	log.Println("Shutting down server...")
+	slog.Info("shutting down server")
 
 	// Create a deadline to wait for
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 
-	// Stop the scheduler
-	sched.Stop()
+	// Abort running git operations, then stop the scheduler
+	cancel()
+	if err := sched.Stop(shutdownCtx); err != nil {
+		slog.Error("scheduler stop failed", "error", err)
+	}
+	select {
+	case <-outboxDone:
+	case <-shutdownCtx.Done():
+	}
 
 	// Shutdown the server
 	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Fatalf("Server shutdown failed: %v", err)
+		slog.Error("server shutdown failed", "error", err)
+		os.Exit(1)
 	}
 
-	log.Println("Server gracefully stopped")
+	// Wait for the notifications of the handled requests; unsent ones stay in the outbox
+	webhookClient.Shutdown(shutdownCtx)
+
+	slog.Info("server gracefully stopped")
 }
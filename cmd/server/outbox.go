@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Jieay/git-watcher/internal/webhook"
+)
+
+// handleListOutbox handles GET /webhook/outbox, listing notifications whose delivery failed
+func handleListOutbox(webhookClient *webhook.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		entries, err := webhookClient.FailedDeliveries()
+		if err != nil {
+			http.Error(w, "Failed to list outbox: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"deliveries": entries})
+	}
+}
+
+// handleRedeliver handles POST /webhook/outbox/{id}/redeliver, sending a failed notification again
+func handleRedeliver(webhookClient *webhook.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, "/webhook/outbox/")
+		idPart, ok := strings.CutSuffix(path, "/redeliver")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		id, err := strconv.ParseUint(idPart, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid outbox id", http.StatusBadRequest)
+			return
+		}
+
+		err = webhookClient.Redeliver(r.Context(), id)
+		if errors.Is(err, webhook.ErrDeliveryNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Redelivery failed: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "delivered", "id": id})
+	}
+}
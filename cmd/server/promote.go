@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jieay/git-watcher/internal/git"
+	"github.com/Jieay/git-watcher/internal/history"
+	"github.com/Jieay/git-watcher/internal/logging"
+	"github.com/Jieay/git-watcher/internal/webhook"
+)
+
+// errNotApprover is returned when a user may not approve promotions to an environment
+var errNotApprover = errors.New("user may not approve promotions to this environment")
+
+// promoteRequest is the body of POST /promote
+type promoteRequest struct {
+	Artifact git.Artifact `json:"artifact"` // Artifact whose version is promoted
+	From     string       `json:"from"`     // Environment recording the version
+	To       string       `json:"to"`       // Environment following from, optional
+	User     string       `json:"user"`     // Requester, artifact.userName by default
+	Comment  string       `json:"comment"`
+	Force    bool         `json:"force"` // Replace a newer version of the target environment
+}
+
+// decisionRequest is the body of POST /promotions/{id}/approve and /promotions/{id}/reject
+type decisionRequest struct {
+	User    string `json:"user"`
+	Comment string `json:"comment"`
+}
+
+// handlePromote handles POST /promote, promoting a package version from an environment of the
+// artifacts repository to the next one. Promotions to environments requiring approval are
+// recorded as pending until approved with POST /promotions/{id}/approve.
+func handlePromote(webhookClient *webhook.Client, gitManager *git.Manager, historyStore *history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req promoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Artifact.ArtifactRepoName == "" || req.Artifact.ArtifactPkgName == "" || req.Artifact.ArtifactVersionName == "" || req.From == "" {
+			http.Error(w, "Missing required fields", http.StatusBadRequest)
+			return
+		}
+		artifactsRepo := gitManager.GetConfig().ArtifactsRepo
+		if artifactsRepo == nil || len(artifactsRepo.Environments) == 0 {
+			http.Error(w, "No environments are configured for the artifacts repository", http.StatusBadRequest)
+			return
+		}
+		if _, err := artifactsRepo.EnvironmentFor(req.From); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		to := artifactsRepo.NextEnvironment(req.From)
+		if to == nil {
+			http.Error(w, fmt.Sprintf("Environment %s is the last environment", req.From), http.StatusBadRequest)
+			return
+		}
+		if req.To != "" && req.To != to.Name {
+			http.Error(w, fmt.Sprintf("Versions of %s are promoted to %s", req.From, to.Name), http.StatusBadRequest)
+			return
+		}
+
+		status := history.PromotionRunning
+		if to.Approval {
+			status = history.PromotionPending
+		}
+		promotion := history.NewPromotion(req.Artifact, req.From, to.Name, status)
+		promotion.RequestedBy = req.User
+		if promotion.RequestedBy == "" {
+			promotion.RequestedBy = req.Artifact.UserName
+		}
+		promotion.Comment = req.Comment
+		promotion.Force = req.Force
+		if err := historyStore.CreatePromotion(promotion); err != nil {
+			http.Error(w, "Failed to record promotion: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ctx := logging.With(r.Context(), logging.KeyRepository, promotion.Repository)
+		logging.FromContext(ctx).Info("promotion requested", "promotion", promotion.ID, "package", promotion.Package,
+			"version", promotion.Version, "from", promotion.From, "to", promotion.To, "user", promotion.RequestedBy)
+		if promotion.Status == history.PromotionPending {
+			notifyPromotion(ctx, webhookClient, gitManager, promotion, nil)
+			writeJSON(w, http.StatusAccepted, map[string]interface{}{
+				"status":    "pending",
+				"message":   fmt.Sprintf("Promotion of %s to %s is waiting for approval", promotion.Version, promotion.To),
+				"promotion": promotion,
+			})
+			return
+		}
+		runPromotion(ctx, w, webhookClient, gitManager, historyStore, promotion)
+	}
+}
+
+// handleListPromotions handles GET /promotions. Query parameters repository, package and
+// status filter the promotions and limit bounds their number, newest first.
+func handleListPromotions(historyStore *history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := history.PromotionFilter{
+			Repository: query.Get("repository"),
+			Package:    query.Get("package"),
+			Status:     history.PromotionStatus(query.Get("status")),
+			Limit:      defaultRunsLimit,
+		}
+		if limit := query.Get("limit"); limit != "" {
+			value, err := strconv.Atoi(limit)
+			if err != nil || value <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			filter.Limit = value
+		}
+
+		promotions, err := historyStore.ListPromotions(filter)
+		if err != nil {
+			http.Error(w, "Failed to list promotions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"promotions": promotions})
+	}
+}
+
+// handlePromotion handles GET /promotions/{id} and POST /promotions/{id}/approve and
+// /promotions/{id}/reject
+func handlePromotion(webhookClient *webhook.Client, gitManager *git.Manager, historyStore *history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idPart, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/promotions/"), "/")
+		id, err := strconv.ParseUint(idPart, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid promotion id", http.StatusBadRequest)
+			return
+		}
+
+		switch action {
+		case "":
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			promotion, err := historyStore.GetPromotion(id)
+			if errors.Is(err, history.ErrPromotionNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to get promotion: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, promotion)
+			return
+		case "approve", "reject":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req decisionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.User == "" {
+			http.Error(w, "Missing required fields", http.StatusBadRequest)
+			return
+		}
+
+		artifactsRepo := gitManager.GetConfig().ArtifactsRepo
+		promotion, err := historyStore.DecidePromotion(id, func(p *history.Promotion) error {
+			if artifactsRepo == nil {
+				return fmt.Errorf("no artifacts repository is configured")
+			}
+			env, err := artifactsRepo.EnvironmentFor(p.To)
+			if err != nil {
+				return err
+			}
+			if !env.CanApprove(req.User) {
+				return fmt.Errorf("%w: %s", errNotApprover, req.User)
+			}
+			now := time.Now()
+			p.DecidedBy, p.DecidedAt, p.Reason = req.User, &now, req.Comment
+			p.Status = history.PromotionRunning
+			if action == "reject" {
+				p.Status = history.PromotionRejected
+				p.FinishedAt = &now
+			}
+			return nil
+		})
+		switch {
+		case errors.Is(err, history.ErrPromotionNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, history.ErrPromotionDecided):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case errors.Is(err, errNotApprover):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			http.Error(w, "Failed to decide promotion: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ctx := logging.With(r.Context(), logging.KeyRepository, promotion.Repository)
+		logging.FromContext(ctx).Info("promotion "+action+"d", "promotion", promotion.ID, "user", req.User)
+		if promotion.Status == history.PromotionRejected {
+			notifyPromotion(ctx, webhookClient, gitManager, promotion, nil)
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"status":    "rejected",
+				"message":   fmt.Sprintf("Promotion of %s to %s was rejected", promotion.Version, promotion.To),
+				"promotion": promotion,
+			})
+			return
+		}
+		runPromotion(ctx, w, webhookClient, gitManager, historyStore, promotion)
+	}
+}
+
+// runPromotion writes the version of an approved promotion to its target environment,
+// records the run and the outcome, notifies the subscribers and writes the response. A dry
+// run answers with the plan and leaves the promotion pending without notifying.
+func runPromotion(ctx context.Context, w http.ResponseWriter, webhookClient *webhook.Client, gitManager *git.Manager, historyStore *history.Store, promotion *history.Promotion) {
+	extendDeadlines(ctx, w, gitManager)
+	run := history.NewRun(history.TriggerPromote, "")
+	run.DryRun = gitManager.IsDryRun(ctx)
+	if err := historyStore.Begin(run); err != nil {
+		logging.FromContext(ctx).Warn("failed to record promotion run", "error", err)
+	}
+	ctx = logging.With(ctx, logging.KeyRunID, run.ID)
+	logger := logging.FromContext(ctx)
+
+	result, err := gitManager.UpdateArtifactsRepo(ctx, promotion.Artifact, git.ArtifactsOptions{
+		Force:       promotion.Force,
+		Environment: promotion.To,
+		PromoteFrom: promotion.From,
+	})
+	run.Artifacts = result
+	run.Finish(err)
+	if saveErr := historyStore.Save(run); saveErr != nil {
+		logger.Warn("failed to save run", "error", saveErr)
+	}
+	promotion.RunID = run.ID
+	promotion.Finish(result, err)
+	if saveErr := historyStore.SavePromotion(promotion); saveErr != nil {
+		logger.Warn("failed to save promotion", "error", saveErr)
+	}
+	if result.Conflict != nil {
+		notifyArtifactsConflict(ctx, webhookClient, result)
+	}
+	if err == nil && result.Plan != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status":    "success",
+			"message":   fmt.Sprintf("Planned promotion of %s from %s to %s", promotion.Version, promotion.From, promotion.To),
+			"runId":     run.ID,
+			"dryRun":    true,
+			"plan":      result.Plan,
+			"promotion": promotion,
+		})
+		return
+	}
+	notifyPromotion(ctx, webhookClient, gitManager, promotion, result)
+
+	if err != nil {
+		logger.Error("failed to promote artifacts", "error", err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, git.ErrArtifactsConflict) || errors.Is(err, git.ErrArtifactsDowngrade) || errors.Is(err, git.ErrNotInEnvironment) {
+			status = http.StatusConflict
+		}
+		http.Error(w, fmt.Sprintf("Failed to promote artifacts: %v", err), status)
+		return
+	}
+	response := map[string]interface{}{
+		"status":    "success",
+		"message":   fmt.Sprintf("Promoted %s from %s to %s", promotion.Version, promotion.From, promotion.To),
+		"runId":     run.ID,
+		"promotion": promotion,
+	}
+	if result.Push != nil && result.Push.PullRequest != nil {
+		response["pullRequest"] = result.Push.PullRequest
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// notifyPromotion sends the notification of a promotion: promotion_pending when it waits for
+// approval, promotion_rejected, artifacts_promoted or promotion_failed. result is the update
+// of the target environment, nil when the promotion did not run.
+func notifyPromotion(ctx context.Context, webhookClient *webhook.Client, gitManager *git.Manager, promotion *history.Promotion, result *git.ArtifactsResult) {
+	payload := webhook.WebhookPayload{
+		Timestamp:  time.Now(),
+		Repository: promotion.Repository,
+		Promotion: &webhook.Promotion{
+			ID:          promotion.ID,
+			Package:     promotion.Package,
+			Version:     promotion.Version,
+			From:        promotion.From,
+			To:          promotion.To,
+			Status:      string(promotion.Status),
+			RequestedBy: promotion.RequestedBy,
+			Comment:     promotion.Comment,
+			DecidedBy:   promotion.DecidedBy,
+			Reason:      promotion.Reason,
+			Commit:      promotion.Commit,
+			Error:       promotion.Error,
+		},
+	}
+	if artifactsRepo := gitManager.GetConfig().ArtifactsRepo; artifactsRepo != nil {
+		if env, err := artifactsRepo.EnvironmentFor(promotion.To); err == nil {
+			payload.Branch = artifactsRepo.TargetBranch(env)
+		}
+	}
+	if result != nil && result.Push != nil && result.Push.PullRequest != nil {
+		payload.Promotion.PullRequest = result.Push.PullRequest.URL
+	}
+
+	who := promotion.RequestedBy
+	if promotion.DecidedBy != "" {
+		who = promotion.DecidedBy
+	}
+	switch promotion.Status {
+	case history.PromotionPending:
+		payload.Event = "promotion_pending"
+		payload.Message = fmt.Sprintf("Promotion of %s %s from %s to %s requested by %s is waiting for approval",
+			promotion.Package, promotion.Version, promotion.From, promotion.To, promotion.RequestedBy)
+	case history.PromotionRejected:
+		payload.Event = "promotion_rejected"
+		payload.Message = fmt.Sprintf("Promotion of %s %s from %s to %s was rejected by %s",
+			promotion.Package, promotion.Version, promotion.From, promotion.To, promotion.DecidedBy)
+	case history.PromotionPromoted:
+		payload.Event = "artifacts_promoted"
+		payload.Message = fmt.Sprintf("Promoted %s %s from %s to %s, approved by %s",
+			promotion.Package, promotion.Version, promotion.From, promotion.To, who)
+		if promotion.DecidedBy == "" {
+			payload.Message = fmt.Sprintf("Promoted %s %s from %s to %s, requested by %s",
+				promotion.Package, promotion.Version, promotion.From, promotion.To, who)
+		}
+	default:
+		payload.Event = "promotion_failed"
+		payload.Message = fmt.Sprintf("Promotion of %s %s from %s to %s failed: %s",
+			promotion.Package, promotion.Version, promotion.From, promotion.To, promotion.Error)
+	}
+	webhookClient.Notify(ctx, payload)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/git"
+	"github.com/Jieay/git-watcher/internal/history"
+	"github.com/Jieay/git-watcher/internal/logging"
+	"github.com/Jieay/git-watcher/internal/scheduler"
+	"github.com/Jieay/git-watcher/internal/webhook"
+)
+
+// handleGitHubWebhook handles POST /webhook/github, receiving GitHub push, create and delete events
+func handleGitHubWebhook(webhookClient *webhook.Client, gitManager *git.Manager, sched *scheduler.Scheduler) http.HandlerFunc {
+	return handleRefEvents(webhookClient.ValidateGitHubWebhook, history.TriggerGitHub, gitManager, sched)
+}
+
+// handleGitLabWebhook handles POST /webhook/gitlab, receiving GitLab Push Hook and Tag Push Hook events
+func handleGitLabWebhook(webhookClient *webhook.Client, gitManager *git.Manager, sched *scheduler.Scheduler) http.HandlerFunc {
+	return handleRefEvents(webhookClient.ValidateGitLabWebhook, history.TriggerGitLab, gitManager, sched)
+}
+
+// handleGiteaWebhook handles POST /webhook/gitea, receiving Gitea and Forgejo push, create and delete events
+func handleGiteaWebhook(webhookClient *webhook.Client, gitManager *git.Manager, sched *scheduler.Scheduler) http.HandlerFunc {
+	return handleRefEvents(webhookClient.ValidateGiteaWebhook, history.TriggerGitea, gitManager, sched)
+}
+
+// handleRefEvents returns a handler acting on the reference events of a hosting service parsed
+// by validate. Pushes to and creations of a watched branch of a watched repository start a
+// check of that branch in the background; deletions remove the branch worktree. Tag pushes
+// start a check of the tags of the repository when it has tag patterns. Pushes to the
+// repository of a submodule update that submodule in every watched branch using it. Other
+// events are acknowledged and ignored.
+func handleRefEvents(validate func(*http.Request) (*webhook.RefEvent, error), trigger history.Trigger, gitManager *git.Manager, sched *scheduler.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		event, err := validate(r)
+		if errors.Is(err, webhook.ErrInvalidSignature) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid webhook request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		logger := logging.FromContext(r.Context()).With(
+			"provider", event.Provider,
+			"event", event.Event,
+			"delivery", event.DeliveryID,
+			logging.KeyBranch, event.Branch)
+		logger.Info("hosting service webhook received",
+			"action", event.Action, "remote", event.Repository, "tag", event.Tag, "commit", event.Commit)
+
+		switch {
+		case event.Action == webhook.RefPing:
+			writeJSON(w, http.StatusOK, map[string]interface{}{"status": "pong"})
+			return
+		case event.Action == "":
+			ignoreRefEvent(w, logger, fmt.Sprintf("event %s is not handled", event.Event))
+			return
+		case event.Branch == "" && event.Tag == "":
+			ignoreRefEvent(w, logger, "event does not concern a branch or tag")
+			return
+		}
+
+		repos := gitManager.RepositoriesForURL(event.URLs...)
+		if len(repos) == 0 {
+			handleSubmoduleRefEvent(w, logger, event, trigger, gitManager, sched)
+			return
+		}
+		if event.Tag != "" {
+			handleTagRefEvent(w, logger, event, repos, sched)
+			return
+		}
+
+		names := make([]string, 0, len(repos))
+		for _, repo := range repos {
+			if !slices.Contains(gitManager.GetConfig().BranchesFor(repo), event.Branch) {
+				continue
+			}
+			if event.Action == webhook.RefDeleted {
+				err = sched.TriggerBranchRemoval(repo.GetName(), event.Branch)
+			} else {
+				err = sched.TriggerBranchCheck(repo.GetName(), event.Branch, trigger)
+			}
+			if err != nil {
+				logger.Error("failed to handle hosting service webhook", logging.KeyRepository, repo.GetName(), "error", err)
+				http.Error(w, fmt.Sprintf("Failed to handle %s of branch %s: %v", event.Action, event.Branch, err), http.StatusServiceUnavailable)
+				return
+			}
+			names = append(names, repo.GetName())
+		}
+		if len(names) == 0 {
+			ignoreRefEvent(w, logger, fmt.Sprintf("branch %s is not watched", event.Branch))
+			return
+		}
+
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"status":       "accepted",
+			"action":       event.Action,
+			"branch":       event.Branch,
+			"repositories": names,
+		})
+	}
+}
+
+// ignoreRefEvent acknowledges a hosting service webhook the watcher does not act on
+func ignoreRefEvent(w http.ResponseWriter, logger *slog.Logger, reason string) {
+	logger.Info("hosting service webhook ignored", "reason", reason)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ignored", "reason": reason})
+}
+
+// handleTagRefEvent checks the tags of the watched repositories that received a tag push
+func handleTagRefEvent(w http.ResponseWriter, logger *slog.Logger, event *webhook.RefEvent, repos []*config.Repository, sched *scheduler.Scheduler) {
+	if event.Action == webhook.RefDeleted {
+		ignoreRefEvent(w, logger, fmt.Sprintf("tag %s was deleted", event.Tag))
+		return
+	}
+
+	names := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		if !git.MatchTag(repo.Tags, event.Tag) {
+			continue
+		}
+		if err := sched.TriggerTagCheck(repo.GetName()); err != nil {
+			logger.Error("failed to handle hosting service webhook", logging.KeyRepository, repo.GetName(), "error", err)
+			http.Error(w, fmt.Sprintf("Failed to check tags of %s: %v", repo.GetName(), err), http.StatusServiceUnavailable)
+			return
+		}
+		names = append(names, repo.GetName())
+	}
+	if len(names) == 0 {
+		ignoreRefEvent(w, logger, fmt.Sprintf("tag %s is not watched", event.Tag))
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":       "accepted",
+		"action":       event.Action,
+		"tag":          event.Tag,
+		"repositories": names,
+	})
+}
+
+// handleSubmoduleRefEvent updates the submodules whose repository received a push. A tag push
+// only updates the submodules whose tag policy can select the tag.
+func handleSubmoduleRefEvent(w http.ResponseWriter, logger *slog.Logger, event *webhook.RefEvent, trigger history.Trigger, gitManager *git.Manager, sched *scheduler.Scheduler) {
+	targets := gitManager.SubmodulesForURL(event.Branch, event.Tag, event.URLs...)
+	if len(targets) == 0 {
+		ignoreRefEvent(w, logger, fmt.Sprintf("repository %s is not watched", event.Repository))
+		return
+	}
+	if event.Action == webhook.RefDeleted {
+		ignoreRefEvent(w, logger, fmt.Sprintf("reference %s%s of submodule repository %s was deleted", event.Branch, event.Tag, event.Repository))
+		return
+	}
+
+	if err := sched.TriggerSubmoduleUpdate(targets, trigger); err != nil {
+		logger.Error("failed to handle hosting service webhook", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to update submodules of %s: %v", event.Repository, err), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":     "accepted",
+		"action":     event.Action,
+		"branch":     event.Branch,
+		"tag":        event.Tag,
+		"submodules": targets,
+	})
+}
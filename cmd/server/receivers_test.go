@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/git"
+	"github.com/Jieay/git-watcher/internal/scheduler"
+	"github.com/Jieay/git-watcher/internal/webhook"
+)
+
+const (
+	testSecret = "s3cret"
+	zeroCommit = "0000000000000000000000000000000000000000"
+)
+
+// newGitHubReceiver returns the GitHub webhook handler of a watcher of the main branch of
+// owner/app, which uses the submodule owner/lib. The scheduler is not started: events that
+// would start a check are routed to it and fail with 503.
+func newGitHubReceiver(t *testing.T) http.HandlerFunc {
+	useSubmodules := true
+	cfg := &config.GitConfig{
+		WorkingDir: t.TempDir(),
+		Branches:   []string{"main"},
+		Repositories: []*config.Repository{{
+			Name:          "app",
+			URL:           "https://github.com/owner/app.git",
+			Directory:     "app",
+			Tags:          []string{"v*"},
+			UseSubmodules: &useSubmodules,
+		}},
+	}
+	gitManager, err := git.NewManagerWithBackend(cfg, git.NewCLIBackend())
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree := gitManager.BranchPath(cfg.Repositories[0], "main")
+	if err := os.MkdirAll(worktree, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gitmodules := "[submodule \"lib\"]\n\tpath = lib\n\turl = ../lib.git\n"
+	if err := os.WriteFile(filepath.Join(worktree, ".gitmodules"), []byte(gitmodules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	webhookClient := webhook.NewClient(&config.WebhookConfig{GitHub: config.ReceiverConfig{Secret: testSecret}}, nil)
+	sched := scheduler.NewScheduler(&config.ScheduleConfig{}, gitManager, webhookClient, nil)
+	return handleGitHubWebhook(webhookClient, gitManager, sched)
+}
+
+// postGitHubEvent posts a signed GitHub event to a handler
+func postGitHubEvent(handler http.HandlerFunc, event, body, secret string) *httptest.ResponseRecorder {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	r := httptest.NewRequest(http.MethodPost, "/webhook/github", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	if event != "" {
+		r.Header.Set("X-GitHub-Event", event)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestHandleGitHubWebhook(t *testing.T) {
+	const (
+		app = `"repository": {"full_name": "owner/app", "clone_url": "https://github.com/owner/app.git"}`
+		lib = `"repository": {"full_name": "owner/lib", "ssh_url": "git@github.com:owner/lib.git"}`
+	)
+	tests := []struct {
+		name   string
+		event  string
+		body   string
+		secret string // testSecret when empty
+		status int
+		want   string // Part of the response body
+	}{
+		{
+			name:   "ping",
+			event:  "ping",
+			body:   `{"zen": "Design for failure.", ` + app + `}`,
+			status: http.StatusOK,
+			want:   `{"status":"pong"}`,
+		},
+		{
+			name:   "invalid signature",
+			event:  "push",
+			body:   `{"ref": "refs/heads/main", ` + app + `}`,
+			secret: "other",
+			status: http.StatusUnauthorized,
+			want:   "invalid webhook signature",
+		},
+		{
+			name:   "missing event",
+			body:   `{"ref": "refs/heads/main", ` + app + `}`,
+			status: http.StatusBadRequest,
+			want:   "missing X-GitHub-Event header",
+		},
+		{
+			name:   "unhandled event",
+			event:  "issues",
+			body:   `{` + app + `}`,
+			status: http.StatusOK,
+			want:   "event issues is not handled",
+		},
+		{
+			name:   "push to a watched branch",
+			event:  "push",
+			body:   `{"ref": "refs/heads/main", "before": "a1", "after": "b2", ` + app + `}`,
+			status: http.StatusServiceUnavailable,
+			want:   "Failed to handle push of branch main: scheduler is not running",
+		},
+		{
+			name:   "push to another branch",
+			event:  "push",
+			body:   `{"ref": "refs/heads/dev", "before": "a1", "after": "b2", ` + app + `}`,
+			status: http.StatusOK,
+			want:   "branch dev is not watched",
+		},
+		{
+			name:   "delete of a watched branch",
+			event:  "delete",
+			body:   `{"ref": "main", "ref_type": "branch", ` + app + `}`,
+			status: http.StatusServiceUnavailable,
+			want:   "Failed to handle delete of branch main: scheduler is not running",
+		},
+		{
+			name:   "push of a watched tag",
+			event:  "push",
+			body:   `{"ref": "refs/tags/v1.2.0", "before": "` + zeroCommit + `", "after": "c3", ` + app + `}`,
+			status: http.StatusServiceUnavailable,
+			want:   "Failed to check tags of app: scheduler is not running",
+		},
+		{
+			name:   "create of a watched tag",
+			event:  "create",
+			body:   `{"ref": "v1.2.0", "ref_type": "tag", ` + app + `}`,
+			status: http.StatusServiceUnavailable,
+			want:   "Failed to check tags of app: scheduler is not running",
+		},
+		{
+			name:   "push of another tag",
+			event:  "push",
+			body:   `{"ref": "refs/tags/nightly", "before": "` + zeroCommit + `", "after": "c3", ` + app + `}`,
+			status: http.StatusOK,
+			want:   "tag nightly is not watched",
+		},
+		{
+			name:   "delete of a tag",
+			event:  "delete",
+			body:   `{"ref": "v1.2.0", "ref_type": "tag", ` + app + `}`,
+			status: http.StatusOK,
+			want:   "tag v1.2.0 was deleted",
+		},
+		{
+			name:   "push to a submodule",
+			event:  "push",
+			body:   `{"ref": "refs/heads/main", "before": "a1", "after": "b2", ` + lib + `}`,
+			status: http.StatusServiceUnavailable,
+			want:   "Failed to update submodules of owner/lib: scheduler is not running",
+		},
+		{
+			name:   "delete of a submodule branch",
+			event:  "push",
+			body:   `{"ref": "refs/heads/main", "before": "a1", "after": "` + zeroCommit + `", "deleted": true, ` + lib + `}`,
+			status: http.StatusOK,
+			want:   "reference main of submodule repository owner/lib was deleted",
+		},
+		{
+			name:   "push to another repository",
+			event:  "push",
+			body:   `{"ref": "refs/heads/main", "before": "a1", "after": "b2", "repository": {"full_name": "owner/other", "clone_url": "https://github.com/owner/other.git"}}`,
+			status: http.StatusOK,
+			want:   "repository owner/other is not watched",
+		},
+	}
+	handler := newGitHubReceiver(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := tt.secret
+			if secret == "" {
+				secret = testSecret
+			}
+			w := postGitHubEvent(handler, tt.event, tt.body, secret)
+			if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("response = %d %s, want %d containing %q", w.Code, w.Body.String(), tt.status, tt.want)
+			}
+			if w.Code == http.StatusOK {
+				var response map[string]interface{}
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Errorf("response is not JSON: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleGitHubWebhookMethod(t *testing.T) {
+	w := httptest.NewRecorder()
+	newGitHubReceiver(t)(w, httptest.NewRequest(http.MethodGet, "/webhook/github", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Jieay/git-watcher/internal/git"
+	"github.com/Jieay/git-watcher/internal/history"
+	"github.com/Jieay/git-watcher/internal/logging"
+	"github.com/Jieay/git-watcher/internal/webhook"
+)
+
+// artifactsRollbackRequest is the body of POST /rollback/artifacts
+type artifactsRollbackRequest struct {
+	// Artifact whose key is rolled back; its version selects the key, such as the version being replaced
+	Artifact    git.Artifact `json:"artifact"`
+	Version     string       `json:"version"`     // Version restored, the previous version by default
+	Environment string       `json:"environment"` // Environment rolled back, the first configured environment by default
+	User        string       `json:"user"`        // Requester, artifact.userName by default
+	Reason      string       `json:"reason"`
+	DryRun      bool         `json:"dryRun"` // Only plan the rollback
+}
+
+// submodulesRollbackRequest is the body of POST /rollback/submodules
+type submodulesRollbackRequest struct {
+	Repository string `json:"repository"` // Watched repository, optional when only one tracks the branch
+	Branch     string `json:"branch"`
+	Commit     string `json:"commit"` // Commit whose submodule pointers are restored, the previous auto-commit by default
+	User       string `json:"user"`
+	Reason     string `json:"reason"`
+	DryRun     bool   `json:"dryRun"` // Only plan the rollback
+}
+
+// submodulesReleaseRequest is the body of POST /rollback/submodules/release
+type submodulesReleaseRequest struct {
+	Repository string `json:"repository"` // Watched repository, optional when only one tracks the branch
+	Branch     string `json:"branch"`
+	User       string `json:"user"`
+}
+
+// handleArtifactsRollback handles POST /rollback/artifacts, restoring an earlier version of a
+// package from the history of its key in the artifacts repository
+func handleArtifactsRollback(webhookClient *webhook.Client, gitManager *git.Manager, historyStore *history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req artifactsRollbackRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Artifact.ArtifactRepoName == "" || req.Artifact.ArtifactPkgName == "" {
+			http.Error(w, "Missing required fields", http.StatusBadRequest)
+			return
+		}
+		// The version selects the key of the package; a named version belongs to the same key
+		if req.Artifact.ArtifactVersionName == "" {
+			req.Artifact.ArtifactVersionName = req.Version
+		}
+		if req.Artifact.ArtifactVersionName == "" {
+			http.Error(w, "Missing artifact version or version to restore", http.StatusBadRequest)
+			return
+		}
+		if req.User == "" {
+			req.User = req.Artifact.UserName
+		}
+		artifactsRepo := gitManager.GetConfig().ArtifactsRepo
+		if artifactsRepo == nil {
+			http.Error(w, "No artifacts repository is configured", http.StatusBadRequest)
+			return
+		}
+		if _, err := artifactsRepo.EnvironmentFor(req.Environment); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		run := history.NewRun(history.TriggerRollback, "")
+		run.DryRun = req.DryRun || r.URL.Query().Get("dryRun") == "true" || gitManager.IsDryRun(r.Context())
+		if err := historyStore.Begin(run); err != nil {
+			logging.FromContext(r.Context()).Warn("failed to record rollback run", "error", err)
+		}
+		ctx := logging.With(r.Context(), logging.KeyRunID, run.ID, logging.KeyRepository, req.Artifact.ArtifactRepoName)
+		if run.DryRun {
+			ctx = git.WithDryRun(ctx)
+		}
+		logger := logging.FromContext(ctx)
+		logger.Info("artifacts rollback requested", "package", req.Artifact.ArtifactPkgName,
+			"version", req.Version, "environment", req.Environment, "user", req.User, "reason", req.Reason)
+
+		extendDeadlines(ctx, w, gitManager)
+		result, err := gitManager.UpdateArtifactsRepo(ctx, req.Artifact, git.ArtifactsOptions{
+			Environment: req.Environment,
+			Rollback:    true,
+			RollbackTo:  req.Version,
+		})
+		run.Artifacts = result
+		run.Finish(err)
+		if saveErr := historyStore.Save(run); saveErr != nil {
+			logger.Warn("failed to save run", "error", saveErr)
+		}
+		if result.Conflict != nil {
+			notifyArtifactsConflict(ctx, webhookClient, result)
+		}
+		if err != nil {
+			logger.Error("failed to roll back artifacts", "error", err)
+			status := http.StatusInternalServerError
+			if errors.Is(err, git.ErrNoRollbackTarget) || errors.Is(err, git.ErrArtifactsConflict) {
+				status = http.StatusConflict
+			}
+			http.Error(w, fmt.Sprintf("Failed to roll back artifacts: %v", err), status)
+			return
+		}
+
+		response := map[string]interface{}{
+			"status":  "success",
+			"message": fmt.Sprintf("Rolled back %s from %s to %s", result.Package, result.RolledBackFrom, result.Version),
+			"runId":   run.ID,
+			"result":  result,
+		}
+		if result.Plan != nil {
+			response["message"] = fmt.Sprintf("Planned rollback of %s from %s to %s", result.Package, result.RolledBackFrom, result.Version)
+			writeJSON(w, http.StatusOK, response)
+			return
+		}
+		if result.Commit != "" {
+			notifyArtifactsRollback(ctx, webhookClient, result, req.User, req.Reason)
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// handleSubmodulesRollback handles POST /rollback/submodules, resetting the submodule pointers
+// of a watched branch to those of an earlier commit
+func handleSubmodulesRollback(webhookClient *webhook.Client, gitManager *git.Manager, historyStore *history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req submodulesRollbackRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Branch == "" {
+			http.Error(w, "Missing required fields", http.StatusBadRequest)
+			return
+		}
+		repos, err := resolveTriggerRepositories(gitManager, req.Repository, req.Branch)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(repos) > 1 {
+			http.Error(w, fmt.Sprintf("Several repositories track branch %s, specify the repository", req.Branch), http.StatusBadRequest)
+			return
+		}
+		repo := repos[0]
+
+		run := history.NewRun(history.TriggerRollback, repo.GetName())
+		run.DryRun = req.DryRun || r.URL.Query().Get("dryRun") == "true" || gitManager.IsDryRun(r.Context())
+		if err := historyStore.Begin(run); err != nil {
+			logging.FromContext(r.Context()).Warn("failed to record rollback run", "error", err)
+		}
+		ctx := logging.With(r.Context(), logging.KeyRunID, run.ID, logging.KeyRepository, repo.GetName(), logging.KeyBranch, req.Branch)
+		if run.DryRun {
+			ctx = git.WithDryRun(ctx)
+		}
+		logger := logging.FromContext(ctx)
+		logger.Info("submodules rollback requested", "commit", req.Commit, "user", req.User, "reason", req.Reason)
+
+		extendDeadlines(ctx, w, gitManager)
+		result, err := gitManager.RollbackSubmodules(ctx, repo.GetName(), req.Branch, git.SubmoduleRollbackOptions{
+			Commit: req.Commit,
+			User:   req.User,
+			Reason: req.Reason,
+		})
+		run.AddBranch(result)
+		run.Finish(err)
+		if saveErr := historyStore.Save(run); saveErr != nil {
+			logger.Warn("failed to save run", "error", saveErr)
+		}
+		if err != nil {
+			logger.Error("failed to roll back submodules", "error", err)
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, git.ErrNoRollbackTarget):
+				status = http.StatusConflict
+			case errors.Is(err, git.ErrRollbackNotCommitted):
+				status = http.StatusBadRequest
+			}
+			http.Error(w, fmt.Sprintf("Failed to roll back submodules: %v", err), status)
+			return
+		}
+
+		response := map[string]interface{}{
+			"status":  "success",
+			"message": fmt.Sprintf("Rolled back %d submodules of %s branch %s to %s", len(result.Submodules), repo.GetName(), req.Branch, result.RolledBackTo),
+			"runId":   run.ID,
+			"result":  result,
+		}
+		if result.Plan != nil {
+			response["message"] = fmt.Sprintf("Planned rollback of %d submodules of %s branch %s to %s", len(result.Plan.Submodules), repo.GetName(), req.Branch, result.RolledBackTo)
+			writeJSON(w, http.StatusOK, response)
+			return
+		}
+		notifySubmodulesRollback(ctx, webhookClient, repo.GetURL(), result, req.User, req.Reason)
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// handleSubmodulesRelease handles POST /rollback/submodules/release, releasing the hold a
+// submodule rollback set on a branch so that its submodules follow their policies again
+func handleSubmodulesRelease(gitManager *git.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req submodulesReleaseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Branch == "" {
+			http.Error(w, "Missing required fields", http.StatusBadRequest)
+			return
+		}
+		repos, err := resolveTriggerRepositories(gitManager, req.Repository, req.Branch)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(repos) > 1 {
+			http.Error(w, fmt.Sprintf("Several repositories track branch %s, specify the repository", req.Branch), http.StatusBadRequest)
+			return
+		}
+		repo := repos[0]
+
+		hold, err := gitManager.ReleaseSubmodules(repo.GetName(), req.Branch)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, git.ErrNoHold) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, fmt.Sprintf("Failed to release submodules: %v", err), status)
+			return
+		}
+		logging.FromContext(r.Context()).Info("submodules released",
+			logging.KeyRepository, repo.GetName(), logging.KeyBranch, req.Branch, "user", req.User, "held_since", hold.CreatedAt)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status":  "success",
+			"message": fmt.Sprintf("Released the submodules of %s branch %s held at %s", repo.GetName(), req.Branch, hold.Commit),
+			"hold":    hold,
+		})
+	}
+}
+
+// notifyArtifactsRollback sends an artifacts_rolled_back notification for a committed artifacts rollback
+func notifyArtifactsRollback(ctx context.Context, webhookClient *webhook.Client, result *git.ArtifactsResult, user, reason string) {
+	rollback := &webhook.Rollback{
+		Package:     result.Package,
+		Environment: result.Environment,
+		From:        result.RolledBackFrom,
+		To:          result.Version,
+		User:        user,
+		Reason:      reason,
+		Commit:      result.Commit,
+	}
+	if result.Push != nil && result.Push.PullRequest != nil {
+		rollback.PullRequest = result.Push.PullRequest.URL
+	}
+	payload := webhook.WebhookPayload{
+		Event:      "artifacts_rolled_back",
+		Timestamp:  time.Now(),
+		Repository: result.Repository,
+		Branch:     result.TargetBranch,
+		Message:    fmt.Sprintf("Rolled back %s from %s to %s", result.Package, result.RolledBackFrom, result.Version),
+		Rollback:   rollback,
+	}
+	webhookClient.Notify(ctx, payload)
+}
+
+// notifySubmodulesRollback sends a submodules_rolled_back notification for a submodule
+// rollback, with the repository update of the branch like repository_update notifications
+func notifySubmodulesRollback(ctx context.Context, webhookClient *webhook.Client, repoURL string, result *git.BranchResult, user, reason string) {
+	rollback := &webhook.Rollback{
+		To:     result.RolledBackTo,
+		User:   user,
+		Reason: reason,
+		Commit: result.Commit,
+	}
+	for _, change := range result.Submodules {
+		rollback.Submodules = append(rollback.Submodules, change.Path)
+	}
+	if result.Push != nil && result.Push.PullRequest != nil {
+		rollback.PullRequest = result.Push.PullRequest.URL
+	}
+	payload := webhook.WebhookPayload{
+		Event:      "submodules_rolled_back",
+		Timestamp:  time.Now(),
+		Repository: result.Repository,
+		Branch:     result.Branch,
+		RepoUpdates: map[string]webhook.RepoUpdate{
+			result.Branch: {
+				Repository: repoURL,
+				Branch:     result.Branch,
+				Timestamp:  time.Now(),
+				CommitHash: result.HeadAfter,
+			},
+		},
+		Message:  fmt.Sprintf("Rolled back submodules %v of %s branch %s to %s", rollback.Submodules, result.Repository, result.Branch, result.RolledBackTo),
+		Rollback: rollback,
+	}
+	webhookClient.Notify(ctx, payload)
+}
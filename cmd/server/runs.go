@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Jieay/git-watcher/internal/history"
+)
+
+// defaultRunsLimit is the number of runs returned by GET /runs without a limit parameter
+const defaultRunsLimit = 50
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleListRuns handles GET /runs. Query parameters repository, trigger and status filter
+// the runs; limit and before (a run ID) page through them, newest first.
+func handleListRuns(historyStore *history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := history.Filter{
+			Repository: query.Get("repository"),
+			Trigger:    history.Trigger(query.Get("trigger")),
+			Status:     history.Status(query.Get("status")),
+			Limit:      defaultRunsLimit,
+		}
+		if limit := query.Get("limit"); limit != "" {
+			value, err := strconv.Atoi(limit)
+			if err != nil || value <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			filter.Limit = value
+		}
+		if before := query.Get("before"); before != "" {
+			value, err := strconv.ParseUint(before, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid before", http.StatusBadRequest)
+				return
+			}
+			filter.Before = value
+		}
+
+		runs, err := historyStore.List(filter)
+		if err != nil {
+			http.Error(w, "Failed to list runs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"runs": runs})
+	}
+}
+
+// handleGetRun handles GET /runs/{id}
+func handleGetRun(historyStore *history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/runs/"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid run id", http.StatusBadRequest)
+			return
+		}
+
+		run, err := historyStore.Get(id)
+		if errors.Is(err, history.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to get run: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, run)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Jieay/git-watcher/internal/git"
+	"github.com/Jieay/git-watcher/internal/scheduler"
+	"github.com/Jieay/git-watcher/internal/webhook"
+)
+
+// handleStatus handles GET /status. It reports the scheduler state, the sync state of every
+// configured branch of the watched repositories, pending artifacts updates and the last
+// webhook delivery to each subscriber, all kept in memory since startup.
+func handleStatus(sched *scheduler.Scheduler, gitManager *git.Manager, webhookClient *webhook.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		branches := make([]*git.BranchStatus, 0)
+		for _, repo := range gitManager.Repositories() {
+			for _, branch := range gitManager.GetConfig().BranchesFor(repo) {
+				branches = append(branches, gitManager.BranchStatus(repo.GetName(), branch))
+			}
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"scheduler":         sched.Status(),
+			"branches":          branches,
+			"pendingArtifacts":  gitManager.PendingArtifacts(),
+			"submoduleHolds":    gitManager.SubmoduleHolds(),
+			"webhookDeliveries": webhookClient.LastDeliveries(),
+		})
+	}
+}
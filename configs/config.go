@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 )
 
@@ -15,16 +19,23 @@ const (
 	EnvServerPort = "GIT_WATCHER_SERVER_PORT"
 
 	// Git
+	EnvGitMainRepoName      = "GIT_WATCHER_MAIN_REPO_NAME"
 	EnvGitMainRepoURL       = "GIT_WATCHER_MAIN_REPO_URL"
 	EnvGitMainRepoBranch    = "GIT_WATCHER_MAIN_REPO_BRANCH"
 	EnvGitMainRepoDirectory = "GIT_WATCHER_MAIN_REPO_DIRECTORY"
 	EnvGitWorkingDir        = "GIT_WATCHER_WORKING_DIR"
+	EnvGitBackend           = "GIT_WATCHER_GIT_BACKEND"
 	EnvGitUseSubmodules     = "GIT_WATCHER_USE_SUBMODULES"
 	EnvGitBranches          = "GIT_WATCHER_BRANCHES"
 	EnvGitAutoCommit        = "GIT_WATCHER_AUTO_COMMIT"
 	EnvGitCommitUserName    = "GIT_WATCHER_COMMIT_USER_NAME"
 	EnvGitCommitUserEmail   = "GIT_WATCHER_COMMIT_USER_EMAIL"
 	EnvGitCommitMessage     = "GIT_WATCHER_COMMIT_MESSAGE"
+	EnvGitCloneTimeout      = "GIT_WATCHER_CLONE_TIMEOUT"
+	EnvGitFetchTimeout      = "GIT_WATCHER_FETCH_TIMEOUT"
+	EnvGitPushTimeout       = "GIT_WATCHER_PUSH_TIMEOUT"
+	EnvGitDeliveryToken     = "GIT_WATCHER_DELIVERY_TOKEN"
+	EnvGitDryRun            = "GIT_WATCHER_DRY_RUN"
 
 	// Artifacts Repo
 	EnvGitArtifactsRepoURL       = "GIT_WATCHER_ARTIFACTS_REPO_URL"
@@ -35,6 +46,11 @@ const (
 	EnvGitArtifactsAuthPassword  = "GIT_WATCHER_ARTIFACTS_AUTH_PASSWORD"
 	EnvGitArtifactsAuthSSHKey    = "GIT_WATCHER_ARTIFACTS_AUTH_SSH_KEY_PATH"
 	EnvGitArtifactsAuthSSHPriv   = "GIT_WATCHER_ARTIFACTS_AUTH_SSH_PRIVATE_KEY"
+	EnvGitArtifactsConflict      = "GIT_WATCHER_ARTIFACTS_CONFLICT_STRATEGY"
+	EnvGitArtifactsJsonnet       = "GIT_WATCHER_ARTIFACTS_JSONNET_COMMAND"
+	EnvGitArtifactsSkipJsonnet   = "GIT_WATCHER_ARTIFACTS_SKIP_JSONNET_EVALUATION"
+	EnvGitArtifactsFormat        = "GIT_WATCHER_ARTIFACTS_FORMAT"
+	EnvGitArtifactsVersionScheme = "GIT_WATCHER_ARTIFACTS_VERSION_SCHEME"
 
 	// Auth
 	EnvGitAuthType          = "GIT_WATCHER_AUTH_TYPE"
@@ -48,9 +64,26 @@ const (
 	EnvWebhookSecret      = "GIT_WATCHER_WEBHOOK_SECRET"
 	EnvWebhookMethod      = "GIT_WATCHER_WEBHOOK_METHOD"
 
+	EnvWebhookRetryMaxAttempts    = "GIT_WATCHER_WEBHOOK_RETRY_MAX_ATTEMPTS"
+	EnvWebhookRetryInitialBackoff = "GIT_WATCHER_WEBHOOK_RETRY_INITIAL_BACKOFF"
+	EnvWebhookRetryMaxBackoff     = "GIT_WATCHER_WEBHOOK_RETRY_MAX_BACKOFF"
+	EnvWebhookOutboxPath          = "GIT_WATCHER_WEBHOOK_OUTBOX_PATH"
+	EnvWebhookOutboxInterval      = "GIT_WATCHER_WEBHOOK_OUTBOX_INTERVAL"
+	EnvWebhookGitHubSecret        = "GIT_WATCHER_WEBHOOK_GITHUB_SECRET"
+	EnvWebhookGitLabSecret        = "GIT_WATCHER_WEBHOOK_GITLAB_SECRET"
+	EnvWebhookGiteaSecret         = "GIT_WATCHER_WEBHOOK_GITEA_SECRET"
+
 	// Schedule
 	EnvScheduleCheckInterval = "GIT_WATCHER_CHECK_INTERVAL"
 
+	// Log
+	EnvLogLevel  = "GIT_WATCHER_LOG_LEVEL"
+	EnvLogFormat = "GIT_WATCHER_LOG_FORMAT"
+
+	// History
+	EnvHistoryPath    = "GIT_WATCHER_HISTORY_PATH"
+	EnvHistoryMaxRuns = "GIT_WATCHER_HISTORY_MAX_RUNS"
+
 	// Artifacts Repo
 	EnvArtifactsRepoURL            = "ARTIFACTS_REPO_URL"
 	EnvArtifactsRepoBranch         = "ARTIFACTS_REPO_BRANCH"
@@ -74,11 +107,52 @@ type RepositoryInterface interface {
 
 // Repository 仓库配置
 type Repository struct {
-	URL          string       `json:"url"`          // 仓库URL
-	Branch       string       `json:"branch"`       // 分支名称
-	Directory    string       `json:"directory"`    // 本地目录
-	Auth         AuthConfig   `json:"auth"`         // 认证配置
-	CommitConfig CommitConfig `json:"commitConfig"` // 提交信息配置
+	Name              string             `json:"name,omitempty"`              // 仓库名称，用于调度、触发和通知
+	URL               string             `json:"url"`                         // 仓库URL
+	Branch            string             `json:"branch"`                      // 分支名称
+	Directory         string             `json:"directory"`                   // 本地目录
+	Branches          []string           `json:"branches,omitempty"`          // 需要检查的分支列表，未设置时使用 git.branches
+	UseSubmodules     *bool              `json:"useSubmodules,omitempty"`     // 是否使用子模块，未设置时使用 git.useSubmodules
+	AutoCommit        *bool              `json:"autoCommit,omitempty"`        // 是否自动提交，未设置时使用 git.autoCommit
+	Tags              []string           `json:"tags,omitempty"`              // 需要监听的标签模式，如 "v*"
+	SubmoduleTags     []string           `json:"submoduleTags,omitempty"`     // 设置后子模块固定到匹配的最新标签，而不是分支最新提交
+	SubmodulePolicies []*SubmodulePolicy `json:"submodulePolicies,omitempty"` // 子模块更新策略，按顺序匹配，未匹配时使用 submoduleTags 或跟踪分支
+	Delivery          *DeliveryConfig    `json:"delivery,omitempty"`          // 子模块更新的交付方式，未设置时使用 git.delivery
+	Auth              AuthConfig         `json:"auth"`                        // 认证配置
+	CommitConfig      CommitConfig       `json:"commitConfig"`                // 提交信息配置
+}
+
+// Submodule tracking modes
+const (
+	TrackBranch = "branch" // Follow the tip of a branch of the submodule
+	TrackTag    = "tag"    // Follow the highest version tag satisfying a constraint
+	TrackFrozen = "frozen" // Keep the commit recorded by the main repository
+)
+
+// SubmodulePolicy 子模块更新策略
+type SubmodulePolicy struct {
+	Path       string   `json:"path"`                 // 子模块路径，支持 "libs/*" 形式的通配符
+	Branches   []string `json:"branches,omitempty"`   // 策略生效的主仓库分支，为空时对所有分支生效
+	Track      string   `json:"track,omitempty"`      // branch（默认）、tag 或 frozen
+	Branch     string   `json:"branch,omitempty"`     // track 为 branch 时跟踪的分支，默认使用 .gitmodules 中的配置
+	Tags       []string `json:"tags,omitempty"`       // track 为 tag 时参与选择的标签模式，默认所有标签
+	Constraint string   `json:"constraint,omitempty"` // track 为 tag 时的语义化版本约束，如 "^1.4"
+}
+
+// GetTrack returns the tracking mode of the policy, defaulting to branch
+func (p *SubmodulePolicy) GetTrack() string {
+	if p.Track == "" {
+		return TrackBranch
+	}
+	return p.Track
+}
+
+// GetName returns the repository name, falling back to its directory
+func (r *Repository) GetName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Directory
 }
 
 // GetURL 实现 RepositoryInterface 接口
@@ -116,6 +190,189 @@ type ArtifactsRepo struct {
 	UseMainCommit  bool         `json:"useMainCommit"`  // 是否使用主仓库的提交信息
 	CommitConfig   CommitConfig `json:"commitConfig"`   // 提交信息配置
 	AutoBranchName string       `json:"autoBranchName"` // 自动合并的目标分支名称
+	// 交付方式，pullRequest 时为 feature 分支创建到目标分支的 PR，而不是在本地合并
+	Delivery *DeliveryConfig `json:"delivery,omitempty"`
+	// 合并 feature 分支发生冲突时的处理方式：reapply（默认）、theirs、fail、rebase 或 pullRequest
+	ConflictStrategy string `json:"conflictStrategy,omitempty"`
+	// 提交前校验 .jsonnet 文件的求值命令，默认 jsonnet，未安装时记录警告并跳过求值
+	JsonnetCommand string `json:"jsonnetCommand,omitempty"`
+	// 跳过提交前对 .jsonnet 文件的求值，只检查语法
+	SkipJsonnetEvaluation bool `json:"skipJsonnetEvaluation,omitempty"`
+	// 版本文件的格式：jsonnet（默认）、yaml、helm、kustomize 或 toml
+	Format string `json:"format,omitempty"`
+	// 制品版本的格式：build（默认，<前缀>-<构建号>）、semver 或 calver，决定版本前缀和版本的比较
+	VersionScheme string `json:"versionScheme,omitempty"`
+	// 按制品类型、制品仓库名、包名和团队选择版本写入的文件、键和 feature 分支，使用第一条匹配的规则
+	Manifests []ManifestRule `json:"manifests,omitempty"`
+	// 晋级流水线的环境，按晋级顺序排列，如 dev、staging、prod；制品更新默认写入第一个环境
+	Environments []Environment `json:"environments,omitempty"`
+}
+
+// Environment 制品仓库中的一个部署环境，每个环境使用不同的分支或目录
+type Environment struct {
+	Name      string   `json:"name"`                // 环境名称
+	Branch    string   `json:"branch,omitempty"`    // 环境的目标分支，默认为 autoBranchName 或 branch
+	Path      string   `json:"path,omitempty"`      // 环境的目录，版本文件的路径相对于该目录，默认为仓库根目录
+	Approval  bool     `json:"approval,omitempty"`  // 晋级到该环境需要审批
+	Approvers []string `json:"approvers,omitempty"` // 可以审批的用户，为空时任何用户都可以审批
+}
+
+// CanApprove reports whether a user may approve promotions to the environment
+func (e *Environment) CanApprove(user string) bool {
+	return user != "" && (len(e.Approvers) == 0 || slices.Contains(e.Approvers, user))
+}
+
+// ManifestRule 指定制品包的版本写入制品仓库中的哪个文件和键。
+// File、Key 和 Branch 为 text/template 模板，可以使用 /webhook/artifacts 请求中 artifact 的所有字段，
+// 如 {{.ProjectName}}、{{.ArtifactRepoName}}、{{.ArtifactPkgName}}，以及默认键使用的 {{.VersionPrefix}}
+type ManifestRule struct {
+	Type       string  `json:"type,omitempty"`       // 匹配的制品类型（artifactType），支持通配符，为空时匹配所有
+	Repository string  `json:"repository,omitempty"` // 匹配的制品仓库名（artifactRepoName），支持通配符，为空时匹配所有
+	Package    string  `json:"package,omitempty"`    // 匹配的包名（artifactPkgName），支持通配符，为空时匹配所有
+	Teams      []int64 `json:"teams,omitempty"`      // 匹配的团队ID（teamId），为空时匹配所有
+	Format     string  `json:"format,omitempty"`     // 文件格式，默认使用 artifactsRepo.format
+	File       string  `json:"file,omitempty"`       // 制品仓库中的文件路径模板，默认使用该格式的默认文件
+	Key        string  `json:"key,omitempty"`        // 以 . 分隔的键路径模板，kustomize 格式为镜像名称，默认使用该格式的默认键
+	Branch     string  `json:"branch,omitempty"`     // feature 分支名模板，默认 feature-{{.ArtifactRepoName}}
+	Scheme     string  `json:"scheme,omitempty"`     // 版本格式，默认使用 artifactsRepo.versionScheme
+	Pattern    string  `json:"pattern,omitempty"`    // 提取版本号的正则表达式，命名分组 version 为版本号、name 为名称，默认按版本格式提取
+}
+
+// ManifestTarget identifies the artifact a manifest rule is selected for
+type ManifestTarget struct {
+	Type       string // artifactType
+	Repository string // artifactRepoName
+	Package    string // artifactPkgName
+	Team       int64  // teamId
+}
+
+// Manifest formats of the artifacts repository
+const (
+	FormatJsonnet   = "jsonnet"   // Jsonnet object
+	FormatYAML      = "yaml"      // YAML mapping
+	FormatHelm      = "helm"      // Helm values file
+	FormatKustomize = "kustomize" // images of a kustomization.yaml
+	FormatTOML      = "toml"      // TOML table
+)
+
+// Conflict strategies of artifacts merges
+const (
+	ConflictTheirs      = "theirs"      // Merge again preferring the feature branch
+	ConflictFail        = "fail"        // Abort the merge and fail the update
+	ConflictRebase      = "rebase"      // Rebase the feature branch onto the target branch
+	ConflictReapply     = "reapply"     // Write the version again into the latest target branch
+	ConflictPullRequest = "pullRequest" // Open a pull request to resolve the conflict manually
+)
+
+// GetConflictStrategy returns how merge conflicts are handled, ConflictReapply by default
+func (r *ArtifactsRepo) GetConflictStrategy() string {
+	if r.ConflictStrategy == "" {
+		return ConflictReapply
+	}
+	return r.ConflictStrategy
+}
+
+// GetFormat returns the format of the version files, FormatJsonnet by default
+func (r *ArtifactsRepo) GetFormat() string {
+	if r.Format == "" {
+		return FormatJsonnet
+	}
+	return r.Format
+}
+
+// Version schemes of artifact versions
+const (
+	VersionSchemeBuild  = "build"  // <prefix>-<build number>, such as "pkg-1.0-3"
+	VersionSchemeSemver = "semver" // [<name>-]<semantic version>, such as "pkg-1.2.3-rc.1"
+	VersionSchemeCalver = "calver" // [<name>-]<year>.<month>[.<day>][.<micro>][-<build>], such as "pkg-2024.06.2"
+)
+
+// GetVersionScheme returns the scheme of the artifact versions, VersionSchemeBuild by default
+func (r *ArtifactsRepo) GetVersionScheme() string {
+	if r.VersionScheme == "" {
+		return VersionSchemeBuild
+	}
+	return r.VersionScheme
+}
+
+// ManifestFor returns the rule selecting where the version of an artifact is written: the
+// first matching entry of manifests, else a rule using the default file and key of the format
+// of the artifacts repository. The format and scheme of the returned rule are always set.
+func (r *ArtifactsRepo) ManifestFor(target ManifestTarget) ManifestRule {
+	for _, rule := range r.Manifests {
+		if rule.matches(target) {
+			if rule.Format == "" {
+				rule.Format = r.GetFormat()
+			}
+			if rule.Scheme == "" {
+				rule.Scheme = r.GetVersionScheme()
+			}
+			return rule
+		}
+	}
+	return ManifestRule{Format: r.GetFormat(), Scheme: r.GetVersionScheme()}
+}
+
+// matches reports whether a manifest rule applies to an artifact
+func (rule ManifestRule) matches(target ManifestTarget) bool {
+	for _, m := range []struct{ pattern, value string }{
+		{rule.Type, target.Type},
+		{rule.Repository, target.Repository},
+		{rule.Package, target.Package},
+	} {
+		if ok, _ := path.Match(m.pattern, m.value); m.pattern != "" && !ok {
+			return false
+		}
+	}
+	return len(rule.Teams) == 0 || slices.Contains(rule.Teams, target.Team)
+}
+
+// TargetBranch returns the branch artifacts updates of an environment are merged into:
+// the branch of the environment, else autoBranchName, else branch. env may be nil.
+func (r *ArtifactsRepo) TargetBranch(env *Environment) string {
+	switch {
+	case env != nil && env.Branch != "":
+		return env.Branch
+	case r.AutoBranchName != "":
+		return r.AutoBranchName
+	}
+	return r.Branch
+}
+
+// EnvironmentFor returns the environment with a name, or the first environment when name is
+// empty. It returns nil when no environments are configured and name is empty.
+func (r *ArtifactsRepo) EnvironmentFor(name string) (*Environment, error) {
+	if name == "" {
+		if len(r.Environments) == 0 {
+			return nil, nil
+		}
+		return &r.Environments[0], nil
+	}
+	for i := range r.Environments {
+		if r.Environments[i].Name == name {
+			return &r.Environments[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown environment %q", name)
+}
+
+// NextEnvironment returns the environment following an environment in the promotion
+// pipeline, nil for the last one
+func (r *ArtifactsRepo) NextEnvironment(name string) *Environment {
+	for i := range r.Environments {
+		if r.Environments[i].Name == name && i+1 < len(r.Environments) {
+			return &r.Environments[i+1]
+		}
+	}
+	return nil
+}
+
+// GetJsonnetCommand returns the command evaluating the jsonnet files, "jsonnet" by default
+func (r *ArtifactsRepo) GetJsonnetCommand() string {
+	if r.JsonnetCommand == "" {
+		return "jsonnet"
+	}
+	return r.JsonnetCommand
 }
 
 // GetURL 实现 RepositoryInterface 接口
@@ -149,6 +406,8 @@ type Config struct {
 	Git      GitConfig      `json:"git"`
 	Webhook  WebhookConfig  `json:"webhook"`
 	Schedule ScheduleConfig `json:"schedule"`
+	History  HistoryConfig  `json:"history"`
+	Log      LogConfig      `json:"log"`
 	// 添加制品仓库配置
 	ArtifactsRepo ArtifactsRepo `json:"artifactsRepo"`
 }
@@ -160,13 +419,266 @@ type ServerConfig struct {
 
 // GitConfig contains Git-related configuration
 type GitConfig struct {
+	// Git 操作实现："cli"（默认）或 "go-git"。go-git 无需安装 git，但只能快进，不实现三方合并和带本地提交的变基，
+	// 因此不支持 autoCommit 以及制品仓库的 theirs 和 rebase 冲突策略
+	Backend       string         `json:"backend"`
 	WorkingDir    string         `json:"workingDir"`    // 工作目录
 	UseSubmodules bool           `json:"useSubmodules"` // 是否使用子模块
 	Branches      []string       `json:"branches"`      // 分支列表
 	AutoCommit    bool           `json:"autoCommit"`    // 是否自动提交
 	CommitConfig  CommitConfig   `json:"commitConfig"`  // 提交信息配置
 	MainRepo      *Repository    `json:"mainRepo"`      // 主仓库配置
+	Repositories  []*Repository  `json:"repositories"`  // 多个主仓库配置
 	ArtifactsRepo *ArtifactsRepo `json:"artifactsRepo"` // 制品仓库配置
+	Timeouts      TimeoutConfig  `json:"timeouts"`      // Git 网络操作超时配置
+	Delivery      DeliveryConfig `json:"delivery"`      // 子模块更新的交付方式
+	DryRun        bool           `json:"dryRun"`        // 只生成执行计划，不提交、推送或合并
+}
+
+// Delivery modes
+const (
+	DeliveryPush        = "push"        // Push commits to the branch
+	DeliveryPullRequest = "pullRequest" // Push commits to a bot branch and open a pull request
+)
+
+// DefaultBotBranchPrefix prefixes the bot branches holding the submodule updates of pull requests
+const DefaultBotBranchPrefix = "git-watcher/"
+
+// DeliveryConfig 变更交付配置
+type DeliveryConfig struct {
+	Mode         string   `json:"mode,omitempty"`         // push（默认）或 pullRequest
+	Provider     string   `json:"provider,omitempty"`     // github、gitlab 或 gitea，未设置时根据仓库地址的主机名推断
+	APIURL       string   `json:"apiUrl,omitempty"`       // REST API 地址，未设置时根据仓库地址推断
+	Token        string   `json:"token,omitempty"`        // API 访问令牌，未设置时使用 git.delivery.token
+	Project      string   `json:"project,omitempty"`      // 仓库在托管平台上的路径，如 "owner/name"，未设置时根据仓库地址推断
+	BranchPrefix string   `json:"branchPrefix,omitempty"` // 提交子模块更新的机器人分支前缀，默认 "git-watcher/"
+	Labels       []string `json:"labels,omitempty"`       // 新建 PR 时添加的标签
+	AutoMerge    bool     `json:"autoMerge,omitempty"`    // 新建 PR 时开启检查通过后自动合并
+	MergeMethod  string   `json:"mergeMethod,omitempty"`  // 自动合并方式：merge（默认）、squash 或 rebase
+}
+
+// IsPullRequest reports whether changes are delivered as pull requests
+func (d *DeliveryConfig) IsPullRequest() bool {
+	return d != nil && d.Mode == DeliveryPullRequest
+}
+
+// GetBranchPrefix returns the prefix of bot branches, falling back to DefaultBotBranchPrefix
+func (d *DeliveryConfig) GetBranchPrefix() string {
+	if d.BranchPrefix == "" {
+		return DefaultBotBranchPrefix
+	}
+	return d.BranchPrefix
+}
+
+// Default timeouts of network Git operations
+const (
+	DefaultCloneTimeout = 10 * time.Minute
+	DefaultFetchTimeout = 2 * time.Minute
+	DefaultPushTimeout  = 2 * time.Minute
+)
+
+// TimeoutConfig bounds network Git operations. Fetch also covers pull, ls-remote and submodule updates.
+type TimeoutConfig struct {
+	Clone Duration `json:"clone"` // 克隆超时时间，默认 10m
+	Fetch Duration `json:"fetch"` // 拉取超时时间，默认 2m
+	Push  Duration `json:"push"`  // 推送超时时间，默认 2m
+}
+
+// CloneTimeout returns the clone timeout, falling back to DefaultCloneTimeout
+func (t TimeoutConfig) CloneTimeout() time.Duration {
+	if t.Clone <= 0 {
+		return DefaultCloneTimeout
+	}
+	return time.Duration(t.Clone)
+}
+
+// FetchTimeout returns the fetch timeout, falling back to DefaultFetchTimeout
+func (t TimeoutConfig) FetchTimeout() time.Duration {
+	if t.Fetch <= 0 {
+		return DefaultFetchTimeout
+	}
+	return time.Duration(t.Fetch)
+}
+
+// PushTimeout returns the push timeout, falling back to DefaultPushTimeout
+func (t TimeoutConfig) PushTimeout() time.Duration {
+	if t.Push <= 0 {
+		return DefaultPushTimeout
+	}
+	return time.Duration(t.Push)
+}
+
+// Duration is a time.Duration read from JSON as a duration string such as "2m" or as nanoseconds
+type Duration time.Duration
+
+// UnmarshalJSON 自定义 JSON 解析
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	switch v := raw.(type) {
+	case float64: // JSON 中的数字默认会被解析为 float64
+		*d = Duration(v)
+	case string:
+		duration, err := time.ParseDuration(v)
+		if err != nil {
+			// 尝试解析为整数字符串（纳秒）
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid duration: %v", v)
+			}
+			duration = time.Duration(i)
+		}
+		*d = Duration(duration)
+	case nil:
+		*d = 0
+	default:
+		return fmt.Errorf("invalid duration: %v", v)
+	}
+	return nil
+}
+
+// MarshalJSON 序列化为字符串形式
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// DefaultRepositoryName is the name given to the legacy mainRepo entry when it has none
+const DefaultRepositoryName = "main"
+
+// WatchedRepositories returns every main repository watched by this instance.
+// The legacy mainRepo entry is included first when it has a URL.
+func (g *GitConfig) WatchedRepositories() []*Repository {
+	repos := make([]*Repository, 0, len(g.Repositories)+1)
+	if g.MainRepo != nil && g.MainRepo.URL != "" {
+		repos = append(repos, g.MainRepo)
+	}
+	for _, repo := range g.Repositories {
+		if repo != nil {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
+
+// FindRepository returns the watched repository with the given name
+func (g *GitConfig) FindRepository(name string) (*Repository, bool) {
+	for _, repo := range g.WatchedRepositories() {
+		if repo.GetName() == name {
+			return repo, true
+		}
+	}
+	return nil, false
+}
+
+// PrimaryRepository returns the first watched repository, or nil if none is configured
+func (g *GitConfig) PrimaryRepository() *Repository {
+	repos := g.WatchedRepositories()
+	if len(repos) == 0 {
+		return nil
+	}
+	return repos[0]
+}
+
+// BranchesFor returns the branches to check for a repository
+func (g *GitConfig) BranchesFor(repo *Repository) []string {
+	if len(repo.Branches) > 0 {
+		return repo.Branches
+	}
+	if len(g.Branches) > 0 {
+		return g.Branches
+	}
+	return []string{repo.Branch}
+}
+
+// UseSubmodulesFor reports whether submodules are handled for a repository
+func (g *GitConfig) UseSubmodulesFor(repo *Repository) bool {
+	if repo.UseSubmodules != nil {
+		return *repo.UseSubmodules
+	}
+	return g.UseSubmodules
+}
+
+// AutoCommitFor reports whether submodule changes are committed for a repository
+func (g *GitConfig) AutoCommitFor(repo *Repository) bool {
+	if repo.AutoCommit != nil {
+		return *repo.AutoCommit
+	}
+	return g.AutoCommit
+}
+
+// SubmodulePolicyFor returns the update policy of a submodule in a branch of a repository: the
+// first matching entry of submodulePolicies, else following tags matching submoduleTags when
+// set, else following the branch configured in .gitmodules
+func (g *GitConfig) SubmodulePolicyFor(repo *Repository, branch, submodule string) *SubmodulePolicy {
+	for _, policy := range repo.SubmodulePolicies {
+		if ok, _ := path.Match(policy.Path, submodule); !ok {
+			continue
+		}
+		if len(policy.Branches) > 0 && !matchAnyPattern(policy.Branches, branch) {
+			continue
+		}
+		return policy
+	}
+	if len(repo.SubmoduleTags) > 0 {
+		return &SubmodulePolicy{Path: submodule, Track: TrackTag, Tags: repo.SubmoduleTags}
+	}
+	return &SubmodulePolicy{Path: submodule, Track: TrackBranch}
+}
+
+// matchAnyPattern reports whether value matches one of the path.Match patterns
+func matchAnyPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliveryFor returns how submodule updates of a repository are delivered, falling back to
+// git.delivery. An unset token is taken from git.delivery.
+func (g *GitConfig) DeliveryFor(repo *Repository) *DeliveryConfig {
+	return g.inheritDelivery(repo.Delivery, &g.Delivery)
+}
+
+// ArtifactsDelivery returns how updates of the artifacts repository are delivered. An unset
+// token is taken from git.delivery.
+func (g *GitConfig) ArtifactsDelivery() *DeliveryConfig {
+	if g.ArtifactsRepo == nil {
+		return &DeliveryConfig{}
+	}
+	return g.inheritDelivery(g.ArtifactsRepo.Delivery, &DeliveryConfig{})
+}
+
+// inheritDelivery returns delivery, or fallback when it is unset, with the token of git.delivery
+func (g *GitConfig) inheritDelivery(delivery, fallback *DeliveryConfig) *DeliveryConfig {
+	if delivery == nil {
+		delivery = fallback
+	}
+	if delivery.Token != "" {
+		return delivery
+	}
+	inherited := *delivery
+	inherited.Token = g.Delivery.Token
+	return &inherited
+}
+
+// CommitConfigFor returns the commit config for a repository, filling unset fields from git.commitConfig
+func (g *GitConfig) CommitConfigFor(repo *Repository) CommitConfig {
+	commitConfig := repo.CommitConfig
+	if commitConfig.UserName == "" {
+		commitConfig.UserName = g.CommitConfig.UserName
+	}
+	if commitConfig.UserEmail == "" {
+		commitConfig.UserEmail = g.CommitConfig.UserEmail
+	}
+	if commitConfig.Message == "" {
+		commitConfig.Message = g.CommitConfig.Message
+	}
+	return commitConfig
 }
 
 // CommitConfig 提交信息配置
@@ -187,9 +699,155 @@ type AuthConfig struct {
 
 // WebhookConfig contains webhook-related configuration
 type WebhookConfig struct {
-	CallbackURL string `json:"callbackUrl"`
-	Secret      string `json:"secret"`
-	Method      string `json:"method"`
+	CallbackURL string         `json:"callbackUrl"` // 兼容旧配置，作为名为 default 的订阅者
+	Secret      string         `json:"secret"`      // 校验 /webhook/trigger 请求签名，同时用于 default 订阅者
+	Method      string         `json:"method"`
+	Subscribers []*Subscriber  `json:"subscribers,omitempty"` // 通知订阅者列表
+	Retry       RetryConfig    `json:"retry"`                 // 发送失败时的重试策略
+	Outbox      OutboxConfig   `json:"outbox"`                // 重试后仍失败的通知的持久化队列
+	GitHub      ReceiverConfig `json:"github"`                // /webhook/github 接收 GitHub 推送事件
+	GitLab      ReceiverConfig `json:"gitlab"`                // /webhook/gitlab 接收 GitLab 推送事件，secret 即 Secret token
+	Gitea       ReceiverConfig `json:"gitea"`                 // /webhook/gitea 接收 Gitea/Forgejo 推送事件
+}
+
+// ReceiverConfig configures an endpoint receiving the webhooks of a Git hosting service
+type ReceiverConfig struct {
+	Secret string `json:"secret"` // 在托管平台上配置的 Webhook 密钥，为空时不校验签名
+}
+
+// DefaultSubscriberName is the name of the subscriber built from the legacy callbackUrl
+const DefaultSubscriberName = "default"
+
+// Subscriber receives the webhook notifications matching its filters. Empty filters match
+// everything; filter entries are exact values or path.Match patterns such as "release/*".
+type Subscriber struct {
+	Name         string            `json:"name"`                   // 订阅者名称，用于投递状态和重新发送
+	URL          string            `json:"url"`                    // 通知地址
+	Method       string            `json:"method,omitempty"`       // 请求方法，默认 POST
+	Secret       string            `json:"secret,omitempty"`       // 签名密钥，设置后添加 X-Webhook-Signature 请求头
+	Headers      map[string]string `json:"headers,omitempty"`      // 附加请求头
+	Events       []string          `json:"events,omitempty"`       // 只接收这些事件类型
+	Repositories []string          `json:"repositories,omitempty"` // 只接收这些仓库的通知
+	Branches     []string          `json:"branches,omitempty"`     // 只接收这些分支的通知
+}
+
+// GetName returns the subscriber name, falling back to its URL
+func (s *Subscriber) GetName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.URL
+}
+
+// AllSubscribers returns every webhook subscriber. The legacy callbackUrl is included
+// first, named DefaultSubscriberName, when it is set.
+func (w *WebhookConfig) AllSubscribers() []*Subscriber {
+	subscribers := make([]*Subscriber, 0, len(w.Subscribers)+1)
+	if w.CallbackURL != "" {
+		subscribers = append(subscribers, &Subscriber{
+			Name:   DefaultSubscriberName,
+			URL:    w.CallbackURL,
+			Method: w.Method,
+			Secret: w.Secret,
+		})
+	}
+	for _, subscriber := range w.Subscribers {
+		if subscriber != nil {
+			subscribers = append(subscribers, subscriber)
+		}
+	}
+	return subscribers
+}
+
+// FindSubscriber returns the webhook subscriber with the given name
+func (w *WebhookConfig) FindSubscriber(name string) (*Subscriber, bool) {
+	for _, subscriber := range w.AllSubscribers() {
+		if subscriber.GetName() == name {
+			return subscriber, true
+		}
+	}
+	return nil, false
+}
+
+// Webhook delivery defaults
+const (
+	DefaultWebhookMaxAttempts    = 3
+	DefaultWebhookInitialBackoff = time.Second
+	DefaultWebhookMaxBackoff     = 5 * time.Minute
+	DefaultWebhookOutboxInterval = time.Minute
+)
+
+// RetryConfig controls the exponential backoff between webhook delivery attempts
+type RetryConfig struct {
+	MaxAttempts    int      `json:"maxAttempts"`    // 每次发送的最大尝试次数，默认 3
+	InitialBackoff Duration `json:"initialBackoff"` // 首次重试前的等待时间，之后每次翻倍，默认 1s
+	MaxBackoff     Duration `json:"maxBackoff"`     // 重试等待时间上限，默认 5m
+}
+
+// Attempts returns the number of delivery attempts, falling back to DefaultWebhookMaxAttempts
+func (r RetryConfig) Attempts() int {
+	if r.MaxAttempts <= 0 {
+		return DefaultWebhookMaxAttempts
+	}
+	return r.MaxAttempts
+}
+
+// Initial returns the first backoff, falling back to DefaultWebhookInitialBackoff
+func (r RetryConfig) Initial() time.Duration {
+	if r.InitialBackoff <= 0 {
+		return DefaultWebhookInitialBackoff
+	}
+	return time.Duration(r.InitialBackoff)
+}
+
+// Max returns the backoff limit, falling back to DefaultWebhookMaxBackoff
+func (r RetryConfig) Max() time.Duration {
+	if r.MaxBackoff <= 0 {
+		return DefaultWebhookMaxBackoff
+	}
+	return time.Duration(r.MaxBackoff)
+}
+
+// OutboxConfig contains the configuration of the webhook outbox
+type OutboxConfig struct {
+	Path     string   `json:"path"`     // 队列数据库文件路径，默认为 <workingDir>/webhook-outbox.db
+	Interval Duration `json:"interval"` // 后台重新发送队列中通知的间隔，默认 1m
+}
+
+// ReplayInterval returns the interval of outbox replays, falling back to DefaultWebhookOutboxInterval
+func (o OutboxConfig) ReplayInterval() time.Duration {
+	if o.Interval <= 0 {
+		return DefaultWebhookOutboxInterval
+	}
+	return time.Duration(o.Interval)
+}
+
+// LogConfig contains logging configuration
+type LogConfig struct {
+	Level  string `json:"level"`  // 日志级别：debug、info（默认）、warn、error
+	Format string `json:"format"` // 日志格式：text（默认）或 json
+}
+
+// HistoryConfig contains run history configuration
+type HistoryConfig struct {
+	Path    string `json:"path"`    // 运行记录数据库文件路径，默认为 <workingDir>/history.db
+	MaxRuns int    `json:"maxRuns"` // 保留的最大运行记录数，默认 1000
+}
+
+// HistoryPath returns the path of the run history database
+func (c *Config) HistoryPath() string {
+	if c.History.Path != "" {
+		return c.History.Path
+	}
+	return filepath.Join(c.Git.WorkingDir, "history.db")
+}
+
+// OutboxPath returns the path of the webhook outbox database
+func (c *Config) OutboxPath() string {
+	if c.Webhook.Outbox.Path != "" {
+		return c.Webhook.Outbox.Path
+	}
+	return filepath.Join(c.Git.WorkingDir, "webhook-outbox.db")
 }
 
 // ScheduleConfig contains scheduling configuration
@@ -256,14 +914,16 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
-	// 设置默认值
-	if config.Git.MainRepo.Branch == "" {
-		config.Git.MainRepo.Branch = "main"
-	}
-
 	// 使用环境变量覆盖配置
 	OverrideWithEnv(&config)
 
+	// 设置默认值
+	for _, repo := range config.Git.WatchedRepositories() {
+		if repo.Branch == "" {
+			repo.Branch = "main"
+		}
+	}
+
 	// 验证配置
 	if err := validateConfig(&config); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
@@ -280,6 +940,15 @@ func OverrideWithEnv(config *Config) {
 	}
 
 	// Git Main Repo config
+	if config.Git.MainRepo == nil {
+		config.Git.MainRepo = &Repository{}
+	}
+	if name := os.Getenv(EnvGitMainRepoName); name != "" {
+		config.Git.MainRepo.Name = name
+	}
+	if config.Git.MainRepo.Name == "" {
+		config.Git.MainRepo.Name = DefaultRepositoryName
+	}
 	if url := os.Getenv(EnvGitMainRepoURL); url != "" {
 		config.Git.MainRepo.URL = url
 	}
@@ -292,6 +961,9 @@ func OverrideWithEnv(config *Config) {
 	if workingDir := os.Getenv(EnvGitWorkingDir); workingDir != "" {
 		config.Git.WorkingDir = workingDir
 	}
+	if backend := os.Getenv(EnvGitBackend); backend != "" {
+		config.Git.Backend = backend
+	}
 	if useSubmodules, exists := getEnvBool(EnvGitUseSubmodules); exists {
 		config.Git.UseSubmodules = useSubmodules
 	}
@@ -326,27 +998,85 @@ func OverrideWithEnv(config *Config) {
 	if method := os.Getenv(EnvWebhookMethod); method != "" {
 		config.Webhook.Method = method
 	}
+	if maxAttempts, exists := getEnvInt(EnvWebhookRetryMaxAttempts); exists {
+		config.Webhook.Retry.MaxAttempts = maxAttempts
+	}
+	if backoff, exists := getEnvDuration(EnvWebhookRetryInitialBackoff); exists {
+		config.Webhook.Retry.InitialBackoff = Duration(backoff)
+	}
+	if backoff, exists := getEnvDuration(EnvWebhookRetryMaxBackoff); exists {
+		config.Webhook.Retry.MaxBackoff = Duration(backoff)
+	}
+	if path := os.Getenv(EnvWebhookOutboxPath); path != "" {
+		config.Webhook.Outbox.Path = path
+	}
+	if interval, exists := getEnvDuration(EnvWebhookOutboxInterval); exists {
+		config.Webhook.Outbox.Interval = Duration(interval)
+	}
+	if secret, exists := os.LookupEnv(EnvWebhookGitHubSecret); exists {
+		config.Webhook.GitHub.Secret = secret
+	}
+	if secret, exists := os.LookupEnv(EnvWebhookGitLabSecret); exists {
+		config.Webhook.GitLab.Secret = secret
+	}
+	if secret, exists := os.LookupEnv(EnvWebhookGiteaSecret); exists {
+		config.Webhook.Gitea.Secret = secret
+	}
 
 	// Schedule config
 	if interval, exists := getEnvDuration(EnvScheduleCheckInterval); exists {
 		config.Schedule.CheckInterval = interval
 	}
 
+	// Log config
+	if level := os.Getenv(EnvLogLevel); level != "" {
+		config.Log.Level = level
+	}
+	if format := os.Getenv(EnvLogFormat); format != "" {
+		config.Log.Format = format
+	}
+
+	// History config
+	if path := os.Getenv(EnvHistoryPath); path != "" {
+		config.History.Path = path
+	}
+	if maxRuns, exists := getEnvInt(EnvHistoryMaxRuns); exists {
+		config.History.MaxRuns = maxRuns
+	}
+
 	// Git auto commit config
 	if autoCommit, exists := getEnvBool(EnvGitAutoCommit); exists {
 		config.Git.AutoCommit = autoCommit
 	}
+	if dryRun, exists := getEnvBool(EnvGitDryRun); exists {
+		config.Git.DryRun = dryRun
+	}
 	if userName := os.Getenv(EnvGitCommitUserName); userName != "" {
 		config.Git.CommitConfig.UserName = userName
 	}
 	if userEmail := os.Getenv(EnvGitCommitUserEmail); userEmail != "" {
 		config.Git.CommitConfig.UserEmail = userEmail
 	}
+	if timeout, exists := getEnvDuration(EnvGitCloneTimeout); exists {
+		config.Git.Timeouts.Clone = Duration(timeout)
+	}
+	if timeout, exists := getEnvDuration(EnvGitFetchTimeout); exists {
+		config.Git.Timeouts.Fetch = Duration(timeout)
+	}
+	if timeout, exists := getEnvDuration(EnvGitPushTimeout); exists {
+		config.Git.Timeouts.Push = Duration(timeout)
+	}
+	if token := os.Getenv(EnvGitDeliveryToken); token != "" {
+		config.Git.Delivery.Token = token
+	}
 	if commitMessage := os.Getenv(EnvGitCommitMessage); commitMessage != "" {
 		config.Git.CommitConfig.Message = commitMessage
 	}
 
 	// Artifacts Repo config
+	if config.Git.ArtifactsRepo == nil {
+		config.Git.ArtifactsRepo = &ArtifactsRepo{}
+	}
 	if url := os.Getenv(EnvGitArtifactsRepoURL); url != "" {
 		config.Git.ArtifactsRepo.URL = url
 	}
@@ -362,6 +1092,21 @@ func OverrideWithEnv(config *Config) {
 	if useMainCommit, exists := getEnvBool("GIT_WATCHER_ARTIFACTS_USE_MAIN_COMMIT"); exists {
 		config.Git.ArtifactsRepo.UseMainCommit = useMainCommit
 	}
+	if strategy := os.Getenv(EnvGitArtifactsConflict); strategy != "" {
+		config.Git.ArtifactsRepo.ConflictStrategy = strategy
+	}
+	if command := os.Getenv(EnvGitArtifactsJsonnet); command != "" {
+		config.Git.ArtifactsRepo.JsonnetCommand = command
+	}
+	if skip, exists := getEnvBool(EnvGitArtifactsSkipJsonnet); exists {
+		config.Git.ArtifactsRepo.SkipJsonnetEvaluation = skip
+	}
+	if format := os.Getenv(EnvGitArtifactsFormat); format != "" {
+		config.Git.ArtifactsRepo.Format = format
+	}
+	if scheme := os.Getenv(EnvGitArtifactsVersionScheme); scheme != "" {
+		config.Git.ArtifactsRepo.VersionScheme = scheme
+	}
 
 	// 只有在不使用主仓库认证时才设置制品仓库的认证信息
 	if !config.Git.ArtifactsRepo.UseMainAuth {
@@ -422,21 +1167,178 @@ func getEnvDuration(key string) (time.Duration, bool) {
 	return 0, false
 }
 
+// validateSubmodulePolicy validates a submodule update policy
+func validateSubmodulePolicy(policy *SubmodulePolicy) error {
+	if policy == nil || policy.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	for _, pattern := range append(append([]string{policy.Path}, policy.Branches...), policy.Tags...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	switch policy.GetTrack() {
+	case TrackBranch, TrackFrozen, TrackTag:
+	default:
+		return fmt.Errorf("unknown track %q, expected %s, %s or %s", policy.Track, TrackBranch, TrackTag, TrackFrozen)
+	}
+	return nil
+}
+
+// validateDelivery validates a delivery configuration
+func validateDelivery(delivery *DeliveryConfig) error {
+	if delivery == nil {
+		return nil
+	}
+	switch delivery.Mode {
+	case "", DeliveryPush, DeliveryPullRequest:
+	default:
+		return fmt.Errorf("unknown delivery mode %q, expected %s or %s", delivery.Mode, DeliveryPush, DeliveryPullRequest)
+	}
+	switch delivery.Provider {
+	case "", "github", "gitlab", "gitea":
+	default:
+		return fmt.Errorf("unknown delivery provider %q, expected github, gitlab or gitea", delivery.Provider)
+	}
+	switch delivery.MergeMethod {
+	case "", "merge", "squash", "rebase":
+	default:
+		return fmt.Errorf("unknown merge method %q, expected merge, squash or rebase", delivery.MergeMethod)
+	}
+	return nil
+}
+
+// validateFormat validates a manifest format
+func validateFormat(format string) error {
+	switch format {
+	case FormatJsonnet, FormatYAML, FormatHelm, FormatKustomize, FormatTOML:
+		return nil
+	}
+	return fmt.Errorf("unknown format %q, expected %s, %s, %s, %s or %s", format,
+		FormatJsonnet, FormatYAML, FormatHelm, FormatKustomize, FormatTOML)
+}
+
+// validateVersionScheme validates a version scheme
+func validateVersionScheme(scheme string) error {
+	switch scheme {
+	case VersionSchemeBuild, VersionSchemeSemver, VersionSchemeCalver:
+		return nil
+	}
+	return fmt.Errorf("unknown version scheme %q, expected %s, %s or %s", scheme,
+		VersionSchemeBuild, VersionSchemeSemver, VersionSchemeCalver)
+}
+
+// validateManifestRule validates a manifest rule of the artifacts repository
+func validateManifestRule(rule ManifestRule) error {
+	for _, pattern := range []string{rule.Type, rule.Repository, rule.Package} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	if rule.Format != "" {
+		if err := validateFormat(rule.Format); err != nil {
+			return err
+		}
+	}
+	if rule.Scheme != "" {
+		if err := validateVersionScheme(rule.Scheme); err != nil {
+			return err
+		}
+	}
+	for name, text := range map[string]string{"file": rule.File, "key": rule.Key, "branch": rule.Branch} {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return fmt.Errorf("invalid %s template: %w", name, err)
+		}
+	}
+	if rule.File != "" && !filepath.IsLocal(rule.File) {
+		return fmt.Errorf("file %q must be a relative path inside the artifacts repository", rule.File)
+	}
+	return nil
+}
+
+// validateEnvironments validates the promotion environments of the artifacts repository
+func validateEnvironments(repo *ArtifactsRepo) error {
+	names := make(map[string]bool)
+	locations := make(map[string]string) // Environment name by target branch and directory
+	for i, env := range repo.Environments {
+		if env.Name == "" {
+			return fmt.Errorf("environments[%d]: name is required", i)
+		}
+		if names[env.Name] {
+			return fmt.Errorf("environments[%d]: duplicate environment %q", i, env.Name)
+		}
+		names[env.Name] = true
+		if env.Path != "" && !filepath.IsLocal(env.Path) {
+			return fmt.Errorf("environment %s: path %q must be a relative path inside the artifacts repository", env.Name, env.Path)
+		}
+		if len(env.Approvers) > 0 && !env.Approval {
+			return fmt.Errorf("environment %s: approvers are set but approval is not required", env.Name)
+		}
+		location := repo.TargetBranch(&repo.Environments[i]) + ":" + path.Clean("/"+env.Path)
+		if other, ok := locations[location]; ok {
+			return fmt.Errorf("environments %s and %s use the same branch and path", other, env.Name)
+		}
+		locations[location] = env.Name
+	}
+	return nil
+}
+
 // validateConfig validates the configuration values
 func validateConfig(config *Config) error {
 	if config.Server.Port <= 0 {
 		return fmt.Errorf("server port must be greater than zero")
 	}
 
-	// Validate main repository configuration
-	if config.Git.MainRepo.URL == "" {
-		return fmt.Errorf("main repository URL is required")
+	if err := validateDelivery(&config.Git.Delivery); err != nil {
+		return fmt.Errorf("git delivery: %w", err)
 	}
-	if config.Git.MainRepo.Branch == "" {
-		return fmt.Errorf("main repository branch is required")
+
+	// Validate main repository configuration
+	repos := config.Git.WatchedRepositories()
+	if len(repos) == 0 {
+		return fmt.Errorf("at least one main repository is required")
 	}
-	if config.Git.MainRepo.Directory == "" {
-		return fmt.Errorf("main repository directory is required")
+	names := make(map[string]bool)
+	directories := make(map[string]bool)
+	for i, repo := range repos {
+		if repo.URL == "" {
+			return fmt.Errorf("repository #%d URL is required", i)
+		}
+		if repo.Branch == "" {
+			return fmt.Errorf("repository %s branch is required", repo.GetName())
+		}
+		if repo.Directory == "" {
+			return fmt.Errorf("repository %s directory is required", repo.GetName())
+		}
+		if names[repo.GetName()] {
+			return fmt.Errorf("duplicate repository name: %s", repo.GetName())
+		}
+		if directories[repo.Directory] {
+			return fmt.Errorf("duplicate repository directory: %s", repo.Directory)
+		}
+		for _, pattern := range append(append([]string{}, repo.Tags...), repo.SubmoduleTags...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("repository %s has an invalid tag pattern %q: %w", repo.GetName(), pattern, err)
+			}
+		}
+		for j, policy := range repo.SubmodulePolicies {
+			if err := validateSubmodulePolicy(policy); err != nil {
+				return fmt.Errorf("repository %s submodule policy #%d: %w", repo.GetName(), j, err)
+			}
+		}
+		if err := validateDelivery(repo.Delivery); err != nil {
+			return fmt.Errorf("repository %s: %w", repo.GetName(), err)
+		}
+		if delivery := config.Git.DeliveryFor(repo); delivery.IsPullRequest() && delivery.Token == "" {
+			return fmt.Errorf("repository %s: pull request delivery requires a token", repo.GetName())
+		}
+		// Auto-commits diverge from the remote branch when it moves before they are pushed,
+		// and the go-git backend only fast-forwards when rebasing onto it
+		if config.Git.Backend == "go-git" && config.Git.AutoCommitFor(repo) {
+			return fmt.Errorf("repository %s: autoCommit is not supported by the go-git backend, use the cli backend", repo.GetName())
+		}
+		names[repo.GetName()] = true
+		directories[repo.Directory] = true
 	}
 
 	// Validate artifacts repository configuration
@@ -449,10 +1351,62 @@ func validateConfig(config *Config) error {
 	if config.Git.ArtifactsRepo.Directory == "" {
 		return fmt.Errorf("artifacts repository directory is required")
 	}
+	if err := validateDelivery(config.Git.ArtifactsRepo.Delivery); err != nil {
+		return fmt.Errorf("artifacts repository: %w", err)
+	}
+	if delivery := config.Git.ArtifactsDelivery(); delivery.IsPullRequest() && delivery.Token == "" {
+		return fmt.Errorf("artifacts repository: pull request delivery requires a token")
+	}
+	switch strategy := config.Git.ArtifactsRepo.GetConflictStrategy(); strategy {
+	case ConflictTheirs, ConflictRebase:
+		// Both merge or rebase diverged branches, which the go-git backend cannot do
+		if config.Git.Backend == "go-git" {
+			return fmt.Errorf("artifacts repository: conflict strategy %s is not supported by the go-git backend, use %s, %s or %s",
+				strategy, ConflictReapply, ConflictFail, ConflictPullRequest)
+		}
+	case ConflictFail, ConflictReapply:
+	case ConflictPullRequest:
+		if config.Git.ArtifactsDelivery().Token == "" {
+			return fmt.Errorf("artifacts repository: conflict strategy %s requires a delivery token", strategy)
+		}
+	default:
+		return fmt.Errorf("artifacts repository: unknown conflict strategy %q, expected %s, %s, %s, %s or %s", strategy,
+			ConflictTheirs, ConflictFail, ConflictRebase, ConflictReapply, ConflictPullRequest)
+	}
+	if err := validateFormat(config.Git.ArtifactsRepo.GetFormat()); err != nil {
+		return fmt.Errorf("artifacts repository: %w", err)
+	}
+	if err := validateVersionScheme(config.Git.ArtifactsRepo.GetVersionScheme()); err != nil {
+		return fmt.Errorf("artifacts repository: %w", err)
+	}
+	for i, rule := range config.Git.ArtifactsRepo.Manifests {
+		if err := validateManifestRule(rule); err != nil {
+			return fmt.Errorf("artifacts repository: manifests[%d]: %w", i, err)
+		}
+	}
+	if err := validateEnvironments(config.Git.ArtifactsRepo); err != nil {
+		return fmt.Errorf("artifacts repository: %w", err)
+	}
 
 	// Validate webhook configuration
-	if config.Webhook.CallbackURL == "" {
-		return fmt.Errorf("webhook callback URL is required")
+	subscribers := config.Webhook.AllSubscribers()
+	if len(subscribers) == 0 {
+		return fmt.Errorf("webhook callback URL or at least one subscriber is required")
+	}
+	subscriberNames := make(map[string]bool)
+	for i, subscriber := range subscribers {
+		if subscriber.URL == "" {
+			return fmt.Errorf("webhook subscriber #%d URL is required", i)
+		}
+		if subscriberNames[subscriber.GetName()] {
+			return fmt.Errorf("duplicate webhook subscriber name: %s", subscriber.GetName())
+		}
+		subscriberNames[subscriber.GetName()] = true
+		for _, pattern := range append(append(append([]string{}, subscriber.Events...), subscriber.Repositories...), subscriber.Branches...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("webhook subscriber %s has an invalid filter %q: %w", subscriber.GetName(), pattern, err)
+			}
+		}
 	}
 
 	// Validate schedule configuration
@@ -0,0 +1,270 @@
+// Package forge opens pull requests (merge requests on GitLab) through the REST APIs of
+// GitHub, GitLab and Gitea/Forgejo.
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/logging"
+)
+
+// Supported providers
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+	ProviderGitea  = "gitea"
+)
+
+// PullRequest is an open pull request
+type PullRequest struct {
+	Provider  string `json:"provider"`
+	Number    int    `json:"number"`
+	URL       string `json:"url,omitempty"`
+	Head      string `json:"head"`
+	Base      string `json:"base"`
+	Title     string `json:"title,omitempty"`
+	Created   bool   `json:"created"`   // The pull request was opened by this delivery
+	AutoMerge bool   `json:"autoMerge"` // Auto-merge was enabled when it was opened
+
+	body   string
+	nodeID string // GraphQL id of GitHub pull requests
+}
+
+// Request describes the pull request to open or update
+type Request struct {
+	Head  string `json:"head"` // Branch holding the changes
+	Base  string `json:"base"` // Branch the changes are merged into
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// provider talks to the API of one kind of forge
+type provider interface {
+	find(ctx context.Context, head, base string) (*PullRequest, error)
+	create(ctx context.Context, req Request) (*PullRequest, error)
+	update(ctx context.Context, pr *PullRequest, req Request) error
+	addLabels(ctx context.Context, pr *PullRequest, labels []string) error
+	enableAutoMerge(ctx context.Context, pr *PullRequest, method string) error
+}
+
+// Client opens and updates the pull requests of one repository
+type Client struct {
+	config   *config.DeliveryConfig
+	provider provider
+}
+
+// New creates a client for the repository at remoteURL. The provider, API URL and project
+// path are taken from the delivery configuration and inferred from the remote URL when unset.
+func New(cfg *config.DeliveryConfig, remoteURL string) (*Client, error) {
+	scheme, host, project := splitRemoteURL(remoteURL)
+	kind := cfg.Provider
+	if kind == "" {
+		kind = inferProvider(host)
+	}
+	if kind == "" {
+		return nil, fmt.Errorf("cannot infer the provider of %s, set delivery.provider", remoteURL)
+	}
+	if cfg.Project != "" {
+		project = cfg.Project
+	}
+	if project == "" {
+		return nil, fmt.Errorf("cannot infer the project of %s, set delivery.project", remoteURL)
+	}
+
+	apiURL := strings.TrimSuffix(cfg.APIURL, "/")
+	if apiURL == "" {
+		if host == "" {
+			return nil, fmt.Errorf("cannot infer the API URL of %s, set delivery.apiUrl", remoteURL)
+		}
+		apiURL = defaultAPIURL(kind, scheme, host)
+	}
+
+	api := &api{
+		baseURL: apiURL,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+	client := &Client{config: cfg}
+	switch kind {
+	case ProviderGitHub:
+		api.header = map[string]string{"Authorization": "Bearer " + cfg.Token, "Accept": "application/vnd.github+json"}
+		client.provider = &github{api: api, project: project}
+	case ProviderGitLab:
+		api.header = map[string]string{"PRIVATE-TOKEN": cfg.Token}
+		client.provider = &gitlab{api: api, project: project}
+	case ProviderGitea:
+		api.header = map[string]string{"Authorization": "token " + cfg.Token}
+		client.provider = &gitea{api: api, project: project}
+	default:
+		return nil, fmt.Errorf("unknown provider %q", kind)
+	}
+	return client, nil
+}
+
+// Find returns the open pull request from head into base, nil when there is none
+func (c *Client) Find(ctx context.Context, head, base string) (*PullRequest, error) {
+	return c.provider.find(ctx, head, base)
+}
+
+// Ensure opens a pull request for req or, when one is already open from its head into its
+// base, updates its title and description. Labels and auto-merge are only set on pull
+// requests it opens, so changes made by reviewers are kept.
+func (c *Client) Ensure(ctx context.Context, req Request) (*PullRequest, error) {
+	logger := logging.FromContext(ctx)
+	pr, err := c.provider.find(ctx, req.Head, req.Base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up pull request: %w", err)
+	}
+	if pr != nil {
+		if pr.Title != req.Title || pr.body != req.Body {
+			if err := c.provider.update(ctx, pr, req); err != nil {
+				return pr, fmt.Errorf("failed to update pull request #%d: %w", pr.Number, err)
+			}
+			pr.Title, pr.body = req.Title, req.Body
+			logger.Info("updated pull request", "number", pr.Number, "url", pr.URL)
+		}
+		return pr, nil
+	}
+
+	pr, err = c.provider.create(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pull request: %w", err)
+	}
+	pr.Created = true
+	logger.Info("opened pull request", "number", pr.Number, "url", pr.URL)
+
+	if len(c.config.Labels) > 0 {
+		if err := c.provider.addLabels(ctx, pr, c.config.Labels); err != nil {
+			logger.Warn("failed to label pull request", "number", pr.Number, "error", err)
+		}
+	}
+	if c.config.AutoMerge {
+		if err := c.provider.enableAutoMerge(ctx, pr, c.mergeMethod()); err != nil {
+			logger.Warn("failed to enable auto-merge", "number", pr.Number, "error", err)
+		} else {
+			pr.AutoMerge = true
+		}
+	}
+	return pr, nil
+}
+
+// mergeMethod returns the configured merge method, merge by default
+func (c *Client) mergeMethod() string {
+	if c.config.MergeMethod == "" {
+		return "merge"
+	}
+	return c.config.MergeMethod
+}
+
+// splitRemoteURL splits a remote URL into the scheme of its web server, its host, with the
+// port for HTTP URLs, and its project path without ".git"
+func splitRemoteURL(remote string) (string, string, string) {
+	scheme, host, path := "https", "", ""
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return scheme, "", ""
+		}
+		host, path = u.Hostname(), u.Path
+		if u.Scheme == "http" || u.Scheme == "https" {
+			scheme, host = u.Scheme, u.Host
+		}
+	} else if i := strings.Index(remote, ":"); i > 0 && !strings.Contains(remote[:i], "/") {
+		host, path = remote[:i], remote[i+1:]
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+	}
+	return scheme, host, strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+}
+
+// inferProvider guesses the provider from the host name of a repository
+func inferProvider(host string) string {
+	host = strings.ToLower(host)
+	switch {
+	case strings.Contains(host, "github"):
+		return ProviderGitHub
+	case strings.Contains(host, "gitlab"):
+		return ProviderGitLab
+	case strings.Contains(host, "gitea"), strings.Contains(host, "forgejo"), strings.Contains(host, "codeberg"):
+		return ProviderGitea
+	}
+	return ""
+}
+
+// defaultAPIURL returns the REST API root of a forge host
+func defaultAPIURL(kind, scheme, host string) string {
+	switch kind {
+	case ProviderGitHub:
+		if host == "github.com" {
+			return "https://api.github.com"
+		}
+		return scheme + "://" + host + "/api/v3" // GitHub Enterprise Server
+	case ProviderGitLab:
+		return scheme + "://" + host + "/api/v4"
+	}
+	return scheme + "://" + host + "/api/v1"
+}
+
+// api sends JSON requests to a REST API
+type api struct {
+	baseURL string
+	header  map[string]string
+	client  *http.Client
+}
+
+// do sends a request with in, when not nil, as JSON body and decodes the response into out,
+// when not nil. Responses with a status other than 2xx are returned as errors.
+func (a *api) do(ctx context.Context, method, path string, in, out interface{}) error {
+	target := path
+	if !strings.Contains(path, "://") {
+		target = a.baseURL + path
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, value := range a.header {
+		req.Header.Set(key, value)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response of %s %s: %w", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to decode response of %s %s: %w", method, path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+// fakeForge is an API server answering requests with canned responses
+type fakeForge struct {
+	t         *testing.T
+	server    *httptest.Server
+	mu        sync.Mutex
+	responses map[string]string // Body by "METHOD /path?query", 404 when missing
+	requests  []fakeRequest
+}
+
+// fakeRequest is a request received by a fakeForge
+type fakeRequest struct {
+	target string // "METHOD /path?query"
+	header http.Header
+	body   map[string]interface{}
+}
+
+func newFakeForge(t *testing.T, responses map[string]string) *fakeForge {
+	f := &fakeForge{t: t, responses: responses}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeForge) serve(w http.ResponseWriter, r *http.Request) {
+	target := r.Method + " " + r.URL.RequestURI()
+	req := fakeRequest{target: target, header: r.Header}
+	if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+		if err := json.Unmarshal(data, &req.body); err != nil {
+			f.t.Errorf("%s: invalid body %q", target, data)
+		}
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	response, ok := f.responses[target]
+	f.mu.Unlock()
+	if !ok {
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, response)
+}
+
+// targets returns the targets of the requests received
+func (f *fakeForge) targets() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	targets := make([]string, len(f.requests))
+	for i, req := range f.requests {
+		targets[i] = req.target
+	}
+	return targets
+}
+
+// request returns the last request received for a target
+func (f *fakeForge) request(target string) *fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.requests) - 1; i >= 0; i-- {
+		if f.requests[i].target == target {
+			return &f.requests[i]
+		}
+	}
+	f.t.Fatalf("no request %s, got %v", target, f.targets())
+	return nil
+}
+
+// checkTargets fails the test when the requests received are not the expected ones
+func (f *fakeForge) checkTargets(want ...string) {
+	f.t.Helper()
+	if got := f.targets(); !reflect.DeepEqual(got, want) {
+		f.t.Errorf("requests = %q, want %q", got, want)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.DeliveryConfig
+		remote   string
+		provider string
+		apiURL   string
+		project  string
+		err      string
+	}{
+		{
+			name:     "github.com over SSH",
+			remote:   "git@github.com:owner/name.git",
+			provider: ProviderGitHub,
+			apiURL:   "https://api.github.com",
+			project:  "owner/name",
+		},
+		{
+			name:     "GitHub Enterprise over HTTP",
+			remote:   "http://github.example.com:8080/owner/name.git",
+			provider: ProviderGitHub,
+			apiURL:   "http://github.example.com:8080/api/v3",
+			project:  "owner/name",
+		},
+		{
+			name:     "GitLab subgroup over SSH URL",
+			remote:   "ssh://git@gitlab.example.com:2222/group/sub/name.git",
+			provider: ProviderGitLab,
+			apiURL:   "https://gitlab.example.com/api/v4",
+			project:  "group/sub/name",
+		},
+		{
+			name:     "Codeberg",
+			remote:   "https://codeberg.org/owner/name",
+			provider: ProviderGitea,
+			apiURL:   "https://codeberg.org/api/v1",
+			project:  "owner/name",
+		},
+		{
+			name:     "configured provider, API URL and project",
+			cfg:      config.DeliveryConfig{Provider: ProviderGitea, APIURL: "https://git.example.com/api/v1/", Project: "team/app"},
+			remote:   "git@git.example.com:mirror/app.git",
+			provider: ProviderGitea,
+			apiURL:   "https://git.example.com/api/v1",
+			project:  "team/app",
+		},
+		{
+			name:   "unknown host",
+			remote: "git@git.example.com:owner/name.git",
+			err:    "cannot infer the provider",
+		},
+		{
+			name:   "local path",
+			cfg:    config.DeliveryConfig{Provider: ProviderGitHub},
+			remote: "/srv/git/name.git",
+			err:    "cannot infer the project",
+		},
+		{
+			name:   "unknown provider",
+			cfg:    config.DeliveryConfig{Provider: "bitbucket"},
+			remote: "git@bitbucket.org:owner/name.git",
+			err:    `unknown provider "bitbucket"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := New(&tt.cfg, tt.remote)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("New() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			var (
+				provider, project string
+				api               *api
+			)
+			switch p := client.provider.(type) {
+			case *github:
+				provider, project, api = ProviderGitHub, p.project, p.api
+			case *gitlab:
+				provider, project, api = ProviderGitLab, p.project, p.api
+			case *gitea:
+				provider, project, api = ProviderGitea, p.project, p.api
+			}
+			if provider != tt.provider || api.baseURL != tt.apiURL || project != tt.project {
+				t.Errorf("New() = %s %s %s, want %s %s %s", provider, api.baseURL, project, tt.provider, tt.apiURL, tt.project)
+			}
+		})
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	f := newFakeForge(t, nil)
+	client, err := New(&config.DeliveryConfig{Provider: ProviderGitHub, APIURL: f.server.URL}, "git@github.com:owner/name.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Ensure(context.Background(), Request{Head: "feature", Base: "main", Title: "Update"})
+	if err == nil || !strings.Contains(err.Error(), "returned status 404: {\"message\":\"Not Found\"}") {
+		t.Errorf("Ensure() error = %v, want the status and body of the response", err)
+	}
+}
@@ -0,0 +1,111 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+)
+
+// gitea implements provider with the Gitea API, also served by Forgejo
+type gitea struct {
+	api     *api
+	project string // owner/name
+}
+
+// giteaPull is the part of a Gitea pull request used here
+type giteaPull struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	Head    struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+// pullRequest converts a Gitea pull request
+func (p giteaPull) pullRequest() *PullRequest {
+	return &PullRequest{
+		Provider: ProviderGitea,
+		Number:   p.Number,
+		URL:      p.HTMLURL,
+		Head:     p.Head.Ref,
+		Base:     p.Base.Ref,
+		Title:    p.Title,
+		body:     p.Body,
+	}
+}
+
+// find pages through the open pull requests, the API cannot filter them by branch
+func (g *gitea) find(ctx context.Context, head, base string) (*PullRequest, error) {
+	for page := 1; ; page++ {
+		var pulls []giteaPull
+		if err := g.api.do(ctx, "GET", fmt.Sprintf("/repos/%s/pulls?state=open&limit=50&page=%d", g.project, page), nil, &pulls); err != nil {
+			return nil, err
+		}
+		for _, pull := range pulls {
+			if pull.Head.Ref == head && pull.Base.Ref == base {
+				return pull.pullRequest(), nil
+			}
+		}
+		if len(pulls) < 50 {
+			return nil, nil
+		}
+	}
+}
+
+func (g *gitea) create(ctx context.Context, req Request) (*PullRequest, error) {
+	in := map[string]interface{}{
+		"title": req.Title,
+		"body":  req.Body,
+		"head":  req.Head,
+		"base":  req.Base,
+	}
+	var pull giteaPull
+	if err := g.api.do(ctx, "POST", fmt.Sprintf("/repos/%s/pulls", g.project), in, &pull); err != nil {
+		return nil, err
+	}
+	return pull.pullRequest(), nil
+}
+
+func (g *gitea) update(ctx context.Context, pr *PullRequest, req Request) error {
+	in := map[string]interface{}{"title": req.Title, "body": req.Body}
+	return g.api.do(ctx, "PATCH", fmt.Sprintf("/repos/%s/pulls/%d", g.project, pr.Number), in, nil)
+}
+
+// addLabels looks up the ids of the labels, the API does not accept label names
+func (g *gitea) addLabels(ctx context.Context, pr *PullRequest, labels []string) error {
+	var existing []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := g.api.do(ctx, "GET", fmt.Sprintf("/repos/%s/labels?limit=50", g.project), nil, &existing); err != nil {
+		return err
+	}
+	ids := make([]int64, 0, len(labels))
+	for _, label := range labels {
+		found := false
+		for _, candidate := range existing {
+			if candidate.Name == label {
+				ids = append(ids, candidate.ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("label %q does not exist", label)
+		}
+	}
+	in := map[string]interface{}{"labels": ids}
+	return g.api.do(ctx, "POST", fmt.Sprintf("/repos/%s/issues/%d/labels", g.project, pr.Number), in, nil)
+}
+
+func (g *gitea) enableAutoMerge(ctx context.Context, pr *PullRequest, method string) error {
+	in := map[string]interface{}{
+		"Do":                        method,
+		"merge_when_checks_succeed": true,
+	}
+	return g.api.do(ctx, "POST", fmt.Sprintf("/repos/%s/pulls/%d/merge", g.project, pr.Number), in, nil)
+}
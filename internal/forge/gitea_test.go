@@ -0,0 +1,152 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+func newGiteaClient(t *testing.T, f *fakeForge, cfg config.DeliveryConfig) *Client {
+	cfg.Provider, cfg.APIURL, cfg.Token = ProviderGitea, f.server.URL+"/api/v1", "secret"
+	client, err := New(&cfg, "https://gitea.example.com/owner/name.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// giteaPulls returns a page of n pull requests from other branches
+func giteaPulls(t *testing.T, n int) string {
+	pulls := make([]giteaPull, n)
+	for i := range pulls {
+		pulls[i].Number = i + 100
+		pulls[i].Head.Ref, pulls[i].Base.Ref = "other", "main"
+	}
+	data, err := json.Marshal(pulls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestGiteaFind(t *testing.T) {
+	tests := []struct {
+		name    string
+		pages   []string
+		number  int
+		targets []string
+	}{
+		{
+			name:    "first page",
+			pages:   []string{`[{"number": 5, "head": {"ref": "feature"}, "base": {"ref": "main"}}]`},
+			number:  5,
+			targets: []string{"GET /api/v1/repos/owner/name/pulls?state=open&limit=50&page=1"},
+		},
+		{
+			name: "second page",
+			pages: []string{
+				giteaPulls(t, 50),
+				`[{"number": 5, "head": {"ref": "feature"}, "base": {"ref": "main"}}]`,
+			},
+			number: 5,
+			targets: []string{
+				"GET /api/v1/repos/owner/name/pulls?state=open&limit=50&page=1",
+				"GET /api/v1/repos/owner/name/pulls?state=open&limit=50&page=2",
+			},
+		},
+		{
+			name:    "other base",
+			pages:   []string{`[{"number": 5, "head": {"ref": "feature"}, "base": {"ref": "release"}}]`},
+			targets: []string{"GET /api/v1/repos/owner/name/pulls?state=open&limit=50&page=1"},
+		},
+		{
+			name:  "last full page",
+			pages: []string{giteaPulls(t, 50), `[]`},
+			targets: []string{
+				"GET /api/v1/repos/owner/name/pulls?state=open&limit=50&page=1",
+				"GET /api/v1/repos/owner/name/pulls?state=open&limit=50&page=2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := map[string]string{}
+			for i, page := range tt.pages {
+				responses["GET /api/v1/repos/owner/name/pulls?state=open&limit=50&page="+strconv.Itoa(i+1)] = page
+			}
+			f := newFakeForge(t, responses)
+			client := newGiteaClient(t, f, config.DeliveryConfig{})
+
+			pr, err := client.Find(context.Background(), "feature", "main")
+			if err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			switch {
+			case tt.number == 0 && pr != nil:
+				t.Errorf("Find() = %+v, want none", pr)
+			case tt.number != 0 && (pr == nil || pr.Number != tt.number):
+				t.Errorf("Find() = %+v, want #%d", pr, tt.number)
+			}
+			f.checkTargets(tt.targets...)
+		})
+	}
+}
+
+func TestGiteaEnsureCreates(t *testing.T) {
+	f := newFakeForge(t, map[string]string{
+		"GET /api/v1/repos/owner/name/pulls?state=open&limit=50&page=1": `[]`,
+		"POST /api/v1/repos/owner/name/pulls": `{"number": 9, "html_url": "https://gitea.example.com/owner/name/pulls/9",
+			"title": "Update", "body": "Body", "head": {"ref": "feature"}, "base": {"ref": "main"}}`,
+		"GET /api/v1/repos/owner/name/labels?limit=50":  `[{"id": 1, "name": "bug"}, {"id": 4, "name": "release"}]`,
+		"POST /api/v1/repos/owner/name/issues/9/labels": `[]`,
+		"POST /api/v1/repos/owner/name/pulls/9/merge":   ``,
+	})
+	client := newGiteaClient(t, f, config.DeliveryConfig{Labels: []string{"release"}, AutoMerge: true, MergeMethod: "rebase"})
+
+	pr, err := client.Ensure(context.Background(), Request{Head: "feature", Base: "main", Title: "Update", Body: "Body"})
+	if err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+	want := &PullRequest{Provider: ProviderGitea, Number: 9, URL: "https://gitea.example.com/owner/name/pulls/9",
+		Head: "feature", Base: "main", Title: "Update", Created: true, AutoMerge: true, body: "Body"}
+	if !reflect.DeepEqual(pr, want) {
+		t.Errorf("Ensure() = %+v, want %+v", pr, want)
+	}
+	if got := f.request("POST /api/v1/repos/owner/name/pulls").header.Get("Authorization"); got != "token secret" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if got := f.request("POST /api/v1/repos/owner/name/issues/9/labels").body["labels"]; !reflect.DeepEqual(got, []interface{}{4.0}) {
+		t.Errorf("label ids = %v, want [4]", got)
+	}
+	wantMerge := map[string]interface{}{"Do": "rebase", "merge_when_checks_succeed": true}
+	if got := f.request("POST /api/v1/repos/owner/name/pulls/9/merge").body; !reflect.DeepEqual(got, wantMerge) {
+		t.Errorf("merge body = %v, want %v", got, wantMerge)
+	}
+}
+
+func TestGiteaMissingLabel(t *testing.T) {
+	f := newFakeForge(t, map[string]string{
+		"GET /api/v1/repos/owner/name/pulls?state=open&limit=50&page=1": `[]`,
+		"POST /api/v1/repos/owner/name/pulls":                           `{"number": 9, "head": {"ref": "feature"}, "base": {"ref": "main"}}`,
+		"GET /api/v1/repos/owner/name/labels?limit=50":                  `[{"id": 1, "name": "bug"}]`,
+	})
+	client := newGiteaClient(t, f, config.DeliveryConfig{})
+	provider := client.provider.(*gitea)
+
+	err := provider.addLabels(context.Background(), &PullRequest{Number: 9}, []string{"release"})
+	if err == nil || !strings.Contains(err.Error(), `label "release" does not exist`) {
+		t.Errorf("addLabels() error = %v", err)
+	}
+
+	// The pull request stays open when it cannot be labeled
+	client.config.Labels = []string{"release"}
+	pr, err := client.Ensure(context.Background(), Request{Head: "feature", Base: "main", Title: "Update"})
+	if err != nil || pr.Number != 9 || !pr.Created {
+		t.Errorf("Ensure() = %+v, %v", pr, err)
+	}
+}
@@ -0,0 +1,110 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// github implements provider with the GitHub REST API
+type github struct {
+	api     *api
+	project string // owner/name
+}
+
+// githubPull is the part of a GitHub pull request used here
+type githubPull struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	NodeID  string `json:"node_id"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	Head    struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+// pullRequest converts a GitHub pull request
+func (p githubPull) pullRequest() *PullRequest {
+	return &PullRequest{
+		Provider: ProviderGitHub,
+		Number:   p.Number,
+		URL:      p.HTMLURL,
+		Head:     p.Head.Ref,
+		Base:     p.Base.Ref,
+		Title:    p.Title,
+		body:     p.Body,
+		nodeID:   p.NodeID,
+	}
+}
+
+func (g *github) find(ctx context.Context, head, base string) (*PullRequest, error) {
+	owner, _, _ := strings.Cut(g.project, "/")
+	query := url.Values{"state": {"open"}, "head": {owner + ":" + head}, "base": {base}}
+	var pulls []githubPull
+	if err := g.api.do(ctx, "GET", fmt.Sprintf("/repos/%s/pulls?%s", g.project, query.Encode()), nil, &pulls); err != nil {
+		return nil, err
+	}
+	if len(pulls) == 0 {
+		return nil, nil
+	}
+	return pulls[0].pullRequest(), nil
+}
+
+func (g *github) create(ctx context.Context, req Request) (*PullRequest, error) {
+	in := map[string]interface{}{
+		"title": req.Title,
+		"body":  req.Body,
+		"head":  req.Head,
+		"base":  req.Base,
+	}
+	var pull githubPull
+	if err := g.api.do(ctx, "POST", fmt.Sprintf("/repos/%s/pulls", g.project), in, &pull); err != nil {
+		return nil, err
+	}
+	return pull.pullRequest(), nil
+}
+
+func (g *github) update(ctx context.Context, pr *PullRequest, req Request) error {
+	in := map[string]interface{}{"title": req.Title, "body": req.Body}
+	return g.api.do(ctx, "PATCH", fmt.Sprintf("/repos/%s/pulls/%d", g.project, pr.Number), in, nil)
+}
+
+func (g *github) addLabels(ctx context.Context, pr *PullRequest, labels []string) error {
+	in := map[string]interface{}{"labels": labels}
+	return g.api.do(ctx, "POST", fmt.Sprintf("/repos/%s/issues/%d/labels", g.project, pr.Number), in, nil)
+}
+
+// enableAutoMerge uses the GraphQL API, the REST API cannot enable auto-merge
+func (g *github) enableAutoMerge(ctx context.Context, pr *PullRequest, method string) error {
+	in := map[string]interface{}{
+		"query": `mutation($id: ID!, $method: PullRequestMergeMethod!) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: $method}) { clientMutationId }
+}`,
+		"variables": map[string]interface{}{"id": pr.nodeID, "method": strings.ToUpper(method)},
+	}
+	var out struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := g.api.do(ctx, "POST", g.graphqlURL(), in, &out); err != nil {
+		return err
+	}
+	if len(out.Errors) > 0 {
+		return fmt.Errorf("graphql: %s", out.Errors[0].Message)
+	}
+	return nil
+}
+
+// graphqlURL returns the GraphQL endpoint next to the REST API
+func (g *github) graphqlURL() string {
+	if base, ok := strings.CutSuffix(g.api.baseURL, "/api/v3"); ok {
+		return base + "/api/graphql"
+	}
+	return g.api.baseURL + "/graphql"
+}
@@ -0,0 +1,132 @@
+package forge
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+func newGitHubClient(t *testing.T, f *fakeForge, cfg config.DeliveryConfig) *Client {
+	cfg.Provider, cfg.APIURL, cfg.Token = ProviderGitHub, f.server.URL+"/api/v3", "secret"
+	client, err := New(&cfg, "git@github.example.com:owner/name.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestGitHubEnsureCreates(t *testing.T) {
+	f := newFakeForge(t, map[string]string{
+		"GET /api/v3/repos/owner/name/pulls?base=main&head=owner%3Afeature&state=open": `[]`,
+		"POST /api/v3/repos/owner/name/pulls": `{"number": 7, "html_url": "https://github.example.com/owner/name/pull/7",
+			"node_id": "PR_7", "title": "Update", "body": "Body", "head": {"ref": "feature"}, "base": {"ref": "main"}}`,
+		"POST /api/v3/repos/owner/name/issues/7/labels": `[]`,
+		"POST /api/graphql":                             `{"data": {}}`,
+	})
+	client := newGitHubClient(t, f, config.DeliveryConfig{Labels: []string{"release"}, AutoMerge: true, MergeMethod: "squash"})
+
+	pr, err := client.Ensure(context.Background(), Request{Head: "feature", Base: "main", Title: "Update", Body: "Body"})
+	if err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+	want := &PullRequest{Provider: ProviderGitHub, Number: 7, URL: "https://github.example.com/owner/name/pull/7",
+		Head: "feature", Base: "main", Title: "Update", Created: true, AutoMerge: true, body: "Body", nodeID: "PR_7"}
+	if !reflect.DeepEqual(pr, want) {
+		t.Errorf("Ensure() = %+v, want %+v", pr, want)
+	}
+	f.checkTargets(
+		"GET /api/v3/repos/owner/name/pulls?base=main&head=owner%3Afeature&state=open",
+		"POST /api/v3/repos/owner/name/pulls",
+		"POST /api/v3/repos/owner/name/issues/7/labels",
+		"POST /api/graphql",
+	)
+
+	create := f.request("POST /api/v3/repos/owner/name/pulls")
+	if got := create.header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if got := create.header.Get("Accept"); got != "application/vnd.github+json" {
+		t.Errorf("Accept = %q", got)
+	}
+	wantBody := map[string]interface{}{"title": "Update", "body": "Body", "head": "feature", "base": "main"}
+	if !reflect.DeepEqual(create.body, wantBody) {
+		t.Errorf("create body = %v, want %v", create.body, wantBody)
+	}
+	if got := f.request("POST /api/v3/repos/owner/name/issues/7/labels").body["labels"]; !reflect.DeepEqual(got, []interface{}{"release"}) {
+		t.Errorf("labels = %v", got)
+	}
+	variables := f.request("POST /api/graphql").body["variables"]
+	if want := map[string]interface{}{"id": "PR_7", "method": "SQUASH"}; !reflect.DeepEqual(variables, want) {
+		t.Errorf("graphql variables = %v, want %v", variables, want)
+	}
+}
+
+func TestGitHubEnsureUpdates(t *testing.T) {
+	tests := []struct {
+		name    string
+		title   string
+		targets []string
+	}{
+		{
+			name:  "changed title",
+			title: "Update to 2.0",
+			targets: []string{
+				"GET /api/v3/repos/owner/name/pulls?base=main&head=owner%3Afeature&state=open",
+				"PATCH /api/v3/repos/owner/name/pulls/3",
+			},
+		},
+		{
+			name:  "unchanged",
+			title: "Update",
+			targets: []string{
+				"GET /api/v3/repos/owner/name/pulls?base=main&head=owner%3Afeature&state=open",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeForge(t, map[string]string{
+				"GET /api/v3/repos/owner/name/pulls?base=main&head=owner%3Afeature&state=open": `[{"number": 3,
+					"title": "Update", "body": "Body", "head": {"ref": "feature"}, "base": {"ref": "main"}}]`,
+				"PATCH /api/v3/repos/owner/name/pulls/3": `{}`,
+			})
+			// Labels and auto-merge are left to reviewers on existing pull requests
+			client := newGitHubClient(t, f, config.DeliveryConfig{Labels: []string{"release"}, AutoMerge: true})
+
+			pr, err := client.Ensure(context.Background(), Request{Head: "feature", Base: "main", Title: tt.title, Body: "Body"})
+			if err != nil {
+				t.Fatalf("Ensure() error = %v", err)
+			}
+			if pr.Number != 3 || pr.Title != tt.title || pr.Created || pr.AutoMerge {
+				t.Errorf("Ensure() = %+v", pr)
+			}
+			f.checkTargets(tt.targets...)
+		})
+	}
+}
+
+func TestGitHubAutoMergeError(t *testing.T) {
+	f := newFakeForge(t, map[string]string{
+		"GET /repos/owner/name/pulls?base=main&head=owner%3Afeature&state=open": `[]`,
+		"POST /repos/owner/name/pulls":                                          `{"number": 7, "node_id": "PR_7", "head": {"ref": "feature"}, "base": {"ref": "main"}}`,
+		"POST /graphql":                                                         `{"errors": [{"message": "auto-merge is not allowed"}]}`,
+	})
+	client, err := New(&config.DeliveryConfig{Provider: ProviderGitHub, APIURL: f.server.URL, AutoMerge: true}, "git@github.com:owner/name.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Failing to enable auto-merge leaves the pull request open
+	pr, err := client.Ensure(context.Background(), Request{Head: "feature", Base: "main", Title: "Update"})
+	if err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+	if !pr.Created || pr.AutoMerge {
+		t.Errorf("Ensure() = %+v, want a created pull request without auto-merge", pr)
+	}
+	if method := f.request("POST /graphql").body["variables"].(map[string]interface{})["method"]; method != "MERGE" {
+		t.Errorf("merge method = %v, want MERGE", method)
+	}
+}
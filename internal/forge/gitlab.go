@@ -0,0 +1,89 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// gitlab implements provider with the GitLab REST API
+type gitlab struct {
+	api     *api
+	project string // Namespace path, such as group/subgroup/name
+}
+
+// gitlabMergeRequest is the part of a GitLab merge request used here
+type gitlabMergeRequest struct {
+	IID          int    `json:"iid"`
+	WebURL       string `json:"web_url"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	SourceBranch string `json:"source_branch"`
+	TargetBranch string `json:"target_branch"`
+}
+
+// pullRequest converts a GitLab merge request
+func (m gitlabMergeRequest) pullRequest() *PullRequest {
+	return &PullRequest{
+		Provider: ProviderGitLab,
+		Number:   m.IID,
+		URL:      m.WebURL,
+		Head:     m.SourceBranch,
+		Base:     m.TargetBranch,
+		Title:    m.Title,
+		body:     m.Description,
+	}
+}
+
+// path returns an API path below the project
+func (g *gitlab) path(format string, args ...interface{}) string {
+	return "/projects/" + url.PathEscape(g.project) + fmt.Sprintf(format, args...)
+}
+
+func (g *gitlab) find(ctx context.Context, head, base string) (*PullRequest, error) {
+	query := url.Values{"state": {"opened"}, "source_branch": {head}, "target_branch": {base}}
+	var requests []gitlabMergeRequest
+	if err := g.api.do(ctx, "GET", g.path("/merge_requests?%s", query.Encode()), nil, &requests); err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	return requests[0].pullRequest(), nil
+}
+
+func (g *gitlab) create(ctx context.Context, req Request) (*PullRequest, error) {
+	in := map[string]interface{}{
+		"title":                req.Title,
+		"description":          req.Body,
+		"source_branch":        req.Head,
+		"target_branch":        req.Base,
+		"remove_source_branch": true,
+	}
+	var request gitlabMergeRequest
+	if err := g.api.do(ctx, "POST", g.path("/merge_requests"), in, &request); err != nil {
+		return nil, err
+	}
+	return request.pullRequest(), nil
+}
+
+func (g *gitlab) update(ctx context.Context, pr *PullRequest, req Request) error {
+	in := map[string]interface{}{"title": req.Title, "description": req.Body}
+	return g.api.do(ctx, "PUT", g.path("/merge_requests/%d", pr.Number), in, nil)
+}
+
+func (g *gitlab) addLabels(ctx context.Context, pr *PullRequest, labels []string) error {
+	in := map[string]interface{}{"add_labels": strings.Join(labels, ",")}
+	return g.api.do(ctx, "PUT", g.path("/merge_requests/%d", pr.Number), in, nil)
+}
+
+// enableAutoMerge sets the merge request to merge when its pipeline succeeds. GitLab has no
+// rebase merge method, rebase merges without squashing.
+func (g *gitlab) enableAutoMerge(ctx context.Context, pr *PullRequest, method string) error {
+	in := map[string]interface{}{
+		"merge_when_pipeline_succeeds": true,
+		"squash":                       method == "squash",
+	}
+	return g.api.do(ctx, "PUT", g.path("/merge_requests/%d/merge", pr.Number), in, nil)
+}
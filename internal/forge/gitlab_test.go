@@ -0,0 +1,83 @@
+package forge
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+func newGitLabClient(t *testing.T, f *fakeForge, cfg config.DeliveryConfig) *Client {
+	cfg.Provider, cfg.APIURL, cfg.Token = ProviderGitLab, f.server.URL+"/api/v4", "secret"
+	client, err := New(&cfg, "git@gitlab.example.com:group/sub/name.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestGitLabEnsureCreates(t *testing.T) {
+	f := newFakeForge(t, map[string]string{
+		"GET /api/v4/projects/group%2Fsub%2Fname/merge_requests?source_branch=feature&state=opened&target_branch=main": `[]`,
+		"POST /api/v4/projects/group%2Fsub%2Fname/merge_requests": `{"iid": 12, "web_url": "https://gitlab.example.com/group/sub/name/-/merge_requests/12",
+			"title": "Update", "description": "Body", "source_branch": "feature", "target_branch": "main"}`,
+		"PUT /api/v4/projects/group%2Fsub%2Fname/merge_requests/12":       `{}`,
+		"PUT /api/v4/projects/group%2Fsub%2Fname/merge_requests/12/merge": `{}`,
+	})
+	client := newGitLabClient(t, f, config.DeliveryConfig{Labels: []string{"release", "bot"}, AutoMerge: true, MergeMethod: "squash"})
+
+	pr, err := client.Ensure(context.Background(), Request{Head: "feature", Base: "main", Title: "Update", Body: "Body"})
+	if err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+	want := &PullRequest{Provider: ProviderGitLab, Number: 12, URL: "https://gitlab.example.com/group/sub/name/-/merge_requests/12",
+		Head: "feature", Base: "main", Title: "Update", Created: true, AutoMerge: true, body: "Body"}
+	if !reflect.DeepEqual(pr, want) {
+		t.Errorf("Ensure() = %+v, want %+v", pr, want)
+	}
+	f.checkTargets(
+		"GET /api/v4/projects/group%2Fsub%2Fname/merge_requests?source_branch=feature&state=opened&target_branch=main",
+		"POST /api/v4/projects/group%2Fsub%2Fname/merge_requests",
+		"PUT /api/v4/projects/group%2Fsub%2Fname/merge_requests/12",
+		"PUT /api/v4/projects/group%2Fsub%2Fname/merge_requests/12/merge",
+	)
+
+	create := f.request("POST /api/v4/projects/group%2Fsub%2Fname/merge_requests")
+	if got := create.header.Get("PRIVATE-TOKEN"); got != "secret" {
+		t.Errorf("PRIVATE-TOKEN = %q", got)
+	}
+	wantBody := map[string]interface{}{"title": "Update", "description": "Body", "source_branch": "feature",
+		"target_branch": "main", "remove_source_branch": true}
+	if !reflect.DeepEqual(create.body, wantBody) {
+		t.Errorf("create body = %v, want %v", create.body, wantBody)
+	}
+	if got := f.request("PUT /api/v4/projects/group%2Fsub%2Fname/merge_requests/12").body; !reflect.DeepEqual(got, map[string]interface{}{"add_labels": "release,bot"}) {
+		t.Errorf("labels body = %v", got)
+	}
+	wantMerge := map[string]interface{}{"merge_when_pipeline_succeeds": true, "squash": true}
+	if got := f.request("PUT /api/v4/projects/group%2Fsub%2Fname/merge_requests/12/merge").body; !reflect.DeepEqual(got, wantMerge) {
+		t.Errorf("merge body = %v, want %v", got, wantMerge)
+	}
+}
+
+func TestGitLabEnsureUpdates(t *testing.T) {
+	f := newFakeForge(t, map[string]string{
+		"GET /api/v4/projects/group%2Fsub%2Fname/merge_requests?source_branch=feature&state=opened&target_branch=main": `[{"iid": 4,
+			"title": "Update", "description": "Old body", "source_branch": "feature", "target_branch": "main"}]`,
+		"PUT /api/v4/projects/group%2Fsub%2Fname/merge_requests/4": `{}`,
+	})
+	client := newGitLabClient(t, f, config.DeliveryConfig{})
+
+	pr, err := client.Ensure(context.Background(), Request{Head: "feature", Base: "main", Title: "Update", Body: "Body"})
+	if err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+	if pr.Number != 4 || pr.Created || pr.body != "Body" {
+		t.Errorf("Ensure() = %+v", pr)
+	}
+	want := map[string]interface{}{"title": "Update", "description": "Body"}
+	if got := f.request("PUT /api/v4/projects/group%2Fsub%2Fname/merge_requests/4").body; !reflect.DeepEqual(got, want) {
+		t.Errorf("update body = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+// Artifact is a package version published to the artifact registry, as received by the
+// artifacts webhook. Its fields are available to the templates of the manifest rules.
+type Artifact struct {
+	UserId              int64   `json:"userId"`
+	UserName            string  `json:"userName"`
+	ProjectId           int64   `json:"projectId"`
+	ProjectName         string  `json:"projectName"`
+	TeamId              int64   `json:"teamId"`
+	Action              string  `json:"action"`
+	ArtifactType        string  `json:"artifactType"`
+	ArtifactRepoId      int64   `json:"artifactRepoId"`
+	ArtifactRepoName    string  `json:"artifactRepoName"`
+	ArtifactPkgId       int64   `json:"artifactPkgId"`
+	ArtifactPkgName     string  `json:"artifactPkgName"`
+	ArtifactVersionId   int64   `json:"artifactVersionId"`
+	ArtifactVersionName string  `json:"artifactVersionName"`
+	Size                float64 `json:"size"`
+}
+
+// ArtifactsOptions changes how an artifacts update is applied
+type ArtifactsOptions struct {
+	// Write the version even when the file holds a newer version, see ErrArtifactsDowngrade
+	Force bool
+	// Environment the version is written to, the first configured environment by default
+	Environment string
+	// Environment the version is promoted from, which must already record it, see
+	// ErrNotInEnvironment
+	PromoteFrom string
+	// Restore a version the key held earlier on the target branch instead of writing the
+	// artifact version, which only selects the key, see ErrNoRollbackTarget
+	Rollback bool
+	// Version restored by a rollback, by default the latest earlier version older than the
+	// current one
+	RollbackTo string
+}
+
+// ErrArtifactsDowngrade is returned when an artifacts update would replace a newer version
+// of the package and was not forced
+var ErrArtifactsDowngrade = errors.New("artifacts downgrade refused")
+
+// manifestTarget returns what manifest rules are matched against
+func (a Artifact) manifestTarget() config.ManifestTarget {
+	return config.ManifestTarget{
+		Type:       a.ArtifactType,
+		Repository: a.ArtifactRepoName,
+		Package:    a.ArtifactPkgName,
+		Team:       a.TeamId,
+	}
+}
+
+// manifestData is the data of the templates of a manifest rule
+type manifestData struct {
+	Artifact
+	VersionPrefix string
+	Environment   string // Name of the environment written to, empty without environments
+}
+
+// renderManifestTemplate executes a template of a manifest rule for an artifact
+func renderManifestTemplate(name, text string, data manifestData) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+	return b.String(), nil
+}
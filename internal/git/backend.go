@@ -0,0 +1,173 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+// Backend names accepted in git.backend
+const (
+	BackendCLI   = "cli"
+	BackendGoGit = "go-git"
+)
+
+// Credentials carries the remote URL and authentication used by network operations
+type Credentials struct {
+	URL  string
+	Auth config.AuthConfig
+}
+
+// credentialsFor returns the credentials of a configured repository
+func credentialsFor(repo config.RepositoryInterface) Credentials {
+	return Credentials{URL: repo.GetURL(), Auth: repo.GetAuth()}
+}
+
+// Signature identifies the author of a commit. Empty fields fall back to the repository configuration.
+type Signature struct {
+	Name  string
+	Email string
+}
+
+// RemoteRef is a reference advertised by a remote
+type RemoteRef struct {
+	Name string
+	Hash string
+}
+
+// CloneOptions configures Backend.Clone
+type CloneOptions struct {
+	Branch      string
+	Credentials Credentials
+}
+
+// FetchOptions configures Backend.Fetch
+type FetchOptions struct {
+	Remote      string
+	RefSpecs    []string
+	Credentials Credentials
+}
+
+// PullOptions configures Backend.Pull
+type PullOptions struct {
+	Remote      string
+	Branch      string
+	Rebase      bool
+	Credentials Credentials
+}
+
+// PushOptions configures Backend.Push
+type PushOptions struct {
+	Remote         string
+	RefSpec        string
+	Force          bool
+	ForceWithLease bool
+	Credentials    Credentials
+}
+
+// LsRemoteOptions configures Backend.LsRemote. Patterns match full ref names or their trailing path components.
+type LsRemoteOptions struct {
+	Remote      string
+	Patterns    []string
+	Credentials Credentials
+}
+
+// CheckoutOptions configures Backend.Checkout. With Detach, StartPoint (HEAD by default) is checked out detached.
+type CheckoutOptions struct {
+	Branch     string
+	Create     bool
+	StartPoint string
+	Detach     bool
+}
+
+// Tag is a tag of a local repository
+type Tag struct {
+	Name       string    `json:"name"`
+	Commit     string    `json:"commit"`               // Commit the tag points to
+	Annotation string    `json:"annotation,omitempty"` // Message of an annotated tag
+	Date       time.Time `json:"date"`                 // Tagger date, or committer date of a lightweight tag
+}
+
+// LogOptions configures Backend.Log
+type LogOptions struct {
+	Rev   string   // Revision the walk starts from, HEAD by default
+	Paths []string // Only list commits changing one of these paths
+	Limit int      // Maximum number of commits, unlimited when 0
+}
+
+// Commit is a commit listed by Backend.Log
+type Commit struct {
+	Hash    string
+	Author  Signature
+	Date    time.Time // Committer date
+	Message string
+}
+
+// MergeOptions configures Backend.Merge
+type MergeOptions struct {
+	NoFastForward  bool
+	StrategyOption string
+	Author         Signature
+}
+
+// WorktreeAddOptions configures Backend.WorktreeAdd
+type WorktreeAddOptions struct {
+	Branch      string
+	StartPoint  string
+	Credentials Credentials
+}
+
+// SubmoduleUpdateOptions configures Backend.SubmoduleUpdate
+type SubmoduleUpdateOptions struct {
+	Init        bool
+	Remote      bool
+	Recursive   bool
+	Force       bool
+	Paths       []string
+	Credentials Credentials
+}
+
+// Backend performs Git operations on local repositories.
+// Every directory argument is the working tree the operation runs in, and every
+// operation is abandoned once its context is done.
+type Backend interface {
+	Clone(ctx context.Context, url, dir string, opts CloneOptions) error
+	Fetch(ctx context.Context, dir string, opts FetchOptions) error
+	Pull(ctx context.Context, dir string, opts PullOptions) error
+	Push(ctx context.Context, dir string, opts PushOptions) error
+	LsRemote(ctx context.Context, dir string, opts LsRemoteOptions) ([]RemoteRef, error)
+	RevParse(ctx context.Context, dir, rev string) (string, error)
+	CountCommits(ctx context.Context, dir, from, to string) (int, error)
+	Status(ctx context.Context, dir string) (string, error)
+	Add(ctx context.Context, dir string, paths ...string) error
+	Commit(ctx context.Context, dir, message string, author Signature) error
+	Checkout(ctx context.Context, dir string, opts CheckoutOptions) error
+	Reset(ctx context.Context, dir, rev string) error
+	Rebase(ctx context.Context, dir, upstream string) error
+	Merge(ctx context.Context, dir, branch string, opts MergeOptions) error
+	WorktreeAdd(ctx context.Context, dir, path string, opts WorktreeAddOptions) error
+	WorktreePrune(ctx context.Context, dir string) error
+	SubmoduleInit(ctx context.Context, dir string) error
+	SubmoduleUpdate(ctx context.Context, dir string, opts SubmoduleUpdateOptions) error
+	SubmoduleStatus(ctx context.Context, dir string) (string, error)
+	Tags(ctx context.Context, dir string) ([]Tag, error)
+	// Log lists the commits reachable from a revision, newest first
+	Log(ctx context.Context, dir string, opts LogOptions) ([]Commit, error)
+	// ReadFile returns the content of a file at a revision, an error wrapping
+	// os.ErrNotExist when the revision has no such file
+	ReadFile(ctx context.Context, dir, rev, path string) ([]byte, error)
+}
+
+// NewBackend returns the backend with the given name, defaulting to the git CLI
+func NewBackend(name string) (Backend, error) {
+	switch name {
+	case "", BackendCLI:
+		return NewCLIBackend(), nil
+	case BackendGoGit:
+		return NewGoGitBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown git backend: %s", name)
+	}
+}
@@ -0,0 +1,488 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jieay/git-watcher/internal/logging"
+)
+
+// CLIBackend runs Git operations through the git binary
+type CLIBackend struct{}
+
+// NewCLIBackend creates a backend that shells out to git
+func NewCLIBackend() *CLIBackend {
+	return &CLIBackend{}
+}
+
+// processWaitDelay bounds how long a cancelled git command may keep its output pipes open
+const processWaitDelay = 5 * time.Second
+
+// command prepares a git command in dir that is killed together with its
+// children (ssh, credential helpers) once ctx is done
+func (b *CLIBackend) command(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// Never block on interactive prompts, they would hang until the timeout
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	configureProcessGroup(cmd)
+	return cmd
+}
+
+// commandError describes a failed git command, reporting the context error if it was cancelled
+func commandError(ctx context.Context, args []string, err error, output []byte) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("git %s aborted: %w", args[0], ctxErr)
+	}
+	if output == nil {
+		return fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+	return fmt.Errorf("git %s failed: %w, output: %s", args[0], err, string(output))
+}
+
+// logCommand logs a finished git command and its output at debug level
+func logCommand(ctx context.Context, dir string, args []string, started time.Time, output []byte, err error) {
+	logger := logging.FromContext(ctx)
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	attrs := []interface{}{
+		"args", redactArgs(args),
+		"dir", dir,
+		"duration", time.Since(started),
+		"output", strings.TrimSpace(string(output)),
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	logger.Debug("git command", attrs...)
+}
+
+// redactArgs removes credentials embedded in URL arguments
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = redactURL(arg)
+	}
+	return redacted
+}
+
+// redactURL removes the password of a URL with user info, leaving other strings untouched
+func redactURL(raw string) string {
+	if !strings.Contains(raw, "://") {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
+
+// run executes a git command in dir and returns its combined output
+func (b *CLIBackend) run(ctx context.Context, dir string, creds *Credentials, args ...string) (string, error) {
+	cmd := b.command(ctx, dir, args...)
+	if creds != nil {
+		cleanup := b.setupCredentials(ctx, *creds, cmd)
+		defer cleanup()
+	}
+
+	started := time.Now()
+	output, err := cmd.CombinedOutput()
+	logCommand(ctx, dir, args, started, output, err)
+	if err != nil {
+		return string(output), commandError(ctx, args, err, output)
+	}
+	return string(output), nil
+}
+
+// output executes a git command in dir and returns its standard output
+func (b *CLIBackend) output(ctx context.Context, dir string, args ...string) (string, error) {
+	started := time.Now()
+	output, err := b.command(ctx, dir, args...).Output()
+	logCommand(ctx, dir, args, started, output, err)
+	if err != nil {
+		return "", commandError(ctx, args, err, nil)
+	}
+	return string(output), nil
+}
+
+// setupCredentials configures Git credentials based on authentication settings.
+// The returned function removes temporary key material once the command finished.
+func (b *CLIBackend) setupCredentials(ctx context.Context, creds Credentials, cmd *exec.Cmd) func() {
+	auth := creds.Auth
+	switch auth.Type {
+	case "basic":
+		if auth.Username != "" && auth.Password != "" {
+			// 设置 Git 凭证
+			cmd.Env = append(cmd.Env,
+				"GIT_ASKPASS=echo",
+				fmt.Sprintf("GIT_USERNAME=%s", auth.Username),
+				fmt.Sprintf("GIT_PASSWORD=%s", auth.Password),
+			)
+			b.storeCredentials(ctx, creds)
+		}
+	case "ssh":
+		if auth.SSHKeyPath != "" {
+			// For SSH authentication with a key file
+			cmd.Env = append(cmd.Env,
+				fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o StrictHostKeyChecking=no", auth.SSHKeyPath),
+			)
+		} else if auth.SSHPrivateKey != "" {
+			// If SSH key is provided as a string, write it to a temporary file
+			tmpDir, err := os.MkdirTemp("", "git-ssh-key")
+			if err == nil {
+				keyPath := filepath.Join(tmpDir, "id_rsa")
+				if err := os.WriteFile(keyPath, []byte(auth.SSHPrivateKey), 0600); err == nil {
+					cmd.Env = append(cmd.Env,
+						fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o StrictHostKeyChecking=no", keyPath),
+					)
+				}
+				// Clean up the temporary file when the command finishes
+				return func() { os.RemoveAll(tmpDir) }
+			}
+		}
+	}
+	return func() {}
+}
+
+// storeCredentials writes basic auth credentials for the git credential store helper
+func (b *CLIBackend) storeCredentials(ctx context.Context, creds Credentials) {
+	// 配置 Git 使用凭证
+	configCmd := b.command(ctx, "", "config", "--global", "credential.helper", "store")
+	configCmd.Run() // 忽略错误，因为可能已经配置过
+
+	// 写入凭证到临时文件
+	credentialContent := fmt.Sprintf("https://%s:%s@%s\n",
+		creds.Auth.Username,
+		creds.Auth.Password,
+		strings.TrimPrefix(creds.URL, "https://"))
+
+	homeDir, err := os.UserHomeDir()
+	if err == nil {
+		gitConfigDir := filepath.Join(homeDir, ".git")
+		if err := os.MkdirAll(gitConfigDir, 0755); err == nil {
+			credentialFile := filepath.Join(gitConfigDir, "credentials")
+			os.WriteFile(credentialFile, []byte(credentialContent), 0600)
+			logging.FromContext(ctx).Debug("stored git credentials", "user", creds.Auth.Username)
+		}
+	}
+}
+
+// Clone implements Backend
+func (b *CLIBackend) Clone(ctx context.Context, url, dir string, opts CloneOptions) error {
+	auth := opts.Credentials.Auth
+	if auth.Type == "basic" && auth.Username != "" && auth.Password != "" {
+		b.storeCredentials(ctx, opts.Credentials)
+
+		// Rewrite HTTP(S) URLs to include basic auth
+		if urlParts := strings.SplitN(url, "://", 2); len(urlParts) == 2 {
+			url = fmt.Sprintf("%s://%s:%s@%s", urlParts[0], auth.Username, auth.Password, urlParts[1])
+		}
+	}
+
+	args := []string{"clone"}
+	if opts.Branch != "" {
+		args = append(args, "--branch", opts.Branch)
+	}
+	args = append(args, url, dir)
+
+	// SSH URLs use key based authentication
+	var creds *Credentials
+	if auth.Type == "ssh" {
+		creds = &opts.Credentials
+	}
+	_, err := b.run(ctx, "", creds, args...)
+	return err
+}
+
+// Fetch implements Backend
+func (b *CLIBackend) Fetch(ctx context.Context, dir string, opts FetchOptions) error {
+	args := append([]string{"fetch", opts.Remote}, opts.RefSpecs...)
+	_, err := b.run(ctx, dir, &opts.Credentials, args...)
+	return err
+}
+
+// Pull implements Backend
+func (b *CLIBackend) Pull(ctx context.Context, dir string, opts PullOptions) error {
+	args := []string{"pull"}
+	if opts.Rebase {
+		args = append(args, "--rebase")
+	}
+	args = append(args, opts.Remote, opts.Branch)
+	_, err := b.run(ctx, dir, &opts.Credentials, args...)
+	return err
+}
+
+// Push implements Backend
+func (b *CLIBackend) Push(ctx context.Context, dir string, opts PushOptions) error {
+	args := []string{"push"}
+	if opts.Force {
+		args = append(args, "-f")
+	} else if opts.ForceWithLease {
+		args = append(args, "--force-with-lease")
+	}
+	args = append(args, opts.Remote, opts.RefSpec)
+	_, err := b.run(ctx, dir, &opts.Credentials, args...)
+	return err
+}
+
+// LsRemote implements Backend
+func (b *CLIBackend) LsRemote(ctx context.Context, dir string, opts LsRemoteOptions) ([]RemoteRef, error) {
+	args := append([]string{"ls-remote", opts.Remote}, opts.Patterns...)
+	cmd := b.command(ctx, dir, args...)
+	cleanup := b.setupCredentials(ctx, opts.Credentials, cmd)
+	defer cleanup()
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, commandError(ctx, args, err, nil)
+	}
+
+	refs := make([]RemoteRef, 0)
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			refs = append(refs, RemoteRef{Hash: fields[0], Name: fields[1]})
+		}
+	}
+	return refs, nil
+}
+
+// RevParse implements Backend
+func (b *CLIBackend) RevParse(ctx context.Context, dir, rev string) (string, error) {
+	output, err := b.output(ctx, dir, "rev-parse", rev)
+	return strings.TrimSpace(output), err
+}
+
+// CountCommits implements Backend
+func (b *CLIBackend) CountCommits(ctx context.Context, dir, from, to string) (int, error) {
+	output, err := b.output(ctx, dir, "rev-list", from+".."+to, "--count")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(output))
+}
+
+// Status implements Backend
+func (b *CLIBackend) Status(ctx context.Context, dir string) (string, error) {
+	return b.output(ctx, dir, "status", "--porcelain")
+}
+
+// Add implements Backend
+func (b *CLIBackend) Add(ctx context.Context, dir string, paths ...string) error {
+	_, err := b.run(ctx, dir, nil, append([]string{"add"}, paths...)...)
+	return err
+}
+
+// Commit implements Backend
+func (b *CLIBackend) Commit(ctx context.Context, dir, message string, author Signature) error {
+	args := make([]string, 0, 7)
+	if author.Name != "" {
+		args = append(args, "-c", "user.name="+author.Name)
+	}
+	if author.Email != "" {
+		args = append(args, "-c", "user.email="+author.Email)
+	}
+	args = append(args, "commit", "-m", message)
+	_, err := b.run(ctx, dir, nil, args...)
+	return err
+}
+
+// Checkout implements Backend
+func (b *CLIBackend) Checkout(ctx context.Context, dir string, opts CheckoutOptions) error {
+	args := []string{"checkout"}
+	switch {
+	case opts.Detach:
+		args = append(args, "--detach")
+		if opts.StartPoint != "" {
+			args = append(args, opts.StartPoint)
+		}
+	case opts.Create:
+		args = append(args, "-b", opts.Branch)
+		if opts.StartPoint != "" {
+			args = append(args, opts.StartPoint)
+		}
+	default:
+		args = append(args, opts.Branch)
+	}
+	_, err := b.run(ctx, dir, nil, args...)
+	return err
+}
+
+// Reset implements Backend
+func (b *CLIBackend) Reset(ctx context.Context, dir, rev string) error {
+	_, err := b.run(ctx, dir, nil, "reset", "--hard", rev)
+	return err
+}
+
+// Rebase implements Backend. A failed rebase is aborted before returning.
+func (b *CLIBackend) Rebase(ctx context.Context, dir, upstream string) error {
+	if _, err := b.run(ctx, dir, nil, "rebase", upstream); err != nil {
+		b.run(ctx, dir, nil, "rebase", "--abort")
+		return err
+	}
+	return nil
+}
+
+// Merge implements Backend
+func (b *CLIBackend) Merge(ctx context.Context, dir, branch string, opts MergeOptions) error {
+	args := make([]string, 0, 8)
+	if opts.Author.Name != "" {
+		args = append(args, "-c", "user.name="+opts.Author.Name)
+	}
+	if opts.Author.Email != "" {
+		args = append(args, "-c", "user.email="+opts.Author.Email)
+	}
+	args = append(args, "merge")
+	if opts.NoFastForward {
+		args = append(args, "--no-ff")
+	}
+	if opts.StrategyOption != "" {
+		args = append(args, "--strategy-option="+opts.StrategyOption)
+	}
+	args = append(args, branch)
+	_, err := b.run(ctx, dir, nil, args...)
+	return err
+}
+
+// WorktreeAdd implements Backend
+func (b *CLIBackend) WorktreeAdd(ctx context.Context, dir, path string, opts WorktreeAddOptions) error {
+	_, err := b.run(ctx, dir, nil, "worktree", "add", "-B", opts.Branch, path, opts.StartPoint)
+	return err
+}
+
+// WorktreePrune implements Backend
+func (b *CLIBackend) WorktreePrune(ctx context.Context, dir string) error {
+	_, err := b.run(ctx, dir, nil, "worktree", "prune")
+	return err
+}
+
+// SubmoduleInit implements Backend
+func (b *CLIBackend) SubmoduleInit(ctx context.Context, dir string) error {
+	_, err := b.run(ctx, dir, nil, "submodule", "init")
+	return err
+}
+
+// SubmoduleUpdate implements Backend
+func (b *CLIBackend) SubmoduleUpdate(ctx context.Context, dir string, opts SubmoduleUpdateOptions) error {
+	args := []string{"submodule", "update"}
+	if opts.Init {
+		args = append(args, "--init")
+	}
+	if opts.Recursive {
+		args = append(args, "--recursive")
+	}
+	if opts.Remote {
+		args = append(args, "--remote")
+	}
+	if opts.Force {
+		args = append(args, "--force")
+	}
+	args = append(args, opts.Paths...)
+	_, err := b.run(ctx, dir, &opts.Credentials, args...)
+	return err
+}
+
+// SubmoduleStatus implements Backend
+func (b *CLIBackend) SubmoduleStatus(ctx context.Context, dir string) (string, error) {
+	output, err := b.run(ctx, dir, nil, "submodule", "status")
+	return output, err
+}
+
+// ReadFile implements Backend
+func (b *CLIBackend) ReadFile(ctx context.Context, dir, rev, path string) ([]byte, error) {
+	entry, err := b.output(ctx, dir, "ls-tree", rev, "--", path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(entry) == "" {
+		return nil, fmt.Errorf("%s:%s: %w", rev, path, os.ErrNotExist)
+	}
+	output, err := b.output(ctx, dir, "cat-file", "blob", rev+":"+path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(output), nil
+}
+
+// logFormat prints the fields of a commit separated by NUL, each commit terminated by a record separator
+const logFormat = "%H%x00%an%x00%ae%x00%ct%x00%B%x1e"
+
+// Log implements Backend
+func (b *CLIBackend) Log(ctx context.Context, dir string, opts LogOptions) ([]Commit, error) {
+	rev := opts.Rev
+	if rev == "" {
+		rev = "HEAD"
+	}
+	args := []string{"log", "--format=" + logFormat}
+	if opts.Limit > 0 {
+		args = append(args, "-n", strconv.Itoa(opts.Limit))
+	}
+	args = append(args, rev, "--")
+	args = append(args, opts.Paths...)
+	output, err := b.output(ctx, dir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := make([]Commit, 0)
+	for _, record := range strings.Split(output, "\x1e") {
+		fields := strings.SplitN(strings.TrimLeft(record, "\n"), "\x00", 5)
+		if len(fields) < 5 {
+			continue
+		}
+		commit := Commit{
+			Hash:    fields[0],
+			Author:  Signature{Name: fields[1], Email: fields[2]},
+			Message: strings.TrimSpace(fields[4]),
+		}
+		if seconds, err := strconv.ParseInt(fields[3], 10, 64); err == nil {
+			commit.Date = time.Unix(seconds, 0)
+		}
+		commits = append(commits, commit)
+	}
+	return commits, nil
+}
+
+// tagFormat prints the fields of a tag separated by NUL, each tag terminated by a record separator
+const tagFormat = "%(refname:strip=2)%00%(objecttype)%00%(objectname)%00%(*objectname)%00%(creatordate:unix)%00%(contents)%1e"
+
+// Tags implements Backend
+func (b *CLIBackend) Tags(ctx context.Context, dir string) ([]Tag, error) {
+	output, err := b.output(ctx, dir, "for-each-ref", "--format="+tagFormat, "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]Tag, 0)
+	for _, record := range strings.Split(output, "\x1e") {
+		fields := strings.SplitN(strings.TrimLeft(record, "\n"), "\x00", 6)
+		if len(fields) < 6 {
+			continue
+		}
+		tag := Tag{Name: fields[0], Commit: fields[2]}
+		if fields[1] == "tag" {
+			tag.Commit = fields[3]
+			tag.Annotation = strings.TrimSpace(fields[5])
+		}
+		if seconds, err := strconv.ParseInt(fields[4], 10, 64); err == nil {
+			tag.Date = time.Unix(seconds, 0)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
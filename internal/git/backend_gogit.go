@@ -0,0 +1,912 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/Jieay/git-watcher/internal/logging"
+)
+
+// ErrUnsupported is returned for operations the in-process backend cannot perform
+var ErrUnsupported = errors.New("operation not supported by the go-git backend")
+
+// GoGitBackend runs Git operations in process with go-git, so no git binary is required.
+// Linked worktrees are emulated with independent clones, and rebases and merges are
+// limited to the fast-forward cases the watcher produces.
+type GoGitBackend struct{}
+
+// NewGoGitBackend creates an in-process go-git backend
+func NewGoGitBackend() *GoGitBackend {
+	return &GoGitBackend{}
+}
+
+// progressWriter logs the progress messages sent by a remote at debug level
+type progressWriter struct {
+	ctx  context.Context
+	op   string
+	line []byte
+}
+
+// Write implements io.Writer. Messages arrive in arbitrary fragments, so complete lines are
+// buffered; intermediate progress a terminal would overwrite after a carriage return is dropped.
+func (w *progressWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		switch c {
+		case '\r':
+			w.line = w.line[:0]
+		case '\n':
+			if line := strings.TrimSpace(string(w.line)); line != "" {
+				logging.FromContext(w.ctx).Debug("git remote output", "op", w.op, "output", line)
+			}
+			w.line = w.line[:0]
+		default:
+			w.line = append(w.line, c)
+		}
+	}
+	return len(p), nil
+}
+
+// progress returns the sideband writer for a remote operation, nil unless debug logging is enabled
+func progress(ctx context.Context, op string) sideband.Progress {
+	if !logging.FromContext(ctx).Enabled(ctx, slog.LevelDebug) {
+		return nil
+	}
+	return &progressWriter{ctx: ctx, op: op}
+}
+
+// open opens the repository containing dir, including linked worktrees created by the git CLI
+func (b *GoGitBackend) open(dir string) (*gogit.Repository, error) {
+	repo, err := gogit.PlainOpenWithOptions(dir, &gogit.PlainOpenOptions{EnableDotGitCommonDir: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository %s: %w", dir, err)
+	}
+	return repo, nil
+}
+
+// openWorktree opens the repository containing dir and its worktree
+func (b *GoGitBackend) openWorktree(dir string) (*gogit.Repository, *gogit.Worktree, error) {
+	repo, err := b.open(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open worktree %s: %w", dir, err)
+	}
+	return repo, wt, nil
+}
+
+// authMethod converts configured credentials into a go-git transport auth method
+func (b *GoGitBackend) authMethod(creds Credentials) (transport.AuthMethod, error) {
+	auth := creds.Auth
+	switch auth.Type {
+	case "basic":
+		if auth.Username == "" && auth.Password == "" {
+			return nil, nil
+		}
+		return &http.BasicAuth{Username: auth.Username, Password: auth.Password}, nil
+	case "ssh":
+		user := "git"
+		address := creds.URL
+		if i := strings.Index(address, "://"); i >= 0 {
+			address = address[i+3:]
+		}
+		if i := strings.Index(address, "@"); i > 0 && !strings.ContainsAny(address[:i], "/:") {
+			user = address[:i]
+		}
+
+		var (
+			keys *ssh.PublicKeys
+			err  error
+		)
+		switch {
+		case auth.SSHKeyPath != "":
+			keys, err = ssh.NewPublicKeysFromFile(user, auth.SSHKeyPath, "")
+		case auth.SSHPrivateKey != "":
+			keys, err = ssh.NewPublicKeys(user, []byte(auth.SSHPrivateKey), "")
+		default:
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load ssh key: %w", err)
+		}
+		// Mirrors StrictHostKeyChecking=no of the CLI backend
+		keys.HostKeyCallback = gossh.InsecureIgnoreHostKey()
+		return keys, nil
+	}
+	return nil, nil
+}
+
+// resolve resolves a revision such as HEAD, a branch or origin/<branch> to a commit hash
+func (b *GoGitBackend) resolve(repo *gogit.Repository, rev string) (plumbing.Hash, error) {
+	// <rev>:<path> names a tree entry, such as the commit recorded for a submodule
+	if commitRev, path, ok := strings.Cut(rev, ":"); ok && commitRev != "" {
+		return b.resolveTreeEntry(repo, commitRev, path)
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to resolve %s: %w", rev, err)
+	}
+	return *hash, nil
+}
+
+// resolveTreeEntry returns the object a path points to in the tree of a commit, the tree
+// itself for an empty path
+func (b *GoGitBackend) resolveTreeEntry(repo *gogit.Repository, rev, path string) (plumbing.Hash, error) {
+	hash, err := b.resolve(repo, rev)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to load commit %s: %w", rev, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to load tree of %s: %w", rev, err)
+	}
+	if path == "" {
+		return tree.Hash, nil
+	}
+	entry, err := tree.FindEntry(path)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to resolve %s:%s: %w", rev, path, err)
+	}
+	return entry.Hash, nil
+}
+
+// Clone implements Backend
+func (b *GoGitBackend) Clone(ctx context.Context, url, dir string, opts CloneOptions) error {
+	auth, err := b.authMethod(opts.Credentials)
+	if err != nil {
+		return err
+	}
+
+	cloneOptions := &gogit.CloneOptions{URL: url, Auth: auth, Progress: progress(ctx, "clone")}
+	if opts.Branch != "" {
+		cloneOptions.ReferenceName = plumbing.NewBranchReferenceName(opts.Branch)
+	}
+	if _, err := gogit.PlainCloneContext(ctx, dir, false, cloneOptions); err != nil {
+		return fmt.Errorf("clone failed: %w", err)
+	}
+	return nil
+}
+
+// Fetch implements Backend
+func (b *GoGitBackend) Fetch(ctx context.Context, dir string, opts FetchOptions) error {
+	repo, err := b.open(dir)
+	if err != nil {
+		return err
+	}
+	auth, err := b.authMethod(opts.Credentials)
+	if err != nil {
+		return err
+	}
+
+	refSpecs := make([]gitconfig.RefSpec, 0, len(opts.RefSpecs))
+	for _, refSpec := range opts.RefSpecs {
+		refSpecs = append(refSpecs, gitconfig.RefSpec(refSpec))
+	}
+
+	err = repo.FetchContext(ctx, &gogit.FetchOptions{RemoteName: opts.Remote, RefSpecs: refSpecs, Auth: auth, Progress: progress(ctx, "fetch")})
+	if err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("fetch failed: %w", err)
+	}
+	return nil
+}
+
+// Pull implements Backend as a fetch followed by a fast-forward rebase or merge
+func (b *GoGitBackend) Pull(ctx context.Context, dir string, opts PullOptions) error {
+	refSpec := fmt.Sprintf("+refs/heads/%s:refs/remotes/%s/%s", opts.Branch, opts.Remote, opts.Branch)
+	if err := b.Fetch(ctx, dir, FetchOptions{Remote: opts.Remote, RefSpecs: []string{refSpec}, Credentials: opts.Credentials}); err != nil {
+		return err
+	}
+
+	upstream := opts.Remote + "/" + opts.Branch
+	if opts.Rebase {
+		return b.Rebase(ctx, dir, upstream)
+	}
+	return b.Merge(ctx, dir, upstream, MergeOptions{})
+}
+
+// Push implements Backend
+func (b *GoGitBackend) Push(ctx context.Context, dir string, opts PushOptions) error {
+	repo, err := b.open(dir)
+	if err != nil {
+		return err
+	}
+	auth, err := b.authMethod(opts.Credentials)
+	if err != nil {
+		return err
+	}
+
+	refSpec := opts.RefSpec
+	if !strings.Contains(refSpec, ":") {
+		ref := plumbing.NewBranchReferenceName(refSpec).String()
+		refSpec = ref + ":" + ref
+	}
+
+	pushOptions := &gogit.PushOptions{
+		RemoteName: opts.Remote,
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(refSpec)},
+		Force:      opts.Force,
+		Auth:       auth,
+		Progress:   progress(ctx, "push"),
+	}
+	if opts.ForceWithLease {
+		pushOptions.ForceWithLease = &gogit.ForceWithLease{}
+	}
+
+	err = repo.PushContext(ctx, pushOptions)
+	if err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("push failed: %w", err)
+	}
+	return nil
+}
+
+// LsRemote implements Backend
+func (b *GoGitBackend) LsRemote(ctx context.Context, dir string, opts LsRemoteOptions) ([]RemoteRef, error) {
+	repo, err := b.open(dir)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := b.authMethod(opts.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := repo.Remote(opts.Remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load remote %s: %w", opts.Remote, err)
+	}
+
+	advertised, err := remote.ListContext(ctx, &gogit.ListOptions{Auth: auth})
+	if err != nil {
+		return nil, fmt.Errorf("ls-remote failed: %w", err)
+	}
+
+	refs := make([]RemoteRef, 0)
+	for _, ref := range advertised {
+		if ref.Type() != plumbing.HashReference || !matchesRefPattern(ref.Name().String(), opts.Patterns) {
+			continue
+		}
+		refs = append(refs, RemoteRef{Name: ref.Name().String(), Hash: ref.Hash().String()})
+	}
+	return refs, nil
+}
+
+// matchesRefPattern reports whether a ref name matches one of the ls-remote patterns
+func matchesRefPattern(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if name == pattern || strings.HasSuffix(name, "/"+pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// RevParse implements Backend
+func (b *GoGitBackend) RevParse(ctx context.Context, dir, rev string) (string, error) {
+	repo, err := b.open(dir)
+	if err != nil {
+		return "", err
+	}
+	hash, err := b.resolve(repo, rev)
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
+// CountCommits implements Backend
+func (b *GoGitBackend) CountCommits(ctx context.Context, dir, from, to string) (int, error) {
+	repo, err := b.open(dir)
+	if err != nil {
+		return 0, err
+	}
+	fromHash, err := b.resolve(repo, from)
+	if err != nil {
+		return 0, err
+	}
+	toHash, err := b.resolve(repo, to)
+	if err != nil {
+		return 0, err
+	}
+
+	reachable := make(map[plumbing.Hash]bool)
+	fromIter, err := repo.Log(&gogit.LogOptions{From: fromHash})
+	if err != nil {
+		return 0, fmt.Errorf("failed to walk %s: %w", from, err)
+	}
+	if err := fromIter.ForEach(func(c *object.Commit) error {
+		reachable[c.Hash] = true
+		return ctx.Err()
+	}); err != nil {
+		return 0, fmt.Errorf("failed to walk %s: %w", from, err)
+	}
+
+	count := 0
+	toIter, err := repo.Log(&gogit.LogOptions{From: toHash})
+	if err != nil {
+		return 0, fmt.Errorf("failed to walk %s: %w", to, err)
+	}
+	if err := toIter.ForEach(func(c *object.Commit) error {
+		if !reachable[c.Hash] {
+			count++
+		}
+		return ctx.Err()
+	}); err != nil {
+		return 0, fmt.Errorf("failed to walk %s: %w", to, err)
+	}
+	return count, nil
+}
+
+// Status implements Backend using the porcelain format of the git CLI
+func (b *GoGitBackend) Status(ctx context.Context, dir string) (string, error) {
+	_, wt, err := b.openWorktree(dir)
+	if err != nil {
+		return "", err
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return "", fmt.Errorf("status failed: %w", err)
+	}
+
+	paths := make([]string, 0, len(status))
+	for path, fileStatus := range status {
+		if fileStatus.Staging == gogit.Unmodified && fileStatus.Worktree == gogit.Unmodified {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var sb strings.Builder
+	for _, path := range paths {
+		fileStatus := status[path]
+		fmt.Fprintf(&sb, "%c%c %s\n", fileStatus.Staging, fileStatus.Worktree, path)
+	}
+	return sb.String(), nil
+}
+
+// Add implements Backend. Submodule pointers are staged directly in the index,
+// since go-git cannot add submodule directories.
+func (b *GoGitBackend) Add(ctx context.Context, dir string, paths ...string) error {
+	repo, wt, err := b.openWorktree(dir)
+	if err != nil {
+		return err
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return fmt.Errorf("status failed: %w", err)
+	}
+	submodules, err := wt.Submodules()
+	if err != nil {
+		return fmt.Errorf("failed to load submodules: %w", err)
+	}
+	submodulesByPath := make(map[string]*gogit.Submodule, len(submodules))
+	for _, submodule := range submodules {
+		submodulesByPath[submodule.Config().Path] = submodule
+	}
+
+	changed := make([]string, 0, len(status))
+	for file, fileStatus := range status {
+		if fileStatus.Worktree == gogit.Unmodified {
+			continue
+		}
+		for _, path := range paths {
+			if path == "." || file == path || strings.HasPrefix(file, path+"/") {
+				changed = append(changed, file)
+				break
+			}
+		}
+	}
+	sort.Strings(changed)
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+	files := make([]string, 0, len(changed))
+	indexChanged := false
+	for _, file := range changed {
+		submodule, ok := submodulesByPath[file]
+		if !ok {
+			files = append(files, file)
+			continue
+		}
+		submoduleStatus, err := submodule.Status()
+		if err != nil {
+			return fmt.Errorf("failed to get status of submodule %s: %w", file, err)
+		}
+		entry, err := idx.Entry(file)
+		if err != nil || submoduleStatus.Current.IsZero() {
+			continue
+		}
+		entry.Hash = submoduleStatus.Current
+		indexChanged = true
+	}
+	if indexChanged {
+		if err := repo.Storer.SetIndex(idx); err != nil {
+			return fmt.Errorf("failed to write index: %w", err)
+		}
+	}
+
+	for _, file := range files {
+		if _, err := wt.Add(file); err != nil {
+			return fmt.Errorf("add %s failed: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// Commit implements Backend
+func (b *GoGitBackend) Commit(ctx context.Context, dir, message string, author Signature) error {
+	_, wt, err := b.openWorktree(dir)
+	if err != nil {
+		return err
+	}
+
+	commitOptions := &gogit.CommitOptions{}
+	if author.Name != "" || author.Email != "" {
+		commitOptions.Author = &object.Signature{Name: author.Name, Email: author.Email, When: time.Now()}
+	}
+	if _, err := wt.Commit(message, commitOptions); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+	return nil
+}
+
+// Checkout implements Backend. Checking out a branch that only exists on origin creates it from there.
+func (b *GoGitBackend) Checkout(ctx context.Context, dir string, opts CheckoutOptions) error {
+	repo, wt, err := b.openWorktree(dir)
+	if err != nil {
+		return err
+	}
+
+	var checkoutOptions *gogit.CheckoutOptions
+	switch {
+	case opts.Detach:
+		startPoint := opts.StartPoint
+		if startPoint == "" {
+			startPoint = "HEAD"
+		}
+		hash, err := b.resolve(repo, startPoint)
+		if err != nil {
+			return err
+		}
+		checkoutOptions = &gogit.CheckoutOptions{Hash: hash}
+	case opts.Create:
+		startPoint := opts.StartPoint
+		if startPoint == "" {
+			startPoint = "HEAD"
+		}
+		hash, err := b.resolve(repo, startPoint)
+		if err != nil {
+			return err
+		}
+		checkoutOptions = &gogit.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(opts.Branch), Create: true, Hash: hash}
+	default:
+		checkoutOptions = &gogit.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(opts.Branch)}
+	}
+
+	err = wt.Checkout(checkoutOptions)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) && !opts.Create && !opts.Detach {
+		return b.Checkout(ctx, dir, CheckoutOptions{Branch: opts.Branch, Create: true, StartPoint: "origin/" + opts.Branch})
+	}
+	if err != nil {
+		return fmt.Errorf("checkout failed: %w", err)
+	}
+	return nil
+}
+
+// Reset implements Backend
+func (b *GoGitBackend) Reset(ctx context.Context, dir, rev string) error {
+	repo, wt, err := b.openWorktree(dir)
+	if err != nil {
+		return err
+	}
+	hash, err := b.resolve(repo, rev)
+	if err != nil {
+		return err
+	}
+	if err := wt.Reset(&gogit.ResetOptions{Commit: hash, Mode: gogit.HardReset}); err != nil {
+		return fmt.Errorf("reset failed: %w", err)
+	}
+	return nil
+}
+
+// Rebase implements Backend for the fast-forward case only
+func (b *GoGitBackend) Rebase(ctx context.Context, dir, upstream string) error {
+	repo, err := b.open(dir)
+	if err != nil {
+		return err
+	}
+	head, other, err := b.commits(repo, "HEAD", upstream)
+	if err != nil {
+		return err
+	}
+
+	if head.Hash == other.Hash {
+		return nil
+	}
+	if contained, err := other.IsAncestor(head); err == nil && contained {
+		return nil
+	}
+	if canFastForward, err := head.IsAncestor(other); err != nil || !canFastForward {
+		return fmt.Errorf("rebase onto %s with local commits: %w", upstream, ErrUnsupported)
+	}
+	return b.Reset(ctx, dir, other.Hash.String())
+}
+
+// Merge implements Backend for branches that fast-forward the current HEAD.
+// With NoFastForward a merge commit is recorded on top, as git merge --no-ff does.
+func (b *GoGitBackend) Merge(ctx context.Context, dir, branch string, opts MergeOptions) error {
+	repo, err := b.open(dir)
+	if err != nil {
+		return err
+	}
+	head, other, err := b.commits(repo, "HEAD", branch)
+	if err != nil {
+		return err
+	}
+
+	if head.Hash == other.Hash {
+		return nil
+	}
+	if contained, err := other.IsAncestor(head); err == nil && contained {
+		return nil
+	}
+	if canFastForward, err := head.IsAncestor(other); err != nil || !canFastForward {
+		return fmt.Errorf("three-way merge of %s: %w", branch, ErrUnsupported)
+	}
+	if !opts.NoFastForward {
+		return b.Reset(ctx, dir, other.Hash.String())
+	}
+
+	signature, err := b.signature(repo, opts.Author)
+	if err != nil {
+		return err
+	}
+	merge := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      fmt.Sprintf("Merge branch '%s'", branch),
+		TreeHash:     other.TreeHash,
+		ParentHashes: []plumbing.Hash{head.Hash, other.Hash},
+	}
+	obj := repo.Storer.NewEncodedObject()
+	if err := merge.Encode(obj); err != nil {
+		return fmt.Errorf("failed to encode merge commit: %w", err)
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return fmt.Errorf("failed to store merge commit: %w", err)
+	}
+	return b.Reset(ctx, dir, hash.String())
+}
+
+// commits resolves two revisions to their commit objects
+func (b *GoGitBackend) commits(repo *gogit.Repository, first, second string) (*object.Commit, *object.Commit, error) {
+	firstHash, err := b.resolve(repo, first)
+	if err != nil {
+		return nil, nil, err
+	}
+	secondHash, err := b.resolve(repo, second)
+	if err != nil {
+		return nil, nil, err
+	}
+	firstCommit, err := repo.CommitObject(firstHash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load commit %s: %w", first, err)
+	}
+	secondCommit, err := repo.CommitObject(secondHash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load commit %s: %w", second, err)
+	}
+	return firstCommit, secondCommit, nil
+}
+
+// signature builds a commit signature, filling empty fields from the repository configuration
+func (b *GoGitBackend) signature(repo *gogit.Repository, author Signature) (object.Signature, error) {
+	cfg, err := repo.ConfigScoped(gitconfig.GlobalScope)
+	if err != nil {
+		return object.Signature{}, fmt.Errorf("failed to load git config: %w", err)
+	}
+	if author.Name == "" {
+		author.Name = cfg.User.Name
+	}
+	if author.Email == "" {
+		author.Email = cfg.User.Email
+	}
+	return object.Signature{Name: author.Name, Email: author.Email, When: time.Now()}, nil
+}
+
+// WorktreeAdd implements Backend by cloning the branch into its own directory,
+// since go-git does not support linked worktrees
+func (b *GoGitBackend) WorktreeAdd(ctx context.Context, dir, path string, opts WorktreeAddOptions) error {
+	return b.Clone(ctx, opts.Credentials.URL, path, CloneOptions{Branch: opts.Branch, Credentials: opts.Credentials})
+}
+
+// WorktreePrune implements Backend. Branch directories are independent clones, so there is nothing to prune.
+func (b *GoGitBackend) WorktreePrune(ctx context.Context, dir string) error {
+	return nil
+}
+
+// SubmoduleInit implements Backend
+func (b *GoGitBackend) SubmoduleInit(ctx context.Context, dir string) error {
+	_, wt, err := b.openWorktree(dir)
+	if err != nil {
+		return err
+	}
+	submodules, err := wt.Submodules()
+	if err != nil {
+		return fmt.Errorf("failed to load submodules: %w", err)
+	}
+	if err := submodules.Init(); err != nil {
+		return fmt.Errorf("submodule init failed: %w", err)
+	}
+	return nil
+}
+
+// SubmoduleUpdate implements Backend. With Remote, each submodule is moved to the tip of its
+// configured branch, or the remote HEAD when no branch is configured.
+func (b *GoGitBackend) SubmoduleUpdate(ctx context.Context, dir string, opts SubmoduleUpdateOptions) error {
+	_, wt, err := b.openWorktree(dir)
+	if err != nil {
+		return err
+	}
+	auth, err := b.authMethod(opts.Credentials)
+	if err != nil {
+		return err
+	}
+	submodules, err := wt.Submodules()
+	if err != nil {
+		return fmt.Errorf("failed to load submodules: %w", err)
+	}
+
+	recursion := gogit.NoRecurseSubmodules
+	if opts.Recursive {
+		recursion = gogit.DefaultSubmoduleRecursionDepth
+	}
+
+	for _, submodule := range submodules {
+		cfg := submodule.Config()
+		if len(opts.Paths) > 0 && !matchesRefPattern(cfg.Path, opts.Paths) && !matchesRefPattern(cfg.Name, opts.Paths) {
+			continue
+		}
+
+		err := submodule.UpdateContext(ctx, &gogit.SubmoduleUpdateOptions{Init: opts.Init, RecurseSubmodules: recursion, Auth: auth})
+		if errors.Is(err, gogit.ErrSubmoduleNotInitialized) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("submodule update of %s failed: %w", cfg.Path, err)
+		}
+
+		if opts.Remote {
+			if err := b.updateSubmoduleToRemote(ctx, submodule, auth, opts.Force); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateSubmoduleToRemote checks out the remote tip tracked by a submodule
+func (b *GoGitBackend) updateSubmoduleToRemote(ctx context.Context, submodule *gogit.Submodule, auth transport.AuthMethod, force bool) error {
+	cfg := submodule.Config()
+	repo, err := submodule.Repository()
+	if err != nil {
+		return fmt.Errorf("failed to open submodule %s: %w", cfg.Path, err)
+	}
+
+	err = repo.FetchContext(ctx, &gogit.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []gitconfig.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+		Auth:       auth,
+		Progress:   progress(ctx, "fetch"),
+	})
+	if err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("fetch of submodule %s failed: %w", cfg.Path, err)
+	}
+
+	var target plumbing.Hash
+	if cfg.Branch != "" {
+		target, err = b.resolve(repo, "origin/"+cfg.Branch)
+		if err != nil {
+			return err
+		}
+	} else {
+		remote, err := repo.Remote("origin")
+		if err != nil {
+			return fmt.Errorf("failed to load remote of submodule %s: %w", cfg.Path, err)
+		}
+		refs, err := remote.ListContext(ctx, &gogit.ListOptions{Auth: auth})
+		if err != nil {
+			return fmt.Errorf("ls-remote of submodule %s failed: %w", cfg.Path, err)
+		}
+		target = remoteHead(refs)
+		if target.IsZero() {
+			return fmt.Errorf("remote HEAD of submodule %s not found", cfg.Path)
+		}
+	}
+
+	subWorktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to open worktree of submodule %s: %w", cfg.Path, err)
+	}
+	if err := subWorktree.Checkout(&gogit.CheckoutOptions{Hash: target, Force: force}); err != nil {
+		return fmt.Errorf("checkout of submodule %s failed: %w", cfg.Path, err)
+	}
+	return nil
+}
+
+// remoteHead returns the commit advertised as HEAD, following a symbolic HEAD to its branch
+func remoteHead(refs []*plumbing.Reference) plumbing.Hash {
+	byName := make(map[plumbing.ReferenceName]*plumbing.Reference, len(refs))
+	for _, ref := range refs {
+		byName[ref.Name()] = ref
+	}
+	head, ok := byName[plumbing.HEAD]
+	if !ok {
+		return plumbing.ZeroHash
+	}
+	if head.Type() == plumbing.SymbolicReference {
+		if target, ok := byName[head.Target()]; ok {
+			return target.Hash()
+		}
+		return plumbing.ZeroHash
+	}
+	return head.Hash()
+}
+
+// SubmoduleStatus implements Backend
+func (b *GoGitBackend) SubmoduleStatus(ctx context.Context, dir string) (string, error) {
+	_, wt, err := b.openWorktree(dir)
+	if err != nil {
+		return "", err
+	}
+	submodules, err := wt.Submodules()
+	if err != nil {
+		return "", fmt.Errorf("failed to load submodules: %w", err)
+	}
+	status, err := submodules.Status()
+	if err != nil {
+		return "", fmt.Errorf("submodule status failed: %w", err)
+	}
+	return status.String(), nil
+}
+
+// Tags implements Backend
+func (b *GoGitBackend) Tags(ctx context.Context, dir string) ([]Tag, error) {
+	repo, err := b.open(dir)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := repo.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	tags := make([]Tag, 0)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		tag := Tag{Name: ref.Name().Short(), Commit: ref.Hash().String()}
+		if annotated, err := repo.TagObject(ref.Hash()); err == nil {
+			tag.Commit = annotated.Target.String()
+			if commit, err := annotated.Commit(); err == nil {
+				tag.Commit = commit.Hash.String()
+			}
+			tag.Annotation = strings.TrimSpace(annotated.Message)
+			tag.Date = annotated.Tagger.When
+		} else if commit, err := repo.CommitObject(ref.Hash()); err == nil {
+			tag.Date = commit.Committer.When
+		}
+		tags = append(tags, tag)
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	return tags, nil
+}
+
+// Log implements Backend
+func (b *GoGitBackend) Log(ctx context.Context, dir string, opts LogOptions) ([]Commit, error) {
+	repo, err := b.open(dir)
+	if err != nil {
+		return nil, err
+	}
+	rev := opts.Rev
+	if rev == "" {
+		rev = "HEAD"
+	}
+	hash, err := b.resolve(repo, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	logOptions := &gogit.LogOptions{From: hash, Order: gogit.LogOrderCommitterTime}
+	if len(opts.Paths) > 0 {
+		logOptions.PathFilter = func(name string) bool {
+			for _, path := range opts.Paths {
+				path = strings.TrimSuffix(path, "/")
+				if name == path || strings.HasPrefix(name, path+"/") {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	iter, err := repo.Log(logOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", rev, err)
+	}
+	defer iter.Close()
+
+	commits := make([]Commit, 0)
+	err = iter.ForEach(func(c *object.Commit) error {
+		if opts.Limit > 0 && len(commits) >= opts.Limit {
+			return storer.ErrStop
+		}
+		commits = append(commits, Commit{
+			Hash:    c.Hash.String(),
+			Author:  Signature{Name: c.Author.Name, Email: c.Author.Email},
+			Date:    c.Committer.When,
+			Message: strings.TrimSpace(c.Message),
+		})
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", rev, err)
+	}
+	return commits, nil
+}
+
+// ReadFile implements Backend
+func (b *GoGitBackend) ReadFile(ctx context.Context, dir, rev, path string) ([]byte, error) {
+	repo, err := b.open(dir)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := b.resolve(repo, rev)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load commit %s: %w", rev, err)
+	}
+	file, err := commit.File(path)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, fmt.Errorf("%s:%s: %w", rev, path, os.ErrNotExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s:%s: %w", rev, path, err)
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s:%s: %w", rev, path, err)
+	}
+	return []byte(content), nil
+}
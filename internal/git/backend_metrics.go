@@ -0,0 +1,63 @@
+package git
+
+import (
+	"context"
+
+	"github.com/Jieay/git-watcher/internal/metrics"
+)
+
+// instrumentedBackend counts failed git operations by operation name. Read-only
+// queries such as RevParse and checkouts are passed through: their failures are
+// expected while probing for submodules and branches that do not exist yet.
+type instrumentedBackend struct {
+	Backend
+}
+
+// observe counts err as a failure of operation and returns it unchanged
+func observe(operation string, err error) error {
+	if err != nil {
+		metrics.AddGitFailure(operation)
+	}
+	return err
+}
+
+func (b instrumentedBackend) Clone(ctx context.Context, url, dir string, opts CloneOptions) error {
+	return observe("clone", b.Backend.Clone(ctx, url, dir, opts))
+}
+
+func (b instrumentedBackend) Fetch(ctx context.Context, dir string, opts FetchOptions) error {
+	return observe("fetch", b.Backend.Fetch(ctx, dir, opts))
+}
+
+func (b instrumentedBackend) Pull(ctx context.Context, dir string, opts PullOptions) error {
+	return observe("pull", b.Backend.Pull(ctx, dir, opts))
+}
+
+func (b instrumentedBackend) Push(ctx context.Context, dir string, opts PushOptions) error {
+	return observe("push", b.Backend.Push(ctx, dir, opts))
+}
+
+func (b instrumentedBackend) LsRemote(ctx context.Context, dir string, opts LsRemoteOptions) ([]RemoteRef, error) {
+	refs, err := b.Backend.LsRemote(ctx, dir, opts)
+	return refs, observe("ls-remote", err)
+}
+
+func (b instrumentedBackend) Commit(ctx context.Context, dir, message string, author Signature) error {
+	return observe("commit", b.Backend.Commit(ctx, dir, message, author))
+}
+
+func (b instrumentedBackend) Rebase(ctx context.Context, dir, upstream string) error {
+	return observe("rebase", b.Backend.Rebase(ctx, dir, upstream))
+}
+
+func (b instrumentedBackend) Merge(ctx context.Context, dir, branch string, opts MergeOptions) error {
+	return observe("merge", b.Backend.Merge(ctx, dir, branch, opts))
+}
+
+func (b instrumentedBackend) WorktreeAdd(ctx context.Context, dir, path string, opts WorktreeAddOptions) error {
+	return observe("worktree-add", b.Backend.WorktreeAdd(ctx, dir, path, opts))
+}
+
+func (b instrumentedBackend) SubmoduleUpdate(ctx context.Context, dir string, opts SubmoduleUpdateOptions) error {
+	return observe("submodule-update", b.Backend.SubmoduleUpdate(ctx, dir, opts))
+}
@@ -0,0 +1,251 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/forge"
+	"github.com/Jieay/git-watcher/internal/logging"
+)
+
+// artifactsPushAttempts is the number of times the target branch of the artifacts repository
+// is pushed before an update fails
+const artifactsPushAttempts = 5
+
+// ErrArtifactsConflict is returned when the feature branch of the artifacts repository
+// conflicts with the target branch and the conflict strategy could not resolve it
+var ErrArtifactsConflict = errors.New("artifacts merge conflict")
+
+// ArtifactsConflict describes a conflict between the feature branch and the target branch of
+// the artifacts repository and how it was handled
+type ArtifactsConflict struct {
+	Strategy    string             `json:"strategy"`
+	Files       []string           `json:"files,omitempty"`       // Files changed on both branches
+	Resolved    bool               `json:"resolved"`              // Whether the update reached the target branch
+	PullRequest *forge.PullRequest `json:"pullRequest,omitempty"` // Pull request opened by the pullRequest strategy
+}
+
+// unmergedStates are the porcelain status codes of paths with merge conflicts
+var unmergedStates = map[string]bool{"DD": true, "AU": true, "UD": true, "UA": true, "DU": true, "AA": true, "UU": true}
+
+// unmergedFiles returns the paths left with conflicts by a failed merge or rebase
+func (m *Manager) unmergedFiles(ctx context.Context, repoPath string) []string {
+	output, err := m.backend.Status(ctx, repoPath)
+	if err != nil {
+		return nil
+	}
+	files := make([]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if len(line) > 3 && unmergedStates[line[:2]] {
+			files = append(files, line[3:])
+		}
+	}
+	return files
+}
+
+// mergeArtifacts merges the feature branch into the checked out target branch. When the
+// branches conflict the merge is abandoned and the conflict strategy of the artifacts
+// repository decides what happens instead; result.Conflict records the conflict. Returns
+// false when the update was left to a pull request and the target branch must not be pushed.
+func (m *Manager) mergeArtifacts(ctx context.Context, repoPath string, result *ArtifactsResult, patch artifactsPatch, commitConfig config.CommitConfig) (bool, error) {
+	author := Signature{Name: commitConfig.UserName, Email: commitConfig.UserEmail}
+	featureBranch, targetBranch := result.FeatureBranch, result.TargetBranch
+	if err := m.backend.Merge(ctx, repoPath, featureBranch, MergeOptions{NoFastForward: true, Author: author}); err == nil {
+		return true, nil
+	}
+
+	strategy := m.config.ArtifactsRepo.GetConflictStrategy()
+	conflict := &ArtifactsConflict{Strategy: strategy, Files: m.unmergedFiles(ctx, repoPath)}
+	result.Conflict = conflict
+	if err := m.backend.Reset(ctx, repoPath, "HEAD"); err != nil {
+		return false, fmt.Errorf("failed to abort merge of %s: %w", featureBranch, err)
+	}
+	logger := logging.FromContext(ctx)
+	logger.Warn("feature branch conflicts with target branch",
+		"feature_branch", featureBranch, "target_branch", targetBranch, "files", conflict.Files, "strategy", strategy)
+
+	var err error
+	switch strategy {
+	case config.ConflictFail:
+		err = fmt.Errorf("%w: branch %s conflicts with %s", ErrArtifactsConflict, featureBranch, targetBranch)
+	case config.ConflictRebase:
+		err = m.rebaseArtifactsFeature(ctx, repoPath, result, author)
+	case config.ConflictReapply:
+		err = m.reapplyArtifacts(ctx, repoPath, result, patch, commitConfig)
+	case config.ConflictPullRequest:
+		conflict.PullRequest, err = m.openConflictPullRequest(ctx, result)
+		if err != nil {
+			return false, err
+		}
+		logger.Info("opened pull request to resolve the conflict", "url", conflict.PullRequest.URL)
+		return false, nil
+	default:
+		err = m.backend.Merge(ctx, repoPath, featureBranch, MergeOptions{NoFastForward: true, StrategyOption: "theirs", Author: author})
+		if err != nil {
+			m.backend.Reset(ctx, repoPath, "HEAD")
+			err = fmt.Errorf("%w: failed to merge branch %s into %s: %v", ErrArtifactsConflict, featureBranch, targetBranch, err)
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	conflict.Resolved = true
+	logger.Info("resolved conflict", "strategy", strategy)
+	return true, nil
+}
+
+// rebaseArtifactsFeature rebases the feature branch onto the target branch, force pushes it and
+// merges it into the target branch, which is checked out again afterwards
+func (m *Manager) rebaseArtifactsFeature(ctx context.Context, repoPath string, result *ArtifactsResult, author Signature) error {
+	featureBranch, targetBranch := result.FeatureBranch, result.TargetBranch
+	if err := m.backend.Checkout(ctx, repoPath, CheckoutOptions{Branch: featureBranch}); err != nil {
+		return fmt.Errorf("failed to checkout feature branch: %w", err)
+	}
+	rebaseErr := m.backend.Rebase(ctx, repoPath, targetBranch)
+	if rebaseErr == nil {
+		result.Commit, _ = m.backend.RevParse(ctx, repoPath, "HEAD")
+		rebaseErr = m.push(ctx, repoPath, PushOptions{
+			Remote:      "origin",
+			RefSpec:     featureBranch,
+			Force:       true,
+			Credentials: credentialsFor(m.artifactsRepo()),
+		})
+	}
+	if err := m.backend.Checkout(ctx, repoPath, CheckoutOptions{Branch: targetBranch}); err != nil {
+		return fmt.Errorf("failed to checkout target branch %s: %w", targetBranch, err)
+	}
+	if rebaseErr != nil {
+		return fmt.Errorf("%w: failed to rebase branch %s onto %s: %v", ErrArtifactsConflict, featureBranch, targetBranch, rebaseErr)
+	}
+	if err := m.backend.Merge(ctx, repoPath, featureBranch, MergeOptions{NoFastForward: true, Author: author}); err != nil {
+		m.backend.Reset(ctx, repoPath, "HEAD")
+		return fmt.Errorf("failed to merge rebased branch %s into %s: %w", featureBranch, targetBranch, err)
+	}
+	return nil
+}
+
+// reapplyArtifacts applies the patch of the update to the version file of the checked out
+// target branch, keeping the other changes of the branch, and commits it
+func (m *Manager) reapplyArtifacts(ctx context.Context, repoPath string, result *ArtifactsResult, patch artifactsPatch, commitConfig config.CommitConfig) error {
+	filePath := filepath.Join(repoPath, patch.File)
+	existing, _ := os.ReadFile(filePath)
+	content, changed, err := patch.apply(existing)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrArtifactsConflict, err)
+	}
+	if changed {
+		if err := m.writeArtifactsFile(ctx, filePath, existing, content, patch); err != nil {
+			return fmt.Errorf("%w: %v", ErrArtifactsConflict, err)
+		}
+		if err := m.backend.Add(ctx, repoPath, patch.File); err != nil {
+			return fmt.Errorf("git add failed: %w", err)
+		}
+		message := artifactsCommitMessage(commitConfig, result)
+		if err := m.backend.Commit(ctx, repoPath, message, Signature{Name: commitConfig.UserName, Email: commitConfig.UserEmail}); err != nil {
+			return fmt.Errorf("git commit failed: %w", err)
+		}
+	}
+	result.Commit, _ = m.backend.RevParse(ctx, repoPath, "HEAD")
+	logging.FromContext(ctx).Info("applied update to target branch", "patch", patch.String(), "changed", changed)
+	return nil
+}
+
+// restartArtifactsFeature starts the feature branch over from the checked out target branch
+// after the update was applied to the target branch directly, so later updates do not
+// conflict with the abandoned feature commits again
+func (m *Manager) restartArtifactsFeature(ctx context.Context, repoPath string, result *ArtifactsResult) error {
+	err := m.push(ctx, repoPath, PushOptions{
+		Remote:      "origin",
+		RefSpec:     fmt.Sprintf("%s:%s", result.TargetBranch, result.FeatureBranch),
+		Force:       true,
+		Credentials: credentialsFor(m.artifactsRepo()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restart feature branch %s: %w", result.FeatureBranch, err)
+	}
+	if err := m.backend.Checkout(ctx, repoPath, CheckoutOptions{Branch: result.FeatureBranch}); err != nil {
+		return fmt.Errorf("failed to checkout feature branch: %w", err)
+	}
+	resetErr := m.backend.Reset(ctx, repoPath, result.TargetBranch)
+	if err := m.backend.Checkout(ctx, repoPath, CheckoutOptions{Branch: result.TargetBranch}); err != nil {
+		return fmt.Errorf("failed to checkout target branch %s: %w", result.TargetBranch, err)
+	}
+	if resetErr != nil {
+		return fmt.Errorf("failed to reset feature branch %s: %w", result.FeatureBranch, resetErr)
+	}
+	return nil
+}
+
+// pushArtifactsTarget pushes the checked out target branch. When the push is rejected because
+// the remote branch moved, for example by a concurrent update of another package, the local
+// branch is reset to the remote one and the patch of the update is applied again on top of
+// it, up to artifactsPushAttempts times.
+func (m *Manager) pushArtifactsTarget(ctx context.Context, repoPath string, result *ArtifactsResult, patch artifactsPatch, commitConfig config.CommitConfig) error {
+	logger := logging.FromContext(ctx)
+	targetBranch := result.TargetBranch
+	creds := credentialsFor(m.artifactsRepo())
+	restart := result.Conflict != nil && result.Conflict.Strategy == config.ConflictReapply
+
+	result.Push = &PushResult{Branch: targetBranch}
+	for attempt := 1; ; attempt++ {
+		err := m.push(ctx, repoPath, PushOptions{Remote: "origin", RefSpec: targetBranch, Credentials: creds})
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil || attempt == artifactsPushAttempts {
+			result.Push.Error = err.Error()
+			return fmt.Errorf("failed to push merged changes to %s: %w", targetBranch, err)
+		}
+		logger.Warn("push of target branch failed, applying the update again on top of the remote branch",
+			"target_branch", targetBranch, "attempt", attempt, "error", err)
+
+		err = m.fetch(ctx, repoPath, FetchOptions{
+			Remote:      "origin",
+			RefSpecs:    []string{fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", targetBranch, targetBranch)},
+			Credentials: creds,
+		})
+		if err != nil {
+			return fmt.Errorf("git fetch of target branch %s failed: %w", targetBranch, err)
+		}
+		if err := m.backend.Reset(ctx, repoPath, "origin/"+targetBranch); err != nil {
+			return fmt.Errorf("failed to reset target branch %s: %w", targetBranch, err)
+		}
+		if err := m.reapplyArtifacts(ctx, repoPath, result, patch, commitConfig); err != nil {
+			return err
+		}
+		restart = true
+	}
+	result.Push.Success = true
+
+	if restart {
+		if err := m.restartArtifactsFeature(ctx, repoPath, result); err != nil {
+			logger.Warn("failed to restart feature branch from target branch", "error", err)
+		}
+	}
+	return nil
+}
+
+// openConflictPullRequest opens a pull request from the feature branch to the target branch,
+// or updates the open one, so the conflict can be resolved on the hosting service
+func (m *Manager) openConflictPullRequest(ctx context.Context, result *ArtifactsResult) (*forge.PullRequest, error) {
+	client, err := forge.New(m.config.ArtifactsDelivery(), m.config.ArtifactsRepo.URL)
+	if err != nil {
+		return nil, err
+	}
+	req := artifactsPullRequest(result.Repository, result.Package, result.Version, result.File, result.FeatureBranch, result.TargetBranch)
+	req.Body += fmt.Sprintf("\nThe branch conflicts with `%s`", result.TargetBranch)
+	if len(result.Conflict.Files) > 0 {
+		req.Body += " in `" + strings.Join(result.Conflict.Files, "`, `") + "`"
+	}
+	req.Body += " and could not be merged automatically.\n"
+	pr, err := client.Ensure(ctx, req)
+	if err != nil {
+		return pr, fmt.Errorf("failed to open pull request for the conflict: %w", err)
+	}
+	return pr, nil
+}
@@ -0,0 +1,270 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+// testVersions returns the content of app.yaml recording three lines of package pkg
+func testVersions(v10, v11, v12 string) string {
+	return "app:\n  pkg:\n    pkg-1.0: " + v10 + "\n    pkg-1.1: " + v11 + "\n    pkg-1.2: " + v12 + "\n"
+}
+
+// newConflictRemote returns an artifacts remote whose feature branch records pkg-1.0-2,
+// while the same version and a change of another line reached main without the feature
+// branch, so the next update of pkg-1.0 conflicts with main
+func newConflictRemote(t *testing.T) string {
+	t.Helper()
+	remote := newRemote(t, "artifacts", map[string]string{"app.yaml": testVersions("pkg-1.0-1", "pkg-1.1-1", "pkg-1.2-1")})
+	pushFiles(t, remote, "feature-app", "Update pkg-1.0-2", map[string]string{"app.yaml": testVersions("pkg-1.0-2", "pkg-1.1-1", "pkg-1.2-1")})
+	pushFiles(t, remote, "main", "Update pkg-1.0-2 and pkg-1.2-2", map[string]string{"app.yaml": testVersions("pkg-1.0-2", "pkg-1.1-1", "pkg-1.2-2")})
+	return remote
+}
+
+// githubServer fakes the pull request API of GitHub for repository owner/art without open
+// pull requests and records the created ones
+type githubServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	created []map[string]interface{}
+}
+
+func newGitHubServer(t *testing.T) *githubServer {
+	s := &githubServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/owner/art/pulls":
+			w.Write([]byte("[]"))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/owner/art/pulls":
+			var in map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&in)
+			s.mu.Lock()
+			s.created = append(s.created, in)
+			s.mu.Unlock()
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"number":   7,
+				"html_url": "https://github.example/owner/art/pull/7",
+				"head":     map[string]string{"ref": in["head"].(string)},
+				"base":     map[string]string{"ref": in["base"].(string)},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestMergeArtifactsConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		want     string // Content of app.yaml on the remote main branch afterwards
+		resolved bool
+		err      error
+		calls    []string // Calls made by the update
+		absent   []string // Calls the update must not make
+	}{
+		{
+			name:     "fail",
+			strategy: config.ConflictFail,
+			want:     testVersions("pkg-1.0-2", "pkg-1.1-1", "pkg-1.2-2"),
+			err:      ErrArtifactsConflict,
+			absent:   []string{"push main", "merge -X theirs feature-app"},
+		},
+		{
+			name:     "theirs",
+			strategy: config.ConflictTheirs,
+			want:     testVersions("pkg-1.0-3", "pkg-1.1-1", "pkg-1.2-2"),
+			resolved: true,
+			calls:    []string{"merge -X theirs feature-app", "push main"},
+		},
+		{
+			name:     "rebase",
+			strategy: config.ConflictRebase,
+			want:     testVersions("pkg-1.0-3", "pkg-1.1-1", "pkg-1.2-2"),
+			resolved: true,
+			calls:    []string{"rebase main", "push -f feature-app", "push main"},
+		},
+		{
+			name:     "pull request",
+			strategy: config.ConflictPullRequest,
+			want:     testVersions("pkg-1.0-2", "pkg-1.1-1", "pkg-1.2-2"),
+			calls:    []string{"push -f feature-app"},
+			absent:   []string{"push main"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote := newConflictRemote(t)
+			server := newGitHubServer(t)
+			m, backend := newArtifactsManager(t, remote, config.ArtifactsRepo{
+				ConflictStrategy: tt.strategy,
+				Delivery:         &config.DeliveryConfig{Provider: "github", APIURL: server.URL, Project: "owner/art", Token: "t"},
+			})
+
+			result, err := m.UpdateArtifactsRepo(context.Background(), testArtifact("pkg-1.0-3"), ArtifactsOptions{})
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("UpdateArtifactsRepo() error = %v, want %v", err, tt.err)
+				}
+			} else if err != nil {
+				t.Fatalf("UpdateArtifactsRepo() error = %v", err)
+			}
+			if content := remoteFile(t, remote, "main", "app.yaml") + "\n"; content != tt.want {
+				t.Errorf("app.yaml = %q, want %q", content, tt.want)
+			}
+
+			conflict := result.Conflict
+			if conflict == nil {
+				t.Fatal("no conflict recorded")
+			}
+			if conflict.Strategy != tt.strategy || conflict.Resolved != tt.resolved {
+				t.Errorf("conflict = %+v, want strategy %s resolved %v", conflict, tt.strategy, tt.resolved)
+			}
+			if len(conflict.Files) != 1 || conflict.Files[0] != "app.yaml" {
+				t.Errorf("conflict files = %q, want [app.yaml]", conflict.Files)
+			}
+			for _, call := range tt.calls {
+				if backend.count(call) == 0 {
+					t.Errorf("missing call %q in %q", call, backend.calls)
+				}
+			}
+			for _, call := range tt.absent {
+				if backend.count(call) > 0 {
+					t.Errorf("unexpected call %q in %q", call, backend.calls)
+				}
+			}
+
+			if tt.strategy == config.ConflictPullRequest {
+				if len(server.created) != 1 || server.created[0]["head"] != "feature-app" || server.created[0]["base"] != "main" {
+					t.Fatalf("created pull requests = %v, want one from feature-app to main", server.created)
+				}
+				if body, _ := server.created[0]["body"].(string); !strings.Contains(body, "conflicts with `main` in `app.yaml`") {
+					t.Errorf("pull request body = %q, want the conflict", body)
+				}
+				if conflict.PullRequest == nil || conflict.PullRequest.Number != 7 {
+					t.Errorf("conflict pull request = %+v, want #7", conflict.PullRequest)
+				}
+			}
+		})
+	}
+}
+
+func TestReapplyArtifactsConflict(t *testing.T) {
+	remote := newConflictRemote(t)
+	m, backend := newArtifactsManager(t, remote, config.ArtifactsRepo{})
+
+	result, err := m.UpdateArtifactsRepo(context.Background(), testArtifact("pkg-1.0-3"), ArtifactsOptions{})
+	if err != nil {
+		t.Fatalf("UpdateArtifactsRepo() error = %v", err)
+	}
+	if result.Conflict == nil || result.Conflict.Strategy != config.ConflictReapply || !result.Conflict.Resolved {
+		t.Errorf("conflict = %+v, want resolved by reapply", result.Conflict)
+	}
+	want := testVersions("pkg-1.0-3", "pkg-1.1-1", "pkg-1.2-2")
+	if content := remoteFile(t, remote, "main", "app.yaml") + "\n"; content != want {
+		t.Errorf("app.yaml = %q, want %q", content, want)
+	}
+
+	// The feature branch starts over from main, so the next update does not conflict again
+	if backend.count("push -f main:feature-app") != 1 {
+		t.Errorf("feature branch not restarted, calls %q", backend.calls)
+	}
+	if feature, main := runGit(t, remote, "rev-parse", "feature-app"), runGit(t, remote, "rev-parse", "main"); feature != main {
+		t.Errorf("feature-app = %s, want main %s", feature, main)
+	}
+	backend.reset()
+	result, err = m.UpdateArtifactsRepo(context.Background(), testArtifact("pkg-1.0-4"), ArtifactsOptions{})
+	if err != nil {
+		t.Fatalf("UpdateArtifactsRepo() error = %v", err)
+	}
+	if result.Conflict != nil {
+		t.Errorf("conflict = %+v after the feature branch was restarted", result.Conflict)
+	}
+}
+
+func TestPushArtifactsTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		rejects int    // Pushes of main rejected because another writer pushed first
+		want    string // Content of app.yaml on the remote main branch afterwards
+		err     string
+	}{
+		{
+			name: "pushes",
+			want: testVersions("pkg-1.0-2", "pkg-1.1-1", "pkg-1.2-1"),
+		},
+		{
+			name:    "applies the update again on top of a concurrent update",
+			rejects: 1,
+			want:    testVersions("pkg-1.0-2", "pkg-1.1-2", "pkg-1.2-1"),
+		},
+		{
+			name:    "gives up",
+			rejects: artifactsPushAttempts,
+			want:    testVersions("pkg-1.0-1", "pkg-1.1-6", "pkg-1.2-1"),
+			err:     "failed to push merged changes to main",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote := newRemote(t, "artifacts", map[string]string{"app.yaml": testVersions("pkg-1.0-1", "pkg-1.1-1", "pkg-1.2-1")})
+			m, backend := newArtifactsManager(t, remote, config.ArtifactsRepo{})
+
+			// Another writer updates pkg-1.1 on main right before the push
+			pushes := 0
+			backend.hook("push", func(call string) error {
+				if call == "push main" && pushes < tt.rejects {
+					pushes++
+					version := "pkg-1.1-" + strconv.Itoa(pushes+1)
+					pushFiles(t, remote, "main", "Update "+version, map[string]string{"app.yaml": testVersions("pkg-1.0-1", version, "pkg-1.2-1")})
+				}
+				return nil
+			})
+
+			result, err := m.UpdateArtifactsRepo(context.Background(), testArtifact("pkg-1.0-2"), ArtifactsOptions{})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("UpdateArtifactsRepo() error = %v, want %q", err, tt.err)
+				}
+				if result.Push == nil || result.Push.Success || result.Push.Error == "" {
+					t.Errorf("push = %+v, want the error", result.Push)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("UpdateArtifactsRepo() error = %v", err)
+				}
+				if result.Push == nil || !result.Push.Success {
+					t.Errorf("push = %+v, want success", result.Push)
+				}
+			}
+			if content := remoteFile(t, remote, "main", "app.yaml") + "\n"; content != tt.want {
+				t.Errorf("app.yaml = %q, want %q", content, tt.want)
+			}
+
+			wantPushes := min(tt.rejects+1, artifactsPushAttempts)
+			if got := backend.count("push main"); got != wantPushes {
+				t.Errorf("pushed main %d times, want %d", got, wantPushes)
+			}
+			if got := backend.count("reset origin/main"); got != wantPushes-1 {
+				t.Errorf("reset to origin/main %d times, want %d", got, wantPushes-1)
+			}
+			// The feature branch only starts over when the update reached main on top of other commits
+			restarted := tt.rejects > 0 && tt.err == ""
+			if got := backend.count("push -f main:feature-app") == 1; got != restarted {
+				t.Errorf("feature branch restarted = %v, want %v, calls %q", got, restarted, backend.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/forge"
+	"github.com/Jieay/git-watcher/internal/logging"
+)
+
+// pushToPullRequest delivers the auto-commit of a branch worktree as a pull request: the
+// commit is force-pushed to the bot branch of the branch, unless the bot branch already holds
+// the same tree, and a pull request from the bot branch into the branch is opened or updated.
+// The branch itself is reset to its remote-tracking branch afterwards, the submodules stay
+// checked out at their new commits so the next check regenerates the bot branch. Returns the
+// commit at the head of the bot branch.
+func (m *Manager) pushToPullRequest(ctx context.Context, repo *config.Repository, branch, repoPath string, push *PushResult) (string, error) {
+	logger := logging.FromContext(ctx)
+	delivery := m.config.DeliveryFor(repo)
+	client, err := forge.New(delivery, repo.GetURL())
+	if err != nil {
+		return "", err
+	}
+	head := delivery.GetBranchPrefix() + branch
+	push.Branch = head
+	defer func() {
+		if err := m.backend.Reset(ctx, repoPath, "origin/"+branch); err != nil {
+			logger.Warn("failed to reset branch after pushing the bot branch", "error", err)
+		}
+	}()
+	changes := m.pendingSubmoduleChanges(ctx, repo, branch, repoPath)
+	commit, _ := m.backend.RevParse(ctx, repoPath, "HEAD")
+
+	upToDate, err := m.botBranchUpToDate(ctx, repo, repoPath, head)
+	if err != nil {
+		return commit, err
+	}
+	if upToDate {
+		logger.Info("bot branch already holds the submodule changes", "bot_branch", head)
+		commit, _ = m.backend.RevParse(ctx, repoPath, "refs/remotes/origin/"+head)
+	} else {
+		err := m.push(ctx, repoPath, PushOptions{
+			Remote:      "origin",
+			RefSpec:     fmt.Sprintf("refs/heads/%s:refs/heads/%s", branch, head),
+			Force:       true,
+			Credentials: credentialsFor(repo),
+		})
+		if err != nil {
+			return commit, fmt.Errorf("git push of bot branch %s failed: %w", head, err)
+		}
+		push.Forced = true
+		logger.Info("pushed submodule changes to bot branch", "bot_branch", head)
+	}
+
+	push.PullRequest, err = client.Ensure(ctx, submodulePullRequest(repo, branch, head, changes))
+	return commit, err
+}
+
+// botBranchUpToDate reports whether the remote bot branch exists and its tree matches HEAD
+func (m *Manager) botBranchUpToDate(ctx context.Context, repo *config.Repository, repoPath, head string) (bool, error) {
+	lsRemoteCtx, cancel := context.WithTimeout(ctx, m.config.Timeouts.FetchTimeout())
+	refs, err := m.backend.LsRemote(lsRemoteCtx, repoPath, LsRemoteOptions{
+		Remote:      "origin",
+		Patterns:    []string{"refs/heads/" + head},
+		Credentials: credentialsFor(repo),
+	})
+	cancel()
+	if err != nil {
+		return false, fmt.Errorf("failed to check bot branch %s: %w", head, err)
+	}
+	if len(refs) == 0 {
+		return false, nil
+	}
+	err = m.fetch(ctx, repoPath, FetchOptions{
+		Remote:      "origin",
+		RefSpecs:    []string{fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", head, head)},
+		Credentials: credentialsFor(repo),
+	})
+	if err != nil {
+		return false, fmt.Errorf("git fetch of bot branch %s failed: %w", head, err)
+	}
+	remoteTree, err := m.backend.RevParse(ctx, repoPath, "refs/remotes/origin/"+head+":")
+	if err != nil {
+		return false, err
+	}
+	localTree, err := m.backend.RevParse(ctx, repoPath, "HEAD:")
+	if err != nil {
+		return false, err
+	}
+	return remoteTree == localTree, nil
+}
+
+// pendingSubmoduleChanges returns the submodules whose commit recorded by HEAD differs from
+// the one recorded by the remote-tracking branch
+func (m *Manager) pendingSubmoduleChanges(ctx context.Context, repo *config.Repository, branch, repoPath string) []SubmoduleChange {
+	submodules, err := m.listSubmodules(repoPath)
+	if err != nil {
+		return nil
+	}
+	changes := make([]SubmoduleChange, 0, len(submodules))
+	for _, submodule := range submodules {
+		after, err := m.backend.RevParse(ctx, repoPath, "HEAD:"+submodule)
+		if err != nil {
+			continue
+		}
+		before, _ := m.backend.RevParse(ctx, repoPath, "origin/"+branch+":"+submodule)
+		if before == after {
+			continue
+		}
+		changes = append(changes, SubmoduleChange{
+			Path:    submodule,
+			Before:  before,
+			After:   after,
+			Version: m.submoduleVersion(ctx, repo, branch, repoPath, submodule),
+		})
+	}
+	return changes
+}
+
+// submodulePullRequest describes the pull request of submodule changes
+func submodulePullRequest(repo *config.Repository, branch, head string, changes []SubmoduleChange) forge.Request {
+	title := fmt.Sprintf("Update %d submodules of %s", len(changes), branch)
+	if len(changes) == 1 {
+		to := changes[0].Version
+		if to == "" {
+			to = shortHash(changes[0].After)
+		}
+		title = fmt.Sprintf("Update submodule %s to %s", changes[0].Path, to)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Updates the submodules of branch `%s` of repository `%s`.\n\n", branch, repo.GetName())
+	body.WriteString("| Submodule | From | To | Version |\n| --- | --- | --- | --- |\n")
+	for _, change := range changes {
+		fmt.Fprintf(&body, "| %s | %s | %s | %s |\n", change.Path, shortHash(change.Before), shortHash(change.After), change.Version)
+	}
+	fmt.Fprintf(&body, "\nOpened by Git Watcher. Branch `%s` is regenerated when the submodules move again.\n", head)
+	return forge.Request{Head: head, Base: branch, Title: title, Body: body.String()}
+}
+
+// prepareArtifactsPullRequest starts the feature branch over from the target branch when no
+// pull request of it is open, so that a merged or closed pull request is not delivered again
+func (m *Manager) prepareArtifactsPullRequest(ctx context.Context, client *forge.Client, repoPath, featureBranch, targetBranch string) error {
+	pr, err := client.Find(ctx, featureBranch, targetBranch)
+	if err != nil {
+		return fmt.Errorf("failed to look up pull request: %w", err)
+	}
+	if pr != nil {
+		return nil
+	}
+	err = m.fetch(ctx, repoPath, FetchOptions{
+		Remote:      "origin",
+		RefSpecs:    []string{fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", targetBranch, targetBranch)},
+		Credentials: credentialsFor(m.artifactsRepo()),
+	})
+	if err != nil {
+		return fmt.Errorf("git fetch of target branch %s failed: %w", targetBranch, err)
+	}
+	if err := m.backend.Reset(ctx, repoPath, "origin/"+targetBranch); err != nil {
+		return fmt.Errorf("failed to reset feature branch to %s: %w", targetBranch, err)
+	}
+	logging.FromContext(ctx).Info("started feature branch over from target branch", "feature_branch", featureBranch, "target_branch", targetBranch)
+	return nil
+}
+
+// artifactsPullRequest describes the pull request of an artifacts update
+func artifactsPullRequest(repoName, pkgName, version, file, featureBranch, targetBranch string) forge.Request {
+	return forge.Request{
+		Head:  featureBranch,
+		Base:  targetBranch,
+		Title: fmt.Sprintf("Update %s to %s in %s", pkgName, version, repoName),
+		Body: fmt.Sprintf("Updates package `%s` to version `%s` in `%s`.\n\nOpened by Git Watcher. Later versions are added to this pull request while it is open.\n",
+			pkgName, version, file),
+	}
+}
+
+// shortHash abbreviates a commit hash
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
@@ -0,0 +1,131 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around changes
+const diffContext = 3
+
+// diffLine is a line of a diff, prefixed with ' ', '-' or '+'
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns the unified diff turning before into after, empty when they are equal
+func unifiedDiff(name, before, after string) string {
+	if before == after {
+		return ""
+	}
+	lines := diffLines(splitLines(before), splitLines(after))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", name, name)
+	for start := 0; start < len(lines); {
+		// Find the next change and the end of the hunk around it
+		first := start
+		for first < len(lines) && lines[first].op == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		hunkStart := max(first-diffContext, start)
+		end, unchanged := first, 0
+		for end < len(lines) && unchanged <= 2*diffContext {
+			if lines[end].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+			end++
+		}
+		hunkEnd := min(end-unchanged+diffContext, len(lines))
+
+		beforeLine, afterLine := 1, 1
+		for _, line := range lines[:hunkStart] {
+			if line.op != '+' {
+				beforeLine++
+			}
+			if line.op != '-' {
+				afterLine++
+			}
+		}
+		beforeCount, afterCount := 0, 0
+		for _, line := range lines[hunkStart:hunkEnd] {
+			if line.op != '+' {
+				beforeCount++
+			}
+			if line.op != '-' {
+				afterCount++
+			}
+		}
+		// An empty side is numbered by the line before it, as diff does
+		if beforeCount == 0 {
+			beforeLine--
+		}
+		if afterCount == 0 {
+			afterLine--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", beforeLine, beforeCount, afterLine, afterCount)
+		for _, line := range lines[hunkStart:hunkEnd] {
+			out.WriteByte(line.op)
+			out.WriteString(line.text)
+			out.WriteByte('\n')
+		}
+		start = hunkEnd
+	}
+	return out.String()
+}
+
+// splitLines splits text into lines without their line endings
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes a line diff from the longest common subsequence of a and b
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+	return lines
+}
@@ -1,42 +1,104 @@
 package git
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/forge"
+	"github.com/Jieay/git-watcher/internal/jsonnet"
+	"github.com/Jieay/git-watcher/internal/logging"
+	"github.com/Jieay/git-watcher/internal/manifest"
+	"github.com/Jieay/git-watcher/internal/metrics"
+	"github.com/Jieay/git-watcher/internal/version"
 )
 
 // Manager handles Git operations
 type Manager struct {
-	config *config.GitConfig
+	config  *config.GitConfig
+	backend Backend
 	// 添加文件锁和 Git 操作锁
 	fileLocks    map[string]*sync.Mutex
 	gitOpLock    sync.Mutex
 	fileLocksMux sync.Mutex
+	// 状态信息，供 /status 查询
+	statusMu         sync.Mutex
+	branchStatus     map[string]*BranchStatus
+	pendingArtifacts map[*ArtifactsOperation]struct{}
+	// 回滚后保持不变的子模块，按仓库和分支索引
+	holdsMu   sync.Mutex
+	holds     map[string]*SubmoduleHold
+	holdStore HoldStore
 }
 
-// NewManager creates a new Git manager
+// NewManager creates a new Git manager using the backend selected by git.backend
 func NewManager(cfg *config.GitConfig) (*Manager, error) {
+	backend, err := NewBackend(cfg.Backend)
+	if err != nil {
+		return nil, err
+	}
+	return NewManagerWithBackend(cfg, backend)
+}
+
+// NewManagerWithBackend creates a new Git manager on top of the given backend.
+// Failed operations of the backend are counted in the git_failures_total metric.
+func NewManagerWithBackend(cfg *config.GitConfig, backend Backend) (*Manager, error) {
+	if err := validateVersioning(cfg); err != nil {
+		return nil, err
+	}
+
 	// Ensure the working directory exists
 	if err := os.MkdirAll(cfg.WorkingDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create working directory: %w", err)
 	}
 
 	return &Manager{
-		config:    cfg,
-		fileLocks: make(map[string]*sync.Mutex),
+		config:           cfg,
+		backend:          instrumentedBackend{backend},
+		fileLocks:        make(map[string]*sync.Mutex),
+		branchStatus:     make(map[string]*BranchStatus),
+		pendingArtifacts: make(map[*ArtifactsOperation]struct{}),
+		holds:            make(map[string]*SubmoduleHold),
 	}, nil
 }
 
+// validateVersioning parses the version patterns of the manifest rules and the version
+// constraints of the submodule policies, which the configuration only checks by name
+func validateVersioning(cfg *config.GitConfig) error {
+	if cfg.ArtifactsRepo != nil {
+		for i, rule := range cfg.ArtifactsRepo.Manifests {
+			scheme := rule.Scheme
+			if scheme == "" {
+				scheme = cfg.ArtifactsRepo.GetVersionScheme()
+			}
+			if _, err := version.NewScheme(scheme, rule.Pattern); err != nil {
+				return fmt.Errorf("artifacts repository: manifests[%d]: %w", i, err)
+			}
+		}
+	}
+	for _, repo := range cfg.WatchedRepositories() {
+		for i, policy := range repo.SubmodulePolicies {
+			if policy.GetTrack() != config.TrackTag || policy.Constraint == "" {
+				continue
+			}
+			if _, err := version.ParseConstraint(policy.Constraint); err != nil {
+				return fmt.Errorf("repository %s submodule policy #%d: %w", repo.GetName(), i, err)
+			}
+		}
+	}
+	return nil
+}
+
 // getFileLock 获取指定文件的锁
 func (m *Manager) getFileLock(filePath string) *sync.Mutex {
 	m.fileLocksMux.Lock()
@@ -50,194 +112,294 @@ func (m *Manager) getFileLock(filePath string) *sync.Mutex {
 	return lock
 }
 
-// CheckAndUpdateRepos checks for updates in the main repository and its submodules
-// for all configured branches
-func (m *Manager) CheckAndUpdateRepos() error {
-	for _, branch := range m.config.Branches {
-		if err := m.CheckAndUpdateRepoBranch(branch); err != nil {
-			return fmt.Errorf("failed to check/update branch %s: %w", branch, err)
+// fetch runs a fetch bounded by the configured fetch timeout
+func (m *Manager) fetch(ctx context.Context, dir string, opts FetchOptions) error {
+	ctx, cancel := context.WithTimeout(ctx, m.config.Timeouts.FetchTimeout())
+	defer cancel()
+	return m.backend.Fetch(ctx, dir, opts)
+}
+
+// pull runs a pull bounded by the configured fetch timeout
+func (m *Manager) pull(ctx context.Context, dir string, opts PullOptions) error {
+	ctx, cancel := context.WithTimeout(ctx, m.config.Timeouts.FetchTimeout())
+	defer cancel()
+	return m.backend.Pull(ctx, dir, opts)
+}
+
+// push runs a push bounded by the configured push timeout
+func (m *Manager) push(ctx context.Context, dir string, opts PushOptions) error {
+	ctx, cancel := context.WithTimeout(ctx, m.config.Timeouts.PushTimeout())
+	defer cancel()
+	return m.backend.Push(ctx, dir, opts)
+}
+
+// CheckAndUpdateRepos checks for updates in every watched repository and its submodules
+// for all configured branches. Branches are processed concurrently in their own worktrees.
+func (m *Manager) CheckAndUpdateRepos(ctx context.Context) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, repo := range m.config.WatchedRepositories() {
+		for _, branch := range m.config.BranchesFor(repo) {
+			wg.Add(1)
+			go func(repoName, branch string) {
+				defer wg.Done()
+				ctx := logging.With(ctx, logging.KeyRepository, repoName, logging.KeyBranch, branch)
+				if _, err := m.CheckAndUpdateRepoBranch(ctx, repoName, branch); err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("failed to check/update repository %s branch %s: %w", repoName, branch, err))
+					mu.Unlock()
+				}
+			}(repo.GetName(), branch)
 		}
 	}
-	return nil
+	wg.Wait()
+	return errors.Join(errs...)
 }
 
-// CheckAndUpdateRepoBranch checks for updates in the main repository for a specific branch
-func (m *Manager) CheckAndUpdateRepoBranch(branch string) error {
-	// Create a copy of the main repo config with the specified branch
-	repoCopy := &config.Repository{
-		URL:       m.config.MainRepo.GetURL(),
-		Branch:    branch,
-		Directory: m.config.MainRepo.GetDirectory(),
-		Auth:      m.config.MainRepo.GetAuth(),
+// Repositories returns the watched main repositories
+func (m *Manager) Repositories() []*config.Repository {
+	return m.config.WatchedRepositories()
+}
+
+// Repository returns the watched main repository with the given name
+func (m *Manager) Repository(name string) (*config.Repository, error) {
+	repo, ok := m.config.FindRepository(name)
+	if !ok {
+		return nil, fmt.Errorf("repository %s is not configured", name)
 	}
+	return repo, nil
+}
 
-	// Check and update the main repository for the specified branch
-	mainRepoUpdated, err := m.checkAndUpdateRepo(repoCopy)
+// CheckAndUpdateRepoBranch checks for updates in a watched repository for a specific branch.
+// The result describes what was done and is returned even when the check fails.
+func (m *Manager) CheckAndUpdateRepoBranch(ctx context.Context, repoName, branch string) (result *BranchResult, err error) {
+	result = &BranchResult{Repository: repoName, Branch: branch}
+	started := time.Now()
+	var submoduleHeads map[string]string
+	m.beginBranchCheck(ctx, repoName, branch, started)
+	defer func() {
+		m.endBranchCheck(ctx, result, started, submoduleHeads, err)
+	}()
+
+	repo, err := m.Repository(repoName)
 	if err != nil {
-		return fmt.Errorf("failed to check/update main repo %s branch %s: %w",
-			m.config.MainRepo.GetURL(), branch, err)
+		return result, err
 	}
 
-	if !m.config.UseSubmodules {
-		return nil
+	// Check and update the branch worktree; concurrent calls for the same branch are serialized
+	branchLock := m.getFileLock(m.BranchPath(repo, branch))
+	branchLock.Lock()
+	defer branchLock.Unlock()
+
+	result.HeadBefore, _ = m.GetBranchCommitHash(ctx, repo, branch)
+
+	if m.IsDryRun(ctx) {
+		result.HeadAfter = result.HeadBefore
+		result.Plan, err = m.planBranch(ctx, repo, branch)
+		return result, err
+	}
+
+	repoPath, mainRepoUpdated, err := m.syncBranchWorktree(ctx, repo, branch)
+	if err != nil {
+		return result, fmt.Errorf("failed to check/update main repo %s branch %s: %w",
+			repo.GetURL(), branch, err)
 	}
+	result.Updated = mainRepoUpdated
+	result.HeadAfter, _ = m.backend.RevParse(ctx, repoPath, "HEAD")
+
+	if !m.config.UseSubmodulesFor(repo) {
+		return result, nil
+	}
+
+	// Remember the submodule commits recorded by the main repository to report what moved
+	recordedSubmodules := m.recordedSubmoduleCommits(ctx, repoPath)
 
 	// If using submodules and main repo updated, update all submodules
 	var submodulesUpdated bool
 	if mainRepoUpdated {
-		if err := m.updateSubmodules(); err != nil {
-			return fmt.Errorf("failed to update submodules: %w", err)
+		if err := m.updateSubmodules(ctx, repo, branch, repoPath); err != nil {
+			return result, fmt.Errorf("failed to update submodules: %w", err)
 		}
-		fmt.Printf("Successfully updated main repository branch %s and all submodules\n", branch)
+		logging.FromContext(ctx).Info("updated repository and all submodules")
 		submodulesUpdated = true
 	} else {
 		// Even if main repo wasn't updated, check submodules for updates
-		submodulesUpdated, err = m.checkAndUpdateSubmodules()
+		submodulesUpdated, err = m.checkAndUpdateSubmodules(ctx, repo, branch, repoPath)
 		if err != nil {
-			return fmt.Errorf("failed to check and update submodules: %w", err)
+			return result, fmt.Errorf("failed to check and update submodules: %w", err)
 		}
 	}
+	submoduleHeads = m.submoduleHeads(ctx, repoPath)
+	result.Submodules = submoduleChanges(recordedSubmodules, submoduleHeads)
+	for i := range result.Submodules {
+		result.Submodules[i].Version = m.submoduleVersion(ctx, repo, branch, repoPath, result.Submodules[i].Path)
+	}
 
 	// If auto commit is enabled and there were updates to submodules,
 	// commit those changes to the main repository
-	if m.config.AutoCommit && submodulesUpdated {
-		if err := m.commitSubmoduleChangesToMainRepo(branch); err != nil {
-			return fmt.Errorf("failed to commit submodule changes to main repository: %w", err)
+	if m.config.AutoCommitFor(repo) && submodulesUpdated {
+		commit, push, err := m.commitSubmoduleChangesToMainRepo(ctx, repo, branch, repoPath)
+		result.Commit, result.Push = commit, push
+		if err != nil {
+			return result, fmt.Errorf("failed to commit submodule changes to main repository: %w", err)
+		}
+		if commit != "" && (push == nil || push.PullRequest == nil) {
+			result.HeadAfter = commit
 		}
 	}
 
-	return nil
+	return result, nil
 }
 
-// checkAndUpdateSubmodules checks if any submodules have updates and updates them if they do
-// Returns true if any submodules were updated
-func (m *Manager) checkAndUpdateSubmodules() (bool, error) {
-	repoPath := filepath.Join(m.config.WorkingDir, m.config.MainRepo.GetDirectory())
+// endBranchCheck records the outcome of a branch check in the status and the metrics.
+// Dry runs change nothing, so they are left out of both.
+func (m *Manager) endBranchCheck(ctx context.Context, result *BranchResult, started time.Time, submoduleHeads map[string]string, err error) {
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if m.IsDryRun(ctx) {
+		return
+	}
+	m.finishBranchCheck(result, started, submoduleHeads)
+	metrics.ObserveBranchCheck(result.Repository, result.Branch, time.Since(started), err)
+	for _, change := range result.Submodules {
+		metrics.AddSubmoduleUpdate(result.Repository, result.Branch, change.Path)
+	}
+}
+
+// checkAndUpdateSubmodules checks if any submodules have updates and updates them if they do,
+// following the submodule policies of the branch. Returns true if any submodules were updated
+func (m *Manager) checkAndUpdateSubmodules(ctx context.Context, repo *config.Repository, branch, repoPath string) (bool, error) {
+	logger := logging.FromContext(ctx)
 	gitmodulesPath := filepath.Join(repoPath, ".gitmodules")
 
 	// Check if .gitmodules exists
 	if _, err := os.Stat(gitmodulesPath); os.IsNotExist(err) {
-		fmt.Println("No .gitmodules file found")
+		logger.Info("no .gitmodules file found")
 		return false, nil
 	}
 
 	// Get list of submodules
-	submodules, err := m.listSubmodules()
+	submodules, err := m.listSubmodules(repoPath)
 	if err != nil {
 		return false, fmt.Errorf("failed to list submodules: %w", err)
 	}
 
 	if len(submodules) == 0 {
-		fmt.Println("No submodules found in .gitmodules")
+		logger.Info("no submodules found in .gitmodules")
 		return false, nil
 	}
 
-	fmt.Printf("Found %d submodules: %v\n", len(submodules), submodules)
+	logger.Info("found submodules", "count", len(submodules), "submodules", submodules)
 
 	// Record original submodule commit hashes before update
 	originalHashes := make(map[string]string)
 	for _, submodule := range submodules {
-		hashCmd := exec.Command("git", "rev-parse", "HEAD")
-		hashCmd.Dir = filepath.Join(repoPath, submodule)
-		if hashOutput, err := hashCmd.Output(); err == nil {
-			originalHashes[submodule] = strings.TrimSpace(string(hashOutput))
-			fmt.Printf("Original %s hash: %s\n", submodule, originalHashes[submodule])
+		if hash, err := m.backend.RevParse(ctx, filepath.Join(repoPath, submodule), "HEAD"); err == nil {
+			originalHashes[submodule] = hash
+			logger.Debug("recorded original submodule commit", logging.KeySubmodule, submodule, "commit", hash)
 		} else {
-			fmt.Printf("Warning: Could not get original hash for submodule %s: %v\n", submodule, err)
+			logger.Warn("could not get original submodule commit", logging.KeySubmodule, submodule, "error", err)
 		}
 	}
 
 	// Check status of all submodules before update
-	statusCmd := exec.Command("git", "submodule", "status")
-	statusCmd.Dir = repoPath
-	statusOutput, err := statusCmd.CombinedOutput()
+	statusOutput, err := m.backend.SubmoduleStatus(ctx, repoPath)
 	if err != nil {
 		return false, fmt.Errorf("failed to check submodule status: %w", err)
 	}
 
-	fmt.Printf("Submodule status before update:\n%s\n", string(statusOutput))
+	logger.Debug("submodule status before update", "output", statusOutput)
 
 	// Check main repository status before submodule updates
-	mainStatusBeforeCmd := exec.Command("git", "status", "--porcelain")
-	mainStatusBeforeCmd.Dir = repoPath
-	mainStatusBeforeOutput, err := mainStatusBeforeCmd.Output()
+	mainStatusBeforeOutput, err := m.backend.Status(ctx, repoPath)
 	if err != nil {
 		return false, fmt.Errorf("failed to check main repository status before update: %w", err)
 	}
 
-	fmt.Printf("Main repository status before submodule updates:\n%s\n", string(mainStatusBeforeOutput))
+	logger.Debug("main repository status before submodule updates", "output", mainStatusBeforeOutput)
 
 	var anyUpdated bool
 	updatedSubmodules := make([]string, 0)
 
 	for _, submodule := range submodules {
-		fmt.Printf("Checking submodule %s for updates...\n", submodule)
+		subCtx := logging.With(ctx, logging.KeySubmodule, submodule)
+		subLogger := logging.FromContext(subCtx)
+		if m.isFrozen(repo, branch, submodule) {
+			subLogger.Info("submodule is frozen, skipping update")
+			continue
+		}
+		subLogger.Info("checking submodule for updates")
 
 		// Check if submodule needs updating
-		updateCmd := exec.Command("git", "submodule", "update", "--recursive", "--remote", submodule)
-		updateCmd.Dir = repoPath
-		if m.config.MainRepo.GetAuth().Type == "ssh" && m.config.MainRepo.GetAuth().SSHKeyPath != "" {
-			updateCmd.Env = append(os.Environ(), fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o StrictHostKeyChecking=no", m.config.MainRepo.GetAuth().SSHKeyPath))
+		updateCtx, cancel := context.WithTimeout(subCtx, m.config.Timeouts.FetchTimeout())
+		err := m.backend.SubmoduleUpdate(updateCtx, repoPath, SubmoduleUpdateOptions{
+			Remote:      true,
+			Recursive:   true,
+			Paths:       []string{submodule},
+			Credentials: credentialsFor(repo),
+		})
+		cancel()
+		if ctx.Err() != nil {
+			return false, fmt.Errorf("submodule update of %s aborted: %w", submodule, ctx.Err())
 		}
-		output, err := updateCmd.CombinedOutput()
 		if err != nil {
-			fmt.Printf("Warning: Failed to update submodule %s: %v\nOutput: %s\n", submodule, err, string(output))
+			subLogger.Warn("failed to update submodule", "error", err)
+			continue
+		}
+		if _, err := m.applySubmodulePolicy(subCtx, repo, branch, repoPath, submodule); err != nil {
+			subLogger.Warn("failed to apply submodule policy", "error", err)
 			continue
 		}
-
-		fmt.Printf("Submodule %s update output: %s\n", submodule, string(output))
 
 		// Get the new commit hash after update
-		hashCmd := exec.Command("git", "rev-parse", "HEAD")
-		hashCmd.Dir = filepath.Join(repoPath, submodule)
-		hashOutput, err := hashCmd.Output()
+		newHash, err := m.backend.RevParse(subCtx, filepath.Join(repoPath, submodule), "HEAD")
 		if err != nil {
-			fmt.Printf("Warning: Failed to get commit hash for submodule %s: %v\n", submodule, err)
+			subLogger.Warn("failed to get submodule commit", "error", err)
 			continue
 		}
 
-		newHash := strings.TrimSpace(string(hashOutput))
 		originalHash := originalHashes[submodule]
 
 		if newHash != originalHash {
-			fmt.Printf("Updated submodule %s from commit %s to commit %s\n", submodule, originalHash, newHash)
+			subLogger.Info("updated submodule", "from", originalHash, "to", newHash)
 			anyUpdated = true
 			updatedSubmodules = append(updatedSubmodules, submodule)
 		} else {
-			fmt.Printf("Submodule %s is already up to date at commit %s\n", submodule, newHash)
+			subLogger.Info("submodule is up to date", "commit", newHash)
 		}
 	}
 
 	// Check main repository status after submodule updates
-	mainStatusAfterCmd := exec.Command("git", "status", "--porcelain")
-	mainStatusAfterCmd.Dir = repoPath
-	mainStatusAfterOutput, err := mainStatusAfterCmd.CombinedOutput()
+	mainStatusAfterOutput, err := m.backend.Status(ctx, repoPath)
 	if err != nil {
 		return false, fmt.Errorf("failed to check main repository status after update: %w", err)
 	}
 
-	fmt.Printf("Main repository status after submodule updates:\n%s\n", string(mainStatusAfterOutput))
+	logger.Debug("main repository status after submodule updates", "output", mainStatusAfterOutput)
 
 	// Additional check: see if there are any changes in the working directory
-	hasChanges := len(strings.TrimSpace(string(mainStatusAfterOutput))) > 0
+	hasChanges := len(strings.TrimSpace(mainStatusAfterOutput)) > 0
 	if hasChanges {
-		fmt.Printf("Git working directory has changes - indicating submodule pointers have been updated\n")
+		logger.Info("working directory has changes, submodule pointers were updated")
 		anyUpdated = true
 	}
 
 	if anyUpdated {
-		fmt.Printf("Summary: Updated %d submodules: %v\n", len(updatedSubmodules), updatedSubmodules)
+		logger.Info("submodules updated", "count", len(updatedSubmodules), "submodules", updatedSubmodules)
 	} else {
-		fmt.Printf("No submodules were updated\n")
+		logger.Info("no submodules were updated")
 	}
 
 	return anyUpdated, nil
 }
 
-// updateSubmodules updates all submodules in the main repository
-func (m *Manager) updateSubmodules() error {
-	repoPath := filepath.Join(m.config.WorkingDir, m.config.MainRepo.GetDirectory())
-
+// updateSubmodules initializes and updates all submodules in a branch worktree, following the
+// submodule policies of the branch
+func (m *Manager) updateSubmodules(ctx context.Context, repo *config.Repository, branch, repoPath string) error {
 	// Check if .gitmodules exists
 	gitmodulesPath := filepath.Join(repoPath, ".gitmodules")
 	if _, err := os.Stat(gitmodulesPath); os.IsNotExist(err) {
@@ -245,72 +407,76 @@ func (m *Manager) updateSubmodules() error {
 	}
 
 	// Initialize submodules if they haven't been initialized yet
-	initCmd := exec.Command("git", "submodule", "init")
-	initCmd.Dir = repoPath
-	if output, err := initCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("git submodule init failed: %w, output: %s", err, string(output))
-	}
-
-	// Update submodules
-	updateCmd := exec.Command("git", "submodule", "update", "--recursive", "--remote", "--force")
-	updateCmd.Dir = repoPath
-
-	// Set environment variables for authentication if using SSH
-	if m.config.MainRepo.GetAuth().Type == "ssh" && m.config.MainRepo.GetAuth().SSHKeyPath != "" {
-		updateCmd.Env = append(os.Environ(), fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o StrictHostKeyChecking=no", m.config.MainRepo.GetAuth().SSHKeyPath))
-	}
-
-	if output, err := updateCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("git submodule update failed: %w, output: %s", err, string(output))
+	if err := m.backend.SubmoduleInit(ctx, repoPath); err != nil {
+		return fmt.Errorf("git submodule init failed: %w", err)
+	}
+
+	// Update submodules; uninitialized submodules are cloned, so the clone timeout applies
+	updateCtx, cancel := context.WithTimeout(ctx, m.config.Timeouts.CloneTimeout())
+	defer cancel()
+	err := m.backend.SubmoduleUpdate(updateCtx, repoPath, SubmoduleUpdateOptions{
+		Init:        true,
+		Remote:      true,
+		Recursive:   true,
+		Force:       true,
+		Credentials: credentialsFor(repo),
+	})
+	if err != nil {
+		return fmt.Errorf("git submodule update failed: %w", err)
 	}
 
 	// Get list of submodules for logging
-	submodules, err := m.listSubmodules()
+	submodules, err := m.listSubmodules(repoPath)
 	if err != nil {
-		fmt.Printf("Warning: Could not list submodules: %v\n", err)
-	} else {
-		fmt.Printf("Updated %d submodules: %s\n", len(submodules), strings.Join(submodules, ", "))
+		logging.FromContext(ctx).Warn("could not list submodules", "error", err)
+		return nil
+	}
+	for _, submodule := range submodules {
+		subCtx := logging.With(ctx, logging.KeySubmodule, submodule)
+		if _, err := m.applySubmodulePolicy(subCtx, repo, branch, repoPath, submodule); err != nil {
+			return fmt.Errorf("failed to apply policy of submodule %s: %w", submodule, err)
+		}
 	}
+	logging.FromContext(ctx).Info("submodules updated", "count", len(submodules), "submodules", submodules)
 
 	return nil
 }
 
-// commitSubmoduleChangesToMainRepo commits submodule changes to the main repository
-func (m *Manager) commitSubmoduleChangesToMainRepo(branch string) error {
-	repoPath := filepath.Join(m.config.WorkingDir, m.config.MainRepo.GetDirectory())
-
-	// Configure Git user for the commit if provided
-	if m.config.CommitConfig.UserName != "" {
-		configNameCmd := exec.Command("git", "config", "user.name", m.config.CommitConfig.UserName)
-		configNameCmd.Dir = repoPath
-		if output, err := configNameCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to set git user.name: %w, output: %s", err, string(output))
-		}
+// commitSubmoduleChangesToMainRepo commits submodule changes in a branch worktree to its main repository.
+// Only the given submodule paths are committed when any are passed, otherwise all changes are.
+// With pull request delivery all changes are committed, since the bot branch carries every pending update.
+// Returns the created commit, empty if there was nothing to commit, and the push result if a push was attempted.
+func (m *Manager) commitSubmoduleChangesToMainRepo(ctx context.Context, repo *config.Repository, branch, repoPath string, paths ...string) (string, *PushResult, error) {
+	commitConfig := m.config.CommitConfigFor(repo)
+	message := func(details []string) string {
+		return submoduleCommitMessage(commitConfig, repo, branch, details)
 	}
+	return m.commitSubmodules(ctx, repo, branch, repoPath, message, paths)
+}
 
-	if m.config.CommitConfig.UserEmail != "" {
-		configEmailCmd := exec.Command("git", "config", "user.email", m.config.CommitConfig.UserEmail)
-		configEmailCmd.Dir = repoPath
-		if output, err := configEmailCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to set git user.email: %w, output: %s", err, string(output))
-		}
+// commitSubmodules commits and delivers submodule changes of a branch worktree like
+// commitSubmoduleChangesToMainRepo, with the message built from the submodule details
+func (m *Manager) commitSubmodules(ctx context.Context, repo *config.Repository, branch, repoPath string, message func(details []string) string, paths []string) (string, *PushResult, error) {
+	logger := logging.FromContext(ctx)
+	commitConfig := m.config.CommitConfigFor(repo)
+	delivery := m.config.DeliveryFor(repo)
+	if delivery.IsPullRequest() {
+		paths = nil
 	}
 
 	// Check if there are changes to submodules
-	statusCmd := exec.Command("git", "status", "--porcelain")
-	statusCmd.Dir = repoPath
-	output, err := statusCmd.Output()
+	output, err := m.backend.Status(ctx, repoPath)
 	if err != nil {
-		return fmt.Errorf("failed to check git status: %w", err)
+		return "", nil, fmt.Errorf("failed to check git status: %w", err)
 	}
 
-	statusOutput := strings.TrimSpace(string(output))
+	statusOutput := strings.TrimSpace(output)
 	if len(statusOutput) == 0 {
-		fmt.Println("No changes to commit in main repository")
-		return nil
+		logger.Info("no changes to commit in main repository")
+		return "", nil, nil
 	}
 
-	fmt.Printf("Changes detected in main repository:\n%s\n", statusOutput)
+	logger.Debug("changes detected in main repository", "output", statusOutput)
 
 	// Check if changes are related to submodules
 	submoduleChanges := false
@@ -319,117 +485,149 @@ func (m *Manager) commitSubmoduleChangesToMainRepo(branch string) error {
 		if strings.Contains(line, " M ") && !strings.Contains(line, ".") {
 			// This indicates a submodule change (modified directory without extension)
 			submoduleChanges = true
-			fmt.Printf("Detected submodule change: %s\n", line)
+			logger.Debug("detected submodule change", "status", line)
 		}
 	}
 
 	if !submoduleChanges {
-		fmt.Println("Changes detected but none appear to be submodule related")
+		logger.Info("changes detected but none appear to be submodule related")
 		// Still proceed with commit as there might be submodule pointer changes
 	}
 
 	// Get the list of modified submodules
-	submodules, err := m.listSubmodules()
-	if err != nil {
-		return fmt.Errorf("failed to list submodules: %w", err)
+	submodules := paths
+	if len(submodules) == 0 {
+		submodules, err = m.listSubmodules(repoPath)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to list submodules: %w", err)
+		}
 	}
 
-	// Add all submodule changes
-	addCmd := exec.Command("git", "add", ".")
-	addCmd.Dir = repoPath
-	if output, err := addCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("git add failed: %w, output: %s", err, string(output))
+	// Add the submodule changes
+	addPaths := paths
+	if len(addPaths) == 0 {
+		addPaths = []string{"."}
 	}
-
-	// Create the commit message with timestamp and submodule details
-	timestamp := time.Now().Format(time.RFC3339)
-	commitMessage := m.config.CommitConfig.Message
-	if commitMessage == "" {
-		commitMessage = "Update submodules [Git Watcher Auto-Commit]"
+	if err := m.backend.Add(ctx, repoPath, addPaths...); err != nil {
+		return "", nil, fmt.Errorf("git add failed: %w", err)
 	}
 
 	// Get the current commit hashes of all submodules
 	submoduleDetails := make([]string, 0, len(submodules))
 	for _, submodule := range submodules {
-		hashCmd := exec.Command("git", "rev-parse", "HEAD")
-		hashCmd.Dir = filepath.Join(repoPath, submodule)
-		if hashOutput, err := hashCmd.Output(); err == nil {
-			submoduleDetails = append(submoduleDetails, fmt.Sprintf("%s: %s", submodule, strings.TrimSpace(string(hashOutput))))
+		hash, err := m.backend.RevParse(ctx, filepath.Join(repoPath, submodule), "HEAD")
+		if err != nil {
+			continue
 		}
+		version := m.submoduleVersion(ctx, repo, branch, repoPath, submodule)
+		submoduleDetails = append(submoduleDetails, submoduleDetail(submodule, hash, version))
 	}
-
-	// Format the commit message
-	commitMessage = fmt.Sprintf("%s\n\nBranch: %s\nTimestamp: %s\n\nUpdated submodules:\n%s",
-		commitMessage,
-		branch,
-		timestamp,
-		strings.Join(submoduleDetails, "\n"))
+	commitMessage := message(submoduleDetails)
 
 	// Commit the changes
-	commitCmd := exec.Command("git", "commit", "-m", commitMessage)
-	commitCmd.Dir = repoPath
-	if output, err := commitCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("git commit failed: %w, output: %s", err, string(output))
+	author := Signature{Name: commitConfig.UserName, Email: commitConfig.UserEmail}
+	if err := m.backend.Commit(ctx, repoPath, commitMessage, author); err != nil {
+		return "", nil, fmt.Errorf("git commit failed: %w", err)
 	}
+	commit, _ := m.backend.RevParse(ctx, repoPath, "HEAD")
 
-	fmt.Printf("Committed submodule changes to main repository on branch %s\n", branch)
-	fmt.Printf("Commit message:\n%s\n", commitMessage)
+	logger.Info("committed submodule changes to main repository", "commit", commit)
+	logger.Debug("commit message", "message", commitMessage)
 
 	// Push the changes if authentication is configured
-	if m.config.MainRepo.GetAuth().Type != "none" {
-		fmt.Printf("Attempting to push changes to remote repository on branch %s\n", branch)
-
-		// First, try to pull any remote changes to avoid conflicts
-		pullCmd := exec.Command("git", "pull", "--rebase", "origin", branch)
-		pullCmd.Dir = repoPath
-		m.setupCredentials(m.config.MainRepo, pullCmd)
-		if pullOutput, err := pullCmd.CombinedOutput(); err != nil {
-			fmt.Printf("Warning: Failed to pull before push: %v, output: %s\n", err, string(pullOutput))
-			// Continue with push attempt even if pull fails
-		} else {
-			fmt.Printf("Successfully pulled latest changes before push\n")
-		}
-
-		// Now push the changes
-		pushCmd := exec.Command("git", "push", "origin", branch)
-		pushCmd.Dir = repoPath
-		m.setupCredentials(m.config.MainRepo, pushCmd)
+	if repo.GetAuth().Type == "none" {
+		logger.Info("no authentication configured, skipping push to remote repository")
+		return commit, nil, nil
+	}
 
-		pushOutput, err := pushCmd.CombinedOutput()
+	push := &PushResult{Branch: branch}
+	if delivery.IsPullRequest() {
+		logger.Info("delivering changes as a pull request")
+		commit, err = m.pushToPullRequest(ctx, repo, branch, repoPath, push)
 		if err != nil {
-			fmt.Printf("First push attempt failed: %v, output: %s\n", err, string(pushOutput))
-
-			// Try force push if regular push fails (be careful with this)
-			fmt.Printf("Attempting force push (this may overwrite remote changes)\n")
-			forcePushCmd := exec.Command("git", "push", "--force-with-lease", "origin", branch)
-			forcePushCmd.Dir = repoPath
-			m.setupCredentials(m.config.MainRepo, forcePushCmd)
-
-			if forceOutput, forceErr := forcePushCmd.CombinedOutput(); forceErr != nil {
-				return fmt.Errorf("git push failed even with force: %w, output: %s", forceErr, string(forceOutput))
-			} else {
-				fmt.Printf("Successfully force-pushed submodule changes to remote repository on branch %s\n", branch)
-			}
-		} else {
-			fmt.Printf("Successfully pushed submodule changes to remote repository on branch %s\n", branch)
+			push.Error = err.Error()
+			return commit, push, err
 		}
+		push.Success = true
+		return commit, push, nil
+	}
+
+	logger.Info("pushing changes to remote repository")
+	commit, err = m.pushSubmoduleCommit(ctx, repo, branch, repoPath, push)
+	if err != nil {
+		push.Error = err.Error()
+		return commit, push, err
+	}
+	push.Success = true
+	return commit, push, nil
+}
+
+// submoduleDetail describes the commit of a submodule in an auto-commit message
+func submoduleDetail(path, hash, version string) string {
+	if version != "" {
+		return fmt.Sprintf("%s: %s (%s)", path, hash, version)
+	}
+	return fmt.Sprintf("%s: %s", path, hash)
+}
+
+// submoduleCommitMessage formats the message of an auto-commit with a timestamp and the
+// submodule details
+func submoduleCommitMessage(commitConfig config.CommitConfig, repo *config.Repository, branch string, details []string) string {
+	message := commitConfig.Message
+	if message == "" {
+		message = "Update submodules [Git Watcher Auto-Commit]"
+	}
+	return fmt.Sprintf("%s\n\nRepository: %s\nBranch: %s\nTimestamp: %s\n\nUpdated submodules:\n%s",
+		message,
+		repo.GetName(),
+		branch,
+		time.Now().Format(time.RFC3339),
+		strings.Join(details, "\n"))
+}
+
+// pushSubmoduleCommit rebases an auto-commit onto the remote branch and pushes it, falling back to a
+// force push with lease. Returns the pushed commit, which changes when the rebase picked up remote commits.
+func (m *Manager) pushSubmoduleCommit(ctx context.Context, repo *config.Repository, branch, repoPath string, push *PushResult) (string, error) {
+	logger := logging.FromContext(ctx)
+
+	// First, try to pull any remote changes to avoid conflicts
+	err := m.pull(ctx, repoPath, PullOptions{Remote: "origin", Branch: branch, Rebase: true, Credentials: credentialsFor(repo)})
+	commit, _ := m.backend.RevParse(ctx, repoPath, "HEAD")
+	if ctx.Err() != nil {
+		return commit, fmt.Errorf("push of branch %s aborted: %w", branch, ctx.Err())
+	}
+	if err != nil {
+		logger.Warn("failed to pull before push", "error", err)
+		// Continue with push attempt even if pull fails
+	} else {
+		logger.Info("pulled latest changes before push")
+	}
 
-		// Verify the push was successful by checking remote status
-		verifyCmd := exec.Command("git", "status", "-v")
-		verifyCmd.Dir = repoPath
-		if verifyOutput, err := verifyCmd.CombinedOutput(); err == nil {
-			fmt.Printf("Post-push repository status:\n%s\n", string(verifyOutput))
+	// Now push the changes
+	err = m.push(ctx, repoPath, PushOptions{Remote: "origin", RefSpec: branch, Credentials: credentialsFor(repo)})
+	if ctx.Err() != nil {
+		return commit, fmt.Errorf("push of branch %s aborted: %w", branch, ctx.Err())
+	}
+	if err != nil {
+		logger.Warn("push failed", "error", err)
+
+		// Try force push if regular push fails (be careful with this)
+		logger.Warn("attempting force push, this may overwrite remote changes")
+		push.Forced = true
+		forceErr := m.push(ctx, repoPath, PushOptions{Remote: "origin", RefSpec: branch, ForceWithLease: true, Credentials: credentialsFor(repo)})
+		if forceErr != nil {
+			return commit, fmt.Errorf("git push failed even with force: %w", forceErr)
 		}
+		logger.Info("force-pushed submodule changes to remote repository", "commit", commit)
 	} else {
-		fmt.Printf("No authentication configured - skipping push to remote repository\n")
+		logger.Info("pushed submodule changes to remote repository", "commit", commit)
 	}
 
-	return nil
+	return commit, nil
 }
 
-// listSubmodules returns a list of submodule names from .gitmodules
-func (m *Manager) listSubmodules() ([]string, error) {
-	repoPath := filepath.Join(m.config.WorkingDir, m.config.MainRepo.GetDirectory())
+// listSubmodules returns a list of submodule names from .gitmodules of a working tree
+func (m *Manager) listSubmodules(repoPath string) ([]string, error) {
 	gitmodulesPath := filepath.Join(repoPath, ".gitmodules")
 
 	data, err := os.ReadFile(gitmodulesPath)
@@ -451,220 +649,25 @@ func (m *Manager) listSubmodules() ([]string, error) {
 	return submodules, nil
 }
 
-// checkAndUpdateRepo checks if a repository has new commits and updates it if necessary
-// Returns true if the repository was updated
-func (m *Manager) checkAndUpdateRepo(repo config.RepositoryInterface) (bool, error) {
-	repoPath := filepath.Join(m.config.WorkingDir, repo.GetDirectory())
-
-	// Check if the repository exists
-	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
-		// Clone the repository if it doesn't exist
-		if err := m.cloneRepo(repo); err != nil {
-			return false, err
-		}
-		return true, nil
-	}
-
-	// Check for new commits
-	hasNewCommits, err := m.hasNewCommits(repo)
-	if err != nil {
-		return false, err
-	}
-
-	// If there are new commits, pull the changes
-	if hasNewCommits {
-		if err := m.pullRepo(repo); err != nil {
-			return false, err
-		}
-		return true, nil
-	}
-
-	return false, nil
-}
-
-// setupCredentials configures Git credentials based on authentication settings
-func (m *Manager) setupCredentials(repo config.RepositoryInterface, cmd *exec.Cmd) {
-	switch repo.GetAuth().Type {
-	case "basic":
-		if repo.GetAuth().Username != "" && repo.GetAuth().Password != "" {
-			// 设置 Git 凭证
-			cmd.Env = append(os.Environ(),
-				"GIT_ASKPASS=echo",
-				fmt.Sprintf("GIT_USERNAME=%s", repo.GetAuth().Username),
-				fmt.Sprintf("GIT_PASSWORD=%s", repo.GetAuth().Password),
-			)
-
-			// 配置 Git 使用凭证
-			configCmd := exec.Command("git", "config", "--global", "credential.helper", "store")
-			configCmd.Env = cmd.Env
-			configCmd.Run() // 忽略错误，因为可能已经配置过
-
-			// 写入凭证到临时文件
-			credentialContent := fmt.Sprintf("https://%s:%s@%s\n",
-				repo.GetAuth().Username,
-				repo.GetAuth().Password,
-				strings.TrimPrefix(repo.GetURL(), "https://"))
-
-			homeDir, err := os.UserHomeDir()
-			if err == nil {
-				gitConfigDir := filepath.Join(homeDir, ".git")
-				if err := os.MkdirAll(gitConfigDir, 0755); err == nil {
-					credentialFile := filepath.Join(gitConfigDir, "credentials")
-					os.WriteFile(credentialFile, []byte(credentialContent), 0600)
-					fmt.Printf("Git authentication configured successfully for user: %s\n", repo.GetAuth().Username)
-				}
-			}
-		}
-	case "ssh":
-		if repo.GetAuth().SSHKeyPath != "" {
-			// For SSH authentication with a key file
-			cmd.Env = append(os.Environ(),
-				fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o StrictHostKeyChecking=no", repo.GetAuth().SSHKeyPath),
-			)
-		} else if repo.GetAuth().SSHPrivateKey != "" {
-			// If SSH key is provided as a string, write it to a temporary file
-			tmpDir, err := os.MkdirTemp("", "git-ssh-key")
-			if err == nil {
-				keyPath := filepath.Join(tmpDir, "id_rsa")
-				if err := os.WriteFile(keyPath, []byte(repo.GetAuth().SSHPrivateKey), 0600); err == nil {
-					cmd.Env = append(os.Environ(),
-						fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o StrictHostKeyChecking=no", keyPath),
-					)
-					// Clean up the temporary file when the command finishes
-					defer os.RemoveAll(tmpDir)
-				}
-			}
-		}
-	}
-}
-
 // cloneRepo clones a Git repository
-func (m *Manager) cloneRepo(repo config.RepositoryInterface) error {
-	repoPath := filepath.Join(m.config.WorkingDir, repo.GetDirectory())
-
-	// 确保认证信息已配置
-	if repo.GetAuth().Type == "basic" && repo.GetAuth().Username != "" && repo.GetAuth().Password != "" {
-		// 配置 Git 使用凭证
-		configCmd := exec.Command("git", "config", "--global", "credential.helper", "store")
-		configCmd.Run() // 忽略错误，因为可能已经配置过
-
-		// 写入凭证到临时文件
-		credentialContent := fmt.Sprintf("https://%s:%s@%s\n",
-			repo.GetAuth().Username,
-			repo.GetAuth().Password,
-			strings.TrimPrefix(repo.GetURL(), "https://"))
-
-		homeDir, err := os.UserHomeDir()
-		if err == nil {
-			gitConfigDir := filepath.Join(homeDir, ".git")
-			if err := os.MkdirAll(gitConfigDir, 0755); err == nil {
-				credentialFile := filepath.Join(gitConfigDir, "credentials")
-				os.WriteFile(credentialFile, []byte(credentialContent), 0600)
-				fmt.Printf("Git authentication configured successfully for user: %s\n", repo.GetAuth().Username)
-			}
-		}
-	}
-
-	args := []string{"clone", "--branch", repo.GetBranch()}
-
-	// Handle authentication for SSH URLs
-	if strings.HasPrefix(repo.GetURL(), "git@") && repo.GetAuth().Type == "ssh" {
-		// SSH URL, will use SSH key based authentication
-		args = append(args, repo.GetURL(), repoPath)
-		cmd := exec.Command("git", args...)
-		m.setupCredentials(repo, cmd)
-
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("git clone failed: %w, output: %s", err, string(output))
-		}
-	} else {
-		// HTTP(S) URL
-		if repo.GetAuth().Type == "basic" && repo.GetAuth().Username != "" && repo.GetAuth().Password != "" {
-			// Rewrite URL to include basic auth
-			urlParts := strings.SplitN(repo.GetURL(), "://", 2)
-			if len(urlParts) == 2 {
-				repoURL := fmt.Sprintf("%s://%s:%s@%s",
-					urlParts[0],
-					repo.GetAuth().Username,
-					repo.GetAuth().Password,
-					urlParts[1],
-				)
-				args = append(args, repoURL, repoPath)
-			}
-		} else {
-			args = append(args, repo.GetURL(), repoPath)
-		}
-		cmd := exec.Command("git", args...)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("git clone failed: %w, output: %s", err, string(output))
-		}
-	}
-
-	fmt.Printf("Cloned repository %s branch %s to %s\n", repo.GetURL(), repo.GetBranch(), repoPath)
-
-	// If this is the main repository and we're using submodules, initialize them
-	if m.config.UseSubmodules && repo.GetDirectory() == m.config.MainRepo.GetDirectory() {
-		if err := m.updateSubmodules(); err != nil {
-			fmt.Printf("Warning: Failed to initialize submodules: %v\n", err)
-		}
-	}
-
-	return nil
-}
-
-// hasNewCommits checks if a repository has new commits
-func (m *Manager) hasNewCommits(repo config.RepositoryInterface) (bool, error) {
+func (m *Manager) cloneRepo(ctx context.Context, repo config.RepositoryInterface) error {
 	repoPath := filepath.Join(m.config.WorkingDir, repo.GetDirectory())
 
-	// Fetch updates from the remote repository
-	fetchCmd := exec.Command("git", "fetch", "origin", repo.GetBranch())
-	fetchCmd.Dir = repoPath
-	m.setupCredentials(repo, fetchCmd)
-
-	if output, err := fetchCmd.CombinedOutput(); err != nil {
-		return false, fmt.Errorf("git fetch failed: %w, output: %s", err, string(output))
-	}
-
-	// Check if the local branch is behind the remote branch
-	diffCmd := exec.Command("git", "rev-list", "HEAD..origin/"+repo.GetBranch(), "--count")
-	diffCmd.Dir = repoPath
-	output, err := diffCmd.Output()
+	cloneCtx, cancel := context.WithTimeout(ctx, m.config.Timeouts.CloneTimeout())
+	defer cancel()
+	err := m.backend.Clone(cloneCtx, repo.GetURL(), repoPath, CloneOptions{Branch: repo.GetBranch(), Credentials: credentialsFor(repo)})
 	if err != nil {
-		return false, fmt.Errorf("failed to check for new commits: %w", err)
+		// An interrupted clone leaves a partial directory that would be mistaken for a clone
+		os.RemoveAll(repoPath)
+		return fmt.Errorf("git clone failed: %w", err)
 	}
 
-	count := strings.TrimSpace(string(output))
-	return count != "0", nil
-}
-
-// pullRepo pulls the latest changes from a repository
-func (m *Manager) pullRepo(repo config.RepositoryInterface) error {
-	repoPath := filepath.Join(m.config.WorkingDir, repo.GetDirectory())
-
-	// Make sure we're on the right branch
-	checkoutCmd := exec.Command("git", "checkout", repo.GetBranch())
-	checkoutCmd.Dir = repoPath
-	if output, err := checkoutCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("git checkout failed: %w, output: %s", err, string(output))
-	}
-
-	// Pull the changes with --rebase option
-	pullCmd := exec.Command("git", "pull", "--rebase", "origin", repo.GetBranch())
-	pullCmd.Dir = repoPath
-	m.setupCredentials(repo, pullCmd)
-
-	if output, err := pullCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("git pull failed: %w, output: %s", err, string(output))
-	}
-
-	fmt.Printf("Updated repository %s branch %s at %s\n", repo.GetURL(), repo.GetBranch(), repoPath)
+	logging.FromContext(ctx).Info("cloned repository", "url", redactURL(repo.GetURL()), "ref", repo.GetBranch(), "path", repoPath)
 	return nil
 }
 
 // GetLastCommitHash returns the last commit hash of a repository
-func (m *Manager) GetLastCommitHash(repo config.RepositoryInterface) (string, error) {
+func (m *Manager) GetLastCommitHash(ctx context.Context, repo config.RepositoryInterface) (string, error) {
 	repoPath := filepath.Join(m.config.WorkingDir, repo.GetDirectory())
 
 	// Check if the repository exists
@@ -672,14 +675,12 @@ func (m *Manager) GetLastCommitHash(repo config.RepositoryInterface) (string, er
 		return "", errors.New("repository does not exist")
 	}
 
-	cmd := exec.Command("git", "rev-parse", "HEAD")
-	cmd.Dir = repoPath
-	output, err := cmd.Output()
+	hash, err := m.backend.RevParse(ctx, repoPath, "HEAD")
 	if err != nil {
 		return "", fmt.Errorf("failed to get last commit hash: %w", err)
 	}
 
-	return strings.TrimSpace(string(output)), nil
+	return hash, nil
 }
 
 // GetConfig returns the Git configuration
@@ -688,279 +689,479 @@ func (m *Manager) GetConfig() *config.GitConfig {
 }
 
 // mergeCommitConfig 合并主仓库和制品仓库的提交配置，制品仓库的配置优先级更高
-func (m *Manager) mergeCommitConfig(mainConfig, artifactsConfig config.CommitConfig) config.CommitConfig {
+func (m *Manager) mergeCommitConfig(ctx context.Context, mainConfig, artifactsConfig config.CommitConfig) config.CommitConfig {
 	// 如果配置了使用主仓库提交信息，则完全使用主仓库的配置
 	if m.config.ArtifactsRepo.UseMainCommit {
-		fmt.Printf("Using main repository commit config for artifacts repository\n")
+		logging.FromContext(ctx).Debug("using main repository commit config for artifacts repository")
 		return mainConfig
 	}
 
 	// 如果未配置使用主仓库提交信息，则使用制品仓库的配置
-	fmt.Printf("Using artifacts repository commit config\n")
+	logging.FromContext(ctx).Debug("using artifacts repository commit config")
 	return artifactsConfig
 }
 
-// UpdateArtifactsRepo 更新制品仓库
-func (m *Manager) UpdateArtifactsRepo(repoName, pkgName, version string) error {
-	// 获取 Git 操作锁
+// artifactsRepo 返回制品仓库配置的副本，配置了使用主仓库认证时副本带有主仓库的认证信息。
+// 共享的配置不会被修改，并发的请求可以安全地读取
+func (m *Manager) artifactsRepo() *config.ArtifactsRepo {
+	repo := *m.config.ArtifactsRepo
+	if repo.UseMainAuth {
+		if mainRepo := m.config.PrimaryRepository(); mainRepo != nil {
+			repo.Auth = mainRepo.GetAuth()
+		}
+	}
+	return &repo
+}
+
+// UpdateArtifactsRepo 将制品的版本写入制品仓库，返回的结果在失败时也描述已完成的操作
+func (m *Manager) UpdateArtifactsRepo(ctx context.Context, artifact Artifact, opts ArtifactsOptions) (result *ArtifactsResult, err error) {
+	repoName, pkgName, version := artifact.ArtifactRepoName, artifact.ArtifactPkgName, artifact.ArtifactVersionName
+	result = &ArtifactsResult{Repository: repoName, Package: pkgName, Version: version}
+	defer func() {
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+			metrics.AddArtifactsUpdate(repoName, pkgName, metrics.ArtifactsFailed)
+		case result.Plan != nil:
+			// 试运行不计入更新次数
+		case result.Commit != "":
+			metrics.AddArtifactsUpdate(repoName, pkgName, metrics.ArtifactsUpdated)
+		default:
+			metrics.AddArtifactsUpdate(repoName, pkgName, metrics.ArtifactsUnchanged)
+		}
+	}()
+
+	// 获取 Git 操作锁，等待期间记录为待处理操作
+	op := m.queueArtifacts(repoName, pkgName, version)
+	defer m.doneArtifacts(op)
 	m.gitOpLock.Lock()
 	defer m.gitOpLock.Unlock()
+	m.startArtifacts(op)
 
 	// 检查制品仓库是否配置
 	if m.config.ArtifactsRepo == nil {
-		return fmt.Errorf("artifacts repository is not configured")
+		return result, fmt.Errorf("artifacts repository is not configured")
+	}
+
+	// 选择写入的环境，配置了环境时默认为第一个环境
+	env, err := m.config.ArtifactsRepo.EnvironmentFor(opts.Environment)
+	if err != nil {
+		return result, err
+	}
+	if env != nil {
+		result.Environment = env.Name
+	}
+	result.PromotedFrom = opts.PromoteFrom
+
+	// 按 manifests 规则选择写入版本的文件、键和 feature 分支
+	patch, featureBranch, err := m.newArtifactsPatch(artifact, env, opts)
+	if err != nil {
+		return result, err
 	}
+	result.File = patch.File
+	result.FeatureBranch = featureBranch
 
-	// 如果配置了使用主仓库认证，则复制主仓库的认证信息
+	// 如果配置了使用主仓库认证，则使用主仓库的认证信息
 	if m.config.ArtifactsRepo.UseMainAuth {
-		m.config.ArtifactsRepo.Auth = m.config.MainRepo.GetAuth()
-		fmt.Printf("Using main repository authentication for artifacts repository\n")
+		if mainRepo := m.config.PrimaryRepository(); mainRepo != nil {
+			logging.FromContext(ctx).Debug("using main repository authentication for artifacts repository", "source", mainRepo.GetName())
+		}
 	}
 
 	// 检查仓库是否存在
 	repoPath := filepath.Join(m.config.WorkingDir, m.config.ArtifactsRepo.Directory)
 	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
 		// 如果仓库不存在，则克隆
-		if err := m.cloneRepo(m.config.ArtifactsRepo); err != nil {
-			return fmt.Errorf("failed to clone artifacts repository: %w", err)
+		if err := m.cloneRepo(ctx, m.artifactsRepo()); err != nil {
+			return result, fmt.Errorf("failed to clone artifacts repository: %w", err)
 		}
 	}
 
 	// 合并提交配置
-	commitConfig := m.mergeCommitConfig(m.config.CommitConfig, m.config.ArtifactsRepo.CommitConfig)
+	commitConfig := m.mergeCommitConfig(ctx, m.config.CommitConfig, m.config.ArtifactsRepo.CommitConfig)
+	author := Signature{Name: commitConfig.UserName, Email: commitConfig.UserEmail}
+	creds := credentialsFor(m.artifactsRepo())
+
+	// 合并的目标分支
+	targetBranch := m.config.ArtifactsRepo.TargetBranch(env)
 
-	// 设置 Git 用户信息
-	if commitConfig.UserName != "" {
-		configNameCmd := exec.Command("git", "config", "user.name", commitConfig.UserName)
-		configNameCmd.Dir = repoPath
-		if output, err := configNameCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to set git user.name: %w, output: %s", err, string(output))
+	// 晋级时确认来源环境已经记录了该版本
+	if opts.PromoteFrom != "" {
+		if err := m.checkPromotionSource(ctx, repoPath, artifact, opts); err != nil {
+			return result, err
 		}
 	}
-	if commitConfig.UserEmail != "" {
-		configEmailCmd := exec.Command("git", "config", "user.email", commitConfig.UserEmail)
-		configEmailCmd.Dir = repoPath
-		if output, err := configEmailCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to set git user.email: %w, output: %s", err, string(output))
+
+	// 回滚时从目标分支上该键的历史中选择恢复的版本
+	if opts.Rollback {
+		var current string
+		patch, current, err = m.rollbackPatch(ctx, repoPath, patch, targetBranch, opts.RollbackTo)
+		if err != nil {
+			return result, err
 		}
+		version = patch.Value
+		result.Version = version
+		result.RolledBackFrom = current
 	}
 
-	// 创建或切换到 feature 分支
-	featureBranch := fmt.Sprintf("feature-%s", repoName)
+	// 以 PR 方式交付时创建托管平台的客户端
+	var forgeClient *forge.Client
+	if delivery := m.config.ArtifactsDelivery(); delivery.IsPullRequest() {
+		forgeClient, err = forge.New(delivery, m.config.ArtifactsRepo.URL)
+		if err != nil {
+			return result, err
+		}
+	}
 
 	// 检查远程分支是否存在
-	lsRemoteCmd := exec.Command("git", "ls-remote", "--heads", "origin", featureBranch)
-	lsRemoteCmd.Dir = repoPath
-	m.setupCredentials(m.config.ArtifactsRepo, lsRemoteCmd)
-	lsRemoteOutput, err := lsRemoteCmd.CombinedOutput()
+	lsRemoteCtx, cancel := context.WithTimeout(ctx, m.config.Timeouts.FetchTimeout())
+	remoteRefs, err := m.backend.LsRemote(lsRemoteCtx, repoPath, LsRemoteOptions{
+		Remote:      "origin",
+		Patterns:    []string{"refs/heads/" + featureBranch},
+		Credentials: creds,
+	})
+	cancel()
 	if err != nil {
-		return fmt.Errorf("failed to check remote branch: %w, output: %s", err, string(lsRemoteOutput))
+		return result, fmt.Errorf("failed to check remote branch: %w", err)
+	}
+
+	// 试运行只计算执行计划，不切换分支、提交、推送或合并
+	if m.IsDryRun(ctx) {
+		result.TargetBranch = targetBranch
+		result.Plan, err = m.planArtifacts(ctx, repoPath, result, patch, len(remoteRefs) > 0, forgeClient, commitConfig)
+		return result, err
 	}
 
 	// 如果远程分支存在，则拉取
-	if len(strings.TrimSpace(string(lsRemoteOutput))) > 0 {
+	if len(remoteRefs) > 0 {
 		// 切换到 feature 分支
-		checkoutCmd := exec.Command("git", "checkout", featureBranch)
-		checkoutCmd.Dir = repoPath
-		if _, err := checkoutCmd.CombinedOutput(); err != nil {
+		if err := m.backend.Checkout(ctx, repoPath, CheckoutOptions{Branch: featureBranch}); err != nil {
 			// 如果本地分支不存在，则创建并拉取
-			checkoutCmd = exec.Command("git", "checkout", "-b", featureBranch, "origin/"+featureBranch)
-			checkoutCmd.Dir = repoPath
-			if output, err := checkoutCmd.CombinedOutput(); err != nil {
-				return fmt.Errorf("failed to checkout feature branch: %w, output: %s", err, string(output))
+			err = m.backend.Checkout(ctx, repoPath, CheckoutOptions{Branch: featureBranch, Create: true, StartPoint: "origin/" + featureBranch})
+			if err != nil {
+				return result, fmt.Errorf("failed to checkout feature branch: %w", err)
 			}
 		}
 	} else {
-		// 如果远程分支不存在，则创建新分支
-		checkoutCmd := exec.Command("git", "checkout", "-b", featureBranch)
-		checkoutCmd.Dir = repoPath
-		if output, err := checkoutCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to create feature branch: %w, output: %s", err, string(output))
+		// 如果远程分支不存在，则创建新分支；之前失败的更新（如被拒绝的降级）可能留下了本地分支，此时直接切换。
+		// 各环境的目标分支可能不同，写入环境时新分支从目标分支的最新提交开始
+		checkout := CheckoutOptions{Branch: featureBranch, Create: true}
+		if env != nil {
+			refSpec := fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", targetBranch, targetBranch)
+			if err := m.fetch(ctx, repoPath, FetchOptions{Remote: "origin", RefSpecs: []string{refSpec}, Credentials: creds}); err != nil {
+				return result, fmt.Errorf("git fetch of branch %s failed: %w", targetBranch, err)
+			}
+			checkout.StartPoint = "origin/" + targetBranch
 		}
-	}
-
-	// 创建或更新 {repoName}.jsonnet 文件
-	jsonnetPath := filepath.Join(repoPath, fmt.Sprintf("%s.jsonnet", repoName))
-
-	// 获取文件锁
-	fileLock := m.getFileLock(jsonnetPath)
-	fileLock.Lock()
-	defer fileLock.Unlock()
-
-	// 从 version 中提取包名（去掉最后一段版本号）
-	parts := strings.Split(version, "-")
-	versionPrefix := strings.Join(parts[:len(parts)-1], "-")
-
-	// 读取现有内容（如果文件存在）
-	var existingContent map[string]interface{}
-	if data, err := os.ReadFile(jsonnetPath); err == nil {
-		if err := json.Unmarshal(data, &existingContent); err != nil {
-			return fmt.Errorf("failed to parse existing jsonnet file: %w", err)
+		err := m.backend.Checkout(ctx, repoPath, checkout)
+		if err != nil {
+			err = m.backend.Checkout(ctx, repoPath, CheckoutOptions{Branch: featureBranch})
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to create feature branch: %w", err)
 		}
-	} else {
-		existingContent = make(map[string]interface{})
 	}
 
-	// 更新或创建内容
-	repoContent, ok := existingContent[repoName].(map[string]interface{})
-	if !ok {
-		repoContent = make(map[string]interface{})
-		existingContent[repoName] = repoContent
+	// 以 PR 方式交付时，没有打开的 PR 则从目标分支重新开始 feature 分支
+	if forgeClient != nil {
+		if err := m.prepareArtifactsPullRequest(ctx, forgeClient, repoPath, featureBranch, targetBranch); err != nil {
+			return result, err
+		}
 	}
 
-	pkgContent, ok := repoContent[pkgName].(map[string]interface{})
-	if !ok {
-		pkgContent = make(map[string]interface{})
-		repoContent[pkgName] = pkgContent
-	}
+	// 创建或更新版本文件
+	filePath := filepath.Join(repoPath, patch.File)
 
-	// 检查版本是否已存在且相同
-	if existingVersion, exists := pkgContent[versionPrefix]; exists && existingVersion == version {
-		fmt.Printf("Version %s already exists and is up to date\n", version)
-		return nil
-	}
-
-	pkgContent[versionPrefix] = version
+	// 获取文件锁
+	fileLock := m.getFileLock(filePath)
+	fileLock.Lock()
+	defer fileLock.Unlock()
 
-	// 将更新后的内容写入文件
-	jsonnetContent, err := json.MarshalIndent(existingContent, "", "  ")
+	// 读取现有内容（如果文件存在）并更新版本
+	existing, _ := os.ReadFile(filePath)
+	content, changed, err := patch.apply(existing)
 	if err != nil {
-		return fmt.Errorf("failed to marshal jsonnet content: %w", err)
+		return result, err
+	}
+	if !changed {
+		logging.FromContext(ctx).Info("version already exists and is up to date", "version", version)
+		return result, nil
 	}
 
-	if err := os.WriteFile(jsonnetPath, jsonnetContent, 0644); err != nil {
-		return fmt.Errorf("failed to write jsonnet file: %w", err)
+	// 将更新后的内容写入文件并校验
+	if err := m.writeArtifactsFile(ctx, filePath, existing, content, patch); err != nil {
+		return result, err
 	}
 
 	// 添加文件到暂存区
-	addCmd := exec.Command("git", "add", fmt.Sprintf("%s.jsonnet", repoName))
-	addCmd.Dir = repoPath
-	if output, err := addCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("git add failed: %w, output: %s", err, string(output))
+	if err := m.backend.Add(ctx, repoPath, patch.File); err != nil {
+		return result, fmt.Errorf("git add failed: %w", err)
 	}
 
 	// 检查是否有更改需要提交
-	statusCmd := exec.Command("git", "status", "--porcelain")
-	statusCmd.Dir = repoPath
-	statusOutput, err := statusCmd.Output()
+	statusOutput, err := m.backend.Status(ctx, repoPath)
 	if err != nil {
-		return fmt.Errorf("failed to check git status: %w", err)
+		return result, fmt.Errorf("failed to check git status: %w", err)
 	}
 
 	// 只有在有更改时才提交
-	if len(strings.TrimSpace(string(statusOutput))) > 0 {
+	if len(strings.TrimSpace(statusOutput)) > 0 {
 		// 提交更改
-		commitMessage := commitConfig.Message
-		if commitMessage == "" {
-			commitMessage = "Update artifacts"
-		}
-		timestamp := time.Now().Format(time.RFC3339)
-		commitMessage = fmt.Sprintf("%s\n\nTime: %s\nArtifactRepoName: %s\nPackage: %s\nVersion: %s",
-			commitMessage,
-			timestamp,
-			repoName,
-			pkgName,
-			version,
-		)
-
-		// 在提交前重新设置用户信息
-		if commitConfig.UserName != "" {
-			configNameCmd := exec.Command("git", "config", "user.name", commitConfig.UserName)
-			configNameCmd.Dir = repoPath
-			if output, err := configNameCmd.CombinedOutput(); err != nil {
-				return fmt.Errorf("failed to set git user.name: %w, output: %s", err, string(output))
-			}
-		}
-		if commitConfig.UserEmail != "" {
-			configEmailCmd := exec.Command("git", "config", "user.email", commitConfig.UserEmail)
-			configEmailCmd.Dir = repoPath
-			if output, err := configEmailCmd.CombinedOutput(); err != nil {
-				return fmt.Errorf("failed to set git user.email: %w, output: %s", err, string(output))
-			}
+		commitMessage := artifactsCommitMessage(commitConfig, result)
+		if err := m.backend.Commit(ctx, repoPath, commitMessage, author); err != nil {
+			return result, fmt.Errorf("git commit failed: %w", err)
 		}
+		result.Commit, _ = m.backend.RevParse(ctx, repoPath, "HEAD")
 
-		commitCmd := exec.Command("git", "commit", "-m", commitMessage)
-		commitCmd.Dir = repoPath
-		if output, err := commitCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("git commit failed: %w, output: %s", err, string(output))
+		// 强制推送到远程仓库
+		if err := m.push(ctx, repoPath, PushOptions{Remote: "origin", RefSpec: featureBranch, Force: true, Credentials: creds}); err != nil {
+			return result, fmt.Errorf("git push failed: %w", err)
 		}
 
-		// 强制推送到远程仓库
-		pushCmd := exec.Command("git", "push", "-f", "origin", featureBranch)
-		pushCmd.Dir = repoPath
-		m.setupCredentials(m.config.ArtifactsRepo, pushCmd)
-		if output, err := pushCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("git push failed: %w, output: %s", err, string(output))
+		result.TargetBranch = targetBranch
+
+		// 以 PR 方式交付时创建或更新 PR，由托管平台合并
+		if forgeClient != nil {
+			result.Push = &PushResult{Branch: featureBranch, Forced: true}
+			pr, err := forgeClient.Ensure(ctx, artifactsPullRequest(repoName, pkgName, version, patch.File, featureBranch, targetBranch))
+			result.Push.PullRequest = pr
+			if err != nil {
+				result.Push.Error = err.Error()
+				return result, err
+			}
+			result.Push.Success = true
+			logging.FromContext(ctx).Info("delivered feature branch as a pull request", "feature_branch", featureBranch, "target_branch", targetBranch)
+			return result, nil
 		}
 
 		// 合并到指定分支
-		targetBranch := m.config.ArtifactsRepo.AutoBranchName
-		if targetBranch == "" {
-			targetBranch = m.config.ArtifactsRepo.Branch // 如果未配置 autoBranchName，则使用默认分支
-		}
 
 		// 切换到目标分支
-		checkoutTargetCmd := exec.Command("git", "checkout", targetBranch)
-		checkoutTargetCmd.Dir = repoPath
-		if output, err := checkoutTargetCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to checkout target branch %s: %w, output: %s", targetBranch, err, string(output))
+		if err := m.backend.Checkout(ctx, repoPath, CheckoutOptions{Branch: targetBranch}); err != nil {
+			return result, fmt.Errorf("failed to checkout target branch %s: %w", targetBranch, err)
 		}
 
 		// 清理未合并的文件
-		cleanupCmd := exec.Command("git", "reset", "--hard", "HEAD")
-		cleanupCmd.Dir = repoPath
-		if output, err := cleanupCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to cleanup unmerged files: %w, output: %s", err, string(output))
+		if err := m.backend.Reset(ctx, repoPath, "HEAD"); err != nil {
+			return result, fmt.Errorf("failed to cleanup unmerged files: %w", err)
 		}
 
 		// 拉取目标分支最新代码
-		pullTargetCmd := exec.Command("git", "pull", "--rebase", "origin", targetBranch)
-		pullTargetCmd.Dir = repoPath
-		m.setupCredentials(m.config.ArtifactsRepo, pullTargetCmd)
-		if output, err := pullTargetCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to pull target branch %s: %w, output: %s", targetBranch, err, string(output))
-		}
-
-		// 在合并前重新设置用户信息
-		if commitConfig.UserName != "" {
-			configNameCmd := exec.Command("git", "config", "user.name", commitConfig.UserName)
-			configNameCmd.Dir = repoPath
-			if output, err := configNameCmd.CombinedOutput(); err != nil {
-				return fmt.Errorf("failed to set git user.name: %w, output: %s", err, string(output))
-			}
+		if err := m.pull(ctx, repoPath, PullOptions{Remote: "origin", Branch: targetBranch, Rebase: true, Credentials: creds}); err != nil {
+			return result, fmt.Errorf("failed to pull target branch %s: %w", targetBranch, err)
 		}
-		if commitConfig.UserEmail != "" {
-			configEmailCmd := exec.Command("git", "config", "user.email", commitConfig.UserEmail)
-			configEmailCmd.Dir = repoPath
-			if output, err := configEmailCmd.CombinedOutput(); err != nil {
-				return fmt.Errorf("failed to set git user.email: %w, output: %s", err, string(output))
-			}
+
+		// 合并 feature 分支，发生冲突时按 conflictStrategy 处理
+		merged, err := m.mergeArtifacts(ctx, repoPath, result, patch, commitConfig)
+		if err != nil {
+			return result, err
+		}
+		if !merged {
+			return result, nil
 		}
 
-		// 合并 feature 分支
-		mergeCmd := exec.Command("git", "merge", "--no-ff", "--strategy-option=theirs", featureBranch)
-		mergeCmd.Dir = repoPath
-		if _, err := mergeCmd.CombinedOutput(); err != nil {
-			// 如果合并失败，尝试使用 --strategy-option=theirs 选项
-			mergeCmd = exec.Command("git", "merge", "--no-ff", "--strategy-option=theirs", featureBranch)
-			mergeCmd.Dir = repoPath
-			if output, err := mergeCmd.CombinedOutput(); err != nil {
-				return fmt.Errorf("failed to merge branch %s into %s: %w, output: %s", featureBranch, targetBranch, err, string(output))
-			}
+		// 推送合并后的更改到远程，目标分支在此期间有新的提交时在其最新内容上重新应用补丁后重试
+		if err := m.pushArtifactsTarget(ctx, repoPath, result, patch, commitConfig); err != nil {
+			return result, err
+		}
+
+		logging.FromContext(ctx).Info("merged feature branch and pushed to remote", "feature_branch", featureBranch, "target_branch", targetBranch)
+	} else {
+		logging.FromContext(ctx).Info("no changes detected in version file, skipping commit and merge", "file", patch.File)
+	}
+
+	return result, nil
+}
+
+// artifactsPatch 将制品仓库中某个文件的某个键路径的值设置为指定的值。
+// 制品更新以补丁的形式表达，可以在目标分支最新的内容上重新应用，不同包的并发更新互不覆盖。
+type artifactsPatch struct {
+	File    string          // 制品仓库中的文件路径
+	Format  string          // 文件格式，决定使用的 manifest.Writer
+	Path    []string        // 键路径，如 [仓库名, 包名, 版本前缀]
+	Value   string          // 制品版本
+	Scheme  *version.Scheme // 版本格式，用于比较已有的版本
+	Release version.Release // 按版本格式解析的 Value
+	Force   bool            // 已有的版本更新时仍然写入
+}
+
+// newArtifactsPatch 按 manifests 规则返回记录制品版本的补丁和 feature 分支名，
+// 规则的文件、键和分支模板使用制品的字段渲染，未设置时使用格式的默认值：
+// jsonnet、yaml 和 toml 设置 {repoName}.<格式> 中的 [repoName][pkgName][版本前缀]，
+// helm 设置 {repoName}/values.yaml 中的 [pkgName].image.tag，
+// kustomize 设置 {repoName}/kustomization.yaml 中名为 pkgName 的镜像的 newTag，
+// feature 分支默认为 feature-{repoName}，写入环境时为 feature-{repoName}-{环境名}，文件路径相对于环境的目录。
+// 版本前缀为按版本格式解析出的版本线，例如 build 格式的 "pkg-1.0-3" 和 semver 格式的 "pkg-1.0.7-rc.1" 都为 "pkg-1.0"
+func (m *Manager) newArtifactsPatch(artifact Artifact, env *config.Environment, opts ArtifactsOptions) (patch artifactsPatch, featureBranch string, err error) {
+	rule := m.config.ArtifactsRepo.ManifestFor(artifact.manifestTarget())
+	scheme, err := version.NewScheme(rule.Scheme, rule.Pattern)
+	if err != nil {
+		return patch, "", err
+	}
+	release, err := scheme.Parse(artifact.ArtifactVersionName)
+	if err != nil {
+		return patch, "", fmt.Errorf("invalid artifact version: %w", err)
+	}
+	data := manifestData{Artifact: artifact, VersionPrefix: release.Line}
+	if env != nil {
+		data.Environment = env.Name
+	}
+	repoName, pkgName := artifact.ArtifactRepoName, artifact.ArtifactPkgName
+
+	patch = artifactsPatch{
+		File:    repoName + "." + rule.Format,
+		Format:  rule.Format,
+		Path:    []string{repoName, pkgName, data.VersionPrefix},
+		Value:   artifact.ArtifactVersionName,
+		Scheme:  scheme,
+		Release: release,
+		Force:   opts.Force,
+	}
+	switch rule.Format {
+	case config.FormatHelm:
+		patch.File, patch.Path = path.Join(repoName, "values.yaml"), []string{pkgName, "image", "tag"}
+	case config.FormatKustomize:
+		patch.File, patch.Path = path.Join(repoName, "kustomization.yaml"), []string{pkgName}
+	}
+	featureBranch = "feature-" + repoName
+	if env != nil {
+		featureBranch += "-" + env.Name
+	}
+
+	if rule.File != "" {
+		if patch.File, err = renderManifestTemplate("file", rule.File, data); err != nil {
+			return patch, "", err
+		}
+	}
+	if rule.Key != "" {
+		key, err := renderManifestTemplate("key", rule.Key, data)
+		if err != nil {
+			return patch, "", err
+		}
+		patch.Path = manifest.SplitKey(rule.Format, key)
+		if slices.Contains(patch.Path, "") {
+			return patch, "", fmt.Errorf("key %q has an empty part", key)
 		}
+	}
+	if rule.Branch != "" {
+		if featureBranch, err = renderManifestTemplate("branch", rule.Branch, data); err != nil {
+			return patch, "", err
+		}
+		if featureBranch == "" || strings.ContainsAny(featureBranch, " ~^:?*[\\") {
+			return patch, "", fmt.Errorf("invalid feature branch name %q", featureBranch)
+		}
+	}
+	// 默认路径包含制品的仓库名，与模板渲染的路径一样在加上环境目录后校验，不能离开制品仓库或环境的目录
+	file := patch.File
+	if env != nil && env.Path != "" {
+		dir := path.Clean(env.Path)
+		patch.File = path.Join(dir, patch.File)
+		if dir != "." && !strings.HasPrefix(patch.File, dir+"/") {
+			return patch, "", fmt.Errorf("file %q is not a relative path inside the directory %s of environment %s", file, env.Path, env.Name)
+		}
+	}
+	if !filepath.IsLocal(patch.File) {
+		return patch, "", fmt.Errorf("file %q is not a relative path inside the artifacts repository", file)
+	}
+	return patch, featureBranch, nil
+}
+
+// String 返回补丁的可读形式，用于日志
+func (p artifactsPatch) String() string {
+	return fmt.Sprintf("%s: %q = %q", p.File, strings.Join(p.Path, "."), p.Value)
+}
 
-		// 推送合并后的更改到远程
-		pushMergeCmd := exec.Command("git", "push", "origin", targetBranch)
-		pushMergeCmd.Dir = repoPath
-		m.setupCredentials(m.config.ArtifactsRepo, pushMergeCmd)
-		if output, err := pushMergeCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to push merged changes to %s: %w, output: %s", targetBranch, err, string(output))
+// apply 将补丁应用到文件内容，只替换目标键的值，注释、格式和其他内容保持不变。
+// data 为空时创建新文件，路径上缺少的键会插入到最近的已有对象中。
+// 已有的值是同一个包更新的版本时返回 ErrArtifactsDowngrade，除非设置了 Force；已有的值无法按版本格式解析时直接替换。
+// 返回新的内容，值已存在且相同时 changed 为 false。
+func (p artifactsPatch) apply(data []byte) (content []byte, changed bool, err error) {
+	writer, err := manifest.New(p.Format)
+	if err != nil {
+		return nil, false, err
+	}
+	if !p.Force && p.Scheme != nil {
+		current, ok, err := writer.Get(data, p.Path)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read %s: %w", p.File, err)
+		}
+		if old, err := p.Scheme.Parse(current); ok && err == nil && old.Comparable(p.Release) && old.Compare(p.Release) > 0 {
+			return nil, false, fmt.Errorf("%w: %s in %s is %s, newer than %s", ErrArtifactsDowngrade, strings.Join(p.Path, "."), p.File, current, p.Value)
 		}
+	}
+	content, changed, err = writer.Set(data, p.Path, p.Value)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to update %s: %w", p.File, err)
+	}
+	return content, changed, nil
+}
 
-		fmt.Printf("Successfully merged branch %s into %s and pushed to remote\n", featureBranch, targetBranch)
+// writeArtifactsFile 写入更新后的版本文件。jsonnet 文件会被求值，确认文件有效且补丁设置的值出现在求值结果中，
+// 校验失败时恢复原来的内容。配置了 skipJsonnetEvaluation 或未安装求值命令时跳过求值，编辑时已经检查过语法。
+func (m *Manager) writeArtifactsFile(ctx context.Context, filePath string, existing, content []byte, patch artifactsPatch) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory of %s: %w", patch.File, err)
+	}
+	if err := os.WriteFile(filePath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", patch.File, err)
+	}
+	if patch.Format != config.FormatJsonnet || m.config.ArtifactsRepo.SkipJsonnetEvaluation {
+		return nil
+	}
+	err := m.validateArtifactsFile(ctx, filePath, patch)
+	if err == nil {
+		return nil
+	}
+	if existing == nil {
+		os.Remove(filePath)
 	} else {
-		fmt.Printf("No changes detected in %s.jsonnet, skipping commit and merge\n", repoName)
+		os.WriteFile(filePath, existing, 0644)
 	}
+	return err
+}
 
+// validateArtifactsFile 对 jsonnet 文件求值并检查补丁路径上的值，未安装求值命令时记录警告并跳过求值
+func (m *Manager) validateArtifactsFile(ctx context.Context, jsonnetPath string, patch artifactsPatch) error {
+	output, err := jsonnet.Evaluate(ctx, m.config.ArtifactsRepo.GetJsonnetCommand(), jsonnetPath)
+	if errors.Is(err, jsonnet.ErrNoEvaluator) {
+		logging.FromContext(ctx).Warn("skipping jsonnet evaluation, install the evaluator to validate the version files",
+			"file", patch.File, "error", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(output, &value); err != nil {
+		return fmt.Errorf("failed to parse output of jsonnet evaluation: %w", err)
+	}
+	for _, key := range patch.Path {
+		object, _ := value.(map[string]interface{})
+		value = object[key]
+	}
+	if value != patch.Value {
+		return fmt.Errorf("%s evaluates to %v instead of %q, the field may be overridden in the jsonnet file",
+			strings.Join(patch.Path, "."), value, patch.Value)
+	}
 	return nil
 }
+
+// artifactsCommitMessage 生成制品仓库的提交信息，回滚时记录被替换的版本
+func artifactsCommitMessage(commitConfig config.CommitConfig, result *ArtifactsResult) string {
+	message := commitConfig.Message
+	if message == "" {
+		message = "Update artifacts"
+	}
+	message = fmt.Sprintf("%s\n\nTime: %s\nArtifactRepoName: %s\nPackage: %s\nVersion: %s",
+		message,
+		time.Now().Format(time.RFC3339),
+		result.Repository,
+		result.Package,
+		result.Version,
+	)
+	if result.RolledBackFrom != "" {
+		message += "\nRolledBackFrom: " + result.RolledBackFrom
+	}
+	return message
+}
@@ -0,0 +1,590 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+// fakeBackend runs the operations of the git CLI backend on local repositories and records
+// the ones changing repositories or talking to remotes, such as "push -f feature-app". A
+// hook registered for an operation runs before it: it can fail the operation or act like a
+// concurrent writer, for example by pushing to the remote first.
+type fakeBackend struct {
+	Backend
+
+	mu    sync.Mutex
+	calls []string
+	hooks map[string]func(call string) error
+	creds []Credentials // Credentials passed to network operations
+}
+
+// newFakeBackend returns a fake backend on top of the git CLI
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{Backend: NewCLIBackend(), hooks: make(map[string]func(call string) error)}
+}
+
+// record records a call of operation op and runs its hook
+func (f *fakeBackend) record(op string, args ...string) error {
+	call := strings.Join(append([]string{op}, args...), " ")
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	hook := f.hooks[op]
+	f.mu.Unlock()
+	if hook != nil {
+		return hook(call)
+	}
+	return nil
+}
+
+// network records the credentials of a network operation
+func (f *fakeBackend) network(creds Credentials) {
+	f.mu.Lock()
+	f.creds = append(f.creds, creds)
+	f.mu.Unlock()
+}
+
+// hook registers fn to run before every call of operation op
+func (f *fakeBackend) hook(op string, fn func(call string) error) {
+	f.mu.Lock()
+	f.hooks[op] = fn
+	f.mu.Unlock()
+}
+
+// count returns how many recorded calls equal call
+func (f *fakeBackend) count(call string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		if c == call {
+			n++
+		}
+	}
+	return n
+}
+
+// reset forgets the recorded calls and credentials
+func (f *fakeBackend) reset() {
+	f.mu.Lock()
+	f.calls, f.creds = nil, nil
+	f.mu.Unlock()
+}
+
+func (f *fakeBackend) Clone(ctx context.Context, url, dir string, opts CloneOptions) error {
+	f.network(opts.Credentials)
+	if err := f.record("clone", filepath.Base(dir)); err != nil {
+		return err
+	}
+	return f.Backend.Clone(ctx, url, dir, opts)
+}
+
+func (f *fakeBackend) Fetch(ctx context.Context, dir string, opts FetchOptions) error {
+	f.network(opts.Credentials)
+	if err := f.record("fetch", opts.RefSpecs...); err != nil {
+		return err
+	}
+	return f.Backend.Fetch(ctx, dir, opts)
+}
+
+func (f *fakeBackend) Pull(ctx context.Context, dir string, opts PullOptions) error {
+	f.network(opts.Credentials)
+	if err := f.record("pull", opts.Branch); err != nil {
+		return err
+	}
+	return f.Backend.Pull(ctx, dir, opts)
+}
+
+func (f *fakeBackend) Push(ctx context.Context, dir string, opts PushOptions) error {
+	f.network(opts.Credentials)
+	args := []string{opts.RefSpec}
+	if opts.Force {
+		args = []string{"-f", opts.RefSpec}
+	}
+	if err := f.record("push", args...); err != nil {
+		return err
+	}
+	return f.Backend.Push(ctx, dir, opts)
+}
+
+func (f *fakeBackend) LsRemote(ctx context.Context, dir string, opts LsRemoteOptions) ([]RemoteRef, error) {
+	f.network(opts.Credentials)
+	if err := f.record("ls-remote", opts.Patterns...); err != nil {
+		return nil, err
+	}
+	return f.Backend.LsRemote(ctx, dir, opts)
+}
+
+func (f *fakeBackend) Commit(ctx context.Context, dir, message string, author Signature) error {
+	if err := f.record("commit"); err != nil {
+		return err
+	}
+	return f.Backend.Commit(ctx, dir, message, author)
+}
+
+func (f *fakeBackend) Reset(ctx context.Context, dir, rev string) error {
+	if err := f.record("reset", rev); err != nil {
+		return err
+	}
+	return f.Backend.Reset(ctx, dir, rev)
+}
+
+func (f *fakeBackend) Rebase(ctx context.Context, dir, upstream string) error {
+	if err := f.record("rebase", upstream); err != nil {
+		return err
+	}
+	return f.Backend.Rebase(ctx, dir, upstream)
+}
+
+func (f *fakeBackend) Merge(ctx context.Context, dir, branch string, opts MergeOptions) error {
+	args := []string{branch}
+	if opts.StrategyOption != "" {
+		args = []string{"-X", opts.StrategyOption, branch}
+	}
+	if err := f.record("merge", args...); err != nil {
+		return err
+	}
+	return f.Backend.Merge(ctx, dir, branch, opts)
+}
+
+func (f *fakeBackend) WorktreeAdd(ctx context.Context, dir, path string, opts WorktreeAddOptions) error {
+	if err := f.record("worktree-add", opts.Branch); err != nil {
+		return err
+	}
+	return f.Backend.WorktreeAdd(ctx, dir, path, opts)
+}
+
+func (f *fakeBackend) WorktreePrune(ctx context.Context, dir string) error {
+	if err := f.record("worktree-prune"); err != nil {
+		return err
+	}
+	return f.Backend.WorktreePrune(ctx, dir)
+}
+
+func (f *fakeBackend) SubmoduleUpdate(ctx context.Context, dir string, opts SubmoduleUpdateOptions) error {
+	f.network(opts.Credentials)
+	if err := f.record("submodule-update", opts.Paths...); err != nil {
+		return err
+	}
+	return f.Backend.SubmoduleUpdate(ctx, dir, opts)
+}
+
+// runGit runs a git command in dir and returns its trimmed output. Commits are authored by
+// a test identity and local submodule URLs are allowed.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "protocol.file.allow=always"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// newRemote creates a bare repository whose main branch holds files
+func newRemote(t *testing.T, name string, files map[string]string) string {
+	t.Helper()
+	remote := filepath.Join(t.TempDir(), name+".git")
+	runGit(t, "", "init", "-q", "--bare", "-b", "main", remote)
+	pushFiles(t, remote, "main", "initial commit", files)
+	return remote
+}
+
+// pushFiles commits files to a branch of a remote, creating the branch from main when it
+// does not exist, like another writer of the remote would. Returns the new commit.
+func pushFiles(t *testing.T, remote, branch, message string, files map[string]string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "clone")
+	runGit(t, "", "clone", "-q", remote, dir)
+	if runGit(t, dir, "ls-remote", "origin", "refs/heads/"+branch) != "" {
+		runGit(t, dir, "checkout", "-q", branch)
+	} else if runGit(t, dir, "ls-remote", "origin", "refs/heads/main") != "" {
+		runGit(t, dir, "checkout", "-q", "-b", branch, "origin/main")
+	} else {
+		runGit(t, dir, "checkout", "-q", "-b", branch)
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", message)
+	runGit(t, dir, "push", "-q", "origin", branch)
+	return runGit(t, dir, "rev-parse", "HEAD")
+}
+
+// remoteFile returns the content of a file on a branch of a remote
+func remoteFile(t *testing.T, remote, branch, path string) string {
+	t.Helper()
+	return runGit(t, remote, "show", branch+":"+path)
+}
+
+// newTestManager returns a manager of cfg running on a fake backend
+func newTestManager(t *testing.T, cfg *config.GitConfig) (*Manager, *fakeBackend) {
+	t.Helper()
+	// The CLI backend inherits the environment: it commits as a test identity and may clone
+	// local submodules
+	for key, value := range map[string]string{
+		"GIT_AUTHOR_NAME": "test", "GIT_AUTHOR_EMAIL": "test@example.com",
+		"GIT_COMMITTER_NAME": "test", "GIT_COMMITTER_EMAIL": "test@example.com",
+		"GIT_CONFIG_COUNT": "1", "GIT_CONFIG_KEY_0": "protocol.file.allow", "GIT_CONFIG_VALUE_0": "always",
+	} {
+		t.Setenv(key, value)
+	}
+	if cfg.WorkingDir == "" {
+		cfg.WorkingDir = t.TempDir()
+	}
+	if cfg.CommitConfig.UserName == "" {
+		cfg.CommitConfig = config.CommitConfig{UserName: "watcher", UserEmail: "watcher@example.com", Message: "Update artifacts"}
+	}
+	backend := newFakeBackend()
+	m, err := NewManagerWithBackend(cfg, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, backend
+}
+
+// newRepoManager returns a manager watching the main branch of a remote without submodules
+func newRepoManager(t *testing.T, remote string) (*Manager, *fakeBackend) {
+	t.Helper()
+	useSubmodules := false
+	return newTestManager(t, &config.GitConfig{
+		Branches: []string{"main"},
+		Repositories: []*config.Repository{{
+			Name:          "app",
+			URL:           remote,
+			Branch:        "main",
+			Directory:     "app",
+			UseSubmodules: &useSubmodules,
+		}},
+	})
+}
+
+func TestCheckAndUpdateRepoBranch(t *testing.T) {
+	remote := newRemote(t, "app", map[string]string{"README": "app\n"})
+	m, backend := newRepoManager(t, remote)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T)
+		updated bool
+		calls   []string // Calls made by the check
+		absent  []string // Calls the check must not make
+		err     string
+	}{
+		{
+			name:    "first check clones the repository and adds the worktree",
+			updated: true,
+			calls:   []string{"clone app", "worktree-prune", "worktree-add main"},
+			absent:  []string{"rebase origin/main"},
+		},
+		{
+			name:   "up to date",
+			absent: []string{"clone app", "worktree-add main", "rebase origin/main"},
+		},
+		{
+			name: "new commits are rebased onto",
+			setup: func(t *testing.T) {
+				pushFiles(t, remote, "main", "change readme", map[string]string{"README": "app v2\n"})
+			},
+			updated: true,
+			calls:   []string{"fetch +refs/heads/main:refs/remotes/origin/main", "rebase origin/main"},
+		},
+		{
+			name: "failed fetch",
+			setup: func(t *testing.T) {
+				backend.hook("fetch", func(string) error { return errors.New("connection refused") })
+				t.Cleanup(func() { backend.hook("fetch", nil) })
+			},
+			err: "git fetch failed: connection refused",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend.reset()
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+			result, err := m.CheckAndUpdateRepoBranch(ctx, "app", "main")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("CheckAndUpdateRepoBranch() error = %v, want %q", err, tt.err)
+				}
+				if result == nil || result.Error != err.Error() {
+					t.Errorf("result error = %+v, want %q", result, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CheckAndUpdateRepoBranch() error = %v", err)
+			}
+			if result.Updated != tt.updated {
+				t.Errorf("Updated = %v, want %v", result.Updated, tt.updated)
+			}
+			if head := runGit(t, remote, "rev-parse", "main"); result.HeadAfter != head {
+				t.Errorf("HeadAfter = %s, want remote head %s", result.HeadAfter, head)
+			}
+			for _, call := range tt.calls {
+				if backend.count(call) == 0 {
+					t.Errorf("missing call %q in %q", call, backend.calls)
+				}
+			}
+			for _, call := range tt.absent {
+				if backend.count(call) > 0 {
+					t.Errorf("unexpected call %q in %q", call, backend.calls)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncBranchWorktree(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, m *Manager, backend *fakeBackend, remote string)
+		updated bool
+		err     string
+	}{
+		{
+			name:    "creates the worktree",
+			updated: true,
+		},
+		{
+			name: "keeps an up to date worktree",
+			setup: func(t *testing.T, m *Manager, backend *fakeBackend, remote string) {
+				syncOnce(t, m, backend)
+			},
+		},
+		{
+			name: "rebases local commits onto the remote branch",
+			setup: func(t *testing.T, m *Manager, backend *fakeBackend, remote string) {
+				syncOnce(t, m, backend)
+				worktree := m.BranchPath(m.config.Repositories[0], "main")
+				if err := os.WriteFile(filepath.Join(worktree, "local"), []byte("local\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				runGit(t, worktree, "add", "local")
+				runGit(t, worktree, "commit", "-q", "-m", "local commit")
+				pushFiles(t, remote, "main", "remote commit", map[string]string{"remote": "remote\n"})
+			},
+			updated: true,
+		},
+		{
+			name: "recreates a removed worktree",
+			setup: func(t *testing.T, m *Manager, backend *fakeBackend, remote string) {
+				syncOnce(t, m, backend)
+				if err := os.RemoveAll(m.BranchPath(m.config.Repositories[0], "main")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			updated: true,
+		},
+		{
+			name: "failed rebase",
+			setup: func(t *testing.T, m *Manager, backend *fakeBackend, remote string) {
+				syncOnce(t, m, backend)
+				pushFiles(t, remote, "main", "remote commit", map[string]string{"remote": "remote\n"})
+				backend.hook("rebase", func(string) error { return errors.New("conflict") })
+			},
+			err: "git rebase failed: conflict",
+		},
+		{
+			name: "failed worktree add removes the partial worktree",
+			setup: func(t *testing.T, m *Manager, backend *fakeBackend, remote string) {
+				backend.hook("worktree-add", func(string) error {
+					if err := os.MkdirAll(m.BranchPath(m.config.Repositories[0], "main"), 0755); err != nil {
+						return err
+					}
+					return errors.New("disk full")
+				})
+			},
+			err: "git worktree add failed: disk full",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote := newRemote(t, "app", map[string]string{"README": "app\n"})
+			m, backend := newRepoManager(t, remote)
+			repo := m.config.Repositories[0]
+			if tt.setup != nil {
+				tt.setup(t, m, backend, remote)
+			}
+			path, updated, err := m.syncBranchWorktree(context.Background(), repo, "main")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("syncBranchWorktree() error = %v, want %q", err, tt.err)
+				}
+				if strings.Contains(tt.err, "worktree add") {
+					if _, err := os.Stat(m.BranchPath(repo, "main")); !os.IsNotExist(err) {
+						t.Errorf("partial worktree was kept: %v", err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("syncBranchWorktree() error = %v", err)
+			}
+			if path != m.BranchPath(repo, "main") {
+				t.Errorf("path = %s, want %s", path, m.BranchPath(repo, "main"))
+			}
+			if updated != tt.updated {
+				t.Errorf("updated = %v, want %v", updated, tt.updated)
+			}
+			// The worktree holds the remote branch, with local commits on top of it
+			runGit(t, path, "merge-base", "--is-ancestor", runGit(t, remote, "rev-parse", "main"), "HEAD")
+		})
+	}
+}
+
+// syncOnce creates the worktree of the main branch and forgets the calls it made
+func syncOnce(t *testing.T, m *Manager, backend *fakeBackend) {
+	t.Helper()
+	if _, _, err := m.syncBranchWorktree(context.Background(), m.config.Repositories[0], "main"); err != nil {
+		t.Fatal(err)
+	}
+	backend.reset()
+}
+
+// newArtifactsManager returns a manager writing versions to the YAML files of an artifacts
+// remote, next to a watched repository whose authentication may be borrowed
+func newArtifactsManager(t *testing.T, remote string, artifactsRepo config.ArtifactsRepo) (*Manager, *fakeBackend) {
+	t.Helper()
+	artifactsRepo.URL, artifactsRepo.Branch, artifactsRepo.Directory = remote, "main", "art"
+	if artifactsRepo.Format == "" {
+		artifactsRepo.Format = config.FormatYAML
+	}
+	return newTestManager(t, &config.GitConfig{
+		Branches: []string{"main"},
+		Repositories: []*config.Repository{{
+			Name:      "app",
+			URL:       "/nonexistent/app.git",
+			Directory: "app",
+			Auth:      config.AuthConfig{Type: "ssh", Username: "main"},
+		}},
+		ArtifactsRepo: &artifactsRepo,
+	})
+}
+
+// testArtifact returns the artifact of a version of package pkg of repository app
+func testArtifact(version string) Artifact {
+	return Artifact{ArtifactRepoName: "app", ArtifactPkgName: "pkg", ArtifactVersionName: version}
+}
+
+func TestUpdateArtifactsRepo(t *testing.T) {
+	remote := newRemote(t, "artifacts", map[string]string{"app.yaml": "app:\n  pkg:\n    pkg-1.0: pkg-1.0-1\n"})
+	m, backend := newArtifactsManager(t, remote, config.ArtifactsRepo{Auth: config.AuthConfig{Type: "ssh", Username: "artifacts"}})
+
+	tests := []struct {
+		name        string
+		version     string
+		opts        ArtifactsOptions
+		dryRun      bool
+		useMainAuth bool
+		want        string // Line of app.yaml on the remote main branch afterwards
+		pushed      bool
+		err         error
+	}{
+		{
+			name:    "writes a new version",
+			version: "pkg-1.0-2",
+			want:    "pkg-1.0: pkg-1.0-2",
+			pushed:  true,
+		},
+		{
+			name:    "keeps the current version",
+			version: "pkg-1.0-2",
+			want:    "pkg-1.0: pkg-1.0-2",
+		},
+		{
+			name:    "refuses an older version",
+			version: "pkg-1.0-1",
+			want:    "pkg-1.0: pkg-1.0-2",
+			err:     ErrArtifactsDowngrade,
+		},
+		{
+			name:    "writes a forced older version",
+			version: "pkg-1.0-1",
+			opts:    ArtifactsOptions{Force: true},
+			want:    "pkg-1.0: pkg-1.0-1",
+			pushed:  true,
+		},
+		{
+			name:    "dry run only plans",
+			version: "pkg-1.0-3",
+			dryRun:  true,
+			want:    "pkg-1.0: pkg-1.0-1",
+		},
+		{
+			name:        "borrows the main repository authentication",
+			version:     "pkg-1.1-1",
+			useMainAuth: true,
+			want:        "pkg-1.1: pkg-1.1-1",
+			pushed:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend.reset()
+			m.config.ArtifactsRepo.UseMainAuth = tt.useMainAuth
+			ctx := context.Background()
+			if tt.dryRun {
+				ctx = WithDryRun(ctx)
+			}
+			result, err := m.UpdateArtifactsRepo(ctx, testArtifact(tt.version), tt.opts)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("UpdateArtifactsRepo() error = %v, want %v", err, tt.err)
+				}
+			} else if err != nil {
+				t.Fatalf("UpdateArtifactsRepo() error = %v", err)
+			}
+			if content := remoteFile(t, remote, "main", "app.yaml"); !strings.Contains(content, tt.want) {
+				t.Errorf("app.yaml = %q, want %q", content, tt.want)
+			}
+			if pushed := backend.count("push main") > 0; pushed != tt.pushed {
+				t.Errorf("pushed = %v, want %v, calls %q", pushed, tt.pushed, backend.calls)
+			}
+			if pushed := backend.count("push -f feature-app") > 0; pushed != tt.pushed {
+				t.Errorf("feature branch pushed = %v, want %v", pushed, tt.pushed)
+			}
+			if tt.pushed && (result.Commit == "" || result.Push == nil || !result.Push.Success) {
+				t.Errorf("result = %+v, want a pushed commit", result)
+			}
+			if tt.dryRun && result.Plan == nil {
+				t.Error("dry run returned no plan")
+			}
+
+			// The authentication is borrowed for the update only, the configuration is left alone
+			wantAuth := "artifacts"
+			if tt.useMainAuth {
+				wantAuth = "main"
+			}
+			for _, creds := range backend.creds {
+				if creds.Auth.Username != wantAuth {
+					t.Errorf("operation authenticated as %q, want %q", creds.Auth.Username, wantAuth)
+				}
+			}
+			if m.config.ArtifactsRepo.Auth.Username != "artifacts" {
+				t.Errorf("artifacts repository auth changed to %+v", m.config.ArtifactsRepo.Auth)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrNoHold is returned when releasing a branch whose submodules are not held
+var ErrNoHold = errors.New("submodules are not held")
+
+// SubmoduleHold keeps the submodules of a branch at the commits restored by a rollback. Until
+// it is released, the submodules of the branch are treated as frozen: checks, pushes of the
+// submodules and updates of the branch leave them at the commits recorded by the branch.
+type SubmoduleHold struct {
+	Repository string    `json:"repository"`
+	Branch     string    `json:"branch"`
+	Commit     string    `json:"commit"` // Commit whose submodule pointers were restored
+	User       string    `json:"user,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// HoldStore persists submodule holds, so they survive restarts
+type HoldStore interface {
+	SubmoduleHolds() ([]*SubmoduleHold, error)
+	SaveSubmoduleHold(hold *SubmoduleHold) error
+	DeleteSubmoduleHold(repository, branch string) error
+}
+
+// UseHoldStore loads the submodule holds kept in store and persists the holds set or
+// released afterwards in it
+func (m *Manager) UseHoldStore(store HoldStore) error {
+	holds, err := store.SubmoduleHolds()
+	if err != nil {
+		return fmt.Errorf("failed to load submodule holds: %w", err)
+	}
+	m.holdsMu.Lock()
+	defer m.holdsMu.Unlock()
+	m.holdStore = store
+	for _, hold := range holds {
+		m.holds[branchKey(hold.Repository, hold.Branch)] = hold
+	}
+	return nil
+}
+
+// SubmoduleHolds returns the branches whose submodules are held, sorted by repository and branch
+func (m *Manager) SubmoduleHolds() []*SubmoduleHold {
+	m.holdsMu.Lock()
+	defer m.holdsMu.Unlock()
+	holds := make([]*SubmoduleHold, 0, len(m.holds))
+	for _, hold := range m.holds {
+		holds = append(holds, hold)
+	}
+	sort.Slice(holds, func(i, j int) bool {
+		if holds[i].Repository != holds[j].Repository {
+			return holds[i].Repository < holds[j].Repository
+		}
+		return holds[i].Branch < holds[j].Branch
+	})
+	return holds
+}
+
+// ReleaseSubmodules releases the hold of a branch, so that its submodules follow their
+// policies again from the next check. Returns ErrNoHold when the branch is not held.
+func (m *Manager) ReleaseSubmodules(repoName, branch string) (*SubmoduleHold, error) {
+	m.holdsMu.Lock()
+	defer m.holdsMu.Unlock()
+	key := branchKey(repoName, branch)
+	hold, ok := m.holds[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s branch %s", ErrNoHold, repoName, branch)
+	}
+	if m.holdStore != nil {
+		if err := m.holdStore.DeleteSubmoduleHold(repoName, branch); err != nil {
+			return nil, fmt.Errorf("failed to release submodule hold: %w", err)
+		}
+	}
+	delete(m.holds, key)
+	return hold, nil
+}
+
+// holdSubmodules records the hold of a branch, replacing an earlier one
+func (m *Manager) holdSubmodules(hold *SubmoduleHold) error {
+	m.holdsMu.Lock()
+	defer m.holdsMu.Unlock()
+	if m.holdStore != nil {
+		if err := m.holdStore.SaveSubmoduleHold(hold); err != nil {
+			return fmt.Errorf("failed to save submodule hold: %w", err)
+		}
+	}
+	m.holds[branchKey(hold.Repository, hold.Branch)] = hold
+	return nil
+}
+
+// isHeld reports whether the submodules of a branch are held by a rollback
+func (m *Manager) isHeld(repoName, branch string) bool {
+	m.holdsMu.Lock()
+	defer m.holdsMu.Unlock()
+	_, ok := m.holds[branchKey(repoName, branch)]
+	return ok
+}
@@ -0,0 +1,309 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/forge"
+	"github.com/Jieay/git-watcher/internal/logging"
+)
+
+// dryRunKey marks the contexts of dry runs
+type dryRunKey struct{}
+
+// WithDryRun returns a context in which branch checks, submodule updates and artifacts updates
+// only plan their changes, as with git.dryRun
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// IsDryRun reports whether changes are only planned, for every run or for the run of ctx
+func (m *Manager) IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun || m.config.DryRun
+}
+
+// BranchPlan describes the changes a check of a branch would make. It is computed from the
+// fetched remote branches without committing, pushing or moving the submodules.
+type BranchPlan struct {
+	Upstream        string            `json:"upstream"`             // Commit of the remote branch the changes are based on
+	IncomingCommits int               `json:"incomingCommits"`      // Remote commits the worktree would be rebased onto
+	Submodules      []SubmoduleChange `json:"submodules,omitempty"` // Submodules that would move
+	Commit          *PlannedCommit    `json:"commit,omitempty"`     // Auto-commit that would be created
+	Pushes          []PlannedPush     `json:"pushes,omitempty"`
+	Warnings        []string          `json:"warnings,omitempty"` // Submodules that could not be planned and skipped steps
+}
+
+// ArtifactsPlan describes the changes an artifacts update would make
+type ArtifactsPlan struct {
+	File   string         `json:"file"`
+	Base   string         `json:"base"`           // Revision the file is read from and the commit is based on
+	Diff   string         `json:"diff,omitempty"` // Unified diff of the file, empty when the version is already recorded
+	Commit *PlannedCommit `json:"commit,omitempty"`
+	Pushes []PlannedPush  `json:"pushes,omitempty"`
+}
+
+// PlannedCommit is a commit a dry run would create
+type PlannedCommit struct {
+	Branch  string   `json:"branch"`
+	Parent  string   `json:"parent,omitempty"`
+	Paths   []string `json:"paths"`
+	Message string   `json:"message"`
+}
+
+// PlannedPush is a push a dry run would make
+type PlannedPush struct {
+	Branch      string         `json:"branch"`
+	Force       bool           `json:"force,omitempty"`
+	MergeFrom   string         `json:"mergeFrom,omitempty"`   // Branch merged into Branch before the push
+	PullRequest *forge.Request `json:"pullRequest,omitempty"` // Pull request opened or updated after the push
+}
+
+// planBranch plans the check of a branch worktree, limited to the given submodule paths when
+// any are passed. The worktree is created if needed and the branch and the submodules are
+// fetched, but the worktree stays at its current commits.
+func (m *Manager) planBranch(ctx context.Context, repo *config.Repository, branch string, paths ...string) (*BranchPlan, error) {
+	basePath := m.basePath(repo)
+	worktreePath := m.BranchPath(repo, branch)
+	baseLock := m.getFileLock(basePath)
+	baseLock.Lock()
+	created, err := m.prepareBranchWorktree(ctx, repo, branch, basePath, worktreePath)
+	baseLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	upstreamRef := "origin/" + branch
+	plan := &BranchPlan{}
+	plan.Upstream, err = m.backend.RevParse(ctx, worktreePath, upstreamRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", upstreamRef, err)
+	}
+	if head, err := m.backend.RevParse(ctx, worktreePath, "HEAD"); err == nil && head != plan.Upstream {
+		plan.IncomingCommits, _ = m.backend.CountCommits(ctx, worktreePath, head, upstreamRef)
+	}
+	if !m.config.UseSubmodulesFor(repo) {
+		return plan, nil
+	}
+
+	data, err := m.backend.ReadFile(ctx, worktreePath, upstreamRef, ".gitmodules")
+	if errors.Is(err, os.ErrNotExist) {
+		return plan, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .gitmodules: %w", err)
+	}
+	submodules, err := parseGitmodules(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse .gitmodules: %w", err)
+	}
+
+	// A new worktree needs the submodule clones, checked out at their recorded commits
+	if created {
+		updateCtx, cancel := context.WithTimeout(ctx, m.config.Timeouts.CloneTimeout())
+		err := m.backend.SubmoduleUpdate(updateCtx, worktreePath, SubmoduleUpdateOptions{
+			Init:        true,
+			Recursive:   true,
+			Credentials: credentialsFor(repo),
+		})
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("git submodule update failed: %w", err)
+		}
+	}
+
+	details := make([]string, 0, len(submodules))
+	changedPaths := make([]string, 0, len(submodules))
+	for _, submodule := range submodules {
+		if len(paths) > 0 && !slices.Contains(paths, submodule.Path) {
+			continue
+		}
+		subCtx := logging.With(ctx, logging.KeySubmodule, submodule.Path)
+		recorded, err := m.backend.RevParse(subCtx, worktreePath, upstreamRef+":"+submodule.Path)
+		if err != nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s: no commit recorded by %s", submodule.Path, upstreamRef))
+			continue
+		}
+		target, version, err := m.planSubmodule(subCtx, repo, branch, worktreePath, submodule, recorded)
+		if err != nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s: %v", submodule.Path, err))
+			continue
+		}
+		details = append(details, submoduleDetail(submodule.Path, target, version))
+		if target != recorded {
+			plan.Submodules = append(plan.Submodules, SubmoduleChange{Path: submodule.Path, Before: recorded, After: target, Version: version})
+			changedPaths = append(changedPaths, submodule.Path)
+		}
+	}
+	m.planSubmoduleCommit(plan, repo, branch, changedPaths, submoduleCommitMessage(m.config.CommitConfigFor(repo), repo, branch, details))
+	return plan, nil
+}
+
+// planSubmoduleCommit adds the auto-commit of the submodule changes of a plan and its
+// delivery, if auto commit is enabled
+func (m *Manager) planSubmoduleCommit(plan *BranchPlan, repo *config.Repository, branch string, paths []string, message string) {
+	if len(plan.Submodules) == 0 || !m.config.AutoCommitFor(repo) {
+		return
+	}
+
+	plan.Commit = &PlannedCommit{
+		Branch:  branch,
+		Parent:  plan.Upstream,
+		Paths:   paths,
+		Message: message,
+	}
+	if repo.GetAuth().Type == "none" {
+		plan.Warnings = append(plan.Warnings, "no authentication configured, the commit would not be pushed")
+		return
+	}
+	if delivery := m.config.DeliveryFor(repo); delivery.IsPullRequest() {
+		head := delivery.GetBranchPrefix() + branch
+		pullRequest := submodulePullRequest(repo, branch, head, plan.Submodules)
+		plan.Commit.Branch = head
+		plan.Pushes = []PlannedPush{{Branch: head, Force: true, PullRequest: &pullRequest}}
+	} else {
+		plan.Pushes = []PlannedPush{{Branch: branch}}
+	}
+}
+
+// planSubmodule returns the commit the policy of a submodule selects, as applySubmodulePolicy
+// would check out, and the selected tag for tag policies. The submodule is fetched but not
+// checked out.
+func (m *Manager) planSubmodule(ctx context.Context, repo *config.Repository, branch, worktreePath string, submodule Submodule, recorded string) (string, string, error) {
+	policy := m.config.SubmodulePolicyFor(repo, branch, submodule.Path)
+	submodulePath := filepath.Join(worktreePath, submodule.Path)
+	if m.isFrozen(repo, branch, submodule.Path) {
+		return recorded, "", nil
+	}
+	if _, err := os.Stat(filepath.Join(submodulePath, ".git")); err != nil {
+		return "", "", fmt.Errorf("submodule is not initialized in the worktree")
+	}
+
+	if policy.GetTrack() == config.TrackTag {
+		tags, err := m.fetchSubmoduleTags(ctx, repo, submodulePath)
+		if err != nil {
+			return "", "", err
+		}
+		tag, ok := selectTag(tags, policy)
+		if !ok {
+			return recorded, "", nil
+		}
+		return tag.Commit, tag.Name, nil
+	}
+
+	tracked := policy.Branch
+	if tracked == "" {
+		tracked = submodule.Branch
+	}
+	if tracked == "." {
+		tracked = branch
+	}
+	if tracked == "" {
+		// The remote HEAD, followed by "git submodule update --remote" without a branch
+		lsRemoteCtx, cancel := context.WithTimeout(ctx, m.config.Timeouts.FetchTimeout())
+		refs, err := m.backend.LsRemote(lsRemoteCtx, submodulePath, LsRemoteOptions{
+			Remote:      "origin",
+			Patterns:    []string{"HEAD"},
+			Credentials: credentialsFor(repo),
+		})
+		cancel()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to resolve the remote HEAD: %w", err)
+		}
+		for _, ref := range refs {
+			if ref.Name == "HEAD" {
+				return ref.Hash, "", nil
+			}
+		}
+		return "", "", fmt.Errorf("remote HEAD is not advertised, set the branch of the submodule")
+	}
+
+	err := m.fetch(ctx, submodulePath, FetchOptions{
+		Remote:      "origin",
+		RefSpecs:    []string{fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", tracked, tracked)},
+		Credentials: credentialsFor(repo),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("git fetch of submodule branch %s failed: %w", tracked, err)
+	}
+	target, err := m.backend.RevParse(ctx, submodulePath, "origin/"+tracked)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve submodule branch %s: %w", tracked, err)
+	}
+	return target, "", nil
+}
+
+// planArtifacts plans an artifacts update: the file is read from the revision the feature
+// branch would start from and the new content is compared with it, without checking out,
+// committing, pushing or merging
+func (m *Manager) planArtifacts(ctx context.Context, repoPath string, result *ArtifactsResult, patch artifactsPatch, featureExists bool, client *forge.Client, commitConfig config.CommitConfig) (*ArtifactsPlan, error) {
+	featureBranch, targetBranch := result.FeatureBranch, result.TargetBranch
+	refSpecs := []string{fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", targetBranch, targetBranch)}
+	if featureExists {
+		refSpecs = append(refSpecs, fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", featureBranch, featureBranch))
+	}
+	err := m.fetch(ctx, repoPath, FetchOptions{Remote: "origin", RefSpecs: refSpecs, Credentials: credentialsFor(m.artifactsRepo())})
+	if err != nil {
+		return nil, fmt.Errorf("git fetch failed: %w", err)
+	}
+
+	// The feature branch starts from the same revision as in a real update
+	base := "HEAD"
+	switch {
+	case client != nil:
+		base = "origin/" + targetBranch
+		if featureExists {
+			pr, err := client.Find(ctx, featureBranch, targetBranch)
+			if err != nil {
+				return nil, fmt.Errorf("failed to look up pull request: %w", err)
+			}
+			if pr != nil {
+				base = "origin/" + featureBranch
+			}
+		}
+	case featureExists:
+		base = "origin/" + featureBranch
+		if _, err := m.backend.RevParse(ctx, repoPath, "refs/heads/"+featureBranch); err == nil {
+			base = featureBranch
+		}
+	case result.Environment != "":
+		// Feature branches of environments start from their target branch
+		base = "origin/" + targetBranch
+	}
+
+	plan := &ArtifactsPlan{File: patch.File, Base: base}
+	existing, err := m.backend.ReadFile(ctx, repoPath, base, plan.File)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", plan.File, err)
+	}
+	content, changed, err := patch.apply(existing)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return plan, nil
+	}
+
+	plan.Diff = unifiedDiff(plan.File, string(existing), string(content))
+	parent, _ := m.backend.RevParse(ctx, repoPath, base)
+	plan.Commit = &PlannedCommit{
+		Branch:  featureBranch,
+		Parent:  parent,
+		Paths:   []string{plan.File},
+		Message: artifactsCommitMessage(commitConfig, result),
+	}
+	plan.Pushes = []PlannedPush{{Branch: featureBranch, Force: true}}
+	if client != nil {
+		pullRequest := artifactsPullRequest(result.Repository, result.Package, result.Version, patch.File, featureBranch, targetBranch)
+		plan.Pushes[0].PullRequest = &pullRequest
+	} else {
+		plan.Pushes = append(plan.Pushes, PlannedPush{Branch: targetBranch, MergeFrom: featureBranch})
+	}
+	return plan, nil
+}
@@ -0,0 +1,176 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/logging"
+	"github.com/Jieay/git-watcher/internal/version"
+)
+
+// policyTagPatterns returns the tag patterns of a tag policy, all tags when none are set
+func policyTagPatterns(policy *config.SubmodulePolicy) []string {
+	if len(policy.Tags) == 0 {
+		return []string{"*"}
+	}
+	return policy.Tags
+}
+
+// MatchPolicyTag reports whether a tag can be selected by a tag policy: it matches the tag
+// patterns and, when the policy has a constraint, is a version satisfying it
+func MatchPolicyTag(policy *config.SubmodulePolicy, name string) bool {
+	if !MatchTag(policyTagPatterns(policy), name) {
+		return false
+	}
+	if policy.Constraint == "" {
+		return true
+	}
+	constraint, err := version.ParseConstraint(policy.Constraint)
+	if err != nil {
+		return false
+	}
+	v, err := version.Parse(name)
+	return err == nil && constraint.Check(v)
+}
+
+// selectTag returns the tag a tag policy selects: the highest version among the tags it can
+// select. Without a constraint, when none of the matching tags is a version, the most recent
+// matching tag is selected instead.
+func selectTag(tags []Tag, policy *config.SubmodulePolicy) (Tag, bool) {
+	var (
+		best        Tag
+		bestVersion version.Version
+		found       bool
+	)
+	for _, tag := range tags {
+		if !MatchPolicyTag(policy, tag.Name) {
+			continue
+		}
+		v, err := version.Parse(tag.Name)
+		if err != nil {
+			continue
+		}
+		if !found || bestVersion.LessThan(v) {
+			best, bestVersion, found = tag, v, true
+		}
+	}
+	if found || policy.Constraint != "" {
+		return best, found
+	}
+	return newestTag(tags, policyTagPatterns(policy))
+}
+
+// isFrozen reports whether a submodule of a branch keeps the commit recorded by the branch,
+// because of its policy or of a hold set by a rollback
+func (m *Manager) isFrozen(repo *config.Repository, branch, submodule string) bool {
+	return m.config.SubmodulePolicyFor(repo, branch, submodule).GetTrack() == config.TrackFrozen ||
+		m.isHeld(repo.GetName(), branch)
+}
+
+// applySubmodulePolicy moves a submodule updated by "git submodule update --remote" to the
+// commit selected by its policy: the tip of the policy branch, the tag selected by a tag policy
+// or, for frozen submodules and tag policies without a matching tag, the commit recorded by the
+// branch. Returns the tag checked out by a tag policy.
+func (m *Manager) applySubmodulePolicy(ctx context.Context, repo *config.Repository, branch, repoPath, submodule string) (string, error) {
+	policy := m.config.SubmodulePolicyFor(repo, branch, submodule)
+	logger := logging.FromContext(ctx)
+	submodulePath := filepath.Join(repoPath, submodule)
+
+	if m.isFrozen(repo, branch, submodule) {
+		logger.Debug("submodule is frozen")
+		return "", m.checkoutRecordedCommit(ctx, repoPath, submodule)
+	}
+	switch policy.GetTrack() {
+
+	case config.TrackTag:
+		tags, err := m.fetchSubmoduleTags(ctx, repo, submodulePath)
+		if err != nil {
+			return "", err
+		}
+		tag, ok := selectTag(tags, policy)
+		if !ok {
+			logger.Warn("no submodule tag satisfies the policy, keeping the recorded commit",
+				"patterns", policyTagPatterns(policy), "constraint", policy.Constraint)
+			return "", m.checkoutRecordedCommit(ctx, repoPath, submodule)
+		}
+		if err := m.backend.Checkout(ctx, submodulePath, CheckoutOptions{Detach: true, StartPoint: tag.Commit}); err != nil {
+			return "", fmt.Errorf("git checkout of tag %s failed: %w", tag.Name, err)
+		}
+		logger.Info("pinned submodule to tag", "tag", tag.Name, "commit", tag.Commit)
+		return tag.Name, nil
+	}
+
+	// Without a policy branch "git submodule update --remote" already followed .gitmodules
+	if policy.Branch == "" {
+		return "", nil
+	}
+	err := m.fetch(ctx, submodulePath, FetchOptions{
+		Remote:      "origin",
+		RefSpecs:    []string{fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", policy.Branch, policy.Branch)},
+		Credentials: credentialsFor(repo),
+	})
+	if err != nil {
+		return "", fmt.Errorf("git fetch of submodule branch %s failed: %w", policy.Branch, err)
+	}
+	if err := m.backend.Checkout(ctx, submodulePath, CheckoutOptions{Detach: true, StartPoint: "origin/" + policy.Branch}); err != nil {
+		return "", fmt.Errorf("git checkout of submodule branch %s failed: %w", policy.Branch, err)
+	}
+	return "", nil
+}
+
+// fetchSubmoduleTags fetches the tags of a submodule and lists them
+func (m *Manager) fetchSubmoduleTags(ctx context.Context, repo *config.Repository, submodulePath string) ([]Tag, error) {
+	err := m.fetch(ctx, submodulePath, FetchOptions{
+		Remote:      "origin",
+		RefSpecs:    []string{tagsRefSpec},
+		Credentials: credentialsFor(repo),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("git fetch of submodule tags failed: %w", err)
+	}
+	tags, err := m.backend.Tags(ctx, submodulePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list submodule tags: %w", err)
+	}
+	return tags, nil
+}
+
+// checkoutRecordedCommit checks out the commit the HEAD of a working tree records for a submodule
+func (m *Manager) checkoutRecordedCommit(ctx context.Context, repoPath, submodule string) error {
+	recorded, err := m.backend.RevParse(ctx, repoPath, "HEAD:"+submodule)
+	if err != nil {
+		return fmt.Errorf("failed to get recorded submodule commit: %w", err)
+	}
+	if err := m.backend.Checkout(ctx, filepath.Join(repoPath, submodule), CheckoutOptions{Detach: true, StartPoint: recorded}); err != nil {
+		return fmt.Errorf("git checkout of recorded submodule commit failed: %w", err)
+	}
+	return nil
+}
+
+// submoduleVersion returns the tag a tag policy selected for the commit checked out in a
+// submodule, empty for other policies
+func (m *Manager) submoduleVersion(ctx context.Context, repo *config.Repository, branch, repoPath, submodule string) string {
+	policy := m.config.SubmodulePolicyFor(repo, branch, submodule)
+	if policy.GetTrack() != config.TrackTag {
+		return ""
+	}
+	submodulePath := filepath.Join(repoPath, submodule)
+	head, err := m.backend.RevParse(ctx, submodulePath, "HEAD")
+	if err != nil {
+		return ""
+	}
+	tags, err := m.backend.Tags(ctx, submodulePath)
+	if err != nil {
+		return ""
+	}
+	atHead := make([]Tag, 0, 1)
+	for _, tag := range tags {
+		if tag.Commit == head {
+			atHead = append(atHead, tag)
+		}
+	}
+	tag, _ := selectTag(atHead, policy)
+	return tag.Name
+}
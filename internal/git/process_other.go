@@ -0,0 +1,11 @@
+//go:build !unix
+
+package git
+
+import "os/exec"
+
+// configureProcessGroup only bounds the wait for output pipes on platforms
+// without process groups; cancellation kills the git process itself
+func configureProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = processWaitDelay
+}
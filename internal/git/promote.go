@@ -0,0 +1,60 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Jieay/git-watcher/internal/logging"
+	"github.com/Jieay/git-watcher/internal/manifest"
+)
+
+// ErrNotInEnvironment is returned when a version is promoted from an environment that does
+// not record it
+var ErrNotInEnvironment = errors.New("version not found in source environment")
+
+// checkPromotionSource checks that the environment a version is promoted from records it on
+// the latest commit of its target branch
+func (m *Manager) checkPromotionSource(ctx context.Context, repoPath string, artifact Artifact, opts ArtifactsOptions) error {
+	from, err := m.config.ArtifactsRepo.EnvironmentFor(opts.PromoteFrom)
+	if err != nil {
+		return err
+	}
+	patch, _, err := m.newArtifactsPatch(artifact, from, ArtifactsOptions{})
+	if err != nil {
+		return err
+	}
+
+	branch := m.config.ArtifactsRepo.TargetBranch(from)
+	err = m.fetch(ctx, repoPath, FetchOptions{
+		Remote:      "origin",
+		RefSpecs:    []string{fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", branch, branch)},
+		Credentials: credentialsFor(m.artifactsRepo()),
+	})
+	if err != nil {
+		return fmt.Errorf("git fetch of branch %s failed: %w", branch, err)
+	}
+	content, err := m.backend.ReadFile(ctx, repoPath, "origin/"+branch, patch.File)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", patch.File, err)
+	}
+	writer, err := manifest.New(patch.Format)
+	if err != nil {
+		return err
+	}
+	current, ok, err := writer.Get(content, patch.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", patch.File, err)
+	}
+	key := strings.Join(patch.Path, ".")
+	if !ok {
+		return fmt.Errorf("%w: %s has no %s in %s", ErrNotInEnvironment, from.Name, key, patch.File)
+	}
+	if current != patch.Value {
+		return fmt.Errorf("%w: %s records %s for %s in %s", ErrNotInEnvironment, from.Name, current, key, patch.File)
+	}
+	logging.FromContext(ctx).Info("version found in source environment", "environment", from.Name, "branch", branch, "file", patch.File)
+	return nil
+}
@@ -0,0 +1,60 @@
+package git
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+// NormalizeRemoteURL reduces a remote URL to "host/path" so that the HTTPS, SSH and
+// scp-like URLs of the same repository compare equal. Credentials, ports, a trailing
+// ".git" and letter case are ignored; local paths are only cleaned.
+func NormalizeRemoteURL(remote string) string {
+	remote = strings.TrimSpace(remote)
+	if remote == "" {
+		return ""
+	}
+
+	var host, path string
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return strings.ToLower(remote)
+		}
+		if u.Scheme == "file" {
+			return filepath.Clean(u.Path)
+		}
+		host, path = u.Hostname(), u.Path
+	} else if i := strings.Index(remote, ":"); i > 0 && !strings.Contains(remote[:i], "/") {
+		// scp-like syntax: [user@]host:path
+		host, path = remote[:i], remote[i+1:]
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+	} else {
+		return filepath.Clean(remote)
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	return strings.ToLower(host + "/" + path)
+}
+
+// RepositoriesForURL returns the watched repositories whose URL refers to one of the given remote URLs
+func (m *Manager) RepositoriesForURL(urls ...string) []*config.Repository {
+	wanted := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		if normalized := NormalizeRemoteURL(u); normalized != "" {
+			wanted[normalized] = true
+		}
+	}
+
+	repos := make([]*config.Repository, 0)
+	for _, repo := range m.Repositories() {
+		if wanted[NormalizeRemoteURL(repo.GetURL())] {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
@@ -0,0 +1,107 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Jieay/git-watcher/internal/forge"
+)
+
+// SubmoduleChange records a submodule moved to a new commit during a check
+type SubmoduleChange struct {
+	Path    string `json:"path"`
+	Before  string `json:"before,omitempty"`  // Commit recorded in the main repository before the check
+	After   string `json:"after"`             // Commit checked out after the update
+	Version string `json:"version,omitempty"` // Tag selected by a tag policy
+}
+
+// PushResult records the outcome of pushing a branch
+type PushResult struct {
+	Branch  string `json:"branch"`
+	Forced  bool   `json:"forced"` // The regular push was rejected and a force push was used
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// Pull request opened or updated instead of pushing to the branch
+	PullRequest *forge.PullRequest `json:"pullRequest,omitempty"`
+}
+
+// BranchResult describes what a check of one branch of a watched repository did
+type BranchResult struct {
+	Repository   string            `json:"repository"`
+	Branch       string            `json:"branch"`
+	Updated      bool              `json:"updated"` // The worktree was created or received new commits
+	HeadBefore   string            `json:"headBefore,omitempty"`
+	HeadAfter    string            `json:"headAfter,omitempty"`
+	Submodules   []SubmoduleChange `json:"submodules,omitempty"`
+	Commit       string            `json:"commit,omitempty"`       // Auto-commit created for the submodule changes
+	RolledBackTo string            `json:"rolledBackTo,omitempty"` // Commit whose submodule pointers a rollback restored
+	Push         *PushResult       `json:"push,omitempty"`
+	Plan         *BranchPlan       `json:"plan,omitempty"` // Changes a dry run would make
+	Error        string            `json:"error,omitempty"`
+}
+
+// ArtifactsResult describes an update of the artifacts repository
+type ArtifactsResult struct {
+	Repository     string             `json:"repository"` // Artifact repository name
+	Package        string             `json:"package"`
+	Version        string             `json:"version"`
+	File           string             `json:"file,omitempty"` // File of the artifacts repository recording the version
+	Environment    string             `json:"environment,omitempty"`
+	PromotedFrom   string             `json:"promotedFrom,omitempty"`   // Environment the version was promoted from
+	RolledBackFrom string             `json:"rolledBackFrom,omitempty"` // Version replaced by a rollback
+	FeatureBranch  string             `json:"featureBranch"`
+	TargetBranch   string             `json:"targetBranch,omitempty"`
+	Commit         string             `json:"commit,omitempty"` // Empty when the version was already present
+	Push           *PushResult        `json:"push,omitempty"`
+	Plan           *ArtifactsPlan     `json:"plan,omitempty"`     // Changes a dry run would make
+	Conflict       *ArtifactsConflict `json:"conflict,omitempty"` // Conflict of the feature branch with the target branch
+	Error          string             `json:"error,omitempty"`
+}
+
+// recordedSubmoduleCommits returns the commits the HEAD of a working tree records for its submodules
+func (m *Manager) recordedSubmoduleCommits(ctx context.Context, repoPath string) map[string]string {
+	commits := make(map[string]string)
+	if _, err := os.Stat(filepath.Join(repoPath, ".gitmodules")); err != nil {
+		return commits
+	}
+	submodules, err := m.listSubmodules(repoPath)
+	if err != nil {
+		return commits
+	}
+	for _, submodule := range submodules {
+		if hash, err := m.backend.RevParse(ctx, repoPath, "HEAD:"+submodule); err == nil {
+			commits[submodule] = hash
+		}
+	}
+	return commits
+}
+
+// submoduleHeads returns the commit checked out in each submodule of a working tree
+func (m *Manager) submoduleHeads(ctx context.Context, repoPath string) map[string]string {
+	submodules, err := m.listSubmodules(repoPath)
+	if err != nil {
+		return nil
+	}
+	heads := make(map[string]string, len(submodules))
+	for _, submodule := range submodules {
+		if head, err := m.backend.RevParse(ctx, filepath.Join(repoPath, submodule), "HEAD"); err == nil {
+			heads[submodule] = head
+		}
+	}
+	return heads
+}
+
+// submoduleChanges compares the checked out submodule commits with the recorded ones
+func submoduleChanges(recorded, heads map[string]string) []SubmoduleChange {
+	changes := make([]SubmoduleChange, 0, len(heads))
+	for submodule, after := range heads {
+		if after == recorded[submodule] {
+			continue
+		}
+		changes = append(changes, SubmoduleChange{Path: submodule, Before: recorded[submodule], After: after})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
@@ -0,0 +1,414 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/logging"
+	"github.com/Jieay/git-watcher/internal/manifest"
+)
+
+// ErrNoRollbackTarget is returned when a rollback finds no earlier state to restore
+var ErrNoRollbackTarget = errors.New("nothing to roll back to")
+
+// ErrRollbackNotCommitted is returned when the submodules of a repository without auto commit
+// are rolled back: the rollback could not be committed, and the next check would restore the
+// commits recorded by the branch
+var ErrRollbackNotCommitted = errors.New("submodule rollback requires autoCommit")
+
+// rollbackPatch returns the patch restoring an earlier version of the key of patch on the
+// target branch, and the version it replaces. Without a version, the latest version the key
+// held before that is older than the current one is restored, so that repeated rollbacks
+// keep going back instead of returning to the version rolled back from.
+func (m *Manager) rollbackPatch(ctx context.Context, repoPath string, patch artifactsPatch, targetBranch, to string) (artifactsPatch, string, error) {
+	err := m.fetch(ctx, repoPath, FetchOptions{
+		Remote:      "origin",
+		RefSpecs:    []string{fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", targetBranch, targetBranch)},
+		Credentials: credentialsFor(m.artifactsRepo()),
+	})
+	if err != nil {
+		return patch, "", fmt.Errorf("git fetch of branch %s failed: %w", targetBranch, err)
+	}
+
+	key := strings.Join(patch.Path, ".")
+	rev := "origin/" + targetBranch
+	history, err := m.keyHistory(ctx, repoPath, rev, patch)
+	if err != nil {
+		return patch, "", err
+	}
+	if len(history) == 0 {
+		return patch, "", fmt.Errorf("%w: %s has no %s in %s", ErrNoRollbackTarget, targetBranch, key, patch.File)
+	}
+	current, earlier := history[0], history[1:]
+
+	target := to
+	switch {
+	case to == current:
+		return patch, "", fmt.Errorf("%w: %s is the current version of %s", ErrNoRollbackTarget, to, key)
+	case to != "":
+		if !slices.Contains(earlier, to) {
+			return patch, "", fmt.Errorf("%w: %s was never recorded for %s on %s", ErrNoRollbackTarget, to, key, targetBranch)
+		}
+	default:
+		target = olderVersion(patch, current, earlier)
+		if target == "" {
+			return patch, "", fmt.Errorf("%w: %s has no version of %s older than %s", ErrNoRollbackTarget, targetBranch, key, current)
+		}
+	}
+
+	patch.Value = target
+	patch.Release, _ = patch.Scheme.Parse(target)
+	patch.Force = true
+	logging.FromContext(ctx).Info("rolling back artifacts", "file", patch.File, "key", key, "from", current, "to", target)
+	return patch, current, nil
+}
+
+// keyHistory returns the distinct values the key of patch held at a revision and the commits
+// changing its file before, newest first
+func (m *Manager) keyHistory(ctx context.Context, repoPath, rev string, patch artifactsPatch) ([]string, error) {
+	writer, err := manifest.New(patch.Format)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := m.backend.Log(ctx, repoPath, LogOptions{Rev: rev, Paths: []string{patch.File}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history of %s: %w", patch.File, err)
+	}
+
+	revs := make([]string, 0, len(commits)+1)
+	revs = append(revs, rev)
+	for _, commit := range commits {
+		revs = append(revs, commit.Hash)
+	}
+	values := make([]string, 0)
+	for i, rev := range revs {
+		content, err := m.backend.ReadFile(ctx, repoPath, rev, patch.File)
+		if errors.Is(err, os.ErrNotExist) {
+			if i == 0 {
+				return nil, nil
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s at %s: %w", patch.File, rev, err)
+		}
+		value, ok, err := writer.Get(content, patch.Path)
+		if err != nil || !ok {
+			// The key did not exist yet, or the file could not be parsed at this commit
+			if i == 0 && err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", patch.File, err)
+			}
+			if i == 0 {
+				return nil, nil
+			}
+			continue
+		}
+		if !slices.Contains(values, value) {
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
+
+// olderVersion returns the first of the earlier values of a key that is older than the
+// current one by the version scheme of patch. Values that cannot be compared with the
+// current one are accepted as older.
+func olderVersion(patch artifactsPatch, current string, earlier []string) string {
+	currentRelease, err := patch.Scheme.Parse(current)
+	for _, value := range earlier {
+		if err == nil {
+			if release, err := patch.Scheme.Parse(value); err == nil && release.Comparable(currentRelease) && release.Compare(currentRelease) >= 0 {
+				continue
+			}
+		}
+		return value
+	}
+	return ""
+}
+
+// SubmoduleRollbackOptions selects what a submodule rollback restores
+type SubmoduleRollbackOptions struct {
+	// Commit whose submodule pointers are restored, by default the latest auto-commit of the
+	// watcher recording other submodule commits than the branch
+	Commit string
+	// Requester and reason, recorded in the hold of the branch
+	User   string
+	Reason string
+}
+
+// RollbackSubmodules resets the submodule pointers of a watched branch to the commits recorded
+// by an earlier commit of the branch, then commits and delivers them like a submodule update.
+// The submodules of the branch are then held, so that later checks do not move them forward
+// again, until ReleaseSubmodules is called. Repositories without auto commit are refused with
+// ErrRollbackNotCommitted.
+func (m *Manager) RollbackSubmodules(ctx context.Context, repoName, branch string, opts SubmoduleRollbackOptions) (result *BranchResult, err error) {
+	result = &BranchResult{Repository: repoName, Branch: branch}
+	started := time.Now()
+	var submoduleHeads map[string]string
+	m.beginBranchCheck(ctx, repoName, branch, started)
+	defer func() {
+		m.endBranchCheck(ctx, result, started, submoduleHeads, err)
+	}()
+
+	repo, err := m.Repository(repoName)
+	if err != nil {
+		return result, err
+	}
+	if !m.config.UseSubmodulesFor(repo) {
+		return result, fmt.Errorf("submodules are not enabled for repository %s", repoName)
+	}
+	if !m.config.AutoCommitFor(repo) {
+		return result, fmt.Errorf("%w: auto commit is disabled for repository %s", ErrRollbackNotCommitted, repoName)
+	}
+
+	branchLock := m.getFileLock(m.BranchPath(repo, branch))
+	branchLock.Lock()
+	defer branchLock.Unlock()
+
+	result.HeadBefore, err = m.GetBranchCommitHash(ctx, repo, branch)
+	if err != nil {
+		return result, err
+	}
+	if m.IsDryRun(ctx) {
+		result.HeadAfter = result.HeadBefore
+		result.Plan, result.RolledBackTo, err = m.planSubmoduleRollback(ctx, repo, branch, opts.Commit)
+		return result, err
+	}
+
+	repoPath, mainRepoUpdated, err := m.syncBranchWorktree(ctx, repo, branch)
+	if err != nil {
+		return result, fmt.Errorf("failed to check/update main repo %s branch %s: %w", repo.GetURL(), branch, err)
+	}
+	result.Updated = mainRepoUpdated
+	result.HeadAfter, _ = m.backend.RevParse(ctx, repoPath, "HEAD")
+
+	// Check out the recorded commits of the submodules, cloning the missing ones
+	updateCtx, cancel := context.WithTimeout(ctx, m.config.Timeouts.CloneTimeout())
+	err = m.backend.SubmoduleUpdate(updateCtx, repoPath, SubmoduleUpdateOptions{
+		Init:        true,
+		Recursive:   true,
+		Credentials: credentialsFor(repo),
+	})
+	cancel()
+	if err != nil {
+		return result, fmt.Errorf("git submodule update failed: %w", err)
+	}
+
+	target, changes, err := m.submoduleRollback(ctx, repoPath, branch, "HEAD", opts.Commit)
+	if err != nil {
+		return result, err
+	}
+	result.RolledBackTo = target
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		subCtx := logging.With(ctx, logging.KeySubmodule, change.Path)
+		if err := m.checkoutSubmoduleCommit(subCtx, repo, repoPath, change.Path, change.After); err != nil {
+			return result, err
+		}
+		paths = append(paths, change.Path)
+		logging.FromContext(subCtx).Info("rolled back submodule", "from", change.Before, "to", change.After)
+	}
+	submoduleHeads = m.submoduleHeads(ctx, repoPath)
+	result.Submodules = changes
+
+	message := func(details []string) string {
+		return submoduleRollbackMessage(repo, branch, target, details)
+	}
+	commit, push, err := m.commitSubmodules(ctx, repo, branch, repoPath, message, paths)
+	result.Commit, result.Push = commit, push
+	if err != nil {
+		return result, fmt.Errorf("failed to commit submodule rollback to main repository: %w", err)
+	}
+	if commit != "" && (push == nil || push.PullRequest == nil) {
+		result.HeadAfter = commit
+	}
+
+	// Hold the submodules while the branch is still locked, so that no later check undoes the rollback
+	err = m.holdSubmodules(&SubmoduleHold{
+		Repository: repoName,
+		Branch:     branch,
+		Commit:     target,
+		User:       opts.User,
+		Reason:     opts.Reason,
+		CreatedAt:  time.Now(),
+	})
+	return result, err
+}
+
+// planSubmoduleRollback plans a submodule rollback of a branch against the fetched remote
+// branch, like planBranch, and returns the restored commit
+func (m *Manager) planSubmoduleRollback(ctx context.Context, repo *config.Repository, branch, commit string) (*BranchPlan, string, error) {
+	basePath := m.basePath(repo)
+	worktreePath := m.BranchPath(repo, branch)
+	baseLock := m.getFileLock(basePath)
+	baseLock.Lock()
+	_, err := m.prepareBranchWorktree(ctx, repo, branch, basePath, worktreePath)
+	baseLock.Unlock()
+	if err != nil {
+		return nil, "", err
+	}
+
+	upstreamRef := "origin/" + branch
+	plan := &BranchPlan{}
+	plan.Upstream, err = m.backend.RevParse(ctx, worktreePath, upstreamRef)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve %s: %w", upstreamRef, err)
+	}
+	target, changes, err := m.submoduleRollback(ctx, worktreePath, branch, upstreamRef, commit)
+	if err != nil {
+		return nil, "", err
+	}
+	plan.Submodules = changes
+	paths := make([]string, 0, len(changes))
+	details := make([]string, 0, len(changes))
+	for _, change := range changes {
+		paths = append(paths, change.Path)
+		details = append(details, submoduleDetail(change.Path, change.After, ""))
+	}
+	m.planSubmoduleCommit(plan, repo, branch, paths, submoduleRollbackMessage(repo, branch, target, details))
+	return plan, target, nil
+}
+
+// submoduleRollback returns the commit whose submodule pointers a rollback restores and the
+// submodules it moves, compared with the pointers recorded by base. commit is resolved when
+// set, otherwise the auto-commits changing the submodules before base are searched.
+func (m *Manager) submoduleRollback(ctx context.Context, repoPath, branch, base, commit string) (string, []SubmoduleChange, error) {
+	data, err := m.backend.ReadFile(ctx, repoPath, base, ".gitmodules")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read .gitmodules: %w", err)
+	}
+	submodules, err := parseGitmodules(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse .gitmodules: %w", err)
+	}
+	paths := make([]string, 0, len(submodules))
+	for _, submodule := range submodules {
+		paths = append(paths, submodule.Path)
+	}
+	current := m.submodulePointers(ctx, repoPath, base, paths)
+
+	if commit != "" {
+		target, err := m.backend.RevParse(ctx, repoPath, commit)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: unknown commit %s: %v", ErrNoRollbackTarget, commit, err)
+		}
+		changes := pointerChanges(paths, current, m.submodulePointers(ctx, repoPath, target, paths))
+		if len(changes) == 0 {
+			return "", nil, fmt.Errorf("%w: the submodules of %s already match %s", ErrNoRollbackTarget, branch, shortHash(target))
+		}
+		return target, changes, nil
+	}
+
+	commits, err := m.backend.Log(ctx, repoPath, LogOptions{Rev: base, Paths: paths})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read history of the submodules: %w", err)
+	}
+	// Commits down to the one restored by a rollback are skipped, so that repeated rollbacks
+	// keep going back instead of returning to the state rolled back from
+	skipTo := ""
+	for _, c := range commits {
+		if skipTo != "" {
+			if c.Hash == skipTo {
+				skipTo = ""
+			}
+			continue
+		}
+		if restored, ok := restoredCommit(c.Message); ok {
+			skipTo = restored
+			continue
+		}
+		if !isSubmoduleAutoCommit(c.Message) {
+			continue
+		}
+		changes := pointerChanges(paths, current, m.submodulePointers(ctx, repoPath, c.Hash, paths))
+		if len(changes) > 0 {
+			logging.FromContext(ctx).Info("found auto-commit to roll back to", "commit", c.Hash, "date", c.Date)
+			return c.Hash, changes, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%w: no auto-commit of %s records other submodule commits", ErrNoRollbackTarget, branch)
+}
+
+// submodulePointers returns the commit a revision records for each of the given submodules
+// it contains
+func (m *Manager) submodulePointers(ctx context.Context, repoPath, rev string, paths []string) map[string]string {
+	pointers := make(map[string]string, len(paths))
+	for _, path := range paths {
+		if hash, err := m.backend.RevParse(ctx, repoPath, rev+":"+path); err == nil {
+			pointers[path] = hash
+		}
+	}
+	return pointers
+}
+
+// pointerChanges lists the submodules whose pointer differs between two states, in the order
+// of paths. Submodules missing from the target state are left alone.
+func pointerChanges(paths []string, current, target map[string]string) []SubmoduleChange {
+	changes := make([]SubmoduleChange, 0)
+	for _, path := range paths {
+		after, ok := target[path]
+		if !ok || after == current[path] {
+			continue
+		}
+		changes = append(changes, SubmoduleChange{Path: path, Before: current[path], After: after})
+	}
+	return changes
+}
+
+// checkoutSubmoduleCommit checks out a commit in a submodule, fetching the submodule first
+// when the commit is not available locally
+func (m *Manager) checkoutSubmoduleCommit(ctx context.Context, repo *config.Repository, repoPath, path, commit string) error {
+	submodulePath := filepath.Join(repoPath, path)
+	checkout := CheckoutOptions{Detach: true, StartPoint: commit}
+	if err := m.backend.Checkout(ctx, submodulePath, checkout); err == nil {
+		return nil
+	}
+	if err := m.fetch(ctx, submodulePath, FetchOptions{Remote: "origin", Credentials: credentialsFor(repo)}); err != nil {
+		return fmt.Errorf("git fetch of submodule %s failed: %w", path, err)
+	}
+	if err := m.backend.Checkout(ctx, submodulePath, checkout); err != nil {
+		return fmt.Errorf("git checkout of submodule %s at %s failed: %w", path, shortHash(commit), err)
+	}
+	return nil
+}
+
+// isSubmoduleAutoCommit reports whether a commit message was written by
+// submoduleCommitMessage
+func isSubmoduleAutoCommit(message string) bool {
+	return strings.Contains(message, "\nUpdated submodules:\n")
+}
+
+// restoredCommitPrefix starts the line of a submodule rollback commit message naming the
+// restored commit
+const restoredCommitPrefix = "Restored commit: "
+
+// restoredCommit returns the commit restored by a submodule rollback commit
+func restoredCommit(message string) (string, bool) {
+	for _, line := range strings.Split(message, "\n") {
+		if hash, ok := strings.CutPrefix(line, restoredCommitPrefix); ok {
+			return strings.TrimSpace(hash), true
+		}
+	}
+	return "", false
+}
+
+// submoduleRollbackMessage formats the message of a submodule rollback commit. It names the
+// restored commit and, unlike an auto-commit, lists the submodules as restored ones.
+func submoduleRollbackMessage(repo *config.Repository, branch, target string, details []string) string {
+	return fmt.Sprintf("Roll back submodules to %s [Git Watcher Rollback]\n\nRepository: %s\nBranch: %s\nTimestamp: %s\n%s%s\n\nRestored submodules:\n%s",
+		shortHash(target),
+		repo.GetName(),
+		branch,
+		time.Now().Format(time.RFC3339),
+		restoredCommitPrefix,
+		target,
+		strings.Join(details, "\n"))
+}
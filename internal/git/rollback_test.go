@@ -0,0 +1,110 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+// newSubmoduleRemote returns a remote recording the main branch of sub as its submodule sub
+func newSubmoduleRemote(t *testing.T, sub string) string {
+	t.Helper()
+	remote := newRemote(t, "app", map[string]string{"README": "app\n"})
+	dir := filepath.Join(t.TempDir(), "clone")
+	runGit(t, "", "clone", "-q", remote, dir)
+	runGit(t, dir, "submodule", "add", "-q", "-b", "main", sub, "sub")
+	runGit(t, dir, "commit", "-q", "-m", "Add submodule sub")
+	runGit(t, dir, "push", "-q", "origin", "main")
+	return remote
+}
+
+// newSubmoduleManager returns a manager watching the main branch of a remote with submodules
+func newSubmoduleManager(t *testing.T, remote string, autoCommit bool) (*Manager, *fakeBackend) {
+	t.Helper()
+	useSubmodules := true
+	return newTestManager(t, &config.GitConfig{
+		Branches: []string{"main"},
+		Repositories: []*config.Repository{{
+			Name:          "app",
+			URL:           remote,
+			Branch:        "main",
+			Directory:     "app",
+			UseSubmodules: &useSubmodules,
+			AutoCommit:    &autoCommit,
+		}},
+	})
+}
+
+func TestRollbackSubmodules(t *testing.T) {
+	sub := newRemote(t, "sub", map[string]string{"VERSION": "1\n"})
+	remote := newSubmoduleRemote(t, sub)
+	m, _ := newSubmoduleManager(t, remote, true)
+	ctx := context.Background()
+
+	check := func(t *testing.T) {
+		t.Helper()
+		if _, err := m.CheckAndUpdateRepoBranch(ctx, "app", "main"); err != nil {
+			t.Fatalf("CheckAndUpdateRepoBranch() error = %v", err)
+		}
+	}
+	pointer := func() string {
+		return runGit(t, remote, "rev-parse", "main:sub")
+	}
+
+	// Two releases of the submodule are recorded by automatic commits
+	check(t)
+	second := pushFiles(t, sub, "main", "Release 2", map[string]string{"VERSION": "2\n"})
+	check(t)
+	third := pushFiles(t, sub, "main", "Release 3", map[string]string{"VERSION": "3\n"})
+	check(t)
+	if got := pointer(); got != third {
+		t.Fatalf("submodule pointer = %s, want the update %s", got, third)
+	}
+
+	result, err := m.RollbackSubmodules(ctx, "app", "main", SubmoduleRollbackOptions{User: "ops"})
+	if err != nil {
+		t.Fatalf("RollbackSubmodules() error = %v", err)
+	}
+	if result.Commit == "" || len(result.Submodules) != 1 || result.Submodules[0].After != second {
+		t.Fatalf("result = %+v, want a commit restoring %s", result, second)
+	}
+	if got := pointer(); got != second {
+		t.Fatalf("submodule pointer = %s, want the rollback %s", got, second)
+	}
+
+	// The held rollback survives the next check although the submodule moved on
+	fourth := pushFiles(t, sub, "main", "Release 4", map[string]string{"VERSION": "4\n"})
+	check(t)
+	if got := pointer(); got != second {
+		t.Errorf("submodule pointer = %s after a check, want the held rollback %s", got, second)
+	}
+
+	// Released, the submodule follows its branch again
+	if _, err := m.ReleaseSubmodules("app", "main"); err != nil {
+		t.Fatal(err)
+	}
+	check(t)
+	if got := pointer(); got != fourth {
+		t.Errorf("submodule pointer = %s after the release, want %s", got, fourth)
+	}
+}
+
+func TestRollbackSubmodulesWithoutAutoCommit(t *testing.T) {
+	sub := newRemote(t, "sub", map[string]string{"VERSION": "1\n"})
+	remote := newSubmoduleRemote(t, sub)
+	m, backend := newSubmoduleManager(t, remote, false)
+
+	_, err := m.RollbackSubmodules(context.Background(), "app", "main", SubmoduleRollbackOptions{})
+	if !errors.Is(err, ErrRollbackNotCommitted) {
+		t.Fatalf("RollbackSubmodules() error = %v, want %v", err, ErrRollbackNotCommitted)
+	}
+	if len(m.SubmoduleHolds()) != 0 {
+		t.Errorf("holds = %v, want none", m.SubmoduleHolds())
+	}
+	if len(backend.calls) != 0 {
+		t.Errorf("calls = %q, want none", backend.calls)
+	}
+}
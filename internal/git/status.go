@@ -0,0 +1,140 @@
+package git
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Check states reported in CheckStatus
+const (
+	CheckRunning = "running"
+	CheckSuccess = "success"
+	CheckFailed  = "failed"
+)
+
+// CheckStatus describes the latest check of a branch
+type CheckStatus struct {
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Updated    bool       `json:"updated"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// BranchStatus is the sync state of a watched branch since the watcher started.
+// Published values are never modified, a check replaces them.
+type BranchStatus struct {
+	Repository string            `json:"repository"`
+	Branch     string            `json:"branch"`
+	Head       string            `json:"head,omitempty"`       // HEAD of the branch worktree after the last check
+	Submodules map[string]string `json:"submodules,omitempty"` // Commit checked out in each submodule
+	LastCheck  *CheckStatus      `json:"lastCheck,omitempty"`
+}
+
+// ArtifactsOperation is an artifacts repository update waiting for or holding the git operation lock
+type ArtifactsOperation struct {
+	Repository string     `json:"repository"`
+	Package    string     `json:"package"`
+	Version    string     `json:"version"`
+	QueuedAt   time.Time  `json:"queuedAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+}
+
+// branchKey identifies a branch of a watched repository in the status map
+func branchKey(repoName, branch string) string {
+	return repoName + "\x00" + branch
+}
+
+// BranchStatus returns the sync state of a branch; branches never checked only carry their name
+func (m *Manager) BranchStatus(repoName, branch string) *BranchStatus {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	if status, ok := m.branchStatus[branchKey(repoName, branch)]; ok {
+		return status
+	}
+	return &BranchStatus{Repository: repoName, Branch: branch}
+}
+
+// beginBranchCheck marks a branch check as running, keeping the last known heads. Dry runs are not shown.
+func (m *Manager) beginBranchCheck(ctx context.Context, repoName, branch string, started time.Time) {
+	if m.IsDryRun(ctx) {
+		return
+	}
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	status := &BranchStatus{
+		Repository: repoName,
+		Branch:     branch,
+		LastCheck:  &CheckStatus{Status: CheckRunning, StartedAt: started},
+	}
+	if previous, ok := m.branchStatus[branchKey(repoName, branch)]; ok {
+		status.Head, status.Submodules = previous.Head, previous.Submodules
+	}
+	m.branchStatus[branchKey(repoName, branch)] = status
+}
+
+// finishBranchCheck records the outcome of a branch check. Heads not determined by a failed check are kept.
+func (m *Manager) finishBranchCheck(result *BranchResult, started time.Time, submodules map[string]string) {
+	finished := time.Now()
+	check := &CheckStatus{
+		Status:     CheckSuccess,
+		StartedAt:  started,
+		FinishedAt: &finished,
+		Updated:    result.Updated,
+		Error:      result.Error,
+	}
+	if result.Error != "" {
+		check.Status = CheckFailed
+	}
+
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	key := branchKey(result.Repository, result.Branch)
+	status := &BranchStatus{Repository: result.Repository, Branch: result.Branch, Head: result.HeadAfter, Submodules: submodules, LastCheck: check}
+	if previous, ok := m.branchStatus[key]; ok {
+		if status.Head == "" {
+			status.Head = previous.Head
+		}
+		if status.Submodules == nil {
+			status.Submodules = previous.Submodules
+		}
+	}
+	m.branchStatus[key] = status
+}
+
+// PendingArtifacts returns the artifacts updates in progress or waiting, oldest first
+func (m *Manager) PendingArtifacts() []ArtifactsOperation {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	pending := make([]ArtifactsOperation, 0, len(m.pendingArtifacts))
+	for op := range m.pendingArtifacts {
+		pending = append(pending, *op)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].QueuedAt.Before(pending[j].QueuedAt) })
+	return pending
+}
+
+// queueArtifacts records an artifacts update waiting for the git operation lock
+func (m *Manager) queueArtifacts(repoName, pkgName, version string) *ArtifactsOperation {
+	op := &ArtifactsOperation{Repository: repoName, Package: pkgName, Version: version, QueuedAt: time.Now()}
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	m.pendingArtifacts[op] = struct{}{}
+	return op
+}
+
+// startArtifacts marks a queued artifacts update as holding the git operation lock
+func (m *Manager) startArtifacts(op *ArtifactsOperation) {
+	now := time.Now()
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	op.StartedAt = &now
+}
+
+// doneArtifacts removes a finished artifacts update
+func (m *Manager) doneArtifacts(op *ArtifactsOperation) {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	delete(m.pendingArtifacts, op)
+}
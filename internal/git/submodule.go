@@ -0,0 +1,274 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/logging"
+)
+
+// Submodule is a submodule declared in .gitmodules
+type Submodule struct {
+	Name   string
+	Path   string
+	URL    string
+	Branch string // Branch followed by "git submodule update --remote", empty for the remote HEAD
+}
+
+// SubmoduleTarget is a submodule of a branch of a watched repository
+type SubmoduleTarget struct {
+	Repository string `json:"repository"`
+	Branch     string `json:"branch"`
+	Path       string `json:"path"`
+}
+
+// readGitmodules parses the .gitmodules file of a working tree
+func readGitmodules(repoPath string) ([]Submodule, error) {
+	file, err := os.Open(filepath.Join(repoPath, ".gitmodules"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseGitmodules(file)
+}
+
+// parseGitmodules parses the content of a .gitmodules file
+func parseGitmodules(r io.Reader) ([]Submodule, error) {
+	var (
+		submodules []Submodule
+		current    *Submodule
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			current = nil
+			if name, ok := strings.CutPrefix(strings.TrimSuffix(line, "]"), "[submodule "); ok {
+				submodules = append(submodules, Submodule{Name: strings.Trim(name, `"`)})
+				current = &submodules[len(submodules)-1]
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || current == nil {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "path":
+			current.Path = value
+		case "url":
+			current.URL = value
+		case "branch":
+			current.Branch = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range submodules {
+		if submodules[i].Path == "" {
+			submodules[i].Path = submodules[i].Name
+		}
+	}
+	return submodules, nil
+}
+
+// resolveSubmoduleURL resolves a submodule URL relative to its superproject ("../lib.git")
+// against the URL of the superproject, as git does
+func resolveSubmoduleURL(superURL, subURL string) string {
+	if !strings.HasPrefix(subURL, "./") && !strings.HasPrefix(subURL, "../") {
+		return subURL
+	}
+
+	base := strings.TrimSuffix(superURL, "/")
+	rest := subURL
+	for {
+		if next, ok := strings.CutPrefix(rest, "./"); ok {
+			rest = next
+			continue
+		}
+		next, ok := strings.CutPrefix(rest, "../")
+		if !ok {
+			break
+		}
+		rest = next
+		if i := strings.LastIndexAny(base, "/:"); i >= 0 {
+			base = base[:i+1]
+			base = strings.TrimSuffix(base, "/")
+		}
+	}
+	if strings.HasSuffix(base, ":") {
+		return base + rest
+	}
+	return base + "/" + rest
+}
+
+// SubmodulesForURL returns the submodules of the watched branches whose URL refers to one of the
+// given remote URLs. Only branches that already have a worktree are considered and frozen
+// submodules are skipped. When pushedBranch is set, submodules following another branch or
+// following tags are skipped; when pushedTag is set, only submodules whose tag policy can
+// select the tag are returned.
+func (m *Manager) SubmodulesForURL(pushedBranch, pushedTag string, urls ...string) []SubmoduleTarget {
+	wanted := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		if normalized := NormalizeRemoteURL(u); normalized != "" {
+			wanted[normalized] = true
+		}
+	}
+
+	targets := make([]SubmoduleTarget, 0)
+	for _, repo := range m.Repositories() {
+		if !m.config.UseSubmodulesFor(repo) {
+			continue
+		}
+		for _, branch := range m.config.BranchesFor(repo) {
+			submodules, err := readGitmodules(m.BranchPath(repo, branch))
+			if err != nil {
+				continue
+			}
+			for _, submodule := range submodules {
+				if !wanted[NormalizeRemoteURL(resolveSubmoduleURL(repo.GetURL(), submodule.URL))] {
+					continue
+				}
+				policy := m.config.SubmodulePolicyFor(repo, branch, submodule.Path)
+				switch policy.GetTrack() {
+				case config.TrackFrozen:
+					continue
+				case config.TrackTag:
+					if pushedBranch != "" || (pushedTag != "" && !MatchPolicyTag(policy, pushedTag)) {
+						continue
+					}
+				default:
+					if pushedTag != "" {
+						continue
+					}
+					tracked := policy.Branch
+					if tracked == "" {
+						tracked = submodule.Branch
+					}
+					if tracked == "." {
+						tracked = branch
+					}
+					if pushedBranch != "" && tracked != "" && tracked != pushedBranch {
+						continue
+					}
+				}
+				targets = append(targets, SubmoduleTarget{Repository: repo.GetName(), Branch: branch, Path: submodule.Path})
+			}
+		}
+	}
+	return targets
+}
+
+// UpdateSubmodule moves a single submodule of a watched branch to the commit selected by its
+// policy, the latest commit of the branch it follows by default, and, with auto commit
+// enabled, commits and pushes the new pointer right away. The other submodules stay at the
+// commits recorded by the branch.
+func (m *Manager) UpdateSubmodule(ctx context.Context, repoName, branch, path string) (result *BranchResult, err error) {
+	result = &BranchResult{Repository: repoName, Branch: branch}
+	started := time.Now()
+	var submoduleHeads map[string]string
+	m.beginBranchCheck(ctx, repoName, branch, started)
+	defer func() {
+		m.endBranchCheck(ctx, result, started, submoduleHeads, err)
+	}()
+
+	repo, err := m.Repository(repoName)
+	if err != nil {
+		return result, err
+	}
+	if m.isFrozen(repo, branch, path) {
+		logging.FromContext(ctx).Info("submodule is frozen, skipping update")
+		return result, nil
+	}
+
+	branchLock := m.getFileLock(m.BranchPath(repo, branch))
+	branchLock.Lock()
+	defer branchLock.Unlock()
+
+	result.HeadBefore, err = m.GetBranchCommitHash(ctx, repo, branch)
+	if err != nil {
+		return result, err
+	}
+	if m.IsDryRun(ctx) {
+		result.HeadAfter = result.HeadBefore
+		result.Plan, err = m.planBranch(ctx, repo, branch, path)
+		return result, err
+	}
+
+	// Bring the branch up to date first so the pointer bump is committed on top of it
+	repoPath, mainRepoUpdated, err := m.syncBranchWorktree(ctx, repo, branch)
+	if err != nil {
+		return result, fmt.Errorf("failed to check/update main repo %s branch %s: %w", repo.GetURL(), branch, err)
+	}
+	result.Updated = mainRepoUpdated
+	result.HeadAfter, _ = m.backend.RevParse(ctx, repoPath, "HEAD")
+	before, _ := m.backend.RevParse(ctx, repoPath, "HEAD:"+path)
+
+	// Check out the recorded commits of the other submodules, which a rebase may have moved
+	if mainRepoUpdated {
+		updateCtx, cancel := context.WithTimeout(ctx, m.config.Timeouts.CloneTimeout())
+		err := m.backend.SubmoduleUpdate(updateCtx, repoPath, SubmoduleUpdateOptions{
+			Init:        true,
+			Recursive:   true,
+			Credentials: credentialsFor(repo),
+		})
+		cancel()
+		if err != nil {
+			return result, fmt.Errorf("git submodule update failed: %w", err)
+		}
+	}
+
+	updateCtx, cancel := context.WithTimeout(ctx, m.config.Timeouts.FetchTimeout())
+	err = m.backend.SubmoduleUpdate(updateCtx, repoPath, SubmoduleUpdateOptions{
+		Init:        true,
+		Remote:      true,
+		Recursive:   true,
+		Paths:       []string{path},
+		Credentials: credentialsFor(repo),
+	})
+	cancel()
+	if err != nil {
+		return result, fmt.Errorf("failed to update submodule %s: %w", path, err)
+	}
+	version, err := m.applySubmodulePolicy(ctx, repo, branch, repoPath, path)
+	if err != nil {
+		return result, fmt.Errorf("failed to apply policy of submodule %s: %w", path, err)
+	}
+
+	submoduleHeads = m.submoduleHeads(ctx, repoPath)
+	after, err := m.backend.RevParse(ctx, filepath.Join(repoPath, path), "HEAD")
+	if err != nil {
+		return result, fmt.Errorf("failed to get submodule commit: %w", err)
+	}
+	if after == before {
+		logging.FromContext(ctx).Info("submodule is up to date", "commit", after)
+		return result, nil
+	}
+	result.Submodules = []SubmoduleChange{{Path: path, Before: before, After: after, Version: version}}
+	logging.FromContext(ctx).Info("updated submodule", "from", before, "to", after, "version", version)
+
+	if m.config.AutoCommitFor(repo) {
+		commit, push, err := m.commitSubmoduleChangesToMainRepo(ctx, repo, branch, repoPath, path)
+		result.Commit, result.Push = commit, push
+		if err != nil {
+			return result, fmt.Errorf("failed to commit submodule changes to main repository: %w", err)
+		}
+		if commit != "" && (push == nil || push.PullRequest == nil) {
+			result.HeadAfter = commit
+		}
+	}
+	return result, nil
+}
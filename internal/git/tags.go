@@ -0,0 +1,126 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/logging"
+)
+
+// tagsRefSpec fetches all tags of a remote, moving tags that were re-created
+const tagsRefSpec = "+refs/tags/*:refs/tags/*"
+
+// tagStatePath returns the file recording the tags of a repository already seen by CheckTags
+func (m *Manager) tagStatePath(repo config.RepositoryInterface) string {
+	return filepath.Join(m.config.WorkingDir, repo.GetDirectory()+"-tags.json")
+}
+
+// MatchTag reports whether a tag name matches one of the patterns
+func MatchTag(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// newestTag returns the most recent tag matching one of the patterns, by date and then by name
+func newestTag(tags []Tag, patterns []string) (Tag, bool) {
+	var (
+		newest Tag
+		found  bool
+	)
+	for _, tag := range tags {
+		if !MatchTag(patterns, tag.Name) {
+			continue
+		}
+		if !found || tag.Date.After(newest.Date) || (tag.Date.Equal(newest.Date) && tag.Name > newest.Name) {
+			newest, found = tag, true
+		}
+	}
+	return newest, found
+}
+
+// CheckTags fetches the tags of a watched repository and returns the tags matching its tag
+// patterns that were not seen by a previous check, oldest first. The first check of a
+// repository only records the existing tags, so no notification is sent for them.
+func (m *Manager) CheckTags(ctx context.Context, repo *config.Repository) ([]Tag, error) {
+	if len(repo.Tags) == 0 {
+		return nil, nil
+	}
+
+	basePath := m.basePath(repo)
+	baseLock := m.getFileLock(basePath)
+	baseLock.Lock()
+	defer baseLock.Unlock()
+
+	if _, err := os.Stat(basePath); os.IsNotExist(err) {
+		if err := m.cloneRepo(ctx, repo); err != nil {
+			return nil, err
+		}
+	}
+
+	err := m.fetch(ctx, basePath, FetchOptions{
+		Remote:      "origin",
+		RefSpecs:    []string{tagsRefSpec},
+		Credentials: credentialsFor(repo),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("git fetch of tags failed: %w", err)
+	}
+
+	tags, err := m.backend.Tags(ctx, basePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	statePath := m.tagStatePath(repo)
+	seen := make(map[string]string)
+	data, err := os.ReadFile(statePath)
+	firstCheck := os.IsNotExist(err)
+	if err != nil && !firstCheck {
+		return nil, fmt.Errorf("failed to read tag state: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &seen); err != nil {
+			return nil, fmt.Errorf("failed to parse tag state %s: %w", statePath, err)
+		}
+	}
+
+	newTags := make([]Tag, 0)
+	current := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		if !MatchTag(repo.Tags, tag.Name) {
+			continue
+		}
+		current[tag.Name] = tag.Commit
+		if _, ok := seen[tag.Name]; !ok && !firstCheck {
+			newTags = append(newTags, tag)
+		}
+	}
+	sort.SliceStable(newTags, func(i, j int) bool {
+		return newTags[i].Date.Before(newTags[j].Date)
+	})
+
+	data, err = json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tag state: %w", err)
+	}
+	if err := os.WriteFile(statePath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write tag state: %w", err)
+	}
+
+	if firstCheck {
+		logging.FromContext(ctx).Info("recorded existing tags", "count", len(current))
+	} else if len(newTags) > 0 {
+		logging.FromContext(ctx).Info("found new tags", "count", len(newTags))
+	}
+	return newTags, nil
+}
@@ -0,0 +1,173 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/logging"
+)
+
+// worktreesDirSuffix is appended to a repository directory to hold its branch worktrees
+const worktreesDirSuffix = "-worktrees"
+
+// basePath returns the directory of the shared clone backing all branch worktrees of a repository
+func (m *Manager) basePath(repo config.RepositoryInterface) string {
+	return filepath.Join(m.config.WorkingDir, repo.GetDirectory())
+}
+
+// BranchPath returns the working tree directory of a branch of a watched repository
+func (m *Manager) BranchPath(repo *config.Repository, branch string) string {
+	return filepath.Join(m.config.WorkingDir, repo.GetDirectory()+worktreesDirSuffix, url.PathEscape(branch))
+}
+
+// GetBranchCommitHash returns the HEAD commit hash of a branch worktree
+func (m *Manager) GetBranchCommitHash(ctx context.Context, repo *config.Repository, branch string) (string, error) {
+	worktreePath := m.BranchPath(repo, branch)
+	if _, err := os.Stat(worktreePath); os.IsNotExist(err) {
+		return "", errors.New("branch worktree does not exist")
+	}
+
+	hash, err := m.backend.RevParse(ctx, worktreePath, "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to get last commit hash: %w", err)
+	}
+
+	return hash, nil
+}
+
+// syncBranchWorktree fetches a branch and brings its worktree up to date.
+// Returns the worktree path and true if the worktree was created or received new commits.
+func (m *Manager) syncBranchWorktree(ctx context.Context, repo *config.Repository, branch string) (string, bool, error) {
+	basePath := m.basePath(repo)
+	worktreePath := m.BranchPath(repo, branch)
+
+	// fetch 和 worktree 元数据都写入共享克隆，需要串行执行
+	baseLock := m.getFileLock(basePath)
+	baseLock.Lock()
+	created, err := m.prepareBranchWorktree(ctx, repo, branch, basePath, worktreePath)
+	baseLock.Unlock()
+	if err != nil {
+		return "", false, err
+	}
+	if created {
+		return worktreePath, true, nil
+	}
+
+	hasNewCommits, err := m.hasNewCommits(ctx, worktreePath, branch)
+	if err != nil {
+		return "", false, err
+	}
+	if !hasNewCommits {
+		return worktreePath, false, nil
+	}
+
+	if err := m.backend.Rebase(ctx, worktreePath, "origin/"+branch); err != nil {
+		return "", false, fmt.Errorf("git rebase failed: %w", err)
+	}
+
+	logging.FromContext(ctx).Info("updated branch worktree", "path", worktreePath)
+	return worktreePath, true, nil
+}
+
+// prepareBranchWorktree clones the shared repository if needed, fetches the branch
+// and adds its worktree. Returns true if the worktree was newly created.
+func (m *Manager) prepareBranchWorktree(ctx context.Context, repo *config.Repository, branch, basePath, worktreePath string) (bool, error) {
+	if _, err := os.Stat(basePath); os.IsNotExist(err) {
+		if err := m.cloneRepo(ctx, repo); err != nil {
+			return false, err
+		}
+	}
+
+	// Fetch updates for the branch into the remote-tracking ref. Existing worktrees fetch
+	// in place, which for linked worktrees updates the refs shared with the base clone.
+	fetchOptions := FetchOptions{
+		Remote:      "origin",
+		RefSpecs:    []string{fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", branch, branch)},
+		Credentials: credentialsFor(repo),
+	}
+	if _, err := os.Stat(worktreePath); err == nil {
+		if err := m.fetch(ctx, worktreePath, fetchOptions); err != nil {
+			return false, fmt.Errorf("git fetch failed: %w", err)
+		}
+		return false, nil
+	}
+	if err := m.fetch(ctx, basePath, fetchOptions); err != nil {
+		return false, fmt.Errorf("git fetch failed: %w", err)
+	}
+
+	// Drop metadata of worktrees whose directories were removed
+	if err := m.backend.WorktreePrune(ctx, basePath); err != nil {
+		return false, fmt.Errorf("git worktree prune failed: %w", err)
+	}
+
+	// The shared clone must not hold the branch, otherwise the worktree cannot check it out
+	if err := m.backend.Checkout(ctx, basePath, CheckoutOptions{Detach: true}); err != nil {
+		return false, fmt.Errorf("git checkout --detach failed: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(worktreePath), 0755); err != nil {
+		return false, fmt.Errorf("failed to create worktrees directory: %w", err)
+	}
+
+	// Backends without linked worktrees clone the branch, so the clone timeout applies
+	addCtx, cancel := context.WithTimeout(ctx, m.config.Timeouts.CloneTimeout())
+	defer cancel()
+	err := m.backend.WorktreeAdd(addCtx, basePath, worktreePath, WorktreeAddOptions{
+		Branch:      branch,
+		StartPoint:  "origin/" + branch,
+		Credentials: credentialsFor(repo),
+	})
+	if err != nil {
+		// Remove a partially created worktree so the next check recreates it
+		os.RemoveAll(worktreePath)
+		return false, fmt.Errorf("git worktree add failed: %w", err)
+	}
+
+	logging.FromContext(ctx).Info("created branch worktree", "path", worktreePath)
+	return true, nil
+}
+
+// hasNewCommits checks if a branch worktree is behind its fetched remote-tracking branch
+func (m *Manager) hasNewCommits(ctx context.Context, worktreePath, branch string) (bool, error) {
+	count, err := m.backend.CountCommits(ctx, worktreePath, "HEAD", "origin/"+branch)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for new commits: %w", err)
+	}
+	return count > 0, nil
+}
+
+// RemoveBranchWorktree removes the worktree of a branch that was deleted from the remote,
+// so the branch is checked out from scratch if it is created again. Returns false if the
+// branch had no worktree.
+func (m *Manager) RemoveBranchWorktree(ctx context.Context, repo *config.Repository, branch string) (bool, error) {
+	worktreePath := m.BranchPath(repo, branch)
+	branchLock := m.getFileLock(worktreePath)
+	branchLock.Lock()
+	defer branchLock.Unlock()
+
+	if _, err := os.Stat(worktreePath); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	basePath := m.basePath(repo)
+	baseLock := m.getFileLock(basePath)
+	baseLock.Lock()
+	defer baseLock.Unlock()
+
+	if err := os.RemoveAll(worktreePath); err != nil {
+		return false, fmt.Errorf("failed to remove branch worktree: %w", err)
+	}
+	if _, err := os.Stat(basePath); err == nil {
+		if err := m.backend.WorktreePrune(ctx, basePath); err != nil {
+			return true, fmt.Errorf("git worktree prune failed: %w", err)
+		}
+	}
+
+	logging.FromContext(ctx).Info("removed branch worktree", "path", worktreePath)
+	return true, nil
+}
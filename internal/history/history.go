@@ -0,0 +1,267 @@
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Jieay/git-watcher/internal/git"
+)
+
+// Trigger identifies what started a run
+type Trigger string
+
+// Run triggers
+const (
+	TriggerSchedule  Trigger = "schedule"  // Periodic check of the scheduler
+	TriggerWebhook   Trigger = "trigger"   // POST /webhook/trigger
+	TriggerArtifacts Trigger = "artifacts" // POST /webhook/artifacts
+	TriggerGitHub    Trigger = "github"    // POST /webhook/github
+	TriggerGitLab    Trigger = "gitlab"    // POST /webhook/gitlab
+	TriggerGitea     Trigger = "gitea"     // POST /webhook/gitea
+	TriggerPromote   Trigger = "promote"   // Promotion of an artifact version to an environment
+	TriggerRollback  Trigger = "rollback"  // POST /rollback/artifacts and /rollback/submodules
+)
+
+// Status is the state of a run
+type Status string
+
+// Run statuses
+const (
+	StatusRunning Status = "running"
+	StatusSuccess Status = "success"
+	StatusFailed  Status = "failed"
+)
+
+// DefaultMaxRuns is the number of runs kept when no limit is configured
+const DefaultMaxRuns = 1000
+
+// ErrNotFound is returned when a run does not exist
+var ErrNotFound = errors.New("run not found")
+
+var runsBucket = []byte("runs")
+
+// Run is one recorded execution of the watcher
+type Run struct {
+	ID         uint64               `json:"id"`
+	Trigger    Trigger              `json:"trigger"`
+	Repository string               `json:"repository,omitempty"`
+	Status     Status               `json:"status"`
+	DryRun     bool                 `json:"dryRun,omitempty"` // Changes were only planned
+	StartedAt  time.Time            `json:"startedAt"`
+	FinishedAt *time.Time           `json:"finishedAt,omitempty"`
+	Branches   []*git.BranchResult  `json:"branches,omitempty"`
+	Artifacts  *git.ArtifactsResult `json:"artifacts,omitempty"`
+	Error      string               `json:"error,omitempty"`
+
+	mu sync.Mutex
+}
+
+// NewRun creates a running run for the given trigger and repository
+func NewRun(trigger Trigger, repository string) *Run {
+	return &Run{
+		Trigger:    trigger,
+		Repository: repository,
+		Status:     StatusRunning,
+		StartedAt:  time.Now(),
+	}
+}
+
+// AddBranch records the result of a branch check. It is safe for concurrent use.
+func (r *Run) AddBranch(result *git.BranchResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Branches = append(r.Branches, result)
+}
+
+// Finish marks the run as finished. The run failed if err is set or any branch failed.
+func (r *Run) Finish(err error) {
+	now := time.Now()
+	r.FinishedAt = &now
+	r.Status = StatusSuccess
+	if err != nil {
+		r.Status = StatusFailed
+		r.Error = err.Error()
+	}
+	for _, branch := range r.Branches {
+		if branch.Error != "" {
+			r.Status = StatusFailed
+		}
+	}
+}
+
+// Filter selects runs returned by List
+type Filter struct {
+	Repository string
+	Trigger    Trigger
+	Status     Status
+	Before     uint64 // Only runs with a lower ID, for paging
+	Limit      int
+}
+
+// matches reports whether a run is selected by the filter
+func (f Filter) matches(run *Run) bool {
+	return (f.Repository == "" || run.Repository == f.Repository) &&
+		(f.Trigger == "" || run.Trigger == f.Trigger) &&
+		(f.Status == "" || run.Status == f.Status)
+}
+
+// Store persists runs in an embedded bbolt database
+type Store struct {
+	db      *bolt.DB
+	maxRuns int
+}
+
+// Open opens or creates the run history database at path, keeping at most maxRuns runs
+func Open(path string, maxRuns int) (*Store, error) {
+	if maxRuns <= 0 {
+		maxRuns = DefaultMaxRuns
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{runsBucket, promotionsBucket, holdsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize history database: %w", err)
+	}
+
+	return &Store{db: db, maxRuns: maxRuns}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Begin assigns an ID to a new run and stores it, dropping the oldest runs beyond the limit
+func (s *Store) Begin(run *Run) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.insertRun(tx.Bucket(runsBucket), run)
+	})
+}
+
+// Save stores the current state of a run started with Begin. A run without an ID, whose
+// Begin failed, is stored as a new run instead of overwriting another one
+func (s *Store) Save(run *Run) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(runsBucket)
+		if run.ID == 0 {
+			return s.insertRun(bucket, run)
+		}
+		return putRun(bucket, run)
+	})
+}
+
+// insertRun assigns the next ID to a run and stores it, dropping the oldest runs beyond the limit
+func (s *Store) insertRun(bucket *bolt.Bucket, run *Run) error {
+	id, err := bucket.NextSequence()
+	if err != nil {
+		return fmt.Errorf("failed to allocate run id: %w", err)
+	}
+	run.ID = id
+	if err := putRun(bucket, run); err != nil {
+		return err
+	}
+
+	// IDs are sequential, so runs older than the newest maxRuns have an ID up to ID-maxRuns
+	if run.ID <= uint64(s.maxRuns) {
+		return nil
+	}
+	oldest := run.ID - uint64(s.maxRuns)
+	cursor := bucket.Cursor()
+	for k, _ := cursor.First(); k != nil && binary.BigEndian.Uint64(k) <= oldest; k, _ = cursor.First() {
+		if err := cursor.Delete(); err != nil {
+			return fmt.Errorf("failed to prune run history: %w", err)
+		}
+	}
+	return nil
+}
+
+// Get returns the run with the given ID
+func (s *Store) Get(id uint64) (*Run, error) {
+	var run *Run
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(runsBucket).Get(itob(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		run = &Run{}
+		return json.Unmarshal(data, run)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// List returns the runs selected by the filter, newest first
+func (s *Store) List(filter Filter) ([]*Run, error) {
+	runs := make([]*Run, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(runsBucket).Cursor()
+		k, v := cursor.Last()
+		if filter.Before > 0 {
+			k, v = cursor.Seek(itob(filter.Before))
+			if k == nil {
+				k, v = cursor.Last()
+			} else {
+				k, v = cursor.Prev()
+			}
+		}
+
+		for ; k != nil; k, v = cursor.Prev() {
+			run := &Run{}
+			if err := json.Unmarshal(v, run); err != nil {
+				return fmt.Errorf("failed to decode run %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			if !filter.matches(run) {
+				continue
+			}
+			runs = append(runs, run)
+			if filter.Limit > 0 && len(runs) >= filter.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// putRun encodes a run under its ID
+func putRun(bucket *bolt.Bucket, run *Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+	return bucket.Put(itob(run.ID), data)
+}
+
+// itob encodes an ID as a big endian key so runs sort by ID
+func itob(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
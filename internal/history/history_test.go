@@ -0,0 +1,140 @@
+package history
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// openStore opens a store in a temporary directory, keeping at most maxRuns runs
+func openStore(t *testing.T, maxRuns int) *Store {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "history", "runs.db"), maxRuns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// ids returns the IDs of runs
+func ids(runs []*Run) []uint64 {
+	ids := make([]uint64, 0, len(runs))
+	for _, run := range runs {
+		ids = append(ids, run.ID)
+	}
+	return ids
+}
+
+func TestBeginPrunesOldRuns(t *testing.T) {
+	store := openStore(t, 3)
+	for i := 0; i < 5; i++ {
+		if err := store.Begin(NewRun(TriggerSchedule, "app")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := store.List(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(runs), []uint64{5, 4, 3}; !slices.Equal(got, want) {
+		t.Errorf("runs = %v, want %v", got, want)
+	}
+	if _, err := store.Get(2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(2) error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestSave(t *testing.T) {
+	store := openStore(t, 0)
+	run := NewRun(TriggerWebhook, "app")
+	if err := store.Begin(run); err != nil {
+		t.Fatal(err)
+	}
+	run.Finish(errors.New("clone failed"))
+	if err := store.Save(run); err != nil {
+		t.Fatal(err)
+	}
+
+	// A run whose Begin failed gets the next ID instead of overwriting another run
+	unsaved := NewRun(TriggerSchedule, "lib")
+	unsaved.Finish(nil)
+	if err := store.Save(unsaved); err != nil {
+		t.Fatal(err)
+	}
+	if unsaved.ID != 2 {
+		t.Errorf("ID = %d, want 2", unsaved.ID)
+	}
+
+	saved, err := store.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != StatusFailed || saved.Error != "clone failed" || saved.Repository != "app" {
+		t.Errorf("run 1 = %+v, want the failed run of app", saved)
+	}
+	saved, err = store.Get(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != StatusSuccess || saved.Repository != "lib" {
+		t.Errorf("run 2 = %+v, want the run of lib", saved)
+	}
+}
+
+func TestList(t *testing.T) {
+	store := openStore(t, 0)
+	for _, run := range []struct {
+		trigger    Trigger
+		repository string
+		err        error
+	}{
+		{TriggerSchedule, "app", nil},                  // 1
+		{TriggerWebhook, "lib", nil},                   // 2
+		{TriggerSchedule, "app", errors.New("failed")}, // 3
+		{TriggerGitHub, "app", nil},                    // 4
+		{TriggerSchedule, "lib", errors.New("failed")}, // 5
+		{TriggerSchedule, "app", nil},                  // 6
+	} {
+		r := NewRun(run.trigger, run.repository)
+		if err := store.Begin(r); err != nil {
+			t.Fatal(err)
+		}
+		r.Finish(run.err)
+		if err := store.Save(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []uint64
+	}{
+		{"all", Filter{}, []uint64{6, 5, 4, 3, 2, 1}},
+		{"limit", Filter{Limit: 2}, []uint64{6, 5}},
+		{"next page", Filter{Before: 5, Limit: 2}, []uint64{4, 3}},
+		{"last page", Filter{Before: 3, Limit: 2}, []uint64{2, 1}},
+		{"before the first run", Filter{Before: 1}, []uint64{}},
+		{"before a future run", Filter{Before: 100, Limit: 1}, []uint64{6}},
+		{"repository", Filter{Repository: "app"}, []uint64{6, 4, 3, 1}},
+		{"trigger", Filter{Trigger: TriggerSchedule}, []uint64{6, 5, 3, 1}},
+		{"status", Filter{Status: StatusFailed}, []uint64{5, 3}},
+		{"combined", Filter{Repository: "app", Trigger: TriggerSchedule, Status: StatusSuccess}, []uint64{6, 1}},
+		{"filtered page", Filter{Repository: "app", Before: 4, Limit: 1}, []uint64{3}},
+		{"no match", Filter{Repository: "other"}, []uint64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, err := store.List(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(runs); !slices.Equal(got, tt.want) {
+				t.Errorf("List(%+v) = %v, want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
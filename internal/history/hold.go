@@ -0,0 +1,54 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Jieay/git-watcher/internal/git"
+)
+
+var holdsBucket = []byte("submoduleHolds")
+
+// holdKey returns the key of the hold of a branch
+func holdKey(repository, branch string) []byte {
+	return []byte(repository + "\x00" + branch)
+}
+
+// SubmoduleHolds implements git.HoldStore
+func (s *Store) SubmoduleHolds() ([]*git.SubmoduleHold, error) {
+	holds := make([]*git.SubmoduleHold, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(holdsBucket).ForEach(func(k, v []byte) error {
+			hold := &git.SubmoduleHold{}
+			if err := json.Unmarshal(v, hold); err != nil {
+				return fmt.Errorf("failed to decode submodule hold %q: %w", k, err)
+			}
+			holds = append(holds, hold)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+// SaveSubmoduleHold implements git.HoldStore
+func (s *Store) SaveSubmoduleHold(hold *git.SubmoduleHold) error {
+	data, err := json.Marshal(hold)
+	if err != nil {
+		return fmt.Errorf("failed to encode submodule hold: %w", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(holdsBucket).Put(holdKey(hold.Repository, hold.Branch), data)
+	})
+}
+
+// DeleteSubmoduleHold implements git.HoldStore
+func (s *Store) DeleteSubmoduleHold(repository, branch string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(holdsBucket).Delete(holdKey(repository, branch))
+	})
+}
@@ -0,0 +1,215 @@
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Jieay/git-watcher/internal/git"
+)
+
+// PromotionStatus is the state of a promotion
+type PromotionStatus string
+
+// Promotion statuses
+const (
+	PromotionPending  PromotionStatus = "pending"  // Waiting for approval
+	PromotionRunning  PromotionStatus = "running"  // Being written to the target environment
+	PromotionRejected PromotionStatus = "rejected" // Refused by an approver
+	PromotionPromoted PromotionStatus = "promoted" // The version reached the target environment
+	PromotionFailed   PromotionStatus = "failed"
+)
+
+var (
+	// ErrPromotionNotFound is returned when a promotion does not exist
+	ErrPromotionNotFound = errors.New("promotion not found")
+	// ErrPromotionDecided is returned when a promotion that is not pending is approved or rejected
+	ErrPromotionDecided = errors.New("promotion is not pending")
+)
+
+var promotionsBucket = []byte("promotions")
+
+// Promotion records a request to copy a package version from one environment of the
+// artifacts repository to the next, who approved it and what it did
+type Promotion struct {
+	ID          uint64          `json:"id"`
+	Repository  string          `json:"repository"` // Artifact repository name
+	Package     string          `json:"package"`
+	Version     string          `json:"version"`
+	From        string          `json:"from"` // Source environment
+	To          string          `json:"to"`   // Target environment
+	Status      PromotionStatus `json:"status"`
+	Force       bool            `json:"force,omitempty"` // Replace a newer version of the target environment
+	RequestedBy string          `json:"requestedBy,omitempty"`
+	RequestedAt time.Time       `json:"requestedAt"`
+	Comment     string          `json:"comment,omitempty"`   // Reason given by the requester
+	DecidedBy   string          `json:"decidedBy,omitempty"` // User who approved or rejected the promotion
+	DecidedAt   *time.Time      `json:"decidedAt,omitempty"`
+	Reason      string          `json:"reason,omitempty"` // Comment of the approval or rejection
+	RunID       uint64          `json:"runId,omitempty"`  // Run writing the version to the target environment
+	Commit      string          `json:"commit,omitempty"`
+	FinishedAt  *time.Time      `json:"finishedAt,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Artifact    git.Artifact    `json:"artifact"` // Artifact of the request, used by the templates of manifest rules
+}
+
+// NewPromotion creates a promotion of an artifact version between two environments
+func NewPromotion(artifact git.Artifact, from, to string, status PromotionStatus) *Promotion {
+	return &Promotion{
+		Repository:  artifact.ArtifactRepoName,
+		Package:     artifact.ArtifactPkgName,
+		Version:     artifact.ArtifactVersionName,
+		From:        from,
+		To:          to,
+		Status:      status,
+		RequestedAt: time.Now(),
+		Artifact:    artifact,
+	}
+}
+
+// Finish records the outcome of writing the version to the target environment. A dry run
+// only planned the update: the promotion stays pending and its approval is discarded.
+func (p *Promotion) Finish(result *git.ArtifactsResult, err error) {
+	if err == nil && result != nil && result.Plan != nil {
+		p.Status = PromotionPending
+		p.DecidedBy, p.DecidedAt, p.Reason = "", nil, ""
+		return
+	}
+	now := time.Now()
+	p.FinishedAt = &now
+	p.Status = PromotionPromoted
+	if result != nil {
+		p.Commit = result.Commit
+	}
+	if err != nil {
+		p.Status = PromotionFailed
+		p.Error = err.Error()
+	}
+}
+
+// PromotionFilter selects promotions returned by ListPromotions
+type PromotionFilter struct {
+	Repository string
+	Package    string
+	Status     PromotionStatus
+	Limit      int
+}
+
+// matches reports whether a promotion is selected by the filter
+func (f PromotionFilter) matches(p *Promotion) bool {
+	return (f.Repository == "" || p.Repository == f.Repository) &&
+		(f.Package == "" || p.Package == f.Package) &&
+		(f.Status == "" || p.Status == f.Status)
+}
+
+// CreatePromotion assigns an ID to a new promotion and stores it. Promotions are kept as an
+// audit trail and are not pruned.
+func (s *Store) CreatePromotion(p *Promotion) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(promotionsBucket)
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return fmt.Errorf("failed to allocate promotion id: %w", err)
+		}
+		p.ID = id
+		return putPromotion(bucket, p)
+	})
+}
+
+// SavePromotion stores the current state of a promotion
+func (s *Store) SavePromotion(p *Promotion) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putPromotion(tx.Bucket(promotionsBucket), p)
+	})
+}
+
+// DecidePromotion approves or rejects a pending promotion: decide updates the promotion and
+// the result is stored, unless decide returns an error. Concurrent decisions of the same
+// promotion are serialized, so only the first one finds it pending.
+func (s *Store) DecidePromotion(id uint64, decide func(*Promotion) error) (*Promotion, error) {
+	var p *Promotion
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(promotionsBucket)
+		var err error
+		if p, err = getPromotion(bucket, id); err != nil {
+			return err
+		}
+		if p.Status != PromotionPending {
+			return fmt.Errorf("%w: promotion %d is %s", ErrPromotionDecided, id, p.Status)
+		}
+		if err := decide(p); err != nil {
+			return err
+		}
+		return putPromotion(bucket, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetPromotion returns the promotion with the given ID
+func (s *Store) GetPromotion(id uint64) (*Promotion, error) {
+	var p *Promotion
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		p, err = getPromotion(tx.Bucket(promotionsBucket), id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ListPromotions returns the promotions selected by the filter, newest first
+func (s *Store) ListPromotions(filter PromotionFilter) ([]*Promotion, error) {
+	promotions := make([]*Promotion, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(promotionsBucket).Cursor()
+		for k, v := cursor.Last(); k != nil; k, v = cursor.Prev() {
+			p := &Promotion{}
+			if err := json.Unmarshal(v, p); err != nil {
+				return fmt.Errorf("failed to decode promotion %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			if !filter.matches(p) {
+				continue
+			}
+			promotions = append(promotions, p)
+			if filter.Limit > 0 && len(promotions) >= filter.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
+
+// getPromotion decodes the promotion with an ID
+func getPromotion(bucket *bolt.Bucket, id uint64) (*Promotion, error) {
+	data := bucket.Get(itob(id))
+	if data == nil {
+		return nil, ErrPromotionNotFound
+	}
+	p := &Promotion{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to decode promotion %d: %w", id, err)
+	}
+	return p, nil
+}
+
+// putPromotion encodes a promotion under its ID
+func putPromotion(bucket *bolt.Bucket, p *Promotion) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to encode promotion: %w", err)
+	}
+	return bucket.Put(itob(p.ID), data)
+}
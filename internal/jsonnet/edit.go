@@ -0,0 +1,262 @@
+package jsonnet
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultIndent indents new objects and the fields of documents without indented fields
+const defaultIndent = "  "
+
+// edit replaces the source between start and end with text
+type edit struct {
+	start, end int
+	text       string
+}
+
+// Set sets the field at path of the object a document evaluates to to a string value and
+// returns the new document. Only the literal of the field is replaced; when the field or one
+// of the objects on the path does not exist it is inserted after the last member of the
+// nearest existing object, indented and quoted like its siblings. Comments, formatting and
+// the other fields of the document are left as they are. An empty document is created as
+// an object holding the path. changed is false when the field already has the value.
+//
+// The document and the objects on the path must be object literals, optionally preceded by
+// local bindings, and an existing field must be a string, number, boolean or null literal.
+func Set(src []byte, path []string, value string) (content []byte, changed bool, err error) {
+	if len(path) == 0 {
+		return nil, false, fmt.Errorf("empty field path")
+	}
+	if len(bytes.TrimSpace(src)) == 0 {
+		return []byte("{\n" + defaultIndent + newField(path, value, defaultIndent, defaultIndent, true, styleDouble) + "\n}\n"), true, nil
+	}
+
+	root, p, err := parse(src)
+	if err != nil {
+		return nil, false, err
+	}
+	n := unwrapLocals(root)
+	if n.kind != nodeObject {
+		return nil, false, fmt.Errorf("the document is not an object literal")
+	}
+
+	obj, inline := n.object, false
+	for i, key := range path {
+		f := obj.lookup(key)
+		if f == nil {
+			return applyEdits(src, insertField(src, p, obj, inline, path[i:], value)), true, nil
+		}
+		v := unwrapLocals(f.value)
+		if i == len(path)-1 {
+			return replaceValue(src, v, path, value)
+		}
+		if v.kind != nodeObject {
+			return nil, false, fmt.Errorf("field %s is not an object literal", strings.Join(path[:i+1], "."))
+		}
+		inline = !obj.multiline(src)
+		obj = v.object
+	}
+	return src, false, nil
+}
+
+// Get returns the value of the field at path of the object a document evaluates to: the
+// value of a string literal or the text of a number, boolean or null literal. ok is false
+// when the document is empty or the field does not exist or is not a literal.
+func Get(src []byte, path []string) (value string, ok bool, err error) {
+	if len(bytes.TrimSpace(src)) == 0 {
+		return "", false, nil
+	}
+	root, _, err := parse(src)
+	if err != nil {
+		return "", false, err
+	}
+	n := unwrapLocals(root)
+	for _, key := range path {
+		if n.kind != nodeObject {
+			return "", false, nil
+		}
+		f := n.object.lookup(key)
+		if f == nil {
+			return "", false, nil
+		}
+		n = unwrapLocals(f.value)
+	}
+	switch n.kind {
+	case nodeString:
+		value, err := decodeString(n.token)
+		return value, err == nil, err
+	case nodeLiteral:
+		return string(src[n.start:n.end]), true, nil
+	}
+	return "", false, nil
+}
+
+// unwrapLocals returns the body of an expression preceded by local bindings
+func unwrapLocals(n *node) *node {
+	for n.kind == nodeLocal {
+		n = n.body
+	}
+	return n
+}
+
+// lookup returns the field of an object with a name, nil when there is none
+func (o *object) lookup(name string) *field {
+	for _, f := range o.fields {
+		if f.static && f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// replaceValue replaces the literal value of a field
+func replaceValue(src []byte, v *node, path []string, value string) ([]byte, bool, error) {
+	style := styleDouble
+	switch v.kind {
+	case nodeString:
+		current, err := decodeString(v.token)
+		if err != nil {
+			return nil, false, err
+		}
+		if current == value {
+			return src, false, nil
+		}
+		style = v.token.style
+	case nodeLiteral:
+	default:
+		return nil, false, fmt.Errorf("field %s is not a literal and cannot be updated", strings.Join(path, "."))
+	}
+	return applyEdits(src, []edit{{start: v.start, end: v.end, text: quoteString(value, style)}}), true, nil
+}
+
+// multiline reports whether an object literal spans multiple lines
+func (o *object) multiline(src []byte) bool {
+	return bytes.IndexByte(src[o.open:o.close], '\n') >= 0
+}
+
+// insertField returns the edits inserting the field at path, holding objects for all but the
+// last key, into an object. inline tells whether the object is the value of a field of an
+// object written on a single line.
+func insertField(src []byte, p *parser, obj *object, inline bool, path []string, value string) []edit {
+	// Quote names like the siblings, or like the rest of the document for objects without
+	// fields, and strings like the first string of the document
+	quoted := true
+	siblings := obj.fields
+	if len(siblings) == 0 {
+		siblings = p.fields
+	}
+	for _, f := range siblings {
+		if f.static {
+			quoted = f.quoted
+			break
+		}
+	}
+	style := styleDouble
+	if p.quote != nil && (*p.quote == styleSingle || *p.quote == styleVerbatimSingle) {
+		style = styleSingle
+	}
+
+	braceIndent := lineIndent(src, obj.open)
+	multiline := obj.multiline(src)
+
+	if obj.lastEnd == obj.open+1 && inline {
+		// Object without members in an object written on a single line: {} becomes { b: 2 }
+		return []edit{{start: obj.open + 1, end: obj.close, text: " " + newField(path, value, "", "", quoted, style) + " "}}
+	}
+	if obj.lastEnd == obj.open+1 {
+		// Object without members, {} is written on multiple lines
+		indent := braceIndent + defaultIndent
+		text := "\n" + indent + newField(path, value, indent, defaultIndent, quoted, style)
+		if !multiline {
+			text += "\n" + braceIndent
+		}
+		return []edit{{start: obj.open + 1, end: obj.open + 1, text: text}}
+	}
+
+	if !multiline {
+		// Inline object: { a: 1 } becomes { a: 1, b: 2 }
+		text := newField(path, value, "", "", quoted, style)
+		if obj.trailingComma {
+			return []edit{{start: obj.commaEnd, end: obj.commaEnd, text: " " + text + ","}}
+		}
+		return []edit{{start: obj.lastEnd, end: obj.lastEnd, text: ", " + text}}
+	}
+
+	indent := braceIndent + defaultIndent
+	if lineStart(src, obj.lastStart) > obj.open {
+		indent = lineIndent(src, obj.lastStart)
+	}
+	unit := defaultIndent
+	if len(indent) > len(braceIndent) && strings.HasPrefix(indent, braceIndent) {
+		unit = indent[len(braceIndent):]
+	}
+
+	pos := obj.lastEnd
+	if obj.trailingComma {
+		pos = obj.commaEnd
+	}
+	// Keep a comment at the end of the line of the last member on that line
+	if rest := skipBlanks(src, pos); rest < len(src) && (src[rest] == '#' || hasPrefixAt(src, rest, "//")) {
+		for pos = rest; pos < len(src) && src[pos] != '\n'; {
+			pos++
+		}
+	}
+	text := "\n" + indent + newField(path, value, indent, unit, quoted, style)
+	if obj.trailingComma {
+		return []edit{{start: pos, end: pos, text: text + ","}}
+	}
+	// The comma goes right after the last member, before a comment following it
+	return []edit{{start: obj.lastEnd, end: obj.lastEnd, text: ","}, {start: pos, end: pos, text: text}}
+}
+
+// newField returns the source of a field holding the path. Nested objects are written on
+// multiple lines indented by unit, or inline when unit is empty.
+func newField(path []string, value, indent, unit string, quoted bool, style stringStyle) string {
+	name := path[0]
+	if quoted || !IsIdentifier(name) {
+		name = quoteString(name, style)
+	}
+	if len(path) == 1 {
+		return name + ": " + quoteString(value, style)
+	}
+	if unit == "" {
+		return name + ": { " + newField(path[1:], value, "", "", quoted, style) + " }"
+	}
+	inner := indent + unit
+	return name + ": {\n" + inner + newField(path[1:], value, inner, unit, quoted, style) + "\n" + indent + "}"
+}
+
+// skipBlanks returns the offset of the first character at or after i that is not a space or tab
+func skipBlanks(src []byte, i int) int {
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// lineStart returns the offset of the first character of the line holding offset
+func lineStart(src []byte, offset int) int {
+	return bytes.LastIndexByte(src[:offset], '\n') + 1
+}
+
+// lineIndent returns the white space starting the line holding offset
+func lineIndent(src []byte, offset int) string {
+	start := lineStart(src, offset)
+	return string(src[start:skipBlanks(src, start)])
+}
+
+// applyEdits applies edits to a copy of src. Text inserted at the same offset is kept in the
+// order of the edits.
+func applyEdits(src []byte, edits []edit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+	content := append([]byte(nil), src...)
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		content = append(content[:e.start], append([]byte(e.text), content[e.end:]...)...)
+	}
+	return content
+}
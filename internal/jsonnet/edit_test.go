@@ -0,0 +1,235 @@
+package jsonnet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		path    string
+		want    string
+		changed bool
+		err     string
+	}{
+		{
+			name:    "empty document",
+			src:     "",
+			path:    "app.pkg",
+			want:    "{\n  \"app\": {\n    \"pkg\": \"2.0\"\n  }\n}\n",
+			changed: true,
+		},
+		{
+			name:    "string keeps its quotes",
+			src:     "{\n  app: {\n    pkg: '1.0',\n  },\n}\n",
+			path:    "app.pkg",
+			want:    "{\n  app: {\n    pkg: '2.0',\n  },\n}\n",
+			changed: true,
+		},
+		{
+			name: "unchanged",
+			src:  "{\n  app: {\n    pkg: '2.0',\n  },\n}\n",
+			path: "app.pkg",
+			want: "{\n  app: {\n    pkg: '2.0',\n  },\n}\n",
+		},
+		{
+			name:    "number",
+			src:     "{\n  app: {\n    pkg: 2,\n  },\n}\n",
+			path:    "app.pkg",
+			want:    "{\n  app: {\n    pkg: \"2.0\",\n  },\n}\n",
+			changed: true,
+		},
+		{
+			name:    "locals before the document",
+			src:     "local base = import 'base.libsonnet';\nlocal v = '1';\n{\n  app: {\n    pkg: '1.0',\n  },\n}\n",
+			path:    "app.pkg",
+			want:    "local base = import 'base.libsonnet';\nlocal v = '1';\n{\n  app: {\n    pkg: '2.0',\n  },\n}\n",
+			changed: true,
+		},
+		{
+			name:    "local members",
+			src:     "{\n  local v = '1',\n  app: {\n    local w = v,\n    pkg: '1.0',\n  },\n}\n",
+			path:    "app.pkg",
+			want:    "{\n  local v = '1',\n  app: {\n    local w = v,\n    pkg: '2.0',\n  },\n}\n",
+			changed: true,
+		},
+		{
+			name: "value bound to a local",
+			src:  "local v = '1';\n{\n  app: {\n    pkg: v,\n  },\n}\n",
+			path: "app.pkg",
+			err:  "field app.pkg is not a literal",
+		},
+		{
+			name:    "hidden field",
+			src:     "{\n  app:: {\n    pkg::: '1.0',\n  },\n}\n",
+			path:    "app.pkg",
+			want:    "{\n  app:: {\n    pkg::: '2.0',\n  },\n}\n",
+			changed: true,
+		},
+		{
+			name: "object merged into an import",
+			src:  "(import 'base.libsonnet') + {\n  app+: {\n    pkg+:: '1.0',\n  },\n}\n",
+			path: "app.pkg",
+			err:  "the document is not an object literal",
+		},
+		{
+			name:    "object merged with +:",
+			src:     "{\n  app+: {\n    pkg: '1.0',\n  },\n}\n",
+			path:    "app.pkg",
+			want:    "{\n  app+: {\n    pkg: '2.0',\n  },\n}\n",
+			changed: true,
+		},
+		{
+			name:    "computed key of a string",
+			src:     "{\n  ['app']: {\n    [\"pkg-1\"]: '1.0',\n  },\n}\n",
+			path:    "app.pkg-1",
+			want:    "{\n  ['app']: {\n    [\"pkg-1\"]: '2.0',\n  },\n}\n",
+			changed: true,
+		},
+		{
+			name:    "computed key of an expression",
+			src:     "{\n  app: {\n    [k]: '1.0',\n    other: '1.0',\n  },\n}\n",
+			path:    "app.pkg",
+			want:    "{\n  app: {\n    [k]: '1.0',\n    other: '1.0',\n    pkg: '2.0',\n  },\n}\n",
+			changed: true,
+		},
+		{
+			name:    "text block before the field",
+			src:     "{\n  app: {\n    notes: |||\n      pkg: '0.1', } {\n    |||,\n    pkg: '1.0',\n  },\n}\n",
+			path:    "app.pkg",
+			want:    "{\n  app: {\n    notes: |||\n      pkg: '0.1', } {\n    |||,\n    pkg: '2.0',\n  },\n}\n",
+			changed: true,
+		},
+		{
+			name:    "new field after a text block",
+			src:     "{\n  app: {\n    notes: |||\n      hi\n    |||,\n  },\n}\n",
+			path:    "app.pkg",
+			want:    "{\n  app: {\n    notes: |||\n      hi\n    |||,\n    pkg: \"2.0\",\n  },\n}\n",
+			changed: true,
+		},
+		{
+			name:    "trailing comment",
+			src:     "{\n  app: {\n    pkg: '1.0', // current\n  },\n}\n",
+			path:    "app.pkg",
+			want:    "{\n  app: {\n    pkg: '2.0', // current\n  },\n}\n",
+			changed: true,
+		},
+		{
+			name:    "new field after a trailing comment",
+			src:     "{\n  app: {\n    pkg: '1.0',  // current\n  },\n}\n",
+			path:    "app.other",
+			want:    "{\n  app: {\n    pkg: '1.0',  // current\n    other: '2.0',\n  },\n}\n",
+			changed: true,
+		},
+		{
+			name:    "new field after a trailing comment without comma",
+			src:     "{\n  app: {\n    pkg: '1.0'  # current\n  },\n}\n",
+			path:    "app.other",
+			want:    "{\n  app: {\n    pkg: '1.0',  # current\n    other: '2.0'\n  },\n}\n",
+			changed: true,
+		},
+		{
+			name:    "new field without trailing comma",
+			src:     "{\n  app: {\n    pkg: '1.0'\n  }\n}\n",
+			path:    "app.other",
+			want:    "{\n  app: {\n    pkg: '1.0',\n    other: '2.0'\n  }\n}\n",
+			changed: true,
+		},
+		{
+			name:    "new field of an inline object with trailing comma",
+			src:     "{ app: { pkg: '1.0', } }\n",
+			path:    "app.other",
+			want:    "{ app: { pkg: '1.0', other: '2.0', } }\n",
+			changed: true,
+		},
+		{
+			name:    "new object quoted like its siblings",
+			src:     "{\n  \"app\": {\n    \"pkg\": \"1.0\",\n  },\n}\n",
+			path:    "new.pkg",
+			want:    "{\n  \"app\": {\n    \"pkg\": \"1.0\",\n  },\n  \"new\": {\n    \"pkg\": \"2.0\"\n  },\n}\n",
+			changed: true,
+		},
+		{
+			name: "value of a call",
+			src:  "{\n  app: {\n    pkg: std.toString(1),\n  },\n}\n",
+			path: "app.pkg",
+			err:  "field app.pkg is not a literal",
+		},
+		{
+			name: "field that is not an object",
+			src:  "{\n  app: 'x',\n}\n",
+			path: "app.pkg",
+			err:  "field app is not an object literal",
+		},
+		{
+			name: "syntax error",
+			src:  "{\n  app: {\n    pkg: '1.0',\n\n}\n",
+			path: "app.pkg",
+			err:  "jsonnet syntax error at line 6",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := Set([]byte(tt.src), strings.Split(tt.path, "."), "2.0")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Set() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			if string(got) != tt.want || changed != tt.changed {
+				t.Errorf("Set() = %q, %v, want %q, %v", got, changed, tt.want, tt.changed)
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		path  string
+		value string
+		ok    bool
+		err   string
+	}{
+		{name: "empty document", src: "", path: "app.pkg"},
+		{name: "string", src: "{ app: { pkg: '1.0' } }", path: "app.pkg", value: "1.0", ok: true},
+		{name: "escaped string", src: `{ app: { pkg: "a\"b" } }`, path: "app.pkg", value: `a"b`, ok: true},
+		{name: "number", src: "{ app: { pkg: 12 } }", path: "app.pkg", value: "12", ok: true},
+		{name: "missing field", src: "{ app: { pkg: '1.0' } }", path: "app.other"},
+		{name: "locals", src: "local v = '1';\n{ local w = v, app: { pkg: '1.0' } }", path: "app.pkg", value: "1.0", ok: true},
+		{name: "value bound to a local", src: "local v = '1';\n{ app: { pkg: v } }", path: "app.pkg"},
+		{name: "hidden fields", src: "{ app:: { pkg::: '1.0' } }", path: "app.pkg", value: "1.0", ok: true},
+		{name: "merged field", src: "{ app+: { pkg+: '1.0' } }", path: "app.pkg", value: "1.0", ok: true},
+		{name: "computed key of a string", src: "{ ['app']: { pkg: '1.0' } }", path: "app.pkg", value: "1.0", ok: true},
+		{name: "computed key of an expression", src: "{ app: { [k]: '1.0' } }", path: "app.k"},
+		{name: "text block", src: "{\n  notes: |||\n    hi\n  |||,\n}\n", path: "notes", value: "hi\n", ok: true},
+		{name: "trailing comment", src: "{\n  pkg: '1.0', // current\n}\n", path: "pkg", value: "1.0", ok: true},
+		{name: "trailing comma", src: "{ app: { pkg: '1.0', }, }", path: "app.pkg", value: "1.0", ok: true},
+		{name: "field of a string", src: "{ app: 'x' }", path: "app.pkg"},
+		{name: "syntax error", src: "{ app: ", path: "app", err: "jsonnet syntax error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok, err := Get([]byte(tt.src), strings.Split(tt.path, "."))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Get() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if value != tt.value || ok != tt.ok {
+				t.Errorf("Get() = %q, %v, want %q, %v", value, ok, tt.value, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package jsonnet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoEvaluator is returned by Evaluate when the evaluator command is not installed
+var ErrNoEvaluator = errors.New("jsonnet evaluator not found")
+
+// Evaluate evaluates a Jsonnet file with an evaluator command, such as "jsonnet" or
+// "jrsonnet --max-stack 500", and returns its JSON output. Imports are resolved relative to
+// the directory of the file.
+func Evaluate(ctx context.Context, command, file string) ([]byte, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, ErrNoEvaluator
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoEvaluator, args[0])
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], "-J", filepath.Dir(file), file)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("failed to evaluate %s: %s", filepath.Base(file), msg)
+		}
+		return nil, fmt.Errorf("failed to evaluate %s: %w", filepath.Base(file), err)
+	}
+	return output, nil
+}
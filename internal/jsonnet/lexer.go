@@ -0,0 +1,385 @@
+// Package jsonnet edits Jsonnet documents in place: a field of the object a document
+// evaluates to is changed without touching the comments, formatting and other fields of the
+// document. It parses the full Jsonnet syntax but does not evaluate it; Evaluate runs an
+// external evaluator for that.
+package jsonnet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tokenKind is the kind of a lexical token
+type tokenKind int
+
+const (
+	tokenEOF      tokenKind = iota
+	tokenIdent              // Identifier
+	tokenKeyword            // Reserved word, such as local or function
+	tokenNumber             // Number literal
+	tokenString             // String literal of any style
+	tokenOperator           // Run of operator characters, such as "+", "==" or "+:"
+	tokenSymbol             // One of { } [ ] ( ) , . ; $
+)
+
+// stringStyle is the quoting style of a string literal
+type stringStyle int
+
+const (
+	styleDouble         stringStyle = iota // "text"
+	styleSingle                            // 'text'
+	styleVerbatimDouble                    // @"text"
+	styleVerbatimSingle                    // @'text'
+	styleTextBlock                         // |||
+)
+
+// token is a lexical token and its position in the source
+type token struct {
+	kind  tokenKind
+	text  string // Source text of the token
+	start int    // Byte offset of the first character
+	end   int    // Byte offset after the last character
+	style stringStyle
+}
+
+var keywords = map[string]bool{
+	"assert": true, "else": true, "error": true, "false": true, "for": true, "function": true,
+	"if": true, "import": true, "importstr": true, "importbin": true, "in": true, "local": true,
+	"null": true, "self": true, "super": true, "tailstrict": true, "then": true, "true": true,
+}
+
+// operatorChars are the characters operators are made of
+const operatorChars = "!:~+-&|^=<>*/%"
+
+// SyntaxError is an error in the source of a Jsonnet document
+type SyntaxError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("jsonnet syntax error at line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// syntaxError returns a SyntaxError at a byte offset of src
+func syntaxError(src []byte, offset int, format string, args ...interface{}) error {
+	line, column := 1, 1
+	for _, c := range string(src[:min(offset, len(src))]) {
+		if c == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+	}
+	return &SyntaxError{Line: line, Column: column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// lex splits a Jsonnet document into tokens, skipping white space and comments
+func lex(src []byte) ([]token, error) {
+	var tokens []token
+	i := 0
+	for {
+		i = skipSpace(src, i)
+		if i < len(src) && (src[i] == '#' || hasPrefixAt(src, i, "//")) {
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		}
+		if hasPrefixAt(src, i, "/*") {
+			end := strings.Index(string(src[i+2:]), "*/")
+			if end < 0 {
+				return nil, syntaxError(src, i, "unterminated comment")
+			}
+			i += end + 4
+			continue
+		}
+		if i >= len(src) {
+			return append(tokens, token{kind: tokenEOF, start: i, end: i}), nil
+		}
+
+		start := i
+		c := src[i]
+		var t token
+		switch {
+		case isIdentStart(c):
+			for i < len(src) && isIdentChar(src[i]) {
+				i++
+			}
+			t = token{kind: tokenIdent}
+			if keywords[string(src[start:i])] {
+				t.kind = tokenKeyword
+			}
+		case c >= '0' && c <= '9':
+			i = lexNumber(src, i)
+			t = token{kind: tokenNumber}
+		case c == '"' || c == '\'':
+			end, err := lexQuoted(src, i+1, c, false)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			t = token{kind: tokenString, style: styleDouble}
+			if c == '\'' {
+				t.style = styleSingle
+			}
+		case c == '@' && i+1 < len(src) && (src[i+1] == '"' || src[i+1] == '\''):
+			end, err := lexQuoted(src, i+2, src[i+1], true)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			t = token{kind: tokenString, style: styleVerbatimDouble}
+			if src[i-1] == '\'' {
+				t.style = styleVerbatimSingle
+			}
+		case hasPrefixAt(src, i, "|||"):
+			end, err := lexTextBlock(src, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			t = token{kind: tokenString, style: styleTextBlock}
+		case strings.IndexByte("{}[](),.;$", c) >= 0:
+			i++
+			t = token{kind: tokenSymbol}
+		case strings.IndexByte(operatorChars, c) >= 0:
+			for i < len(src) && strings.IndexByte(operatorChars, src[i]) >= 0 {
+				if i > start && (hasPrefixAt(src, i, "//") || hasPrefixAt(src, i, "/*") || hasPrefixAt(src, i, "|||")) {
+					break
+				}
+				i++
+			}
+			// Unary operators following another operator are tokens of their own, as in "x:-1"
+			for i-start > 1 && strings.IndexByte("+-~!", src[i-1]) >= 0 {
+				i--
+			}
+			t = token{kind: tokenOperator}
+		default:
+			return nil, syntaxError(src, i, "unexpected character %q", rune(c))
+		}
+		t.start, t.end, t.text = start, i, string(src[start:i])
+		tokens = append(tokens, t)
+	}
+}
+
+// skipSpace returns the offset of the first character at or after i that is not white space
+func skipSpace(src []byte, i int) int {
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t' || src[i] == '\n' || src[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+func hasPrefixAt(src []byte, i int, prefix string) bool {
+	return i <= len(src) && strings.HasPrefix(string(src[i:]), prefix)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+// IsIdentifier reports whether s can be used as a field name without quotes
+func IsIdentifier(s string) bool {
+	if s == "" || !isIdentStart(s[0]) || keywords[s] {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isIdentChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// lexNumber returns the end of the number starting at i
+func lexNumber(src []byte, i int) int {
+	digits := func() {
+		for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+			i++
+		}
+	}
+	digits()
+	if i+1 < len(src) && src[i] == '.' && src[i+1] >= '0' && src[i+1] <= '9' {
+		i++
+		digits()
+	}
+	if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+		j := i + 1
+		if j < len(src) && (src[j] == '+' || src[j] == '-') {
+			j++
+		}
+		if j < len(src) && src[j] >= '0' && src[j] <= '9' {
+			i = j
+			digits()
+		}
+	}
+	return i
+}
+
+// lexQuoted returns the end of the quoted string whose content starts at i
+func lexQuoted(src []byte, i int, quote byte, verbatim bool) (int, error) {
+	start := i - 1
+	for i < len(src) {
+		switch {
+		case src[i] == quote && verbatim && i+1 < len(src) && src[i+1] == quote:
+			i += 2
+		case src[i] == quote:
+			return i + 1, nil
+		case src[i] == '\\' && !verbatim:
+			i += 2
+		default:
+			i++
+		}
+	}
+	return 0, syntaxError(src, start, "unterminated string")
+}
+
+// lexTextBlock returns the end of the text block starting at i
+func lexTextBlock(src []byte, i int) (int, error) {
+	start := i
+	i += 3
+	if i < len(src) && src[i] == '-' {
+		i++
+	}
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t' || src[i] == '\r') {
+		i++
+	}
+	if i >= len(src) || src[i] != '\n' {
+		return 0, syntaxError(src, start, "text block requires a new line after |||")
+	}
+	i++
+	for i < len(src) {
+		lineEnd := i
+		for lineEnd < len(src) && src[lineEnd] != '\n' {
+			lineEnd++
+		}
+		line := string(src[i:lineEnd])
+		if trimmed := strings.TrimLeft(line, " \t"); strings.HasPrefix(trimmed, "|||") {
+			return i + len(line) - len(trimmed) + 3, nil
+		}
+		i = lineEnd + 1
+	}
+	return 0, syntaxError(src, start, "unterminated text block")
+}
+
+// decodeString returns the value of a string literal token
+func decodeString(t token) (string, error) {
+	text := t.text
+	switch t.style {
+	case styleVerbatimDouble:
+		return strings.ReplaceAll(text[2:len(text)-1], `""`, `"`), nil
+	case styleVerbatimSingle:
+		return strings.ReplaceAll(text[2:len(text)-1], `''`, `'`), nil
+	case styleTextBlock:
+		return decodeTextBlock(text), nil
+	}
+
+	body := text[1 : len(text)-1]
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' {
+			b.WriteByte(body[i])
+			continue
+		}
+		i++
+		if i >= len(body) {
+			return "", fmt.Errorf("invalid escape at the end of %s", text)
+		}
+		switch body[i] {
+		case '"', '\'', '\\', '/':
+			b.WriteByte(body[i])
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			if i+5 > len(body) {
+				return "", fmt.Errorf("invalid unicode escape in %s", text)
+			}
+			n, err := strconv.ParseUint(body[i+1:i+5], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid unicode escape in %s", text)
+			}
+			b.WriteRune(rune(n))
+			i += 4
+		default:
+			return "", fmt.Errorf("invalid escape \\%c in %s", body[i], text)
+		}
+	}
+	return b.String(), nil
+}
+
+// decodeTextBlock returns the value of a ||| text block: its lines without the indentation
+// of the first line, ending with a new line unless the block starts with |||-
+func decodeTextBlock(text string) string {
+	chomp := strings.HasPrefix(text, "|||-")
+	lines := strings.Split(text[strings.IndexByte(text, '\n')+1:], "\n")
+	lines = lines[:len(lines)-1] // The line closing the block
+	indent := ""
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			break
+		}
+	}
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(strings.TrimPrefix(line, indent))
+		b.WriteByte('\n')
+	}
+	value := b.String()
+	if chomp {
+		value = strings.TrimSuffix(value, "\n")
+	}
+	return value
+}
+
+// quoteString returns a string literal for value in the given style. Text blocks are
+// replaced by double quoted strings.
+func quoteString(value string, style stringStyle) string {
+	switch style {
+	case styleVerbatimDouble:
+		return `@"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+	case styleVerbatimSingle:
+		return `@'` + strings.ReplaceAll(value, `'`, `''`) + `'`
+	}
+
+	quote := byte('"')
+	if style == styleSingle {
+		quote = '\''
+	}
+	var b strings.Builder
+	b.WriteByte(quote)
+	for _, r := range value {
+		switch {
+		case r == rune(quote) || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte(quote)
+	return b.String()
+}
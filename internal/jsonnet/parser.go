@@ -0,0 +1,548 @@
+package jsonnet
+
+// nodeKind is the kind of an expression the editor cares about
+type nodeKind int
+
+const (
+	nodeOther   nodeKind = iota
+	nodeObject           // Object literal
+	nodeString           // String literal
+	nodeLiteral          // Number, true, false or null
+	nodeLocal            // local binds; body
+)
+
+// node is a parsed expression and its position in the source
+type node struct {
+	kind   nodeKind
+	start  int
+	end    int
+	token  token   // Literal of nodeString and nodeLiteral
+	object *object // Object of nodeObject
+	body   *node   // Body of nodeLocal
+}
+
+// object is an object literal
+type object struct {
+	open          int // Offset of {
+	close         int // Offset of }
+	fields        []*field
+	lastStart     int  // Start of the last member, local and assert members included
+	lastEnd       int  // End of the last member
+	trailingComma bool // Whether the last member is followed by a comma
+	commaEnd      int  // End of the trailing comma
+}
+
+// field is a field of an object literal
+type field struct {
+	name   string // Name of the field, empty for computed names
+	static bool   // Whether the name is an identifier or a string literal, in brackets or not
+	quoted bool   // Whether the name is a string literal
+	style  stringStyle
+	start  int // Offset of the name
+	value  *node
+}
+
+// binaryOperators are the binary operators of Jsonnet, "in" aside
+var binaryOperators = map[string]bool{
+	"*": true, "/": true, "%": true, "+": true, "-": true, "<<": true, ">>": true,
+	"<": true, "<=": true, ">": true, ">=": true, "==": true, "!=": true,
+	"&": true, "^": true, "|": true, "&&": true, "||": true,
+}
+
+// fieldOperators separate the name and the value of an object field
+var fieldOperators = map[string]bool{":": true, "::": true, ":::": true, "+:": true, "+::": true, "+:::": true}
+
+// parser is a recursive descent parser of Jsonnet. It only records what the editor needs and
+// ignores operator precedence, which does not change the extent of the expressions it records.
+type parser struct {
+	src    []byte
+	tokens []token
+	pos    int
+	fields []*field     // All fields of the document, in source order
+	quote  *stringStyle // Style of the first string literal of the document
+}
+
+// parse parses a Jsonnet document
+func parse(src []byte) (*node, *parser, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := &parser{src: src, tokens: tokens}
+	root, err := p.expr()
+	if err != nil {
+		return nil, nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, nil, p.unexpected(t)
+	}
+	return root, p, nil
+}
+
+// Validate checks the syntax of a Jsonnet document
+func Validate(src []byte) error {
+	_, _, err := parse(src)
+	return err
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(n int) token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is reports whether the next token is the given symbol, operator or keyword
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokenSymbol || t.kind == tokenOperator || t.kind == tokenKeyword) && t.text == text
+}
+
+func (p *parser) expect(text string) (token, error) {
+	if !p.is(text) {
+		return token{}, p.unexpected(p.peek())
+	}
+	return p.next(), nil
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokenEOF {
+		return syntaxError(p.src, t.start, "unexpected end of document")
+	}
+	return syntaxError(p.src, t.start, "unexpected %q", t.text)
+}
+
+// sawString records the style of the first string literal of the document
+func (p *parser) sawString(t token) {
+	if p.quote == nil {
+		p.quote = &t.style
+	}
+}
+
+// expr parses an expression
+func (p *parser) expr() (*node, error) {
+	n, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !(t.kind == tokenOperator && binaryOperators[t.text]) && !p.is("in") {
+			return n, nil
+		}
+		p.next()
+		if t.text == "in" && p.is("super") {
+			n = &node{start: n.start, end: p.next().end}
+			continue
+		}
+		rhs, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		n = &node{start: n.start, end: rhs.end}
+	}
+}
+
+// unary parses an expression with optional unary operators
+func (p *parser) unary() (*node, error) {
+	t := p.peek()
+	if t.kind == tokenOperator && (t.text == "-" || t.text == "+" || t.text == "!" || t.text == "~") {
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &node{start: t.start, end: operand.end}, nil
+	}
+	n, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	return p.postfix(n)
+}
+
+// postfix parses field access, indexing, calls and object application following an expression
+func (p *parser) postfix(n *node) (*node, error) {
+	for {
+		switch {
+		case p.is("."):
+			p.next()
+			t := p.next()
+			if t.kind != tokenIdent {
+				return nil, p.unexpected(t)
+			}
+			n = &node{start: n.start, end: t.end}
+		case p.is("["):
+			p.next()
+			for !p.is("]") {
+				if p.is(":") || p.is("::") {
+					p.next()
+					continue
+				}
+				if _, err := p.expr(); err != nil {
+					return nil, err
+				}
+			}
+			n = &node{start: n.start, end: p.next().end}
+		case p.is("("):
+			end, err := p.args()
+			if err != nil {
+				return nil, err
+			}
+			if p.is("tailstrict") {
+				end = p.next().end
+			}
+			n = &node{start: n.start, end: end}
+		case p.is("{"):
+			obj, err := p.object()
+			if err != nil {
+				return nil, err
+			}
+			n = &node{start: n.start, end: obj.end}
+		default:
+			return n, nil
+		}
+	}
+}
+
+// args parses the arguments of a call and returns the end of the closing parenthesis
+func (p *parser) args() (int, error) {
+	p.next()
+	for !p.is(")") {
+		if p.peek().kind == tokenIdent && p.peekAt(1).kind == tokenOperator && p.peekAt(1).text == "=" {
+			p.pos += 2
+		}
+		if _, err := p.expr(); err != nil {
+			return 0, err
+		}
+		if !p.is(",") {
+			break
+		}
+		p.next()
+	}
+	t, err := p.expect(")")
+	return t.end, err
+}
+
+// params parses the parameters of a function
+func (p *parser) params() error {
+	if _, err := p.expect("("); err != nil {
+		return err
+	}
+	for !p.is(")") {
+		if t := p.next(); t.kind != tokenIdent {
+			return p.unexpected(t)
+		}
+		if p.is("=") {
+			p.next()
+			if _, err := p.expr(); err != nil {
+				return err
+			}
+		}
+		if !p.is(",") {
+			break
+		}
+		p.next()
+	}
+	_, err := p.expect(")")
+	return err
+}
+
+// bind parses a local binding, "x = expr" or "f(params) = expr"
+func (p *parser) bind() error {
+	if t := p.next(); t.kind != tokenIdent {
+		return p.unexpected(t)
+	}
+	if p.is("(") {
+		if err := p.params(); err != nil {
+			return err
+		}
+	}
+	if _, err := p.expect("="); err != nil {
+		return err
+	}
+	_, err := p.expr()
+	return err
+}
+
+// assertion parses "assert expr [: expr]" and returns its end
+func (p *parser) assertion() (int, error) {
+	p.next()
+	n, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	if p.is(":") {
+		p.next()
+		if n, err = p.expr(); err != nil {
+			return 0, err
+		}
+	}
+	return n.end, nil
+}
+
+// primary parses an expression without operators
+func (p *parser) primary() (*node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenNumber:
+		p.next()
+		return &node{kind: nodeLiteral, start: t.start, end: t.end, token: t}, nil
+	case tokenString:
+		p.next()
+		p.sawString(t)
+		return &node{kind: nodeString, start: t.start, end: t.end, token: t}, nil
+	case tokenIdent:
+		p.next()
+		return &node{start: t.start, end: t.end}, nil
+	}
+
+	switch t.text {
+	case "true", "false", "null":
+		p.next()
+		return &node{kind: nodeLiteral, start: t.start, end: t.end, token: t}, nil
+	case "self", "$":
+		p.next()
+		return &node{start: t.start, end: t.end}, nil
+	case "super":
+		p.next()
+		if !p.is(".") && !p.is("[") {
+			return nil, p.unexpected(p.peek())
+		}
+		return &node{start: t.start, end: t.end}, nil
+	case "{":
+		return p.object()
+	case "[":
+		return p.array()
+	case "(":
+		p.next()
+		if _, err := p.expr(); err != nil {
+			return nil, err
+		}
+		end, err := p.expect(")")
+		return &node{start: t.start, end: end.end}, err
+	case "import", "importstr", "importbin":
+		p.next()
+		path := p.next()
+		if path.kind != tokenString {
+			return nil, p.unexpected(path)
+		}
+		return &node{start: t.start, end: path.end}, nil
+	case "local":
+		p.next()
+		for {
+			if err := p.bind(); err != nil {
+				return nil, err
+			}
+			if !p.is(",") {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expect(";"); err != nil {
+			return nil, err
+		}
+		body, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return &node{kind: nodeLocal, start: t.start, end: body.end, body: body}, nil
+	case "if":
+		p.next()
+		if _, err := p.expr(); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.is("else") {
+			p.next()
+			if n, err = p.expr(); err != nil {
+				return nil, err
+			}
+		}
+		return &node{start: t.start, end: n.end}, nil
+	case "function":
+		p.next()
+		if err := p.params(); err != nil {
+			return nil, err
+		}
+		body, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return &node{start: t.start, end: body.end}, nil
+	case "assert":
+		if _, err := p.assertion(); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(";"); err != nil {
+			return nil, err
+		}
+		body, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return &node{start: t.start, end: body.end}, nil
+	case "error":
+		p.next()
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return &node{start: t.start, end: n.end}, nil
+	}
+	return nil, p.unexpected(t)
+}
+
+// array parses an array literal or array comprehension
+func (p *parser) array() (*node, error) {
+	start := p.next().start
+	for !p.is("]") {
+		if _, err := p.expr(); err != nil {
+			return nil, err
+		}
+		comma := p.is(",")
+		if comma {
+			p.next()
+		}
+		if p.is("for") {
+			if err := p.compspec(); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if !comma {
+			break
+		}
+	}
+	end, err := p.expect("]")
+	return &node{start: start, end: end.end}, err
+}
+
+// compspec parses the for and if clauses of a comprehension
+func (p *parser) compspec() error {
+	for {
+		switch {
+		case p.is("for"):
+			p.next()
+			if t := p.next(); t.kind != tokenIdent {
+				return p.unexpected(t)
+			}
+			if _, err := p.expect("in"); err != nil {
+				return err
+			}
+		case p.is("if"):
+			p.next()
+		default:
+			return nil
+		}
+		if _, err := p.expr(); err != nil {
+			return err
+		}
+	}
+}
+
+// object parses an object literal or object comprehension
+func (p *parser) object() (*node, error) {
+	obj := &object{open: p.next().start}
+	obj.lastEnd = obj.open + 1
+	for !p.is("}") {
+		start := p.peek().start
+		end, err := p.member(obj)
+		if err != nil {
+			return nil, err
+		}
+		obj.lastStart, obj.lastEnd, obj.trailingComma = start, end, false
+		if p.is("for") {
+			if err := p.compspec(); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if !p.is(",") {
+			break
+		}
+		obj.trailingComma, obj.commaEnd = true, p.next().end
+	}
+	end, err := p.expect("}")
+	if err != nil {
+		return nil, err
+	}
+	obj.close = end.start
+	return &node{kind: nodeObject, start: obj.open, end: end.end, object: obj}, nil
+}
+
+// member parses a member of an object and returns its end
+func (p *parser) member(obj *object) (int, error) {
+	switch {
+	case p.is("local"):
+		p.next()
+		err := p.bind()
+		return p.tokens[p.pos-1].end, err
+	case p.is("assert"):
+		return p.assertion()
+	}
+
+	t := p.next()
+	f := &field{start: t.start}
+	switch {
+	case t.kind == tokenIdent:
+		f.name, f.static = t.text, true
+	case t.kind == tokenString:
+		p.sawString(t)
+		name, err := decodeString(t)
+		if err != nil {
+			return 0, syntaxError(p.src, t.start, "%v", err)
+		}
+		f.name, f.static, f.quoted, f.style = name, true, true, t.style
+	case t.kind == tokenSymbol && t.text == "[":
+		name, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		if _, err := p.expect("]"); err != nil {
+			return 0, err
+		}
+		// A computed name that is a string literal, as in ['pkg-1.0'], is known
+		if name.kind == nodeString {
+			if value, err := decodeString(name.token); err == nil {
+				f.name, f.static, f.quoted, f.style = value, true, true, name.token.style
+			}
+		}
+	default:
+		return 0, p.unexpected(t)
+	}
+	if p.is("(") {
+		if err := p.params(); err != nil {
+			return 0, err
+		}
+	}
+	if op := p.next(); op.kind != tokenOperator || !fieldOperators[op.text] {
+		return 0, p.unexpected(op)
+	}
+	obj.fields = append(obj.fields, f)
+	p.fields = append(p.fields, f)
+	value, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	f.value = value
+	return value.end, nil
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+// Attribute keys carried by loggers to correlate the lines of one run
+const (
+	KeyRunID      = "run_id"
+	KeyRepository = "repository"
+	KeyBranch     = "branch"
+	KeySubmodule  = "submodule"
+)
+
+// Log formats accepted in log.format
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+type contextKey struct{}
+
+// New creates a logger writing to stdout with the configured level and format
+func New(cfg config.LogConfig) (*slog.Logger, error) {
+	return NewWithWriter(cfg, os.Stdout)
+}
+
+// NewWithWriter creates a logger writing to w with the configured level and format
+func NewWithWriter(cfg config.LogConfig, w io.Writer) (*slog.Logger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(cfg.Format) {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", cfg.Format)
+	}
+}
+
+// ParseLevel parses debug, info, warn or error, defaulting to info
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level: %s", level)
+	}
+}
+
+// FromContext returns the logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With returns a context whose logger adds the given attributes to every line
+func With(ctx context.Context, args ...interface{}) context.Context {
+	return context.WithValue(ctx, contextKey{}, FromContext(ctx).With(args...))
+}
@@ -0,0 +1,75 @@
+// Package manifest writes versions into the files of the artifacts repository. Each format
+// has a Writer that changes a single value in place and leaves comments, formatting and the
+// rest of the file as they are.
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/jsonnet"
+)
+
+// Writer reads and sets values in the content of a manifest file
+type Writer interface {
+	// Get returns the value at key; ok is false when the key does not exist or does not
+	// hold a single value.
+	Get(content []byte, key []string) (value string, ok bool, err error)
+	// Set returns the content with the value at key set, creating the file when content is
+	// empty and the missing parts of the key otherwise. changed is false when the key
+	// already has the value.
+	Set(content []byte, key []string, value string) (result []byte, changed bool, err error)
+}
+
+// New returns the writer of a format
+func New(format string) (Writer, error) {
+	switch format {
+	case config.FormatJsonnet, "":
+		return jsonnetWriter{}, nil
+	case config.FormatYAML, config.FormatHelm:
+		return yamlWriter{}, nil
+	case config.FormatKustomize:
+		return kustomizeWriter{}, nil
+	case config.FormatTOML:
+		return tomlWriter{}, nil
+	}
+	return nil, fmt.Errorf("unknown manifest format %q", format)
+}
+
+// SplitKey splits the key of a manifest rule into its path. Keys are separated by dots;
+// a key containing dots is written in double quotes, as in `app."pkg-1.0"`. The key of the
+// kustomize format is an image name and is not split.
+func SplitKey(format, key string) []string {
+	if format == config.FormatKustomize {
+		return []string{key}
+	}
+	var (
+		path    []string
+		current strings.Builder
+		quoted  bool
+	)
+	for _, c := range key {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '.' && !quoted:
+			path = append(path, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(c)
+		}
+	}
+	return append(path, current.String())
+}
+
+// jsonnetWriter writes fields of the object a Jsonnet document evaluates to
+type jsonnetWriter struct{}
+
+func (jsonnetWriter) Get(content []byte, key []string) (string, bool, error) {
+	return jsonnet.Get(content, key)
+}
+
+func (jsonnetWriter) Set(content []byte, key []string, value string) ([]byte, bool, error) {
+	return jsonnet.Set(content, key, value)
+}
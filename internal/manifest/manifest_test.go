@@ -0,0 +1,126 @@
+package manifest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+// setTest is a case of Writer.Set, setting the value "2.0"
+type setTest struct {
+	name    string
+	content string
+	key     string // Split with SplitKey
+	want    string
+	changed bool
+	err     string
+}
+
+// runSetTests runs the cases of Writer.Set of a format and checks the values set can be read
+// back with Get
+func runSetTests(t *testing.T, format string, tests []setTest) {
+	t.Helper()
+	w, err := New(format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := SplitKey(format, tt.key)
+			got, changed, err := w.Set([]byte(tt.content), key, "2.0")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Set() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			if string(got) != tt.want || changed != tt.changed {
+				t.Fatalf("Set() = %q, %v, want %q, %v", got, changed, tt.want, tt.changed)
+			}
+			if value, ok, err := w.Get(got, key); err != nil || !ok || value != "2.0" {
+				t.Errorf("Get() after Set() = %q, %v, %v", value, ok, err)
+			}
+		})
+	}
+}
+
+// getTest is a case of Writer.Get
+type getTest struct {
+	name    string
+	content string
+	key     string
+	value   string
+	ok      bool
+	err     string
+}
+
+func runGetTests(t *testing.T, format string, tests []getTest) {
+	t.Helper()
+	w, err := New(format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok, err := w.Get([]byte(tt.content), SplitKey(format, tt.key))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Get() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if value != tt.value || ok != tt.ok {
+				t.Errorf("Get() = %q, %v, want %q, %v", value, ok, tt.value, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		format string
+		want   Writer
+	}{
+		{format: "", want: jsonnetWriter{}},
+		{format: config.FormatJsonnet, want: jsonnetWriter{}},
+		{format: config.FormatYAML, want: yamlWriter{}},
+		{format: config.FormatHelm, want: yamlWriter{}},
+		{format: config.FormatKustomize, want: kustomizeWriter{}},
+		{format: config.FormatTOML, want: tomlWriter{}},
+	}
+	for _, tt := range tests {
+		if got, err := New(tt.format); err != nil || got != tt.want {
+			t.Errorf("New(%q) = %T, %v, want %T", tt.format, got, err, tt.want)
+		}
+	}
+	if _, err := New("ini"); err == nil || !strings.Contains(err.Error(), `unknown manifest format "ini"`) {
+		t.Errorf(`New("ini") error = %v`, err)
+	}
+}
+
+func TestSplitKey(t *testing.T) {
+	tests := []struct {
+		format string
+		key    string
+		want   []string
+	}{
+		{format: config.FormatYAML, key: "image.tag", want: []string{"image", "tag"}},
+		{format: config.FormatTOML, key: `app."pkg-1.0".version`, want: []string{"app", "pkg-1.0", "version"}},
+		{format: config.FormatJsonnet, key: `"a.b"`, want: []string{"a.b"}},
+		{format: config.FormatHelm, key: "tag", want: []string{"tag"}},
+		{format: config.FormatKustomize, key: "registry.example.com/team/app", want: []string{"registry.example.com/team/app"}},
+	}
+	for _, tt := range tests {
+		if got := SplitKey(tt.format, tt.key); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitKey(%s, %s) = %q, want %q", tt.format, tt.key, got, tt.want)
+		}
+	}
+}
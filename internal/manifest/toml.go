@@ -0,0 +1,471 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tomlWriter writes string values of TOML tables
+type tomlWriter struct{}
+
+func (tomlWriter) Get(content []byte, key []string) (string, bool, error) {
+	doc, err := parseTOML(content)
+	if err != nil {
+		return "", false, err
+	}
+	if e := doc.lookup(key); e != nil && e.str != nil {
+		return *e.str, true, nil
+	}
+	return "", false, nil
+}
+
+func (tomlWriter) Set(content []byte, key []string, value string) ([]byte, bool, error) {
+	doc, err := parseTOML(content)
+	if err != nil {
+		return nil, false, err
+	}
+	result, changed, err := doc.set(key, value)
+	if err != nil || !changed {
+		return result, changed, err
+	}
+	// Check the new value can be read back
+	check, err := parseTOML(result)
+	if err == nil {
+		if e := check.lookup(key); e == nil || e.str == nil || *e.str != value {
+			err = fmt.Errorf("%s is not %q", strings.Join(key, "."), value)
+		}
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("update produced invalid TOML: %w", err)
+	}
+	return result, true, nil
+}
+
+// tomlTable is a table of a TOML document, the root table included
+type tomlTable struct {
+	path   []string
+	array  bool // Keys under [[array]] tables are not addressed by key paths
+	start  int  // Offset of the header
+	end    int  // End of the line of the header or of the last entry
+	header bool // Whether the table has a header, false for the root table
+}
+
+// tomlEntry is a key/value pair of a TOML document
+type tomlEntry struct {
+	path       []string // Full path of the key, table path included
+	table      *tomlTable
+	lineStart  int
+	valueStart int
+	valueEnd   int
+	lineEnd    int     // End of the line the value ends on
+	str        *string // Value of single line strings
+}
+
+// tomlDoc is a parsed TOML document and its source
+type tomlDoc struct {
+	src     []byte
+	tables  []*tomlTable
+	entries []*tomlEntry
+}
+
+// parseTOML parses the tables and key/value pairs of a TOML document. Values are only
+// scanned, except single line strings which are decoded.
+func parseTOML(src []byte) (*tomlDoc, error) {
+	root := &tomlTable{}
+	d := &tomlDoc{src: src, tables: []*tomlTable{root}}
+	table := root
+	i := 0
+	for {
+		i = skipTOMLSpace(src, i, true)
+		if i >= len(src) {
+			return d, nil
+		}
+		lineStart := strings.LastIndexByte(string(src[:i]), '\n') + 1
+		switch src[i] {
+		case '#':
+			i = tomlLineEnd(src, i)
+			continue
+		case '[':
+			array := i+1 < len(src) && src[i+1] == '['
+			j := i + 1
+			if array {
+				j++
+			}
+			path, j, err := parseTOMLKey(src, j)
+			if err != nil {
+				return nil, err
+			}
+			close := "]"
+			if array {
+				close = "]]"
+			}
+			if !strings.HasPrefix(string(src[j:]), close) {
+				return nil, tomlError(src, j, "expected %s", close)
+			}
+			// A path is either a table or an array of tables
+			for _, t := range d.tables[1:] {
+				if equalPath(t.path, path) && t.array != array {
+					if t.array {
+						return nil, tomlError(src, i, "%s is an array of tables", tomlKey(path))
+					}
+					return nil, tomlError(src, i, "%s is not an array of tables", tomlKey(path))
+				}
+			}
+			table = &tomlTable{path: path, array: array, start: i, header: true}
+			table.end = tomlLineEnd(src, j+len(close))
+			d.tables = append(d.tables, table)
+			i = table.end
+			continue
+		}
+
+		path, j, err := parseTOMLKey(src, i)
+		if err != nil {
+			return nil, err
+		}
+		if j >= len(src) || src[j] != '=' {
+			return nil, tomlError(src, j, "expected =")
+		}
+		j = skipTOMLSpace(src, j+1, false)
+		end, err := scanTOMLValue(src, j)
+		if err != nil {
+			return nil, err
+		}
+		entry := &tomlEntry{
+			path:       append(append([]string(nil), table.path...), path...),
+			table:      table,
+			lineStart:  lineStart,
+			valueStart: j,
+			valueEnd:   end,
+			lineEnd:    tomlLineEnd(src, end),
+		}
+		entry.str = decodeTOMLString(string(src[j:end]))
+		d.entries = append(d.entries, entry)
+		table.end = entry.lineEnd
+		i = entry.lineEnd
+	}
+}
+
+// lookup returns the entry of a key path, nil when there is none
+func (d *tomlDoc) lookup(path []string) *tomlEntry {
+	if d.arrayTable(path) != nil {
+		return nil
+	}
+	for _, e := range d.entries {
+		if !e.table.array && equalPath(e.path, path) {
+			return e
+		}
+	}
+	return nil
+}
+
+// arrayTable returns the array of tables whose path is a prefix of a key path, nil when there
+// is none. Such keys name values of every table of the array.
+func (d *tomlDoc) arrayTable(path []string) *tomlTable {
+	for _, t := range d.tables[1:] {
+		if t.array && len(t.path) <= len(path) && equalPath(t.path, path[:len(t.path)]) {
+			return t
+		}
+	}
+	return nil
+}
+
+// set sets the string at key, inserting it into the table holding the longest prefix of it
+func (d *tomlDoc) set(key []string, value string) ([]byte, bool, error) {
+	if t := d.arrayTable(key); t != nil {
+		return nil, false, fmt.Errorf("%s is an array of tables", strings.Join(t.path, "."))
+	}
+	if e := d.lookup(key); e != nil {
+		if e.str != nil && *e.str == value {
+			return d.src, false, nil
+		}
+		switch d.src[e.valueStart] {
+		case '[', '{':
+			return nil, false, fmt.Errorf("%s is not a string", strings.Join(key, "."))
+		}
+		literal := tomlString(value)
+		if d.src[e.valueStart] == '\'' && !strings.HasPrefix(string(d.src[e.valueStart:]), "'''") &&
+			!strings.ContainsAny(value, "'\n") {
+			literal = "'" + value + "'"
+		}
+		return d.replace(e.valueStart, e.valueEnd, literal), true, nil
+	}
+	for _, e := range d.entries {
+		if !e.table.array && len(e.path) < len(key) && equalPath(e.path, key[:len(e.path)]) {
+			return nil, false, fmt.Errorf("%s is not a table", strings.Join(e.path, "."))
+		}
+	}
+
+	// The table with the longest path that is a prefix of the key
+	table := d.tables[0]
+	for _, t := range d.tables[1:] {
+		if !t.array && len(t.path) > len(table.path) && len(t.path) < len(key) && equalPath(t.path, key[:len(t.path)]) {
+			table = t
+		}
+	}
+	rest := key[len(table.path):]
+
+	// After the entry sharing the longest prefix with the key, else after the last entry
+	var (
+		after  *tomlEntry
+		shared int
+	)
+	for _, e := range d.entries {
+		if e.table != table {
+			continue
+		}
+		if n := commonPrefix(e.path[len(table.path):], rest); n >= shared {
+			after, shared = e, n
+		}
+	}
+
+	switch {
+	case len(rest) > 1 && shared == 0:
+		// A new table for the key, after the table or at the end of the document
+		text := "[" + tomlKey(key[:len(key)-1]) + "]\n" + tomlKey(rest[len(rest)-1:]) + " = " + tomlString(value)
+		pos := len(d.src)
+		if table.header {
+			pos = table.end
+		}
+		return d.insert(pos, text, true), true, nil
+	case after != nil:
+		indent := string(d.src[after.lineStart:skipTOMLSpace(d.src, after.lineStart, false)])
+		return d.replace(after.lineEnd, after.lineEnd, "\n"+indent+tomlKey(rest)+" = "+tomlString(value)), true, nil
+	case table.header:
+		return d.replace(table.end, table.end, "\n"+tomlKey(rest)+" = "+tomlString(value)), true, nil
+	case len(d.tables) > 1:
+		// Keys of the root table come before the first table
+		pos := d.tables[1].start
+		return d.replace(pos, pos, tomlKey(rest)+" = "+tomlString(value)+"\n\n"), true, nil
+	default:
+		return d.insert(len(d.src), tomlKey(rest)+" = "+tomlString(value), false), true, nil
+	}
+}
+
+// insert inserts lines at the end of a line or of the document, separated by a blank line
+// when blank is set
+func (d *tomlDoc) insert(pos int, text string, blank bool) []byte {
+	if pos == len(d.src) {
+		switch {
+		case pos == 0:
+			return []byte(text + "\n")
+		case d.src[pos-1] != '\n':
+			text = "\n" + text
+		}
+		if blank {
+			text = "\n" + text
+		}
+		return d.replace(pos, pos, text+"\n")
+	}
+	if blank {
+		text = "\n" + text
+	}
+	return d.replace(pos, pos, "\n"+text)
+}
+
+// replace returns the source with the text between start and end replaced
+func (d *tomlDoc) replace(start, end int, text string) []byte {
+	result := make([]byte, 0, len(d.src)+len(text))
+	result = append(result, d.src[:start]...)
+	result = append(result, text...)
+	return append(result, d.src[end:]...)
+}
+
+// parseTOMLKey parses a dotted key and returns its parts and the offset after it and the
+// white space following it
+func parseTOMLKey(src []byte, i int) ([]string, int, error) {
+	var path []string
+	for {
+		i = skipTOMLSpace(src, i, false)
+		start := i
+		switch {
+		case i < len(src) && (src[i] == '"' || src[i] == '\''):
+			end, err := scanTOMLString(src, i)
+			if err != nil {
+				return nil, 0, err
+			}
+			name := decodeTOMLString(string(src[start:end]))
+			if name == nil {
+				return nil, 0, tomlError(src, start, "invalid key")
+			}
+			path = append(path, *name)
+			i = end
+		default:
+			for i < len(src) && isBareKeyChar(src[i]) {
+				i++
+			}
+			if i == start {
+				return nil, 0, tomlError(src, start, "expected a key")
+			}
+			path = append(path, string(src[start:i]))
+		}
+		i = skipTOMLSpace(src, i, false)
+		if i >= len(src) || src[i] != '.' {
+			return path, i, nil
+		}
+		i++
+	}
+}
+
+// scanTOMLValue returns the end of the value starting at i
+func scanTOMLValue(src []byte, i int) (int, error) {
+	if i >= len(src) {
+		return 0, tomlError(src, i, "expected a value")
+	}
+	switch src[i] {
+	case '"', '\'':
+		return scanTOMLString(src, i)
+	case '[', '{':
+		depth := 0
+		for j := i; j < len(src); j++ {
+			switch src[j] {
+			case '"', '\'':
+				end, err := scanTOMLString(src, j)
+				if err != nil {
+					return 0, err
+				}
+				j = end - 1
+			case '#':
+				j = tomlLineEnd(src, j) - 1
+			case '[', '{':
+				depth++
+			case ']', '}':
+				depth--
+				if depth == 0 {
+					return j + 1, nil
+				}
+			}
+		}
+		return 0, tomlError(src, i, "unterminated %c", src[i])
+	}
+	// Numbers, booleans and dates, which may contain a space between date and time
+	j := i
+	for j < len(src) && strings.IndexByte(",]}#\r\n", src[j]) < 0 {
+		j++
+	}
+	return len(strings.TrimRight(string(src[:j]), " \t")), nil
+}
+
+// scanTOMLString returns the end of the string starting at i
+func scanTOMLString(src []byte, i int) (int, error) {
+	quote := src[i]
+	if strings.HasPrefix(string(src[i:]), strings.Repeat(string(quote), 3)) {
+		for j := i + 3; j+2 < len(src); j++ {
+			if src[j] == '\\' && quote == '"' {
+				j++
+				continue
+			}
+			if src[j] == quote && src[j+1] == quote && src[j+2] == quote {
+				// Up to two quotes of the content may precede the closing delimiter
+				end := j + 3
+				for n := 0; n < 2 && end < len(src) && src[end] == quote; n++ {
+					end++
+				}
+				return end, nil
+			}
+		}
+		return 0, tomlError(src, i, "unterminated multi-line string")
+	}
+	for j := i + 1; j < len(src) && src[j] != '\n'; j++ {
+		if src[j] == '\\' && quote == '"' {
+			j++
+			continue
+		}
+		if src[j] == quote {
+			return j + 1, nil
+		}
+	}
+	return 0, tomlError(src, i, "unterminated string")
+}
+
+// decodeTOMLString returns the value of a single line string literal, nil for other values
+func decodeTOMLString(literal string) *string {
+	if len(literal) < 2 || strings.HasPrefix(literal, `"""`) || strings.HasPrefix(literal, "'''") {
+		return nil
+	}
+	switch literal[0] {
+	case '\'':
+		value := literal[1 : len(literal)-1]
+		return &value
+	case '"':
+		// The escapes of TOML basic strings are a subset of those of Go
+		if value, err := strconv.Unquote(literal); err == nil {
+			return &value
+		}
+	}
+	return nil
+}
+
+// tomlString returns a basic string literal for value
+func tomlString(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range value {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// tomlKey returns a dotted key, quoting the parts that are not bare keys
+func tomlKey(path []string) string {
+	parts := make([]string, len(path))
+	for i, name := range path {
+		parts[i] = name
+		if name == "" || strings.IndexFunc(name, func(r rune) bool { return r > 0x7f || !isBareKeyChar(byte(r)) }) >= 0 {
+			parts[i] = tomlString(name)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func isBareKeyChar(c byte) bool {
+	return c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// skipTOMLSpace skips spaces and tabs, and line breaks when lines is set
+func skipTOMLSpace(src []byte, i int, lines bool) int {
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t' || lines && (src[i] == '\n' || src[i] == '\r')) {
+		i++
+	}
+	return i
+}
+
+// tomlLineEnd returns the offset of the line break ending the line holding i, or the end of
+// the document
+func tomlLineEnd(src []byte, i int) int {
+	for i < len(src) && src[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+func tomlError(src []byte, offset int, format string, args ...interface{}) error {
+	line := strings.Count(string(src[:min(offset, len(src))]), "\n") + 1
+	return fmt.Errorf("TOML syntax error at line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func equalPath(a, b []string) bool {
+	return len(a) == len(b) && commonPrefix(a, b) == len(a)
+}
+
+// commonPrefix returns the number of leading parts two paths share
+func commonPrefix(a, b []string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
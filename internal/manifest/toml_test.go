@@ -0,0 +1,196 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+func TestTOMLSet(t *testing.T) {
+	runSetTests(t, config.FormatTOML, []setTest{
+		{
+			name:    "empty file",
+			content: "",
+			key:     "app.pkg",
+			want:    "[app]\npkg = \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "basic string with a comment",
+			content: "[app]\npkg = \"1.0\" # pinned\n",
+			key:     "app.pkg",
+			want:    "[app]\npkg = \"2.0\" # pinned\n",
+			changed: true,
+		},
+		{
+			name:    "literal string",
+			content: "[app]\npkg = '1.0'\n",
+			key:     "app.pkg",
+			want:    "[app]\npkg = '2.0'\n",
+			changed: true,
+		},
+		{
+			name:    "multi-line string",
+			content: "[app]\npkg = \"\"\"1.0\"\"\"\n",
+			key:     "app.pkg",
+			want:    "[app]\npkg = \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "number becomes a string",
+			content: "[app]\npkg = 1\n",
+			key:     "app.pkg",
+			want:    "[app]\npkg = \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "unchanged",
+			content: "[app]\npkg = \"2.0\"\n",
+			key:     "app.pkg",
+			want:    "[app]\npkg = \"2.0\"\n",
+		},
+		{
+			name:    "quoted key",
+			content: "[app]\n\"pkg-1.0\" = \"1\"\n",
+			key:     `app."pkg-1.0"`,
+			want:    "[app]\n\"pkg-1.0\" = \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "dotted keys",
+			content: "app.pkg = \"1.0\"\napp.lib = \"2\"\n",
+			key:     "app.pkg",
+			want:    "app.pkg = \"2.0\"\napp.lib = \"2\"\n",
+			changed: true,
+		},
+		{
+			name:    "new dotted key",
+			content: "app.pkg = \"1.0\"\n",
+			key:     "app.new",
+			want:    "app.pkg = \"1.0\"\napp.new = \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "new key of a table",
+			content: "[app]\npkg = \"1.0\"\n\n[other]\nx = 1\n",
+			key:     "app.lib",
+			want:    "[app]\npkg = \"1.0\"\nlib = \"2.0\"\n\n[other]\nx = 1\n",
+			changed: true,
+		},
+		{
+			name:    "new key of the root table",
+			content: "title = \"x\"\n\n[other]\nx = 1\n",
+			key:     "version",
+			want:    "title = \"x\"\nversion = \"2.0\"\n\n[other]\nx = 1\n",
+			changed: true,
+		},
+		{
+			name:    "new key of a sub-table",
+			content: "[servers]\n[servers.alpha]\nip = \"1\"\n",
+			key:     "servers.alpha.version",
+			want:    "[servers]\n[servers.alpha]\nip = \"1\"\nversion = \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "new table",
+			content: "[other]\nx = 1\n",
+			key:     "app.pkg",
+			want:    "[other]\nx = 1\n\n[app]\npkg = \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "array",
+			content: "[app]\npkg = [\"1\"]\n",
+			key:     "app.pkg",
+			err:     "app.pkg is not a string",
+		},
+		{
+			name:    "string on the path",
+			content: "[app]\npkg = \"1.0\"\n",
+			key:     "app.pkg.x",
+			err:     "app.pkg is not a table",
+		},
+		{
+			name:    "syntax error",
+			content: "[app\npkg = 1\n",
+			key:     "app.pkg",
+			err:     "TOML syntax error at line 1: expected ]",
+		},
+	})
+}
+
+func TestTOMLGet(t *testing.T) {
+	runGetTests(t, config.FormatTOML, []getTest{
+		{name: "empty file", content: "", key: "app.pkg"},
+		{name: "string", content: "[app]\npkg = \"1.0\"\n", key: "app.pkg", value: "1.0", ok: true},
+		{name: "escaped string", content: "[app]\npkg = \"a\\\"b\"\n", key: "app.pkg", value: `a"b`, ok: true},
+		{name: "dotted key", content: "app.pkg = '1.0'\n", key: "app.pkg", value: "1.0", ok: true},
+		{name: "number", content: "[app]\npkg = 1\n", key: "app.pkg"},
+		{name: "missing key", content: "[app]\npkg = \"1.0\"\n", key: "app.lib"},
+		{name: "syntax error", content: "[app]\npkg = \"1.0\n", key: "app.pkg", err: "unterminated string"},
+	})
+}
+
+func TestTOMLArrayOfTables(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		key     string
+		err     string
+	}{
+		{
+			name:    "key of an array of tables",
+			content: "[[arr]]\nx = \"1\"\n",
+			key:     "arr.x",
+			err:     "arr is an array of tables",
+		},
+		{
+			name:    "new key of an array of tables",
+			content: "[[arr]]\nx = \"1\"\n",
+			key:     "arr.y",
+			err:     "arr is an array of tables",
+		},
+		{
+			name:    "key of a sub-table of an array of tables",
+			content: "[[arr]]\nx = \"1\"\n[arr.sub]\ny = \"2\"\n",
+			key:     "arr.sub.y",
+			err:     "arr is an array of tables",
+		},
+		{
+			name:    "array of tables itself",
+			content: "[[arr]]\nx = \"1\"\n",
+			key:     "arr",
+			err:     "arr is an array of tables",
+		},
+		{
+			name:    "table after an array of tables",
+			content: "[[t]]\nx = \"1\"\n[t]\ny = \"2\"\n",
+			key:     "a",
+			err:     "line 3: t is an array of tables",
+		},
+		{
+			name:    "array of tables after a table",
+			content: "[t]\nx = \"1\"\n[[t]]\ny = \"2\"\n",
+			key:     "a",
+			err:     "line 3: t is not an array of tables",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := tomlWriter{}.Set([]byte(tt.content), SplitKey("toml", tt.key), "2.0.0")
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Set() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTOMLGetUnderArrayOfTables(t *testing.T) {
+	content := "[[arr]]\nx = \"1\"\n[arr.sub]\ny = \"2\"\n"
+	for _, key := range []string{"arr.x", "arr.sub.y"} {
+		if value, ok, err := (tomlWriter{}).Get([]byte(content), SplitKey("toml", key)); err != nil || ok {
+			t.Errorf("Get(%s) = %q, %v, %v, want no value", key, value, ok, err)
+		}
+	}
+}
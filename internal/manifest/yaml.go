@@ -0,0 +1,441 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultIndent indents the entries of new mappings when the document has none to copy
+const defaultIndent = "  "
+
+// yamlWriter writes values of YAML mappings, such as Helm values files
+type yamlWriter struct{}
+
+func (yamlWriter) Get(content []byte, key []string) (string, bool, error) {
+	doc, err := parseYAML(content)
+	if err != nil {
+		return "", false, err
+	}
+	node := doc.root
+	for _, name := range key {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return "", false, nil
+		}
+		_, node = lookup(node, name)
+	}
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return "", false, nil
+	}
+	return node.Value, true, nil
+}
+
+func (yamlWriter) Set(content []byte, key []string, value string) ([]byte, bool, error) {
+	doc, err := parseYAML(content)
+	if err != nil {
+		return nil, false, err
+	}
+	result, changed, err := doc.set(key, value)
+	if err != nil || !changed {
+		return result, changed, err
+	}
+	return result, true, checkYAML(result, key, value)
+}
+
+// kustomizeWriter sets the newTag of an entry of the images of a kustomization.yaml. The key
+// is the name of the image; an entry is added when the image has none.
+type kustomizeWriter struct{}
+
+func (kustomizeWriter) Get(content []byte, key []string) (string, bool, error) {
+	doc, err := parseYAML(content)
+	if err != nil {
+		return "", false, err
+	}
+	entry := doc.imageEntry(strings.Join(key, "."))
+	if entry == nil {
+		return "", false, nil
+	}
+	if _, tag := lookup(entry, "newTag"); tag != nil && tag.Kind == yaml.ScalarNode {
+		return tag.Value, true, nil
+	}
+	return "", false, nil
+}
+
+func (kustomizeWriter) Set(content []byte, key []string, value string) ([]byte, bool, error) {
+	name := strings.Join(key, ".")
+	doc, err := parseYAML(content)
+	if err != nil {
+		return nil, false, err
+	}
+	result, changed, err := doc.setImageTag(name, value)
+	if err != nil || !changed {
+		return result, changed, err
+	}
+	// Check the new tag can be read back
+	check, err := parseYAML(result)
+	if err == nil && check.imageEntry(name) == nil {
+		err = fmt.Errorf("image %s not found after the update", name)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("update produced an invalid kustomization: %w", err)
+	}
+	return result, true, nil
+}
+
+// yamlDoc is a parsed YAML document and its source
+type yamlDoc struct {
+	src   []byte
+	lines []int      // Offsets of the first character of each line
+	root  *yaml.Node // Root mapping, nil for empty documents
+	unit  string     // Indentation of nested mappings relative to their parent
+}
+
+// parseYAML parses a YAML document whose root is a mapping. Files holding several documents
+// are rejected, as a key could name values of any of them.
+func parseYAML(src []byte) (*yamlDoc, error) {
+	var node yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(src))
+	if err := decoder.Decode(&node); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	var next yaml.Node
+	if err := decoder.Decode(&next); !errors.Is(err, io.EOF) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+		return nil, fmt.Errorf("multi-document YAML files are not supported")
+	}
+	d := &yamlDoc{src: src, lines: []int{0}, unit: defaultIndent}
+	for i, c := range src {
+		if c == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+	if len(node.Content) == 0 {
+		return d, nil
+	}
+	root := node.Content[0]
+	if root.Kind == yaml.ScalarNode && root.ShortTag() == "!!null" {
+		return d, nil
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("the YAML document is not a mapping")
+	}
+	d.root = root
+	if unit := nestedIndent(root); unit > 0 {
+		d.unit = strings.Repeat(" ", unit)
+	}
+	return d, nil
+}
+
+// nestedIndent returns the indentation of the first block mapping nested in a mapping relative
+// to its parent, 0 when there is none
+func nestedIndent(mapping *yaml.Node) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if value.Kind != yaml.MappingNode || value.Style&yaml.FlowStyle != 0 || len(value.Content) == 0 {
+			continue
+		}
+		if indent := value.Content[0].Column - key.Column; indent > 0 {
+			return indent
+		}
+		if indent := nestedIndent(value); indent > 0 {
+			return indent
+		}
+	}
+	return 0
+}
+
+// lookup returns the key and value of a mapping entry, nil when there is none
+func lookup(mapping *yaml.Node, name string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if key := mapping.Content[i]; key.Kind == yaml.ScalarNode && key.Value == name {
+			return key, mapping.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// set sets the scalar at key, inserting missing entries into the nearest existing mapping
+func (d *yamlDoc) set(key []string, value string) ([]byte, bool, error) {
+	if d.root == nil {
+		return d.appendText(yamlEntry(key, value, "", d.unit)), true, nil
+	}
+	mapping := d.root
+	for i, name := range key {
+		k, v := lookup(mapping, name)
+		if k == nil {
+			text, err := d.insertEntry(mapping, key[i:], value)
+			return text, err == nil, err
+		}
+		if i == len(key)-1 {
+			return d.replaceScalar(k, v, key, value)
+		}
+		if v.Kind != yaml.MappingNode {
+			return nil, false, fmt.Errorf("%s is not a mapping", strings.Join(key[:i+1], "."))
+		}
+		mapping = v
+	}
+	return d.src, false, nil
+}
+
+// setImageTag sets the newTag of the images entry of a kustomization with a name
+func (d *yamlDoc) setImageTag(name, tag string) ([]byte, bool, error) {
+	entry := fmt.Sprintf("- name: %s\n  newTag: %s", yamlScalar(name), yamlScalar(tag))
+	if d.root == nil {
+		return d.appendText("images:\n" + entry), true, nil
+	}
+	if item := d.imageEntry(name); item != nil {
+		k, v := lookup(item, "newTag")
+		if k == nil {
+			text, err := d.insertEntry(item, []string{"newTag"}, tag)
+			return text, err == nil, err
+		}
+		return d.replaceScalar(k, v, []string{"images", name, "newTag"}, tag)
+	}
+
+	k, images := lookup(d.root, "images")
+	if k == nil {
+		indent := strings.Repeat(" ", d.root.Content[0].Column-1)
+		text := "images:\n" + indent + strings.ReplaceAll(entry, "\n", "\n"+indent)
+		return d.insertText(d.root, text), true, nil
+	}
+	if images.Kind != yaml.SequenceNode || (images.Style&yaml.FlowStyle != 0 && len(images.Content) > 0) {
+		return nil, false, fmt.Errorf("images is not a block sequence")
+	}
+	if len(images.Content) == 0 {
+		// images: [] becomes a block sequence
+		start := d.offset(images)
+		end := start + strings.IndexByte(string(d.src[start:]), ']') + 1
+		for start > 0 && d.src[start-1] == ' ' {
+			start--
+		}
+		indent := strings.Repeat(" ", k.Column-1)
+		return d.replace(start, end, "\n"+indent+strings.ReplaceAll(entry, "\n", "\n"+indent)), true, nil
+	}
+	// Indent like the existing entries, "- " followed by the keys of the entry
+	dash := strings.Repeat(" ", images.Column-1)
+	last := images.Content[len(images.Content)-1]
+	entry = strings.ReplaceAll(entry, "\n  ", "\n"+strings.Repeat(" ", max(last.Column-images.Column, 2)))
+	pos := d.blockEnd(last.Line, images.Column-1)
+	return d.replace(pos, pos, "\n"+dash+strings.ReplaceAll(entry, "\n", "\n"+dash)), true, nil
+}
+
+// imageEntry returns the entry of the images of a kustomization with a name
+func (d *yamlDoc) imageEntry(name string) *yaml.Node {
+	if d.root == nil {
+		return nil
+	}
+	_, images := lookup(d.root, "images")
+	if images == nil || images.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for _, item := range images.Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+		if _, v := lookup(item, "name"); v != nil && v.Value == name {
+			return item
+		}
+	}
+	return nil
+}
+
+// replaceScalar replaces the value of a mapping entry, keeping its quoting style
+func (d *yamlDoc) replaceScalar(key, value *yaml.Node, path []string, text string) ([]byte, bool, error) {
+	if value.Kind != yaml.ScalarNode {
+		return nil, false, fmt.Errorf("%s is not a scalar", strings.Join(path, "."))
+	}
+	if value.ShortTag() == "!!str" && value.Value == text {
+		return d.src, false, nil
+	}
+	if value.ShortTag() == "!!null" && value.Value == "" {
+		// "key:" without a value
+		end, err := d.scalarEnd(key, d.offset(key))
+		if err != nil {
+			return nil, false, err
+		}
+		colon := end + strings.IndexByte(string(d.src[end:]), ':') + 1
+		return d.replace(colon, colon, " "+yamlScalar(text)), true, nil
+	}
+
+	start := d.offset(value)
+	// Keep an anchor or tag in front of the value
+	for start < len(d.src) && (d.src[start] == '&' || d.src[start] == '!') {
+		for start < len(d.src) && d.src[start] != ' ' {
+			start++
+		}
+		for start < len(d.src) && d.src[start] == ' ' {
+			start++
+		}
+	}
+	end, err := d.scalarEnd(value, start)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", strings.Join(path, "."), err)
+	}
+
+	var literal string
+	switch {
+	case value.Style&yaml.DoubleQuotedStyle != 0:
+		literal = strconv.Quote(text)
+	case value.Style&yaml.SingleQuotedStyle != 0 && !strings.Contains(text, "\n"):
+		literal = "'" + strings.ReplaceAll(text, "'", "''") + "'"
+	default:
+		literal = yamlScalar(text)
+	}
+	return d.replace(start, end, literal), true, nil
+}
+
+// scalarEnd returns the end of the single line scalar starting at start
+func (d *yamlDoc) scalarEnd(node *yaml.Node, start int) (int, error) {
+	src := d.src
+	switch {
+	case node.Style&yaml.DoubleQuotedStyle != 0:
+		for i := start + 1; i < len(src); i++ {
+			if src[i] == '\\' {
+				i++
+			} else if src[i] == '"' {
+				return i + 1, nil
+			}
+		}
+	case node.Style&yaml.SingleQuotedStyle != 0:
+		for i := start + 1; i < len(src); i++ {
+			if src[i] == '\'' {
+				if i+1 < len(src) && src[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1, nil
+			}
+		}
+	case node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		return 0, fmt.Errorf("block scalars cannot be updated")
+	default:
+		if end := start + len(node.Value); end <= len(src) && string(src[start:end]) == node.Value {
+			return end, nil
+		}
+		return 0, fmt.Errorf("multi-line scalars cannot be updated")
+	}
+	return 0, fmt.Errorf("unterminated string")
+}
+
+// insertEntry inserts the entry holding the path after the last entry of a block mapping
+func (d *yamlDoc) insertEntry(mapping *yaml.Node, path []string, value string) ([]byte, error) {
+	if mapping.Style&yaml.FlowStyle != 0 || len(mapping.Content) == 0 {
+		return nil, fmt.Errorf("cannot add %s to a flow mapping", strings.Join(path, "."))
+	}
+	indent := strings.Repeat(" ", mapping.Content[0].Column-1)
+	return d.insertText(mapping, yamlEntry(path, value, indent, d.unit)), nil
+}
+
+// insertText inserts text as a new entry after the last entry of a block mapping
+func (d *yamlDoc) insertText(mapping *yaml.Node, text string) []byte {
+	indent := mapping.Content[0].Column - 1
+	pos := d.blockEnd(mapping.Content[len(mapping.Content)-2].Line, indent)
+	return d.replace(pos, pos, "\n"+strings.Repeat(" ", indent)+text)
+}
+
+// blockEnd returns the end of the last line of the block node starting on a line (1-based)
+// whose entries are indented by indent columns: following lines belong to it while they are
+// indented deeper, or are sequence entries at the same indentation. Trailing blank lines and
+// comments are left out.
+func (d *yamlDoc) blockEnd(line, indent int) int {
+	last := line - 1
+	for i := line; i < len(d.lines); i++ {
+		text := d.line(i)
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+		lineIndent := len(text) - len(trimmed)
+		if lineIndent > indent || lineIndent == indent && (trimmed == "-" || strings.HasPrefix(trimmed, "- ")) {
+			last = i
+			continue
+		}
+		break
+	}
+	return d.lines[last] + len(d.line(last))
+}
+
+// line returns the text of a line (0-based) without its line break
+func (d *yamlDoc) line(i int) string {
+	end := len(d.src)
+	if i+1 < len(d.lines) {
+		end = d.lines[i+1] - 1
+	}
+	return strings.TrimSuffix(string(d.src[d.lines[i]:end]), "\r")
+}
+
+// offset returns the offset of the first character of a node
+func (d *yamlDoc) offset(node *yaml.Node) int {
+	i := d.lines[node.Line-1]
+	for column := 1; column < node.Column && i < len(d.src); column++ {
+		_, size := utf8.DecodeRune(d.src[i:])
+		i += size
+	}
+	return i
+}
+
+// replace returns the source with the text between start and end replaced
+func (d *yamlDoc) replace(start, end int, text string) []byte {
+	result := make([]byte, 0, len(d.src)+len(text))
+	result = append(result, d.src[:start]...)
+	result = append(result, text...)
+	return append(result, d.src[end:]...)
+}
+
+// appendText appends a top level entry to the document
+func (d *yamlDoc) appendText(text string) []byte {
+	src := d.src
+	if len(src) > 0 && src[len(src)-1] != '\n' {
+		text = "\n" + text
+	}
+	return d.replace(len(src), len(src), text+"\n")
+}
+
+// yamlEntry returns a mapping entry holding the path, nested mappings indented by unit
+func yamlEntry(path []string, value, indent, unit string) string {
+	name := yamlScalar(path[0])
+	if len(path) == 1 {
+		return name + ": " + yamlScalar(value)
+	}
+	inner := indent + unit
+	return name + ":\n" + inner + yamlEntry(path[1:], value, inner, unit)
+}
+
+// yamlScalar returns a string scalar for text, plain when it reads back as the same string
+// and double quoted otherwise
+func yamlScalar(text string) string {
+	out, err := yaml.Marshal(text)
+	literal := strings.TrimSuffix(string(out), "\n")
+	if err != nil || strings.Contains(literal, "\n") || strings.ContainsAny(text, ",[]{}") {
+		return strconv.Quote(text)
+	}
+	return literal
+}
+
+// checkYAML checks that an updated document parses and holds the value at the path
+func checkYAML(src []byte, path []string, value string) error {
+	doc, err := parseYAML(src)
+	if err != nil {
+		return fmt.Errorf("update produced invalid YAML: %w", err)
+	}
+	node := doc.root
+	for _, name := range path {
+		if node == nil || node.Kind != yaml.MappingNode {
+			node = nil
+			break
+		}
+		_, node = lookup(node, name)
+	}
+	if node == nil || node.Kind != yaml.ScalarNode || node.Value != value {
+		return fmt.Errorf("update produced unexpected YAML: %s is not %q", strings.Join(path, "."), value)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+func TestYAMLMultiDocument(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{
+			name:    "two documents",
+			content: "image:\n  tag: \"1.0.0\"\n---\nimage:\n  tag: \"1.0.0\"\n",
+			err:     "multi-document YAML files are not supported",
+		},
+		{
+			name:    "explicit document starts",
+			content: "---\nname: a\n---\nimage:\n  tag: \"1.0.0\"\n",
+			err:     "multi-document YAML files are not supported",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := []string{"image", "tag"}
+			if _, _, err := (yamlWriter{}).Set([]byte(tt.content), key, "2.0.0"); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Set() error = %v, want %q", err, tt.err)
+			}
+			if _, _, err := (yamlWriter{}).Get([]byte(tt.content), key); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Get() error = %v, want %q", err, tt.err)
+			}
+			if _, _, err := (kustomizeWriter{}).Set([]byte(tt.content), []string{"app"}, "2.0.0"); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("kustomize Set() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestYAMLSet(t *testing.T) {
+	runSetTests(t, config.FormatYAML, []setTest{
+		{
+			name:    "empty file",
+			content: "",
+			key:     "image.tag",
+			want:    "image:\n  tag: \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "double quoted string with a comment",
+			content: "image:\n  repository: app\n  tag: \"1.0\" # pinned\n",
+			key:     "image.tag",
+			want:    "image:\n  repository: app\n  tag: \"2.0\" # pinned\n",
+			changed: true,
+		},
+		{
+			name:    "single quoted string",
+			content: "image:\n  repository: app\n  tag: '1.0'\n",
+			key:     "image.tag",
+			want:    "image:\n  repository: app\n  tag: '2.0'\n",
+			changed: true,
+		},
+		{
+			name:    "number becomes a string",
+			content: "image:\n  tag: 1.0\n",
+			key:     "image.tag",
+			want:    "image:\n  tag: \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "unchanged",
+			content: "image:\n  tag: \"2.0\"\n",
+			key:     "image.tag",
+			want:    "image:\n  tag: \"2.0\"\n",
+		},
+		{
+			name:    "key without a value",
+			content: "image:\n  tag:\n",
+			key:     "image.tag",
+			want:    "image:\n  tag: \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "anchor",
+			content: "image:\n  tag: &tag 1.0\n",
+			key:     "image.tag",
+			want:    "image:\n  tag: &tag \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "flow mapping",
+			content: "image: {tag: 1.0}\n",
+			key:     "image.tag",
+			want:    "image: {tag: \"2.0\"}\n",
+			changed: true,
+		},
+		{
+			name:    "document start",
+			content: "---\nimage:\n  tag: \"1.0\"\n",
+			key:     "image.tag",
+			want:    "---\nimage:\n  tag: \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "document end",
+			content: "image:\n  tag: \"1.0\"\n...\n",
+			key:     "image.tag",
+			want:    "image:\n  tag: \"2.0\"\n...\n",
+			changed: true,
+		},
+		{
+			name:    "new key before a blank line",
+			content: "image:\n    repository: app\n\nother: 1\n",
+			key:     "image.tag",
+			want:    "image:\n    repository: app\n    tag: \"2.0\"\n\nother: 1\n",
+			changed: true,
+		},
+		{
+			name:    "new key after a sequence",
+			content: "image:\n  tags:\n    - a\n  other: 1\n",
+			key:     "image.tag",
+			want:    "image:\n  tags:\n    - a\n  other: 1\n  tag: \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "new mappings indented like the document",
+			content: "image:\n    repository: app\nother: 1\n",
+			key:     "app.image.tag",
+			want:    "image:\n    repository: app\nother: 1\napp:\n    image:\n        tag: \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "new key of a flow mapping",
+			content: "image: {tag: 1.0}\n",
+			key:     "image.other",
+			err:     "cannot add other to a flow mapping",
+		},
+		{
+			name:    "block scalar",
+			content: "image:\n  tag: |\n    1.0\n",
+			key:     "image.tag",
+			err:     "block scalars cannot be updated",
+		},
+		{
+			name:    "scalar on the path",
+			content: "image: app\n",
+			key:     "image.tag",
+			err:     "image is not a mapping",
+		},
+		{
+			name:    "sequence document",
+			content: "- a\n",
+			key:     "image.tag",
+			err:     "the YAML document is not a mapping",
+		},
+		{
+			name:    "syntax error",
+			content: "a:\n  b: [1\n",
+			key:     "image.tag",
+			err:     "failed to parse YAML",
+		},
+	})
+}
+
+func TestYAMLGet(t *testing.T) {
+	runGetTests(t, config.FormatYAML, []getTest{
+		{name: "empty file", content: "", key: "image.tag"},
+		{name: "string", content: "image:\n  tag: \"1.0\"\n", key: "image.tag", value: "1.0", ok: true},
+		{name: "number", content: "image:\n  tag: 1.0\n", key: "image.tag", value: "1.0", ok: true},
+		{name: "missing key", content: "image:\n  tag: \"1.0\"\n", key: "image.name"},
+		{name: "mapping", content: "image:\n  tag: \"1.0\"\n", key: "image"},
+		{name: "scalar on the path", content: "image: app\n", key: "image.tag"},
+		{name: "syntax error", content: "a: [1\n", key: "a", err: "failed to parse YAML"},
+	})
+}
+
+func TestKustomizeSet(t *testing.T) {
+	runSetTests(t, config.FormatKustomize, []setTest{
+		{
+			name:    "empty file",
+			content: "",
+			key:     "app",
+			want:    "images:\n- name: app\n  newTag: \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "without images",
+			content: "resources:\n  - deploy.yaml\n",
+			key:     "app",
+			want:    "resources:\n  - deploy.yaml\nimages:\n- name: app\n  newTag: \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "existing image",
+			content: "images:\n  - name: app\n    newTag: \"1.0\"\n  - name: db\n    newTag: 5\n",
+			key:     "app",
+			want:    "images:\n  - name: app\n    newTag: \"2.0\"\n  - name: db\n    newTag: 5\n",
+			changed: true,
+		},
+		{
+			name:    "unchanged",
+			content: "images:\n  - name: app\n    newTag: \"2.0\"\n",
+			key:     "app",
+			want:    "images:\n  - name: app\n    newTag: \"2.0\"\n",
+		},
+		{
+			name:    "image without a tag",
+			content: "images:\n  - name: app\n    newName: registry.example.com/app\n",
+			key:     "app",
+			want:    "images:\n  - name: app\n    newName: registry.example.com/app\n    newTag: \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "new image indented like the others",
+			content: "images:\n- name: db\n  newTag: \"5\"\nresources:\n- a.yaml\n",
+			key:     "app",
+			want:    "images:\n- name: db\n  newTag: \"5\"\n- name: app\n  newTag: \"2.0\"\nresources:\n- a.yaml\n",
+			changed: true,
+		},
+		{
+			name:    "image name with dots",
+			content: "images:\n  - name: registry.example.com/app\n    newTag: \"1.0\"\n",
+			key:     "registry.example.com/app",
+			want:    "images:\n  - name: registry.example.com/app\n    newTag: \"2.0\"\n",
+			changed: true,
+		},
+		{
+			name:    "empty images",
+			content: "images: []\nresources:\n  - a.yaml\n",
+			key:     "app",
+			want:    "images:\n- name: app\n  newTag: \"2.0\"\nresources:\n  - a.yaml\n",
+			changed: true,
+		},
+		{
+			name:    "flow sequence",
+			content: "images: [{name: db}]\n",
+			key:     "app",
+			err:     "images is not a block sequence",
+		},
+	})
+}
+
+func TestKustomizeGet(t *testing.T) {
+	content := "images:\n  - name: app\n    newTag: \"1.0\"\n  - name: db\n    newName: postgres\n"
+	runGetTests(t, config.FormatKustomize, []getTest{
+		{name: "image", content: content, key: "app", value: "1.0", ok: true},
+		{name: "image without a tag", content: content, key: "db"},
+		{name: "missing image", content: content, key: "web"},
+		{name: "without images", content: "resources: []\n", key: "app"},
+	})
+}
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "git_watcher"
+
+// Result label values
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Artifacts update result label values
+const (
+	ArtifactsUpdated   = "updated"
+	ArtifactsUnchanged = "unchanged"
+	ArtifactsFailed    = "failed"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	branchChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "branch_checks_total",
+		Help:      "Checks of a watched branch, by result.",
+	}, []string{"repository", "branch", "result"})
+
+	branchCheckDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "branch_check_duration_seconds",
+		Help:      "Duration of the checks of a watched branch.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"repository", "branch"})
+
+	lastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_sync_timestamp_seconds",
+		Help:      "Unix time of the last successful check of a watched branch.",
+	}, []string{"repository", "branch"})
+
+	submoduleUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "submodule_updates_total",
+		Help:      "Submodules moved to a new commit in a watched branch.",
+	}, []string{"repository", "branch", "submodule"})
+
+	gitFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "git_failures_total",
+		Help:      "Failed git operations, by operation (clone, fetch, push, merge, ...).",
+	}, []string{"operation"})
+
+	webhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook notifications sent, by subscriber, event and result.",
+	}, []string{"subscriber", "event", "result"})
+
+	webhookOutboxSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "webhook_outbox_size",
+		Help:      "Webhook notifications waiting in the outbox for redelivery.",
+	})
+
+	artifactsUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "artifacts_updates_total",
+		Help:      "Artifacts repository updates, by artifact repository, package and result.",
+	}, []string{"repository", "package", "result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		branchChecks,
+		branchCheckDuration,
+		lastSuccess,
+		submoduleUpdates,
+		gitFailures,
+		webhookDeliveries,
+		webhookOutboxSize,
+		artifactsUpdates,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveBranchCheck records a finished check of a watched branch
+func ObserveBranchCheck(repository, branch string, duration time.Duration, err error) {
+	branchCheckDuration.WithLabelValues(repository, branch).Observe(duration.Seconds())
+	if err != nil {
+		branchChecks.WithLabelValues(repository, branch, ResultFailure).Inc()
+		return
+	}
+	branchChecks.WithLabelValues(repository, branch, ResultSuccess).Inc()
+	lastSuccess.WithLabelValues(repository, branch).SetToCurrentTime()
+}
+
+// AddSubmoduleUpdate records a submodule moved to a new commit
+func AddSubmoduleUpdate(repository, branch, submodule string) {
+	submoduleUpdates.WithLabelValues(repository, branch, submodule).Inc()
+}
+
+// AddGitFailure records a failed git operation
+func AddGitFailure(operation string) {
+	gitFailures.WithLabelValues(operation).Inc()
+}
+
+// ObserveWebhookDelivery records a webhook notification attempt to a subscriber
+func ObserveWebhookDelivery(subscriber, event string, err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultFailure
+	}
+	webhookDeliveries.WithLabelValues(subscriber, event, result).Inc()
+}
+
+// SetWebhookOutboxSize records the number of notifications waiting in the outbox
+func SetWebhookOutboxSize(n int) {
+	webhookOutboxSize.Set(float64(n))
+}
+
+// AddArtifactsUpdate records an update of the artifacts repository with one of the Artifacts* results
+func AddArtifactsUpdate(repository, pkg, result string) {
+	artifactsUpdates.WithLabelValues(repository, pkg, result).Inc()
+}
@@ -3,12 +3,15 @@ package scheduler
 import (
 	"context"
 	"fmt"
-	"log"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
 	config "github.com/Jieay/git-watcher/configs"
 	"github.com/Jieay/git-watcher/internal/git"
+	"github.com/Jieay/git-watcher/internal/history"
+	"github.com/Jieay/git-watcher/internal/logging"
 	"github.com/Jieay/git-watcher/internal/webhook"
 )
 
@@ -17,18 +20,40 @@ type Scheduler struct {
 	config        *config.ScheduleConfig
 	gitManager    *git.Manager
 	webhookClient *webhook.Client
+	history       *history.Store
 	ticker        *time.Ticker
 	mutex         sync.Mutex
 	running       bool
 	stopCh        chan struct{}
+	nextRun       time.Time
+	lastRun       RunTimes
+	// ctx is cancelled on Stop to abort in-flight checks, which are tracked by checks
+	ctx    context.Context
+	cancel context.CancelFunc
+	checks sync.WaitGroup
+}
+
+// RunTimes records when a scheduled check of all repositories started and finished
+type RunTimes struct {
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Status describes the state of the scheduler
+type Status struct {
+	Running  bool       `json:"running"`
+	Interval string     `json:"interval"`
+	NextRun  *time.Time `json:"nextRun,omitempty"`
+	LastRun  RunTimes   `json:"lastRun"`
 }
 
 // NewScheduler creates a new scheduler
-func NewScheduler(cfg *config.ScheduleConfig, gitManager *git.Manager, webhookClient *webhook.Client) *Scheduler {
+func NewScheduler(cfg *config.ScheduleConfig, gitManager *git.Manager, webhookClient *webhook.Client, historyStore *history.Store) *Scheduler {
 	return &Scheduler{
 		config:        cfg,
 		gitManager:    gitManager,
 		webhookClient: webhookClient,
+		history:       historyStore,
 		stopCh:        make(chan struct{}),
 	}
 }
@@ -47,42 +72,64 @@ func (s *Scheduler) Start(ctx context.Context) error {
 	}
 
 	s.ticker = time.NewTicker(s.config.CheckInterval)
+	s.ctx, s.cancel = context.WithCancel(ctx)
 	s.running = true
+	s.nextRun = time.Now().Add(s.config.CheckInterval)
 
+	s.checks.Add(1)
 	go func() {
+		defer s.checks.Done()
+
 		// Run once immediately
-		s.runCheck()
+		s.runScheduledCheck(s.ctx)
 
 		for {
 			select {
-			case <-s.ticker.C:
-				s.runCheck()
+			case tick := <-s.ticker.C:
+				s.mutex.Lock()
+				s.nextRun = tick.Add(s.config.CheckInterval)
+				s.mutex.Unlock()
+				s.runScheduledCheck(s.ctx)
 			case <-s.stopCh:
 				s.ticker.Stop()
 				return
-			case <-ctx.Done():
+			case <-s.ctx.Done():
 				s.ticker.Stop()
 				return
 			}
 		}
 	}()
 
-	log.Printf("Scheduler started with interval: %v\n", s.config.CheckInterval)
+	logging.FromContext(ctx).Info("scheduler started", "interval", s.config.CheckInterval)
 	return nil
 }
 
-// Stop stops the scheduler
-func (s *Scheduler) Stop() {
+// Stop stops the scheduler and cancels in-flight checks, then waits for them
+// to return until ctx is done
+func (s *Scheduler) Stop(ctx context.Context) error {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
 	if !s.running {
-		return
+		s.mutex.Unlock()
+		return nil
 	}
-
 	close(s.stopCh)
+	s.cancel()
 	s.running = false
-	log.Println("Scheduler stopped")
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.checks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logging.FromContext(ctx).Info("scheduler stopped")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for running checks: %w", ctx.Err())
+	}
 }
 
 // IsRunning returns true if the scheduler is running
@@ -92,52 +139,167 @@ func (s *Scheduler) IsRunning() bool {
 	return s.running
 }
 
-// runCheck performs a check for repository updates on all configured branches
-func (s *Scheduler) runCheck() {
-	log.Println("Running scheduled check for repository updates on all configured branches")
+// Status returns the state of the scheduler and the times of its scheduled checks
+func (s *Scheduler) Status() Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status := Status{
+		Running:  s.running,
+		Interval: s.config.CheckInterval.String(),
+		LastRun:  s.lastRun,
+	}
+	if s.running {
+		nextRun := s.nextRun
+		status.NextRun = &nextRun
+	}
+	return status
+}
+
+// runScheduledCheck runs a periodic check and records its start and end
+func (s *Scheduler) runScheduledCheck(ctx context.Context) {
+	started := time.Now()
+	s.mutex.Lock()
+	s.lastRun = RunTimes{StartedAt: &started}
+	s.mutex.Unlock()
+
+	s.runCheck(ctx, history.TriggerSchedule)
+
+	finished := time.Now()
+	s.mutex.Lock()
+	s.lastRun.FinishedAt = &finished
+	s.mutex.Unlock()
+}
+
+// runCheck performs a check for repository updates on every watched repository
+func (s *Scheduler) runCheck(ctx context.Context, trigger history.Trigger) {
+	logging.FromContext(ctx).Info("checking all watched repositories for updates", "trigger", trigger)
+
+	var wg sync.WaitGroup
+	for _, repo := range s.gitManager.Repositories() {
+		wg.Add(1)
+		go func(repo *config.Repository) {
+			defer wg.Done()
+			s.checkRepository(ctx, repo, trigger)
+		}(repo)
+	}
+	wg.Wait()
+}
+
+// checkRepository checks all configured branches of a single repository, records
+// the run and sends one notification keyed by the repository name, then checks its tags
+func (s *Scheduler) checkRepository(ctx context.Context, repo *config.Repository, trigger history.Trigger) {
+	s.checkBranches(ctx, repo, s.gitManager.GetConfig().BranchesFor(repo), trigger)
+	s.checkTags(ctx, repo)
+}
 
-	// Get configured branches
-	gitConfig := s.gitManager.GetConfig()
-	branches := gitConfig.Branches
+// checkTags sends a tag_created notification for each new tag of a repository matching its
+// tag patterns
+func (s *Scheduler) checkTags(ctx context.Context, repo *config.Repository) {
+	if len(repo.Tags) == 0 {
+		return
+	}
+	ctx = logging.With(ctx, logging.KeyRepository, repo.GetName())
+	logger := logging.FromContext(ctx)
+
+	tags, err := s.gitManager.CheckTags(ctx, repo)
+	if err != nil {
+		logger.Error("failed to check tags", "error", err)
+		return
+	}
+	for _, tag := range tags {
+		payload := webhook.WebhookPayload{
+			Event:      "tag_created",
+			Timestamp:  time.Now(),
+			Repository: repo.GetName(),
+			Message:    fmt.Sprintf("Tag %s created in %s", tag.Name, repo.GetName()),
+			Tag: &webhook.Tag{
+				Name:       tag.Name,
+				Commit:     tag.Commit,
+				Annotation: tag.Annotation,
+			},
+		}
+		if err := s.webhookClient.SendNotification(ctx, payload); err != nil {
+			logger.Error("failed to send webhook notification", "tag", tag.Name, "error", err)
+		}
+	}
+}
+
+// checkBranches checks the given branches of a repository as one run and notifies about the
+// branches that were checked successfully
+func (s *Scheduler) checkBranches(ctx context.Context, repo *config.Repository, branches []string, trigger history.Trigger) {
+	run := history.NewRun(trigger, repo.GetName())
+	run.DryRun = s.gitManager.IsDryRun(ctx)
+	if err := s.history.Begin(run); err != nil {
+		logging.FromContext(ctx).Warn("failed to record run", logging.KeyRepository, repo.GetName(), "error", err)
+	}
+	ctx = logging.With(ctx, logging.KeyRunID, run.ID, logging.KeyRepository, repo.GetName())
+	logger := logging.FromContext(ctx)
+	logger.Info("run started", "trigger", trigger, "branches", branches)
+	defer func() {
+		run.Finish(nil)
+		if err := s.history.Save(run); err != nil {
+			logger.Warn("failed to save run", "error", err)
+		}
+		logger.Info("run finished", "status", run.Status)
+	}()
 
-	// Check each branch
-	updatedBranches := make([]string, 0, len(branches))
+	// Check each branch concurrently, every branch has its own worktree
+	var (
+		wg              sync.WaitGroup
+		updatedMutex    sync.Mutex
+		updatedBranches = make([]string, 0, len(branches))
+	)
 	for _, branch := range branches {
-		err := s.gitManager.CheckAndUpdateRepoBranch(branch)
-		if err == nil {
+		wg.Add(1)
+		go func(branch string) {
+			defer wg.Done()
+			ctx := logging.With(ctx, logging.KeyBranch, branch)
+			result, err := s.gitManager.CheckAndUpdateRepoBranch(ctx, repo.GetName(), branch)
+			run.AddBranch(result)
+			if err != nil {
+				logging.FromContext(ctx).Error("failed to check/update branch", "error", err)
+				return
+			}
+			if result.Plan != nil {
+				logging.FromContext(ctx).Info("dry run planned branch changes",
+					"submodules", len(result.Plan.Submodules), "commit", result.Plan.Commit != nil)
+				return
+			}
+			updatedMutex.Lock()
 			updatedBranches = append(updatedBranches, branch)
-		} else {
-			log.Printf("Error checking/updating branch %s: %v\n", branch, err)
-		}
+			updatedMutex.Unlock()
+		}(branch)
 	}
+	wg.Wait()
+	sort.Strings(updatedBranches)
 
 	if len(updatedBranches) == 0 {
-		log.Println("No branches were updated")
+		logger.Info("no branches were updated")
 		return
 	}
 
+	s.notifyBranches(ctx, repo, updatedBranches,
+		fmt.Sprintf("Updated %d branches of %s: %v", len(updatedBranches), repo.GetName(), updatedBranches))
+}
+
+// notifyBranches sends one notification about branches of a repository
+func (s *Scheduler) notifyBranches(ctx context.Context, repo *config.Repository, updatedBranches []string, message string) {
+	logger := logging.FromContext(ctx)
+
 	// Create repository updates information
 	repoUpdates := make(map[string]webhook.RepoUpdate)
 
 	// Add an entry for each updated branch
 	for _, branch := range updatedBranches {
-		// Create a temporary copy of the main repo config with the correct branch
-		repoCopy := &config.Repository{
-			URL:       gitConfig.MainRepo.GetURL(),
-			Branch:    branch,
-			Directory: gitConfig.MainRepo.GetDirectory(),
-			Auth:      gitConfig.MainRepo.GetAuth(),
-		}
-
-		// Get commit hash for the branch
-		commitHash, err := s.gitManager.GetLastCommitHash(repoCopy)
+		// Get commit hash for the branch worktree
+		commitHash, err := s.gitManager.GetBranchCommitHash(ctx, repo, branch)
 		if err != nil {
-			log.Printf("Warning: Could not get commit hash for branch %s: %v\n", branch, err)
+			logger.Warn("could not get commit hash", logging.KeyBranch, branch, "error", err)
 			commitHash = "unknown"
 		}
 
 		repoUpdates[branch] = webhook.RepoUpdate{
-			Repository: gitConfig.MainRepo.GetURL(),
+			Repository: repo.GetURL(),
 			Branch:     branch,
 			Timestamp:  time.Now(),
 			CommitHash: commitHash,
@@ -148,25 +310,185 @@ func (s *Scheduler) runCheck() {
 	payload := webhook.WebhookPayload{
 		Event:       "repository_update",
 		Timestamp:   time.Now(),
-		Message:     fmt.Sprintf("Updated %d branches: %v", len(updatedBranches), updatedBranches),
+		Repository:  repo.GetName(),
+		Message:     message,
 		RepoUpdates: repoUpdates,
 	}
 
 	// Send webhook notification
-	if err := s.webhookClient.SendNotification(payload); err != nil {
-		log.Printf("Error sending webhook notification: %v\n", err)
+	if err := s.webhookClient.SendNotification(ctx, payload); err != nil {
+		logger.Error("failed to send webhook notification", "error", err)
 	}
 }
 
-// TriggerManualCheck triggers a manual check for repository updates on all branches
-func (s *Scheduler) TriggerManualCheck() error {
+// TriggerManualCheck triggers a manual check for repository updates on all branches.
+// An empty repository name checks every watched repository.
+func (s *Scheduler) TriggerManualCheck(repoName string) error {
 	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	if !s.running {
-		s.mutex.Unlock()
 		return fmt.Errorf("scheduler is not running")
 	}
-	s.mutex.Unlock()
 
-	go s.runCheck()
+	if repoName == "" {
+		s.goCheck(func(ctx context.Context) { s.runCheck(ctx, history.TriggerWebhook) })
+		return nil
+	}
+
+	repo, err := s.gitManager.Repository(repoName)
+	if err != nil {
+		return err
+	}
+	s.goCheck(func(ctx context.Context) { s.checkRepository(ctx, repo, history.TriggerWebhook) })
+	return nil
+}
+
+// TriggerBranchCheck checks a single branch of a watched repository in the background,
+// recording the run with the given trigger
+func (s *Scheduler) TriggerBranchCheck(repoName, branch string, trigger history.Trigger) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.running {
+		return fmt.Errorf("scheduler is not running")
+	}
+
+	repo, err := s.gitManager.Repository(repoName)
+	if err != nil {
+		return err
+	}
+	s.goCheck(func(ctx context.Context) { s.checkBranches(ctx, repo, []string{branch}, trigger) })
+	return nil
+}
+
+// TriggerTagCheck checks the tags of a watched repository in the background
+func (s *Scheduler) TriggerTagCheck(repoName string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.running {
+		return fmt.Errorf("scheduler is not running")
+	}
+
+	repo, err := s.gitManager.Repository(repoName)
+	if err != nil {
+		return err
+	}
+	s.goCheck(func(ctx context.Context) { s.checkTags(ctx, repo) })
+	return nil
+}
+
+// TriggerSubmoduleUpdate updates the given submodules in the background after their remote
+// was pushed, recording one run per repository with the given trigger
+func (s *Scheduler) TriggerSubmoduleUpdate(targets []git.SubmoduleTarget, trigger history.Trigger) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.running {
+		return fmt.Errorf("scheduler is not running")
+	}
+
+	byRepo := make(map[string][]git.SubmoduleTarget)
+	for _, target := range targets {
+		byRepo[target.Repository] = append(byRepo[target.Repository], target)
+	}
+	for repoName, repoTargets := range byRepo {
+		repo, err := s.gitManager.Repository(repoName)
+		if err != nil {
+			return err
+		}
+		repoTargets := repoTargets
+		s.goCheck(func(ctx context.Context) { s.updateSubmodules(ctx, repo, repoTargets, trigger) })
+	}
+	return nil
+}
+
+// updateSubmodules updates submodules of a repository as one run and notifies about the
+// branches in which a submodule moved
+func (s *Scheduler) updateSubmodules(ctx context.Context, repo *config.Repository, targets []git.SubmoduleTarget, trigger history.Trigger) {
+	run := history.NewRun(trigger, repo.GetName())
+	run.DryRun = s.gitManager.IsDryRun(ctx)
+	if err := s.history.Begin(run); err != nil {
+		logging.FromContext(ctx).Warn("failed to record run", logging.KeyRepository, repo.GetName(), "error", err)
+	}
+	ctx = logging.With(ctx, logging.KeyRunID, run.ID, logging.KeyRepository, repo.GetName())
+	logger := logging.FromContext(ctx)
+	logger.Info("run started", "trigger", trigger, "submodules", len(targets))
+	defer func() {
+		run.Finish(nil)
+		if err := s.history.Save(run); err != nil {
+			logger.Warn("failed to save run", "error", err)
+		}
+		logger.Info("run finished", "status", run.Status)
+	}()
+
+	// Targets of the same branch are serialized by the branch lock
+	var (
+		wg              sync.WaitGroup
+		updatedMutex    sync.Mutex
+		updatedBranches = make([]string, 0, len(targets))
+		updatedPaths    = make([]string, 0, len(targets))
+	)
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target git.SubmoduleTarget) {
+			defer wg.Done()
+			ctx := logging.With(ctx, logging.KeyBranch, target.Branch, logging.KeySubmodule, target.Path)
+			result, err := s.gitManager.UpdateSubmodule(ctx, repo.GetName(), target.Branch, target.Path)
+			run.AddBranch(result)
+			if err != nil {
+				logging.FromContext(ctx).Error("failed to update submodule", "error", err)
+				return
+			}
+			if len(result.Submodules) == 0 {
+				return
+			}
+			updatedMutex.Lock()
+			if !slices.Contains(updatedBranches, target.Branch) {
+				updatedBranches = append(updatedBranches, target.Branch)
+			}
+			if !slices.Contains(updatedPaths, target.Path) {
+				updatedPaths = append(updatedPaths, target.Path)
+			}
+			updatedMutex.Unlock()
+		}(target)
+	}
+	wg.Wait()
+	sort.Strings(updatedBranches)
+	sort.Strings(updatedPaths)
+
+	if len(updatedBranches) == 0 {
+		logger.Info("no submodules were updated")
+		return
+	}
+
+	s.notifyBranches(ctx, repo, updatedBranches,
+		fmt.Sprintf("Updated submodules %v in %d branches of %s: %v", updatedPaths, len(updatedBranches), repo.GetName(), updatedBranches))
+}
+
+// TriggerBranchRemoval removes the worktree of a branch deleted from the remote in the background
+func (s *Scheduler) TriggerBranchRemoval(repoName, branch string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.running {
+		return fmt.Errorf("scheduler is not running")
+	}
+
+	repo, err := s.gitManager.Repository(repoName)
+	if err != nil {
+		return err
+	}
+	s.goCheck(func(ctx context.Context) {
+		ctx = logging.With(ctx, logging.KeyRepository, repo.GetName(), logging.KeyBranch, branch)
+		if _, err := s.gitManager.RemoveBranchWorktree(ctx, repo, branch); err != nil {
+			logging.FromContext(ctx).Error("failed to remove branch worktree", "error", err)
+		}
+	})
 	return nil
 }
+
+// goCheck runs a manual check in the background, tracked so Stop can wait for it
+func (s *Scheduler) goCheck(check func(ctx context.Context)) {
+	s.checks.Add(1)
+	go func() {
+		defer s.checks.Done()
+		check(s.ctx)
+	}()
+}
@@ -0,0 +1,176 @@
+package version
+
+import (
+	"fmt"
+	"strings"
+)
+
+// comparator compares a version with a bound
+type comparator struct {
+	op    string // One of "=", "!=", ">", ">=", "<", "<="
+	bound Version
+}
+
+// check reports whether v satisfies the comparator
+func (c comparator) check(v Version) bool {
+	cmp := v.Compare(c.bound)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// Constraint is a set of version ranges, such as "^1.4", "~1.4.2", ">=1.2, <2" or
+// "1.x || 2.x". Comparators separated by spaces or commas must all match; ranges
+// separated by "||" are alternatives.
+type Constraint struct {
+	text   string
+	ranges [][]comparator
+}
+
+// ParseConstraint parses a version constraint. Supported terms are exact versions ("1.4.2"),
+// partial and wildcard versions ("1.4", "1.4.x", "*"), caret ranges ("^1.4" allows changes
+// that do not modify the left-most non-zero number), tilde ranges ("~1.4" allows patch
+// changes) and comparisons ("=", "!=", ">", ">=", "<", "<=").
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{text: s}
+	for _, alternative := range strings.Split(s, "||") {
+		terms := strings.FieldsFunc(alternative, func(r rune) bool { return r == ' ' || r == ',' })
+		if len(terms) == 0 {
+			return nil, fmt.Errorf("invalid constraint %q: empty range", s)
+		}
+		var comparators []comparator
+		for i := 0; i < len(terms); i++ {
+			term := terms[i]
+			// Allow a space between an operator and its version, as in ">= 1.4"
+			if strings.Trim(term, "<>=!^~") == "" && i+1 < len(terms) {
+				i++
+				term += terms[i]
+			}
+			parsed, err := parseTerm(term)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %q: %w", s, err)
+			}
+			comparators = append(comparators, parsed...)
+		}
+		c.ranges = append(c.ranges, comparators)
+	}
+	return c, nil
+}
+
+// parseTerm translates a single term of a constraint into comparators
+func parseTerm(term string) ([]comparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", "!=", "^", "~", ">", "<", "="} {
+		if rest, ok := strings.CutPrefix(term, prefix); ok {
+			op, term = prefix, rest
+			break
+		}
+	}
+
+	if isWildcard(term) {
+		if op == "" || op == "=" || op == ">=" || op == "^" || op == "~" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("term %s%s matches nothing", op, term)
+	}
+
+	v, parts, _, err := parse(term)
+	if err != nil {
+		return nil, err
+	}
+	if parts == 0 {
+		return nil, fmt.Errorf("invalid version %q", term)
+	}
+	// next returns the lowest version above every version matching the first n components
+	next := func(n int) Version {
+		switch n {
+		case 1:
+			return Version{Major: v.Major + 1}
+		case 2:
+			return Version{Major: v.Major, Minor: v.Minor + 1}
+		}
+		return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+	lower := comparator{">=", v}
+
+	switch op {
+	case "", "=":
+		if parts == 3 {
+			return []comparator{{"=", v}}, nil
+		}
+		return []comparator{lower, {"<", next(parts)}}, nil
+	case "!=":
+		if parts == 3 {
+			return []comparator{{"!=", v}}, nil
+		}
+		return nil, fmt.Errorf("term !=%s needs a full version", term)
+	case "^":
+		switch {
+		case v.Major > 0 || parts == 1:
+			return []comparator{lower, {"<", next(1)}}, nil
+		case v.Minor > 0 || parts == 2:
+			return []comparator{lower, {"<", next(2)}}, nil
+		}
+		return []comparator{lower, {"<", next(3)}}, nil
+	case "~":
+		if parts == 1 {
+			return []comparator{lower, {"<", next(1)}}, nil
+		}
+		return []comparator{lower, {"<", next(2)}}, nil
+	case ">":
+		if parts == 3 {
+			return []comparator{{">", v}}, nil
+		}
+		return []comparator{{">=", next(parts)}}, nil
+	case "<=":
+		if parts == 3 {
+			return []comparator{{"<=", v}}, nil
+		}
+		return []comparator{{"<", next(parts)}}, nil
+	}
+	return []comparator{{op, v}}, nil
+}
+
+// Check reports whether v satisfies the constraint. Prerelease versions only satisfy a range
+// with a comparator naming a prerelease of the same major, minor and patch numbers, so "^1.4"
+// does not select "1.5.0-rc.1".
+func (c *Constraint) Check(v Version) bool {
+	for _, comparators := range c.ranges {
+		if checkRange(comparators, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRange reports whether v satisfies all comparators of a range
+func checkRange(comparators []comparator, v Version) bool {
+	prereleaseAllowed := v.Prerelease == ""
+	for _, comparator := range comparators {
+		if !comparator.check(v) {
+			return false
+		}
+		bound := comparator.bound
+		if bound.Prerelease != "" && bound.Major == v.Major && bound.Minor == v.Minor && bound.Patch == v.Patch {
+			prereleaseAllowed = true
+		}
+	}
+	return prereleaseAllowed
+}
+
+// String returns the constraint as it was written
+func (c *Constraint) String() string {
+	return c.text
+}
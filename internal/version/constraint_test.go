@@ -0,0 +1,81 @@
+package version
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConstraintErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{in: "", err: "empty range"},
+		{in: "1.x ||", err: "empty range"},
+		{in: ">=1.x.3", err: `component "3" follows a wildcard`},
+		{in: ">*", err: "term >* matches nothing"},
+		{in: "<x", err: "term <x matches nothing"},
+		{in: "!=1.2", err: "term !=1.2 needs a full version"},
+		{in: "^abc", err: `component "abc" is not a number`},
+		{in: ">= ", err: `invalid version ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			_, err := ParseConstraint(tt.in)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseConstraint() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestConstraintCheck(t *testing.T) {
+	tests := []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+	}{
+		{constraint: "*", match: []string{"0.0.1", "1.2.3", "10.0.0"}, noMatch: []string{"1.0.0-rc.1"}},
+		{constraint: "1.2.3", match: []string{"1.2.3", "v1.2.3+build"}, noMatch: []string{"1.2.4", "1.2.3-rc.1"}},
+		{constraint: "=1.4", match: []string{"1.4.0", "1.4.9"}, noMatch: []string{"1.3.9", "1.5.0"}},
+		{constraint: "1.x", match: []string{"1.0.0", "1.99.0"}, noMatch: []string{"0.9.0", "2.0.0"}},
+		{constraint: "1.x.x", match: []string{"1.0.0", "1.4.2"}, noMatch: []string{"2.0.0"}},
+		{constraint: "1.4.x", match: []string{"1.4.0", "1.4.7"}, noMatch: []string{"1.5.0"}},
+		{constraint: "^1.4", match: []string{"1.4.0", "1.9.3"}, noMatch: []string{"1.3.9", "2.0.0", "1.5.0-rc.1"}},
+		{constraint: "^0.4.2", match: []string{"0.4.2", "0.4.9"}, noMatch: []string{"0.5.0", "0.4.1"}},
+		{constraint: "^0.0.3", match: []string{"0.0.3"}, noMatch: []string{"0.0.4"}},
+		{constraint: "^0", match: []string{"0.0.1", "0.9.0"}, noMatch: []string{"1.0.0"}},
+		{constraint: "~1.4.2", match: []string{"1.4.2", "1.4.9"}, noMatch: []string{"1.4.1", "1.5.0"}},
+		{constraint: "~1", match: []string{"1.0.0", "1.9.0"}, noMatch: []string{"2.0.0"}},
+		{constraint: ">=1.2, <2", match: []string{"1.2.0", "1.9.9"}, noMatch: []string{"1.1.9", "2.0.0"}},
+		{constraint: ">= 1.2 < 2", match: []string{"1.5.0"}, noMatch: []string{"2.0.0"}},
+		{constraint: ">1.2", match: []string{"1.3.0"}, noMatch: []string{"1.2.9"}},
+		{constraint: ">1.2.3", match: []string{"1.2.4"}, noMatch: []string{"1.2.3"}},
+		{constraint: "<=1.2", match: []string{"1.2.9"}, noMatch: []string{"1.3.0"}},
+		{constraint: "<1.2", match: []string{"1.1.9"}, noMatch: []string{"1.2.0"}},
+		{constraint: "!=1.2.3", match: []string{"1.2.4"}, noMatch: []string{"1.2.3"}},
+		{constraint: "1.x || 3.x", match: []string{"1.5.0", "3.0.0"}, noMatch: []string{"2.0.0"}},
+		{constraint: ">=1.5.0-rc.1", match: []string{"1.5.0-rc.2", "1.5.0", "1.6.0"}, noMatch: []string{"1.5.0-beta.1", "1.6.0-rc.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			c, err := ParseConstraint(tt.constraint)
+			if err != nil {
+				t.Fatalf("ParseConstraint() error = %v", err)
+			}
+			if c.String() != tt.constraint {
+				t.Errorf("String() = %q", c.String())
+			}
+			for _, v := range tt.match {
+				if !c.Check(mustParse(t, v)) {
+					t.Errorf("Check(%s) = false, want true", v)
+				}
+			}
+			for _, v := range tt.noMatch {
+				if c.Check(mustParse(t, v)) {
+					t.Errorf("Check(%s) = true, want false", v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version schemes of artifact versions
+const (
+	SchemeBuild  = "build"  // <prefix>-<build number>, such as "pkg-1.0-3"
+	SchemeSemver = "semver" // [<name>-]<semantic version>, such as "pkg-1.2.3-rc.1"
+	SchemeCalver = "calver" // [<name>-]<year>.<month>[.<day>][.<micro>][-<build>], such as "pkg-2024.06.2"
+)
+
+// Release is an artifact version parsed by a scheme
+type Release struct {
+	Original string // Text the release was parsed from
+	Name     string // Text before the version number, such as "pkg" for "pkg-1.2.3"
+	// Line groups the releases replacing each other: the prefix for build numbers, the name
+	// followed by the major and minor numbers for semantic versions and by the year and
+	// month for calendar versions, such as "pkg-1.2"
+	Line string
+
+	scheme    string
+	semver    Version // Semantic version
+	numbers   []int   // Numbers of build and calendar versions
+	unordered bool    // Build version without a build number, which is not compared with other releases
+}
+
+// Comparable reports whether two releases can be ordered: they were parsed by the same scheme
+// and, for build numbers, belong to the same line, or otherwise have the same name. Build
+// versions without a build number are not comparable.
+func (r Release) Comparable(o Release) bool {
+	if r.scheme != o.scheme || r.unordered || o.unordered {
+		return false
+	}
+	if r.scheme == SchemeBuild {
+		return r.Line == o.Line
+	}
+	return r.Name == o.Name
+}
+
+// Compare returns -1, 0 or 1 when r is older than, equal to or newer than o. The releases
+// must be comparable.
+func (r Release) Compare(o Release) int {
+	if r.scheme == SchemeSemver {
+		return r.semver.Compare(o.semver)
+	}
+	for i := 0; i < len(r.numbers) && i < len(o.numbers); i++ {
+		if r.numbers[i] != o.numbers[i] {
+			return compareInts(r.numbers[i], o.numbers[i])
+		}
+	}
+	return compareInts(len(r.numbers), len(o.numbers))
+}
+
+// Scheme parses artifact versions
+type Scheme struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// NewScheme returns a version scheme. Without a pattern, the version number is found after
+// the last dash for build numbers and after the first dash it parses after for semantic and
+// calendar versions. Build versions without a number after the last dash are accepted with
+// the text before the last dash, empty without a dash, as their line, but are not ordered. A pattern is a regular expression matching the whole artifact version
+// whose group named "version" holds the version number; the group named "name", or else the
+// text before the version number without trailing separators, is the name.
+func NewScheme(name, pattern string) (*Scheme, error) {
+	switch name {
+	case SchemeBuild, SchemeSemver, SchemeCalver:
+	default:
+		return nil, fmt.Errorf("unknown version scheme %q, expected %s, %s or %s", name, SchemeBuild, SchemeSemver, SchemeCalver)
+	}
+	s := &Scheme{name: name}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version pattern %q: %w", pattern, err)
+		}
+		if re.SubexpIndex("version") < 0 {
+			return nil, fmt.Errorf("invalid version pattern %q: no group named version", pattern)
+		}
+		s.pattern = re
+	}
+	return s, nil
+}
+
+// Parse parses an artifact version
+func (s *Scheme) Parse(v string) (Release, error) {
+	if s.pattern != nil {
+		return s.parsePattern(v)
+	}
+	if s.name == SchemeBuild {
+		prefix, number := "", v
+		if i := strings.LastIndex(v, "-"); i >= 0 {
+			prefix, number = v[:i], v[i+1:]
+		}
+		if r, err := s.parseNumber(v, prefix, number); err == nil {
+			return r, nil
+		}
+		return Release{Original: v, Name: prefix, Line: prefix, scheme: s.name, unordered: true}, nil
+	}
+	// The version number starts at the beginning or after a dash
+	start := 0
+	for {
+		if r, err := s.parseNumber(v, strings.TrimSuffix(v[:start], "-"), v[start:]); err == nil {
+			return r, nil
+		}
+		next := strings.Index(v[start:], "-")
+		if next < 0 {
+			break
+		}
+		start += next + 1
+	}
+	return Release{}, fmt.Errorf("version %q does not contain a %s version", v, s.name)
+}
+
+// parsePattern parses an artifact version with the pattern of the scheme
+func (s *Scheme) parsePattern(v string) (Release, error) {
+	match := s.pattern.FindStringSubmatchIndex(v)
+	if match == nil || match[0] != 0 || match[1] != len(v) {
+		return Release{}, fmt.Errorf("version %q does not match pattern %q", v, s.pattern)
+	}
+	group := s.pattern.SubexpIndex("version")
+	if match[2*group] < 0 {
+		return Release{}, fmt.Errorf("version %q has no version number", v)
+	}
+	number := v[match[2*group]:match[2*group+1]]
+	name := strings.TrimRight(v[:match[2*group]], "-_.")
+	if i := s.pattern.SubexpIndex("name"); i >= 0 && match[2*i] >= 0 {
+		name = v[match[2*i]:match[2*i+1]]
+	}
+	r, err := s.parseNumber(v, name, number)
+	if err != nil {
+		return Release{}, fmt.Errorf("version %q: %w", v, err)
+	}
+	return r, nil
+}
+
+// parseNumber parses the version number of an artifact version
+func (s *Scheme) parseNumber(original, name, number string) (Release, error) {
+	r := Release{Original: original, Name: name, scheme: s.name}
+	var line string
+	switch s.name {
+	case SchemeBuild:
+		n, err := parseNumber(number)
+		if err != nil {
+			return r, fmt.Errorf("build number %q is not a number", number)
+		}
+		if name == "" {
+			return r, fmt.Errorf("version %q has no prefix before its build number", original)
+		}
+		r.numbers = []int{n}
+		r.Line = name
+		return r, nil
+	case SchemeSemver:
+		v, parts, wildcard, err := parse(number)
+		if err != nil || wildcard || parts < 3 || !startsWithDigit(strings.TrimLeft(number, "vV")) {
+			return r, fmt.Errorf("%q is not a semantic version", number)
+		}
+		r.semver = v
+		line = fmt.Sprintf("%d.%d", v.Major, v.Minor)
+	case SchemeCalver:
+		date, build, hasBuild := strings.Cut(number, "-")
+		fields := strings.Split(date, ".")
+		if len(fields) < 2 || len(fields) > 4 || (len(fields[0]) != 2 && len(fields[0]) != 4) {
+			return r, fmt.Errorf("%q is not a calendar version", number)
+		}
+		if hasBuild {
+			fields = append(fields, build)
+		}
+		for _, field := range fields {
+			n, err := parseNumber(field)
+			if err != nil {
+				return r, fmt.Errorf("%q is not a calendar version", number)
+			}
+			r.numbers = append(r.numbers, n)
+		}
+		if r.numbers[1] < 1 || r.numbers[1] > 12 {
+			return r, fmt.Errorf("%q is not a calendar version: invalid month", number)
+		}
+		line = fields[0] + "." + fields[1]
+	}
+	r.Line = line
+	if name != "" {
+		r.Line = name + "-" + line
+	}
+	return r, nil
+}
+
+// parseNumber parses a non-negative decimal number
+func parseNumber(s string) (int, error) {
+	if !startsWithDigit(s) {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return strconv.Atoi(s)
+}
+
+// startsWithDigit reports whether s starts with a decimal digit
+func startsWithDigit(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
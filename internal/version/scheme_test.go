@@ -0,0 +1,153 @@
+package version
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewScheme(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		err     string
+	}{
+		{name: SchemeBuild},
+		{name: SchemeSemver, pattern: `app-(?P<version>.+)`},
+		{name: "date", err: `unknown version scheme "date"`},
+		{name: SchemeCalver, pattern: `(`, err: "invalid version pattern"},
+		{name: SchemeSemver, pattern: `app-(.+)`, err: "no group named version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" "+tt.pattern, func(t *testing.T) {
+			_, err := NewScheme(tt.name, tt.pattern)
+			if tt.err == "" && err != nil {
+				t.Errorf("NewScheme() error = %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("NewScheme() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSchemeParse(t *testing.T) {
+	tests := []struct {
+		scheme  string
+		pattern string
+		in      string
+		name    string
+		line    string
+		err     string
+	}{
+		{scheme: SchemeBuild, in: "pkg-1.0-3", name: "pkg-1.0", line: "pkg-1.0"},
+		{scheme: SchemeBuild, in: "pkg-1.0-x", name: "pkg-1.0", line: "pkg-1.0"},
+		{scheme: SchemeBuild, in: "pkg-1.0-+3", name: "pkg-1.0", line: "pkg-1.0"},
+		{scheme: SchemeBuild, in: "42", name: "", line: ""},
+		{scheme: SchemeBuild, in: "-42", name: "", line: ""},
+		{scheme: SchemeSemver, in: "1.2.3", name: "", line: "1.2"},
+		{scheme: SchemeSemver, in: "pkg-v1.2.3", name: "pkg", line: "pkg-1.2"},
+		{scheme: SchemeSemver, in: "my-pkg-1.2.3-rc.1", name: "my-pkg", line: "my-pkg-1.2"},
+		{scheme: SchemeSemver, in: "pkg-1.2", err: "does not contain a semver version"},
+		{scheme: SchemeSemver, in: "pkg-vx.1.2", err: "does not contain a semver version"},
+		{scheme: SchemeCalver, in: "pkg-2024.06.2", name: "pkg", line: "pkg-2024.06"},
+		{scheme: SchemeCalver, in: "24.6-7", name: "", line: "24.6"},
+		{scheme: SchemeCalver, in: "pkg-2024.13", err: "does not contain a calver version"},
+		{scheme: SchemeCalver, in: "pkg-202.06", err: "does not contain a calver version"},
+		{scheme: SchemeCalver, in: "pkg-2024", err: "does not contain a calver version"},
+		{scheme: SchemeSemver, pattern: `(?P<name>[a-z]+)_build_(?P<version>.+)`, in: "app_build_1.2.3", name: "app", line: "app-1.2"},
+		{scheme: SchemeBuild, pattern: `release/(?P<version>\d+)`, in: "release/7", name: "release/", line: "release/"},
+		{scheme: SchemeBuild, pattern: `(?P<version>\d+)`, in: "7", err: "has no prefix before its build number"},
+		{scheme: SchemeBuild, pattern: `(?P<version>\d+)\.tar`, in: "release-7.tar", err: "does not match pattern"},
+		{scheme: SchemeSemver, pattern: `app-(?P<version>.+)?`, in: "app-", err: "has no version number"},
+		{scheme: SchemeCalver, pattern: `app\.(?P<version>.+)`, in: "app.2024.06", name: "app", line: "app-2024.06"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scheme+" "+tt.in, func(t *testing.T) {
+			s, err := NewScheme(tt.scheme, tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := s.Parse(tt.in)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Parse() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if r.Original != tt.in || r.Name != tt.name || r.Line != tt.line {
+				t.Errorf("Parse() = %q name %q line %q, want name %q line %q", r.Original, r.Name, r.Line, tt.name, tt.line)
+			}
+		})
+	}
+}
+
+func TestReleaseCompare(t *testing.T) {
+	tests := []struct {
+		scheme     string
+		a, b       string
+		comparable bool
+		want       int
+	}{
+		{scheme: SchemeBuild, a: "pkg-1.0-3", b: "pkg-1.0-10", comparable: true, want: -1},
+		{scheme: SchemeBuild, a: "pkg-1.0-3", b: "pkg-1.0-3", comparable: true, want: 0},
+		{scheme: SchemeBuild, a: "pkg-1.1-1", b: "pkg-1.0-9", comparable: false},
+		{scheme: SchemeBuild, a: "pkg-1.0-rc", b: "pkg-1.0-9", comparable: false},
+		{scheme: SchemeBuild, a: "pkg-1.0-rc", b: "pkg-1.0-rc", comparable: false},
+		{scheme: SchemeBuild, a: "pkg", b: "lib", comparable: false},
+		{scheme: SchemeSemver, a: "pkg-1.10.0", b: "pkg-1.9.0", comparable: true, want: 1},
+		{scheme: SchemeSemver, a: "pkg-2.0.0", b: "pkg-1.9.0", comparable: true, want: 1},
+		{scheme: SchemeSemver, a: "pkg-1.0.0-rc.1", b: "pkg-1.0.0", comparable: true, want: -1},
+		{scheme: SchemeSemver, a: "pkg-1.0.0", b: "lib-1.0.0", comparable: false},
+		{scheme: SchemeCalver, a: "pkg-2024.06", b: "pkg-2024.06.1", comparable: true, want: -1},
+		{scheme: SchemeCalver, a: "pkg-2024.12.1", b: "pkg-2025.01", comparable: true, want: -1},
+		{scheme: SchemeCalver, a: "pkg-2024.06.2-3", b: "pkg-2024.06.2-10", comparable: true, want: -1},
+		{scheme: SchemeCalver, a: "pkg-2024.06", b: "lib-2024.06", comparable: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			s, err := NewScheme(tt.scheme, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			a, err := s.Parse(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := s.Parse(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := a.Comparable(b); got != tt.comparable {
+				t.Fatalf("Comparable() = %v, want %v", got, tt.comparable)
+			}
+			if !tt.comparable {
+				return
+			}
+			if got := a.Compare(b); got != tt.want {
+				t.Errorf("Compare() = %d, want %d", got, tt.want)
+			}
+			if got := b.Compare(a); got != -tt.want {
+				t.Errorf("reverse Compare() = %d, want %d", got, -tt.want)
+			}
+		})
+	}
+}
+
+func TestReleasesOfOtherSchemes(t *testing.T) {
+	semver, _ := NewScheme(SchemeSemver, "")
+	calver, _ := NewScheme(SchemeCalver, "")
+	a, err := semver.Parse("pkg-24.6.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := calver.Parse("pkg-24.6.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Comparable(b) {
+		t.Errorf("releases of different schemes are comparable")
+	}
+}
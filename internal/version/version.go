@@ -0,0 +1,164 @@
+// Package version parses semantic versions, such as the names of release tags, and the
+// constraints used to select them.
+package version
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version. A leading "v" and missing minor or patch numbers are
+// accepted, so "v1.4" parses as 1.4.0.
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string // Dot separated identifiers after "-", such as "rc.1"
+	Metadata   string // Build metadata after "+", ignored when comparing
+	Original   string // Text the version was parsed from
+}
+
+// Parse parses a semantic version
+func Parse(s string) (Version, error) {
+	v, _, wildcard, err := parse(s)
+	if err != nil {
+		return Version{}, err
+	}
+	if wildcard {
+		return Version{}, fmt.Errorf("invalid version %q: wildcards are only allowed in constraints", s)
+	}
+	return v, nil
+}
+
+// parse parses a version whose numbers may be missing or wildcards ("x", "X", "*"). Returns
+// the number of numeric components given before the first missing or wildcard one, and
+// whether a wildcard was used.
+func parse(s string) (Version, int, bool, error) {
+	v := Version{Original: s}
+	rest := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "v"), "V")
+	if rest == "" {
+		return v, 0, false, fmt.Errorf("invalid version %q", s)
+	}
+	rest, v.Metadata, _ = strings.Cut(rest, "+")
+	var hasPrerelease bool
+	rest, v.Prerelease, hasPrerelease = strings.Cut(rest, "-")
+	if hasPrerelease {
+		for _, id := range strings.Split(v.Prerelease, ".") {
+			if id == "" {
+				return v, 0, false, fmt.Errorf("invalid version %q: empty prerelease identifier", s)
+			}
+		}
+	}
+
+	fields := strings.Split(rest, ".")
+	if len(fields) > 3 {
+		return v, 0, false, fmt.Errorf("invalid version %q: too many components", s)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	parts := 0
+	for i, field := range fields {
+		if isWildcard(field) {
+			if v.Prerelease != "" {
+				return v, 0, false, fmt.Errorf("invalid version %q: prerelease of a wildcard version", s)
+			}
+			// Only wildcards may follow a wildcard, as in "1.x.x"
+			for _, next := range fields[i+1:] {
+				if !isWildcard(next) {
+					return v, 0, false, fmt.Errorf("invalid version %q: component %q follows a wildcard", s, next)
+				}
+			}
+			return v, parts, true, nil
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return v, 0, false, fmt.Errorf("invalid version %q: component %q is not a number", s, field)
+		}
+		*numbers[i] = n
+		parts++
+	}
+	return v, parts, false, nil
+}
+
+// isWildcard reports whether a component of a version is a wildcard
+func isWildcard(field string) bool {
+	return field == "x" || field == "X" || field == "*"
+}
+
+// String returns the canonical form of the version, without a "v" prefix
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Metadata != "" {
+		s += "+" + v.Metadata
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 when v is lower than, equal to or higher than o, following the
+// precedence rules of semantic versioning
+func (v Version) Compare(o Version) int {
+	for _, pair := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if pair[0] != pair[1] {
+			return compareInts(pair[0], pair[1])
+		}
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+// LessThan reports whether v has a lower precedence than o
+func (v Version) LessThan(o Version) bool {
+	return v.Compare(o) < 0
+}
+
+// compareInts compares two integers
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePrerelease compares prerelease strings; a version without one ranks higher
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return compareInts(an, bn)
+			}
+		case aErr == nil:
+			return -1 // Numeric identifiers rank below alphanumeric ones
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(len(as), len(bs))
+}
+
+// Sort sorts versions in ascending order
+func Sort(versions []Version) {
+	sort.SliceStable(versions, func(i, j int) bool { return versions[i].LessThan(versions[j]) })
+}
@@ -0,0 +1,121 @@
+package version
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Version
+		err  string
+	}{
+		{in: "1.2.3", want: Version{Major: 1, Minor: 2, Patch: 3}},
+		{in: "v1.4", want: Version{Major: 1, Minor: 4}},
+		{in: "V2", want: Version{Major: 2}},
+		{in: "1.2.3-rc.1+build.5", want: Version{Major: 1, Minor: 2, Patch: 3, Prerelease: "rc.1", Metadata: "build.5"}},
+		{in: "1.0.0-alpha-1", want: Version{Major: 1, Prerelease: "alpha-1"}},
+		{in: "", err: `invalid version ""`},
+		{in: "v", err: `invalid version "v"`},
+		{in: "1.2.3.4", err: "too many components"},
+		{in: "1.a.3", err: `component "a" is not a number`},
+		{in: "1..3", err: `component "" is not a number`},
+		{in: "1.2.3-", err: "empty prerelease identifier"},
+		{in: "1.2.3-rc..1", err: "empty prerelease identifier"},
+		{in: "1.x", err: "wildcards are only allowed in constraints"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Parse() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			tt.want.Original = tt.in
+			if got != tt.want {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	for in, want := range map[string]string{
+		"v1.4":             "1.4.0",
+		"1.2.3-rc.1+b.5":   "1.2.3-rc.1+b.5",
+		"V0.0.1+metadata":  "0.0.1+metadata",
+		"10.20.30-alpha.0": "10.20.30-alpha.0",
+	} {
+		v, err := Parse(in)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", in, err)
+		}
+		if got := v.String(); got != want {
+			t.Errorf("Parse(%q).String() = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2", "1.2.0", 0},
+		{"1.2.3+a", "1.2.3+b", 0},
+		{"1.2.3", "1.2.4", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-beta.11", "1.0.0-rc.1", -1},
+		{"1.0.0-rc.1", "1.0.0-alpha", 1},
+	}
+	for _, tt := range tests {
+		a, b := mustParse(t, tt.a), mustParse(t, tt.b)
+		if got := a.Compare(b); got != tt.want {
+			t.Errorf("%s.Compare(%s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.Compare(a); got != -tt.want {
+			t.Errorf("%s.Compare(%s) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+		if got := a.LessThan(b); got != (tt.want < 0) {
+			t.Errorf("%s.LessThan(%s) = %v", tt.a, tt.b, got)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	var versions []Version
+	for _, s := range []string{"1.10.0", "1.0.0", "1.0.0-rc.1", "v0.9", "1.2.0", "1.0.0-alpha"} {
+		versions = append(versions, mustParse(t, s))
+	}
+	Sort(versions)
+	var got []string
+	for _, v := range versions {
+		got = append(got, v.Original)
+	}
+	want := []string{"v0.9", "1.0.0-alpha", "1.0.0-rc.1", "1.0.0", "1.2.0", "1.10.0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Sort() = %v, want %v", got, want)
+	}
+}
+
+func mustParse(t *testing.T, s string) Version {
+	t.Helper()
+	v, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q) error = %v", s, err)
+	}
+	return v
+}
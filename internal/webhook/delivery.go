@@ -0,0 +1,239 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/logging"
+	"github.com/Jieay/git-watcher/internal/metrics"
+)
+
+// SendNotification sends a webhook notification about repository updates to every subscriber
+// whose filters match it. Each subscriber is notified independently: failed attempts are
+// retried with exponential backoff and jitter, and a notification still failing afterwards
+// is stored in the outbox, where RunOutbox keeps redelivering it. The returned error joins
+// the failures of all subscribers.
+func (c *Client) SendNotification(ctx context.Context, payload WebhookPayload) error {
+	subscribers := c.config.AllSubscribers()
+	if len(subscribers) == 0 {
+		return fmt.Errorf("webhook URL is not configured")
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(subscribers))
+	for i, subscriber := range subscribers {
+		subscriberPayload, ok := matchSubscriber(subscriber, payload)
+		if !ok {
+			logging.FromContext(ctx).Debug("webhook subscriber filtered out notification",
+				"subscriber", subscriber.GetName(), "event", payload.Event)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, subscriber *config.Subscriber) {
+			defer wg.Done()
+			if err := c.notify(ctx, subscriber, subscriberPayload); err != nil {
+				errs[i] = fmt.Errorf("subscriber %s: %w", subscriber.GetName(), err)
+			}
+		}(i, subscriber)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Notify sends a notification like SendNotification without waiting for the delivery, so a
+// request handler can respond while a subscriber is retried. ctx only provides the logging
+// attributes: the notification outlives the request and failures are logged.
+func (c *Client) Notify(ctx context.Context, payload WebhookPayload) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(c.background, cancel)
+	c.pending.Add(1)
+	go func() {
+		defer c.pending.Done()
+		defer cancel()
+		defer stop()
+		if err := c.SendNotification(ctx, payload); err != nil {
+			logging.FromContext(ctx).Error("failed to send webhook notification", "event", payload.Event, "error", err)
+		}
+	}()
+}
+
+// Shutdown waits for the notifications sent with Notify until ctx is done, then cancels the
+// remaining ones, which are queued in the outbox, and waits for them to stop
+func (c *Client) Shutdown(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		c.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+	c.stopBackground()
+	<-done
+}
+
+// notify sends a notification to one subscriber, retrying and queueing it in the outbox on failure
+func (c *Client) notify(ctx context.Context, subscriber *config.Subscriber, payload WebhookPayload) error {
+	deliveryID := newDeliveryID()
+	maxAttempts := c.config.Retry.Attempts()
+	attempts := 0
+	var err error
+	for attempts < maxAttempts {
+		attempts++
+		if err = c.deliver(ctx, subscriber, deliveryID, payload); err == nil {
+			return nil
+		}
+		if attempts == maxAttempts || ctx.Err() != nil {
+			break
+		}
+
+		wait := c.backoff(attempts)
+		logging.FromContext(ctx).Warn("webhook delivery failed, retrying",
+			"subscriber", subscriber.GetName(), "delivery", deliveryID, "attempt", attempts, "retry_in", wait, "error", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+	}
+
+	if c.outbox == nil {
+		return fmt.Errorf("webhook delivery failed after %d attempts: %w", attempts, err)
+	}
+	now := time.Now()
+	entry := &OutboxEntry{
+		DeliveryID:    deliveryID,
+		Subscriber:    subscriber.GetName(),
+		Payload:       payload,
+		Attempts:      attempts,
+		CreatedAt:     now,
+		LastAttemptAt: now,
+		NextAttemptAt: now.Add(c.backoff(attempts)),
+		LastError:     err.Error(),
+	}
+	if addErr := c.outbox.Add(entry); addErr != nil {
+		return fmt.Errorf("webhook delivery failed after %d attempts and could not be queued (%v): %w", attempts, addErr, err)
+	}
+	metrics.SetWebhookOutboxSize(c.outbox.Len())
+	return fmt.Errorf("webhook delivery failed after %d attempts, queued for redelivery as outbox entry %d: %w", attempts, entry.ID, err)
+}
+
+// backoff returns the wait before the next attempt after the given number of failed attempts:
+// the initial backoff doubled per attempt up to the maximum, with half of it randomized
+func (c *Client) backoff(attempts int) time.Duration {
+	wait, limit := c.config.Retry.Initial(), c.config.Retry.Max()
+	for i := 1; i < attempts && wait < limit; i++ {
+		wait *= 2
+	}
+	if wait > limit {
+		wait = limit
+	}
+	half := wait / 2
+	return half + time.Duration(mathrand.Int63n(int64(half)+1))
+}
+
+// newDeliveryID returns a random identifier shared by all attempts of a notification
+func newDeliveryID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// RunOutbox redelivers the notifications in the outbox whose next attempt is due, checking
+// every outbox.interval until ctx is done
+func (c *Client) RunOutbox(ctx context.Context) {
+	if c.outbox == nil {
+		return
+	}
+	metrics.SetWebhookOutboxSize(c.outbox.Len())
+
+	ticker := time.NewTicker(c.config.Outbox.ReplayInterval())
+	defer ticker.Stop()
+	for {
+		c.replayOutbox(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// replayOutbox makes one attempt for every due entry
+func (c *Client) replayOutbox(ctx context.Context) {
+	entries, err := c.outbox.List()
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to read webhook outbox", "error", err)
+		return
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		if entry.NextAttemptAt.After(now) {
+			continue
+		}
+		if err := c.Redeliver(ctx, entry.ID); err != nil {
+			logging.FromContext(ctx).Warn("webhook redelivery failed",
+				"outbox_id", entry.ID, "subscriber", outboxSubscriber(entry), "delivery", entry.DeliveryID, logging.KeyRepository, entry.Payload.Repository, "error", err)
+		}
+	}
+}
+
+// FailedDeliveries returns the notifications waiting in the outbox, oldest first
+func (c *Client) FailedDeliveries() ([]*OutboxEntry, error) {
+	if c.outbox == nil {
+		return []*OutboxEntry{}, nil
+	}
+	return c.outbox.List()
+}
+
+// Redeliver makes one attempt to send an outbox entry to its subscriber. A delivered entry
+// is removed, otherwise its next attempt is postponed with exponential backoff.
+func (c *Client) Redeliver(ctx context.Context, id uint64) error {
+	if c.outbox == nil {
+		return ErrDeliveryNotFound
+	}
+
+	c.outboxMu.Lock()
+	defer c.outboxMu.Unlock()
+
+	entry, err := c.outbox.Get(id)
+	if err != nil {
+		return err
+	}
+
+	var deliverErr error
+	if subscriber, ok := c.config.FindSubscriber(outboxSubscriber(entry)); ok {
+		deliverErr = c.deliver(ctx, subscriber, entry.DeliveryID, entry.Payload)
+	} else {
+		deliverErr = fmt.Errorf("webhook subscriber %s is no longer configured", outboxSubscriber(entry))
+	}
+	if deliverErr == nil {
+		if err := c.outbox.Delete(id); err != nil {
+			return fmt.Errorf("delivered but failed to remove outbox entry: %w", err)
+		}
+		metrics.SetWebhookOutboxSize(c.outbox.Len())
+		return nil
+	}
+
+	entry.Attempts++
+	entry.LastAttemptAt = time.Now()
+	entry.NextAttemptAt = entry.LastAttemptAt.Add(c.backoff(entry.Attempts))
+	entry.LastError = deliverErr.Error()
+	if err := c.outbox.Save(entry); err != nil {
+		return fmt.Errorf("failed to update outbox entry (%v): %w", err, deliverErr)
+	}
+	return deliverErr
+}
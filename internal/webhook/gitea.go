@@ -0,0 +1,52 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ProviderGitea identifies events received from Gitea or Forgejo
+const ProviderGitea = "gitea"
+
+// ValidateGiteaWebhook verifies the X-Gitea-Signature (or X-Forgejo-Signature) header of a
+// Gitea or Forgejo webhook against webhook.gitea.secret and parses the event
+func (c *Client) ValidateGiteaWebhook(r *http.Request) (*RefEvent, error) {
+	body, err := readReceivedBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret := c.config.Gitea.Secret; secret != "" {
+		signature := firstHeader(r, "X-Gitea-Signature", "X-Forgejo-Signature")
+		if signature == "" {
+			return nil, fmt.Errorf("%w: missing X-Gitea-Signature header", ErrInvalidSignature)
+		}
+		if err := verifySignature(body, secret, signature); err != nil {
+			return nil, err
+		}
+	}
+
+	event := &RefEvent{
+		Provider:   ProviderGitea,
+		Event:      firstHeader(r, "X-Gitea-Event", "X-Forgejo-Event", "X-Gogs-Event"),
+		DeliveryID: firstHeader(r, "X-Gitea-Delivery", "X-Forgejo-Delivery", "X-Gogs-Delivery"),
+	}
+	if event.Event == "" {
+		return nil, fmt.Errorf("missing X-Gitea-Event header")
+	}
+
+	if err := event.parseGitHubPayload(body); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// firstHeader returns the first non-empty value of the given headers
+func firstHeader(r *http.Request, names ...string) string {
+	for _, name := range names {
+		if value := r.Header.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"testing"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+func TestValidateGiteaWebhook(t *testing.T) {
+	const (
+		push      = `{"ref": "refs/heads/main", "before": "a1", "after": "b2", "repository": {"full_name": "owner/app"}}`
+		pushTag   = `{"ref": "refs/tags/v1.2.0", "before": "` + zeroCommit + `", "after": "c3"}`
+		deleteTag = `{"ref": "v1.2.0", "ref_type": "tag"}`
+	)
+	event := func(name string, action RefAction, branch, tag, commit string) *RefEvent {
+		return &RefEvent{Provider: ProviderGitea, Event: name, DeliveryID: "d1", Action: action, Branch: branch, Tag: tag, Commit: commit}
+	}
+	runReceiverTests(t, newReceiverClient().ValidateGiteaWebhook, []receiverTest{
+		{
+			name:   "Gitea push",
+			header: map[string]string{"X-Gitea-Event": "push", "X-Gitea-Delivery": "d1", "X-Gitea-Signature": sign(push)},
+			body:   push,
+			want:   event("push", RefPushed, "main", "", "b2"),
+		},
+		{
+			name:   "Forgejo push of a tag",
+			header: map[string]string{"X-Forgejo-Event": "push", "X-Forgejo-Delivery": "d1", "X-Forgejo-Signature": sign(pushTag)},
+			body:   pushTag,
+			want:   event("push", RefCreated, "", "v1.2.0", "c3"),
+		},
+		{
+			name:   "Gogs delete tag",
+			header: map[string]string{"X-Gogs-Event": "delete", "X-Gogs-Delivery": "d1", "X-Gitea-Signature": sign(deleteTag)},
+			body:   deleteTag,
+			want:   event("delete", RefDeleted, "", "v1.2.0", ""),
+		},
+		{
+			name:   "ping",
+			header: map[string]string{"X-Gitea-Event": "ping", "X-Gitea-Delivery": "d1", "X-Gitea-Signature": sign(`{}`)},
+			body:   `{}`,
+			want:   event("ping", RefPing, "", "", ""),
+		},
+		{
+			name:   "invalid signature",
+			header: map[string]string{"X-Gitea-Event": "push", "X-Gitea-Signature": sign(pushTag)},
+			body:   push,
+			err:    ErrInvalidSignature,
+		},
+		{
+			name:   "missing signature",
+			header: map[string]string{"X-Gitea-Event": "push"},
+			body:   push,
+			err:    ErrInvalidSignature,
+			errMsg: "missing X-Gitea-Signature header",
+		},
+		{
+			name:   "missing event",
+			header: map[string]string{"X-Gitea-Signature": sign(push)},
+			body:   push,
+			errMsg: "missing X-Gitea-Event header",
+		},
+	})
+}
+
+func TestValidateGiteaWebhookWithoutSecret(t *testing.T) {
+	client := NewClient(&config.WebhookConfig{GitHub: config.ReceiverConfig{Secret: testSecret}}, nil)
+	const push = `{"ref": "refs/heads/main", "before": "a1", "after": "b2"}`
+	runReceiverTests(t, client.ValidateGiteaWebhook, []receiverTest{{
+		name:   "unsigned push",
+		header: map[string]string{"X-Gitea-Event": "push", "X-Gitea-Delivery": "d1"},
+		body:   push,
+		want:   &RefEvent{Provider: ProviderGitea, Event: "push", DeliveryID: "d1", Action: RefPushed, Branch: "main", Commit: "b2"},
+	}})
+}
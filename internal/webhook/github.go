@@ -0,0 +1,106 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProviderGitHub identifies events received from GitHub
+const ProviderGitHub = "github"
+
+// githubPayload holds the fields of the push, create and delete events the watcher uses.
+// Gitea and Forgejo send the same payloads.
+type githubPayload struct {
+	Ref        string `json:"ref"`
+	RefType    string `json:"ref_type"` // create and delete events
+	Before     string `json:"before"`   // push events
+	After      string `json:"after"`    // push events
+	Created    bool   `json:"created"`
+	Deleted    bool   `json:"deleted"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		CloneURL string `json:"clone_url"`
+		SSHURL   string `json:"ssh_url"`
+		GitURL   string `json:"git_url"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+}
+
+// ValidateGitHubWebhook verifies the X-Hub-Signature-256 header of a GitHub webhook against
+// webhook.github.secret and parses the event. Both the application/json and the
+// application/x-www-form-urlencoded content types are accepted.
+func (c *Client) ValidateGitHubWebhook(r *http.Request) (*RefEvent, error) {
+	body, err := readReceivedBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret := c.config.GitHub.Secret; secret != "" {
+		signature, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+		if !ok {
+			return nil, fmt.Errorf("%w: missing X-Hub-Signature-256 header", ErrInvalidSignature)
+		}
+		if err := verifySignature(body, secret, signature); err != nil {
+			return nil, err
+		}
+	}
+
+	event := &RefEvent{
+		Provider:   ProviderGitHub,
+		Event:      r.Header.Get("X-GitHub-Event"),
+		DeliveryID: r.Header.Get("X-GitHub-Delivery"),
+	}
+	if event.Event == "" {
+		return nil, fmt.Errorf("missing X-GitHub-Event header")
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse form payload: %w", err)
+		}
+		body = []byte(form.Get("payload"))
+	}
+
+	if err := event.parseGitHubPayload(body); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// parseGitHubPayload fills an event whose Event is set from a GitHub style payload
+func (e *RefEvent) parseGitHubPayload(body []byte) error {
+	var payload githubPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	e.Repository = payload.Repository.FullName
+	e.URLs = []string{payload.Repository.CloneURL, payload.Repository.SSHURL, payload.Repository.GitURL, payload.Repository.HTMLURL}
+
+	switch e.Event {
+	case "ping":
+		e.Action = RefPing
+	case "push":
+		e.setRef(payload.Ref)
+		e.Commit = payload.After
+		switch {
+		case payload.Deleted || isZeroCommit(payload.After):
+			e.Action = RefDeleted
+			e.Commit = ""
+		case payload.Created || isZeroCommit(payload.Before):
+			e.Action = RefCreated
+		default:
+			e.Action = RefPushed
+		}
+	case "create":
+		e.setRefType(payload.Ref, payload.RefType)
+		e.Action = RefCreated
+	case "delete":
+		e.setRefType(payload.Ref, payload.RefType)
+		e.Action = RefDeleted
+	}
+	return nil
+}
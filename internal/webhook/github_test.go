@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+// githubHeader returns the headers of a GitHub delivery of an event with a signed body
+func githubHeader(event, body string) map[string]string {
+	return map[string]string{
+		"X-GitHub-Event":      event,
+		"X-GitHub-Delivery":   "d1",
+		"X-Hub-Signature-256": "sha256=" + sign(body),
+	}
+}
+
+func TestValidateGitHubWebhook(t *testing.T) {
+	const (
+		ping         = `{"zen": "Keep it logically awesome.", "hook_id": 1}`
+		push         = `{"ref": "refs/heads/main", "before": "a1", "after": "b2", "repository": {"full_name": "owner/app"}}`
+		pushCreated  = `{"ref": "refs/heads/feature", "before": "` + zeroCommit + `", "after": "b2", "created": true}`
+		pushDeleted  = `{"ref": "refs/heads/feature", "before": "a1", "after": "` + zeroCommit + `", "deleted": true}`
+		pushTag      = `{"ref": "refs/tags/v1.2.0", "before": "` + zeroCommit + `", "after": "c3"}`
+		deleteBranch = `{"ref": "feature", "ref_type": "branch"}`
+		deleteTag    = `{"ref": "v1.2.0", "ref_type": "tag"}`
+		createTag    = `{"ref": "v1.2.0", "ref_type": "tag"}`
+	)
+	event := func(name string, action RefAction, branch, tag, commit string) *RefEvent {
+		return &RefEvent{Provider: ProviderGitHub, Event: name, DeliveryID: "d1", Action: action, Branch: branch, Tag: tag, Commit: commit}
+	}
+	runReceiverTests(t, newReceiverClient().ValidateGitHubWebhook, []receiverTest{
+		{name: "ping", header: githubHeader("ping", ping), body: ping, want: event("ping", RefPing, "", "", "")},
+		{name: "push", header: githubHeader("push", push), body: push, want: event("push", RefPushed, "main", "", "b2")},
+		{name: "push creating a branch", header: githubHeader("push", pushCreated), body: pushCreated, want: event("push", RefCreated, "feature", "", "b2")},
+		{name: "push deleting a branch", header: githubHeader("push", pushDeleted), body: pushDeleted, want: event("push", RefDeleted, "feature", "", "")},
+		{name: "push of a tag", header: githubHeader("push", pushTag), body: pushTag, want: event("push", RefCreated, "", "v1.2.0", "c3")},
+		{name: "create tag", header: githubHeader("create", createTag), body: createTag, want: event("create", RefCreated, "", "v1.2.0", "")},
+		{name: "delete branch", header: githubHeader("delete", deleteBranch), body: deleteBranch, want: event("delete", RefDeleted, "feature", "", "")},
+		{name: "delete tag", header: githubHeader("delete", deleteTag), body: deleteTag, want: event("delete", RefDeleted, "", "v1.2.0", "")},
+		{name: "unhandled event", header: githubHeader("issues", `{}`), body: `{}`, want: event("issues", "", "", "", "")},
+		{
+			name:   "invalid signature",
+			header: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(ping)},
+			body:   push,
+			err:    ErrInvalidSignature,
+		},
+		{
+			name:   "missing signature",
+			header: map[string]string{"X-GitHub-Event": "push"},
+			body:   push,
+			err:    ErrInvalidSignature,
+			errMsg: "missing X-Hub-Signature-256 header",
+		},
+		{
+			name:   "SHA-1 signature",
+			header: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature": "sha1=0123"},
+			body:   push,
+			err:    ErrInvalidSignature,
+		},
+		{
+			name:   "missing event",
+			header: map[string]string{"X-Hub-Signature-256": "sha256=" + sign(push)},
+			body:   push,
+			errMsg: "missing X-GitHub-Event header",
+		},
+		{
+			name:   "invalid payload",
+			header: githubHeader("push", `{`),
+			body:   `{`,
+			errMsg: "failed to unmarshal payload",
+		},
+	})
+}
+
+func TestValidateGitHubWebhookWithoutSecret(t *testing.T) {
+	client := NewClient(&config.WebhookConfig{}, nil)
+	const push = `{"ref": "refs/heads/main", "before": "a1", "after": "b2"}`
+	runReceiverTests(t, client.ValidateGitHubWebhook, []receiverTest{{
+		name:   "unsigned push",
+		header: map[string]string{"X-GitHub-Event": "push"},
+		body:   push,
+		want:   &RefEvent{Provider: ProviderGitHub, Event: "push", Action: RefPushed, Branch: "main", Commit: "b2"},
+	}})
+}
+
+func TestValidateGitHubWebhookForm(t *testing.T) {
+	const push = `{"ref": "refs/heads/main", "before": "a1", "after": "b2",
+		"repository": {"full_name": "owner/app", "clone_url": "https://github.com/owner/app.git", "ssh_url": "git@github.com:owner/app.git"}}`
+	body := url.Values{"payload": {push}}.Encode()
+	header := githubHeader("push", body)
+	header["Content-Type"] = "application/x-www-form-urlencoded"
+
+	var got *RefEvent
+	runReceiverTests(t, func(r *http.Request) (*RefEvent, error) {
+		event, err := newReceiverClient().ValidateGitHubWebhook(r)
+		got = event
+		return event, err
+	}, []receiverTest{{
+		name:   "form payload",
+		header: header,
+		body:   body,
+		want:   &RefEvent{Provider: ProviderGitHub, Event: "push", DeliveryID: "d1", Action: RefPushed, Branch: "main", Commit: "b2"},
+	}})
+	if got == nil {
+		return
+	}
+	if got.Repository != "owner/app" {
+		t.Errorf("Repository = %q", got.Repository)
+	}
+	wantURLs := []string{"https://github.com/owner/app.git", "git@github.com:owner/app.git", "", ""}
+	if !reflect.DeepEqual(got.URLs, wantURLs) {
+		t.Errorf("URLs = %q, want %q", got.URLs, wantURLs)
+	}
+}
@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ProviderGitLab identifies events received from GitLab
+const ProviderGitLab = "gitlab"
+
+// gitlabPayload holds the fields of the GitLab Push Hook and Tag Push Hook events the watcher uses
+type gitlabPayload struct {
+	ObjectKind string `json:"object_kind"`
+	Ref        string `json:"ref"`
+	Before     string `json:"before"`
+	After      string `json:"after"`
+	Project    struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		GitHTTPURL        string `json:"git_http_url"`
+		GitSSHURL         string `json:"git_ssh_url"`
+		WebURL            string `json:"web_url"`
+	} `json:"project"`
+}
+
+// ValidateGitLabWebhook compares the X-Gitlab-Token header of a GitLab webhook with
+// webhook.gitlab.secret and parses the event
+func (c *Client) ValidateGitLabWebhook(r *http.Request) (*RefEvent, error) {
+	body, err := readReceivedBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret := c.config.GitLab.Secret; secret != "" {
+		token := r.Header.Get("X-Gitlab-Token")
+		if token == "" {
+			return nil, fmt.Errorf("%w: missing X-Gitlab-Token header", ErrInvalidSignature)
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			return nil, ErrInvalidSignature
+		}
+	}
+
+	event := &RefEvent{
+		Provider:   ProviderGitLab,
+		Event:      r.Header.Get("X-Gitlab-Event"),
+		DeliveryID: firstHeader(r, "X-Gitlab-Webhook-UUID", "X-Gitlab-Event-UUID"),
+	}
+	if event.Event == "" {
+		return nil, fmt.Errorf("missing X-Gitlab-Event header")
+	}
+
+	var payload gitlabPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	event.Repository = payload.Project.PathWithNamespace
+	event.URLs = []string{payload.Project.GitHTTPURL, payload.Project.GitSSHURL, payload.Project.WebURL}
+
+	// System hooks carry the same payloads, identified by object_kind only
+	switch payload.ObjectKind {
+	case "push", "tag_push":
+		event.setRef(payload.Ref)
+		event.Commit = payload.After
+		switch {
+		case isZeroCommit(payload.After):
+			event.Action = RefDeleted
+			event.Commit = ""
+		case isZeroCommit(payload.Before):
+			event.Action = RefCreated
+		default:
+			event.Action = RefPushed
+		}
+	}
+	return event, nil
+}
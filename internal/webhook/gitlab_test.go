@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// gitlabHeader returns the headers of a GitLab delivery of an event
+func gitlabHeader(event string) map[string]string {
+	return map[string]string{
+		"X-Gitlab-Event":        event,
+		"X-Gitlab-Webhook-UUID": "d1",
+		"X-Gitlab-Token":        testSecret,
+	}
+}
+
+func TestValidateGitLabWebhook(t *testing.T) {
+	const (
+		push = `{"object_kind": "push", "ref": "refs/heads/main", "before": "a1", "after": "b2",
+			"project": {"path_with_namespace": "group/app"}}`
+		pushCreated = `{"object_kind": "push", "ref": "refs/heads/feature", "before": "` + zeroCommit + `", "after": "b2"}`
+		pushDeleted = `{"object_kind": "push", "ref": "refs/heads/feature", "before": "a1", "after": "` + zeroCommit + `"}`
+		tagPush     = `{"object_kind": "tag_push", "ref": "refs/tags/v1.2.0", "before": "` + zeroCommit + `", "after": "c3"}`
+		tagDeleted  = `{"object_kind": "tag_push", "ref": "refs/tags/v1.2.0", "before": "c3", "after": "` + zeroCommit + `"}`
+		mergeEvent  = `{"object_kind": "merge_request"}`
+	)
+	event := func(name string, action RefAction, branch, tag, commit string) *RefEvent {
+		return &RefEvent{Provider: ProviderGitLab, Event: name, DeliveryID: "d1", Action: action, Branch: branch, Tag: tag, Commit: commit}
+	}
+	runReceiverTests(t, newReceiverClient().ValidateGitLabWebhook, []receiverTest{
+		{name: "push", header: gitlabHeader("Push Hook"), body: push, want: event("Push Hook", RefPushed, "main", "", "b2")},
+		{name: "push creating a branch", header: gitlabHeader("Push Hook"), body: pushCreated, want: event("Push Hook", RefCreated, "feature", "", "b2")},
+		{name: "push deleting a branch", header: gitlabHeader("Push Hook"), body: pushDeleted, want: event("Push Hook", RefDeleted, "feature", "", "")},
+		{name: "tag push", header: gitlabHeader("Tag Push Hook"), body: tagPush, want: event("Tag Push Hook", RefCreated, "", "v1.2.0", "c3")},
+		{name: "tag deletion", header: gitlabHeader("Tag Push Hook"), body: tagDeleted, want: event("Tag Push Hook", RefDeleted, "", "v1.2.0", "")},
+		{name: "system hook", header: gitlabHeader("System Hook"), body: push, want: event("System Hook", RefPushed, "main", "", "b2")},
+		{name: "unhandled event", header: gitlabHeader("Merge Request Hook"), body: mergeEvent, want: event("Merge Request Hook", "", "", "", "")},
+		{
+			name:   "invalid token",
+			header: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "wrong"},
+			body:   push,
+			err:    ErrInvalidSignature,
+		},
+		{
+			name:   "missing token",
+			header: map[string]string{"X-Gitlab-Event": "Push Hook"},
+			body:   push,
+			err:    ErrInvalidSignature,
+			errMsg: "missing X-Gitlab-Token header",
+		},
+		{
+			name:   "missing event",
+			header: map[string]string{"X-Gitlab-Token": testSecret},
+			body:   push,
+			errMsg: "missing X-Gitlab-Event header",
+		},
+	})
+}
+
+func TestValidateGitLabWebhookURLs(t *testing.T) {
+	const push = `{"object_kind": "push", "ref": "refs/heads/main", "before": "a1", "after": "b2",
+		"project": {"path_with_namespace": "group/app", "git_http_url": "https://gitlab.com/group/app.git",
+		"git_ssh_url": "git@gitlab.com:group/app.git", "web_url": "https://gitlab.com/group/app"}}`
+	r := httptest.NewRequest(http.MethodPost, "/webhook/gitlab", strings.NewReader(push))
+	for key, value := range gitlabHeader("Push Hook") {
+		r.Header.Set(key, value)
+	}
+	r.Header.Del("X-Gitlab-Webhook-UUID")
+	r.Header.Set("X-Gitlab-Event-UUID", "d2")
+
+	event, err := newReceiverClient().ValidateGitLabWebhook(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Repository != "group/app" || event.DeliveryID != "d2" {
+		t.Errorf("event = %+v", event)
+	}
+	want := []string{"https://gitlab.com/group/app.git", "git@gitlab.com:group/app.git", "https://gitlab.com/group/app"}
+	if !reflect.DeepEqual(event.URLs, want) {
+		t.Errorf("URLs = %q, want %q", event.URLs, want)
+	}
+}
@@ -0,0 +1,152 @@
+package webhook
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrDeliveryNotFound is returned when a failed delivery is not in the outbox
+var ErrDeliveryNotFound = errors.New("delivery not found in outbox")
+
+var outboxBucket = []byte("outbox")
+
+// OutboxEntry is a notification whose delivery failed after all retries, kept until it is delivered
+type OutboxEntry struct {
+	ID            uint64         `json:"id"`
+	DeliveryID    string         `json:"deliveryId"` // Sent as X-Webhook-Delivery so receivers can drop duplicates
+	Subscriber    string         `json:"subscriber"` // Name of the subscriber the delivery is for
+	Payload       WebhookPayload `json:"payload"`
+	Attempts      int            `json:"attempts"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	LastAttemptAt time.Time      `json:"lastAttemptAt"`
+	NextAttemptAt time.Time      `json:"nextAttemptAt"`
+	LastError     string         `json:"lastError"`
+}
+
+// Outbox persists failed notifications in an embedded bbolt database so they survive restarts
+type Outbox struct {
+	db *bolt.DB
+}
+
+// OpenOutbox opens or creates the outbox database at path
+func OpenOutbox(path string) (*Outbox, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox database: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(outboxBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize outbox database: %w", err)
+	}
+
+	return &Outbox{db: db}, nil
+}
+
+// Close closes the database
+func (o *Outbox) Close() error {
+	return o.db.Close()
+}
+
+// Add assigns an ID to a failed delivery and stores it
+func (o *Outbox) Add(entry *OutboxEntry) error {
+	return o.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outboxBucket)
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return fmt.Errorf("failed to allocate outbox id: %w", err)
+		}
+		entry.ID = id
+		return putEntry(bucket, entry)
+	})
+}
+
+// Save stores the current state of an entry added with Add
+func (o *Outbox) Save(entry *OutboxEntry) error {
+	return o.db.Update(func(tx *bolt.Tx) error {
+		return putEntry(tx.Bucket(outboxBucket), entry)
+	})
+}
+
+// Get returns the entry with the given ID
+func (o *Outbox) Get(id uint64) (*OutboxEntry, error) {
+	var entry *OutboxEntry
+	err := o.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(outboxBucket).Get(itob(id))
+		if data == nil {
+			return ErrDeliveryNotFound
+		}
+		entry = &OutboxEntry{}
+		return json.Unmarshal(data, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Delete removes a delivered entry
+func (o *Outbox) Delete(id uint64) error {
+	return o.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(outboxBucket).Delete(itob(id))
+	})
+}
+
+// List returns all entries, oldest first
+func (o *Outbox) List() ([]*OutboxEntry, error) {
+	entries := make([]*OutboxEntry, 0)
+	err := o.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(outboxBucket).ForEach(func(k, v []byte) error {
+			entry := &OutboxEntry{}
+			if err := json.Unmarshal(v, entry); err != nil {
+				return fmt.Errorf("failed to decode outbox entry %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Len returns the number of entries
+func (o *Outbox) Len() int {
+	var n int
+	o.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(outboxBucket).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+// putEntry encodes an entry under its ID
+func putEntry(bucket *bolt.Bucket, entry *OutboxEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox entry: %w", err)
+	}
+	return bucket.Put(itob(entry.ID), data)
+}
+
+// itob encodes an ID as a big endian key so entries sort by ID
+func itob(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxReceivedBody bounds the size of a webhook body read from a hosting service
+const maxReceivedBody = 25 << 20
+
+// ErrInvalidSignature is returned when a received webhook is not signed with the configured secret
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// RefAction is what happened to a reference in an event received from a Git hosting service
+type RefAction string
+
+// Reference actions
+const (
+	RefPushed  RefAction = "push"   // New commits were pushed to an existing reference
+	RefCreated RefAction = "create" // The reference was created
+	RefDeleted RefAction = "delete" // The reference was deleted
+	RefPing    RefAction = "ping"   // The hosting service tests the endpoint
+)
+
+// RefEvent is a reference change received from a Git hosting service, reduced to what the
+// watcher acts on. Events the watcher does not handle have an empty Action.
+type RefEvent struct {
+	Provider   string    `json:"provider"`             // Hosting service, such as "github"
+	Event      string    `json:"event"`                // Event name used by the hosting service
+	DeliveryID string    `json:"deliveryId,omitempty"` // Delivery identifier assigned by the hosting service
+	Action     RefAction `json:"action,omitempty"`
+	Branch     string    `json:"branch,omitempty"` // Set when a branch changed
+	Tag        string    `json:"tag,omitempty"`    // Set when a tag changed
+	Commit     string    `json:"commit,omitempty"` // Commit the reference points to after the change
+	Repository string    `json:"repository"`       // Full name of the repository on the hosting service
+	URLs       []string  `json:"-"`                // Clone and web URLs of the repository
+}
+
+// setRef fills the branch or tag of an event from a full reference name such as "refs/heads/main"
+func (e *RefEvent) setRef(ref string) {
+	if branch, ok := strings.CutPrefix(ref, "refs/heads/"); ok {
+		e.Branch = branch
+	} else if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+		e.Tag = tag
+	}
+}
+
+// setRefType fills the branch or tag of an event from a short reference name and its type
+func (e *RefEvent) setRefType(ref, refType string) {
+	switch refType {
+	case "branch":
+		e.Branch = ref
+	case "tag":
+		e.Tag = ref
+	}
+}
+
+// isZeroCommit reports whether a commit hash is the all-zero hash used for missing references
+func isZeroCommit(hash string) bool {
+	return hash != "" && strings.Trim(hash, "0") == ""
+}
+
+// readReceivedBody reads the body of a webhook received from a hosting service
+func readReceivedBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxReceivedBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	return body, nil
+}
+
+// verifySignature checks a hex encoded HMAC-SHA256 signature of body
+func verifySignature(body []byte, secret, signature string) error {
+	expected := generateSignature(body, []byte(secret))
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
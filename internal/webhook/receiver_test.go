@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+const (
+	testSecret = "s3cret"
+	zeroCommit = "0000000000000000000000000000000000000000"
+)
+
+// receiverTest is a case of a Validate*Webhook method
+type receiverTest struct {
+	name   string
+	header map[string]string
+	body   string
+	want   *RefEvent // URLs and Repository are not compared
+	err    error     // Compared with errors.Is when set
+	errMsg string
+}
+
+// runReceiverTests posts the body of each case with its headers to validate
+func runReceiverTests(t *testing.T, validate func(*http.Request) (*RefEvent, error), tests []receiverTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			for key, value := range tt.header {
+				r.Header.Set(key, value)
+			}
+			event, err := validate(r)
+			if tt.err != nil || tt.errMsg != "" {
+				if tt.err != nil && !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("error = %v, want %q", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			got := *event
+			got.URLs, got.Repository = nil, ""
+			if !reflect.DeepEqual(&got, tt.want) {
+				t.Errorf("event = %+v, want %+v", &got, tt.want)
+			}
+		})
+	}
+}
+
+// sign returns the hex encoded HMAC-SHA256 signature of body with testSecret
+func sign(body string) string {
+	return generateSignature([]byte(body), []byte(testSecret))
+}
+
+func newReceiverClient() *Client {
+	return NewClient(&config.WebhookConfig{
+		GitHub: config.ReceiverConfig{Secret: testSecret},
+		GitLab: config.ReceiverConfig{Secret: testSecret},
+		Gitea:  config.ReceiverConfig{Secret: testSecret},
+	}, nil)
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	signature := sign(string(body))
+	if err := verifySignature(body, testSecret, signature); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	if err := verifySignature(body, testSecret, strings.ToUpper(signature)); err != nil {
+		t.Errorf("upper case signature: %v", err)
+	}
+	if err := verifySignature(body, "other", signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other secret: %v", err)
+	}
+	if err := verifySignature(append(body, ' '), testSecret, signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("changed body: %v", err)
+	}
+}
+
+func TestIsZeroCommit(t *testing.T) {
+	for hash, want := range map[string]bool{
+		zeroCommit: true,
+		"0000000":  true,
+		"":         false,
+		"0000001":  false,
+	} {
+		if got := isZeroCommit(hash); got != want {
+			t.Errorf("isZeroCommit(%q) = %v, want %v", hash, got, want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package webhook
+
+import (
+	"path"
+
+	config "github.com/Jieay/git-watcher/configs"
+)
+
+// matchSubscriber applies a subscriber's filters to a notification. It returns the payload
+// to send, trimmed to the repository updates of the branches the subscriber wants, and
+// false when the subscriber is not interested in the notification at all.
+func matchSubscriber(subscriber *config.Subscriber, payload WebhookPayload) (WebhookPayload, bool) {
+	if !matchAny(subscriber.Events, payload.Event) || !matchAny(subscriber.Repositories, payload.Repository) {
+		return payload, false
+	}
+	if len(subscriber.Branches) == 0 {
+		return payload, true
+	}
+
+	if payload.Branch != "" && !matchAny(subscriber.Branches, payload.Branch) {
+		return payload, false
+	}
+	if len(payload.RepoUpdates) == 0 {
+		return payload, payload.Branch != ""
+	}
+
+	updates := make(map[string]RepoUpdate, len(payload.RepoUpdates))
+	for key, update := range payload.RepoUpdates {
+		if matchAny(subscriber.Branches, update.Branch) {
+			updates[key] = update
+		}
+	}
+	if len(updates) == 0 {
+		return payload, false
+	}
+	payload.RepoUpdates = updates
+	return payload, true
+}
+
+// matchAny reports whether value matches one of the patterns; no patterns match everything
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// outboxSubscriber returns the name of the subscriber an outbox entry is for. Entries queued
+// before subscribers existed were meant for the legacy callbackUrl.
+func outboxSubscriber(entry *OutboxEntry) string {
+	if entry.Subscriber == "" {
+		return config.DefaultSubscriberName
+	}
+	return entry.Subscriber
+}
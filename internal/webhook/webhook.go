@@ -2,6 +2,7 @@ package webhook
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -10,24 +11,56 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	config "github.com/Jieay/git-watcher/configs"
+	"github.com/Jieay/git-watcher/internal/logging"
+	"github.com/Jieay/git-watcher/internal/metrics"
 )
 
 // Client handles webhook operations
 type Client struct {
 	config *config.WebhookConfig
 	client *http.Client
+	outbox *Outbox
+	// outboxMu serializes redeliveries so an entry is not sent twice concurrently
+	outboxMu sync.Mutex
+
+	// Notifications sent by Notify run in the background until Shutdown cancels them
+	background     context.Context
+	stopBackground context.CancelFunc
+	pending        sync.WaitGroup
+
+	mu             sync.Mutex
+	lastDeliveries map[string]*Delivery // Keyed by subscriber name
 }
 
-// NewClient creates a new webhook client
-func NewClient(cfg *config.WebhookConfig) *Client {
+// Delivery is the outcome of sending a webhook notification to a subscriber
+type Delivery struct {
+	ID         string    `json:"id"`
+	Subscriber string    `json:"subscriber"`
+	Event      string    `json:"event"`
+	Repository string    `json:"repository,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+	Success    bool      `json:"success"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// NewClient creates a new webhook client. Notifications that cannot be delivered
+// are kept in outbox; a nil outbox drops them.
+func NewClient(cfg *config.WebhookConfig, outbox *Outbox) *Client {
+	background, stopBackground := context.WithCancel(context.Background())
 	return &Client{
 		config: cfg,
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		outbox:         outbox,
+		background:     background,
+		stopBackground: stopBackground,
+		lastDeliveries: make(map[string]*Delivery),
 	}
 }
 
@@ -35,11 +68,68 @@ func NewClient(cfg *config.WebhookConfig) *Client {
 type WebhookPayload struct {
 	Event       string                `json:"event"`
 	Timestamp   time.Time             `json:"timestamp"`
-	Branch      string                `json:"branch,omitempty"` // Branch that was updated
+	Repository  string                `json:"repository,omitempty"` // Name of the watched repository
+	Branch      string                `json:"branch,omitempty"`     // Branch that was updated
 	RepoUpdates map[string]RepoUpdate `json:"repoUpdates"`
+	Tag         *Tag                  `json:"tag,omitempty"`       // Tag that was created, for tag_created events
+	Conflict    *ArtifactsConflict    `json:"conflict,omitempty"`  // Conflict of an artifacts update, for artifacts_conflict events
+	Promotion   *Promotion            `json:"promotion,omitempty"` // Promotion of an artifact version, for promotion events
+	Rollback    *Rollback             `json:"rollback,omitempty"`  // Restored state, for rollback events
 	Message     string                `json:"message"`
 }
 
+// Tag describes a tag created in a watched repository
+type Tag struct {
+	Name       string `json:"name"`
+	Commit     string `json:"commit"`               // Commit the tag points to
+	Annotation string `json:"annotation,omitempty"` // Message of an annotated tag
+}
+
+// ArtifactsConflict describes a conflict between the feature branch and the target branch of
+// the artifacts repository
+type ArtifactsConflict struct {
+	Package       string   `json:"package"`
+	Version       string   `json:"version"`
+	FeatureBranch string   `json:"featureBranch"`
+	TargetBranch  string   `json:"targetBranch"`
+	Strategy      string   `json:"strategy"`              // Conflict strategy that handled the conflict
+	Files         []string `json:"files,omitempty"`       // Files changed on both branches
+	Resolved      bool     `json:"resolved"`              // Whether the update reached the target branch
+	PullRequest   string   `json:"pullRequest,omitempty"` // URL of the pull request opened for the conflict
+	Error         string   `json:"error,omitempty"`
+}
+
+// Promotion describes a promotion of an artifact version from one environment of the
+// artifacts repository to the next
+type Promotion struct {
+	ID          uint64 `json:"id"`
+	Package     string `json:"package"`
+	Version     string `json:"version"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Status      string `json:"status"` // pending, rejected, promoted or failed
+	RequestedBy string `json:"requestedBy,omitempty"`
+	Comment     string `json:"comment,omitempty"`   // Reason given by the requester
+	DecidedBy   string `json:"decidedBy,omitempty"` // User who approved or rejected the promotion
+	Reason      string `json:"reason,omitempty"`    // Comment of the approval or rejection
+	Commit      string `json:"commit,omitempty"`
+	PullRequest string `json:"pullRequest,omitempty"` // URL of the pull request delivering the promotion
+	Error       string `json:"error,omitempty"`
+}
+
+// Rollback describes an artifact version or submodule pointers restored from an earlier commit
+type Rollback struct {
+	Package     string   `json:"package,omitempty"` // Package whose version was restored, for artifacts_rolled_back events
+	Environment string   `json:"environment,omitempty"`
+	From        string   `json:"from,omitempty"`       // Version replaced by an artifacts rollback
+	To          string   `json:"to"`                   // Restored version, or commit whose submodule pointers were restored
+	Submodules  []string `json:"submodules,omitempty"` // Submodules moved back, for submodules_rolled_back events
+	User        string   `json:"user,omitempty"`       // User who requested the rollback
+	Reason      string   `json:"reason,omitempty"`
+	Commit      string   `json:"commit,omitempty"`
+	PullRequest string   `json:"pullRequest,omitempty"` // URL of the pull request delivering the rollback
+}
+
 // RepoUpdate contains information about a repository update
 type RepoUpdate struct {
 	Repository string    `json:"repository"`
@@ -50,56 +140,101 @@ type RepoUpdate struct {
 
 // WebhookTriggerRequest represents the payload received from an external webhook trigger
 type WebhookTriggerRequest struct {
-	Event     string `json:"event"`
-	Branch    string `json:"branch"`    // Optional branch to check
-	Reference string `json:"reference"` // Git reference (alternative to branch)
-	Ref       string `json:"ref"`       // Git reference (alternative to branch and reference)
+	Event      string `json:"event"`
+	Repository string `json:"repository"` // Optional name of the watched repository to check
+	URL        string `json:"url"`        // Optional remote URL of the pushed repository, a watched repository or a submodule
+	Branch     string `json:"branch"`     // Optional branch to check
+	Tag        string `json:"tag"`        // Tag extracted from reference or ref, checks the tags instead of a branch
+	Reference  string `json:"reference"`  // Git reference (alternative to branch)
+	Ref        string `json:"ref"`        // Git reference (alternative to branch and reference)
+	DryRun     bool   `json:"dryRun"`     // Only plan the changes and return the plan
 }
 
-// SendNotification sends a webhook notification about repository updates
-func (c *Client) SendNotification(payload WebhookPayload) error {
-	if c.config.CallbackURL == "" {
-		return fmt.Errorf("webhook URL is not configured")
-	}
-
+// deliver makes a single attempt to send a notification to a subscriber
+func (c *Client) deliver(ctx context.Context, subscriber *config.Subscriber, deliveryID string, payload WebhookPayload) (err error) {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
 	// 使用配置的请求方法，默认为 POST
-	method := c.config.Method
+	method := subscriber.Method
 	if method == "" {
 		method = "POST"
 	}
 
-	req, err := http.NewRequest(method, c.config.CallbackURL, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, method, subscriber.URL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
+	for name, value := range subscriber.Headers {
+		req.Header.Set(name, value)
+	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Delivery", deliveryID)
 
 	// 只有在配置了 secret 时才添加签名头
-	if c.config.Secret != "" {
-		signature := generateSignature(payloadBytes, []byte(c.config.Secret))
+	if subscriber.Secret != "" {
+		signature := generateSignature(payloadBytes, []byte(subscriber.Secret))
 		req.Header.Set("X-Webhook-Signature", signature)
 	}
 
+	var statusCode int
+	defer func() {
+		metrics.ObserveWebhookDelivery(subscriber.GetName(), payload.Event, err)
+		c.recordDelivery(subscriber.GetName(), deliveryID, payload, statusCode, err)
+	}()
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send webhook: %w", err)
 	}
 	defer resp.Body.Close()
+	statusCode = resp.StatusCode
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		body, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("webhook request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
+	logging.FromContext(ctx).Info("webhook notification sent",
+		"subscriber", subscriber.GetName(), "event", payload.Event, "delivery", deliveryID, "status", resp.StatusCode)
 	return nil
 }
 
+// recordDelivery remembers the outcome of the latest notification sent to a subscriber
+func (c *Client) recordDelivery(subscriber, deliveryID string, payload WebhookPayload, statusCode int, err error) {
+	delivery := &Delivery{
+		ID:         deliveryID,
+		Subscriber: subscriber,
+		Event:      payload.Event,
+		Repository: payload.Repository,
+		Timestamp:  time.Now(),
+		Success:    err == nil,
+		StatusCode: statusCode,
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastDeliveries[subscriber] = delivery
+}
+
+// LastDeliveries returns the outcome of the latest notification sent to each configured
+// subscriber, in configuration order. Subscribers that were never notified are omitted.
+func (c *Client) LastDeliveries() []*Delivery {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deliveries := make([]*Delivery, 0, len(c.lastDeliveries))
+	for _, subscriber := range c.config.AllSubscribers() {
+		if delivery, ok := c.lastDeliveries[subscriber.GetName()]; ok {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries
+}
+
 // ValidateWebhook validates an incoming webhook request
 func (c *Client) ValidateWebhook(r *http.Request) (WebhookTriggerRequest, error) {
 	var payload WebhookTriggerRequest
@@ -135,9 +270,7 @@ func (c *Client) ValidateWebhook(r *http.Request) (WebhookTriggerRequest, error)
 		}
 	}
 
-	// Log original payload fields
-	fmt.Printf("Webhook payload before processing - Event: %s, Branch: %s, Reference: %s, Ref: %s\n",
-		payload.Event, payload.Branch, payload.Reference, payload.Ref)
+	logger := logging.FromContext(r.Context())
 
 	// If reference is provided but branch is not, extract branch from reference
 	if payload.Branch == "" && payload.Reference != "" {
@@ -145,7 +278,7 @@ func (c *Client) ValidateWebhook(r *http.Request) (WebhookTriggerRequest, error)
 		parts := strings.Split(payload.Reference, "/")
 		if len(parts) >= 3 && parts[0] == "refs" && parts[1] == "heads" {
 			payload.Branch = parts[2]
-			fmt.Printf("Extracted branch '%s' from reference '%s'\n", payload.Branch, payload.Reference)
+			logger.Debug("extracted branch from reference", "branch", payload.Branch, "reference", payload.Reference)
 		}
 	}
 
@@ -155,13 +288,20 @@ func (c *Client) ValidateWebhook(r *http.Request) (WebhookTriggerRequest, error)
 		parts := strings.Split(payload.Ref, "/")
 		if len(parts) >= 3 && parts[0] == "refs" && parts[1] == "heads" {
 			payload.Branch = parts[2]
-			fmt.Printf("Extracted branch '%s' from ref '%s'\n", payload.Branch, payload.Ref)
+			logger.Debug("extracted branch from ref", "branch", payload.Branch, "ref", payload.Ref)
 		}
 	}
 
-	// Log final payload fields
-	fmt.Printf("Webhook payload after processing - Event: %s, Branch: %s, Reference: %s, Ref: %s\n",
-		payload.Event, payload.Branch, payload.Reference, payload.Ref)
+	// A tag reference requests a check of the tags instead of a branch
+	if payload.Branch == "" {
+		for _, ref := range []string{payload.Reference, payload.Ref} {
+			if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok && tag != "" {
+				payload.Tag = tag
+				logger.Debug("extracted tag from reference", "tag", tag, "reference", ref)
+				break
+			}
+		}
+	}
 
 	return payload, nil
 }